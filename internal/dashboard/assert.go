@@ -0,0 +1,80 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"aws-relay/internal/store"
+)
+
+// queueExpectation is what a test expects of one queue's stats. Omitted
+// fields are not checked.
+type queueExpectation struct {
+	Sent     *int `json:"sent"`
+	Received *int `json:"received"`
+	Deleted  *int `json:"deleted"`
+	Pending  *int `json:"pending"`
+}
+
+type assertMismatch struct {
+	Queue    string `json:"queue"`
+	Field    string `json:"field"`
+	Expected int    `json:"expected"`
+	Actual   int    `json:"actual"`
+}
+
+// handleAssert checks a POSTed map of queue name to expected counts against
+// the capture, e.g. {"orders": {"sent": 3, "deleted": 3, "pending": 0}}. It
+// responds 200 if every expectation holds and 422 listing the mismatches
+// otherwise, so integration tests need only check the status.
+func (d *Dashboard) handleAssert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var expectations map[string]queueExpectation
+	if err := json.NewDecoder(r.Body).Decode(&expectations); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats := make(map[string]store.QueueStats)
+	for _, qs := range d.store.GetQueueStats() {
+		stats[qs.QueueName] = qs
+	}
+
+	queues := make([]string, 0, len(expectations))
+	for queue := range expectations {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+
+	mismatches := []assertMismatch{}
+	for _, queue := range queues {
+		want, got := expectations[queue], stats[queue]
+		for _, check := range []struct {
+			field    string
+			expected *int
+			actual   int
+		}{
+			{"sent", want.Sent, got.TotalSent},
+			{"received", want.Received, got.TotalReceived},
+			{"deleted", want.Deleted, got.TotalDeleted},
+			{"pending", want.Pending, got.Pending},
+		} {
+			if check.expected != nil && *check.expected != check.actual {
+				mismatches = append(mismatches, assertMismatch{queue, check.field, *check.expected, check.actual})
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "mismatches": mismatches})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"ok": true, "mismatches": mismatches})
+}
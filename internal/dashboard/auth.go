@@ -0,0 +1,48 @@
+package dashboard
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+)
+
+// unauthenticatedPaths are served without credentials: the health probes
+// reveal nothing captured, and container healthchecks can't log in.
+var unauthenticatedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// SetBasicAuth requires HTTP Basic credentials user and pass on every
+// request but the health probes and CORS preflights. An empty user turns
+// authentication off.
+func (d *Dashboard) SetBasicAuth(user, pass string) {
+	if user == "" {
+		d.authUser, d.authPass = nil, nil
+		return
+	}
+	u, p := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(pass))
+	d.authUser, d.authPass = u[:], p[:]
+}
+
+// authorized reports whether r may be served, asking for credentials if
+// not.
+func (d *Dashboard) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if d.authUser == nil || unauthenticatedPaths[r.URL.Path] {
+		return true
+	}
+
+	// Compare digests in constant time, so neither the credentials nor
+	// their lengths can be guessed from the response time
+	user, pass, _ := r.BasicAuth()
+	u, p := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(pass))
+	userOK := subtle.ConstantTimeCompare(u[:], d.authUser)
+	passOK := subtle.ConstantTimeCompare(p[:], d.authPass)
+	if userOK&passOK == 1 {
+		return true
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="aws-relay", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
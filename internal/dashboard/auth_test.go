@@ -0,0 +1,60 @@
+package dashboard
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		user, pass string // configured; empty user disables auth
+		method     string
+		path       string
+		creds      []string // user and pass sent, if any
+		want       int
+	}{
+		{"disabled", "", "", http.MethodGet, "/api/stats", nil, http.StatusOK},
+		{"authorized", "admin", "s3cret", http.MethodGet, "/api/stats", []string{"admin", "s3cret"}, http.StatusOK},
+		{"no credentials", "admin", "s3cret", http.MethodGet, "/api/stats", nil, http.StatusUnauthorized},
+		{"wrong password", "admin", "s3cret", http.MethodGet, "/api/stats", []string{"admin", "guess"}, http.StatusUnauthorized},
+		{"wrong user", "admin", "s3cret", http.MethodGet, "/api/stats", []string{"root", "s3cret"}, http.StatusUnauthorized},
+		{"password prefix", "admin", "s3cret", http.MethodGet, "/api/stats", []string{"admin", "s3cre"}, http.StatusUnauthorized},
+		{"health probe", "admin", "s3cret", http.MethodGet, "/healthz", nil, http.StatusOK},
+		{"CORS preflight", "admin", "s3cret", http.MethodOptions, "/api/stats", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _, _, srv := newTestDashboard(t)
+			d.SetCORSOrigin("http://localhost:3000")
+			d.SetBasicAuth(tt.user, tt.pass)
+
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if tt.creds != nil {
+				req.SetBasicAuth(tt.creds[0], tt.creds[1])
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if challenge := resp.Header.Get("WWW-Authenticate"); (resp.StatusCode == http.StatusUnauthorized) != (challenge != "") {
+				t.Errorf("status %d with WWW-Authenticate %q", resp.StatusCode, challenge)
+			}
+		})
+	}
+}
+
+func TestBasicAuthTurnedOff(t *testing.T) {
+	d, _, _, srv := newTestDashboard(t)
+	d.SetBasicAuth("admin", "s3cret")
+	d.SetBasicAuth("", "")
+
+	resp := getJSON(t, srv, "/api/stats", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d after turning auth off, want 200", resp.StatusCode)
+	}
+}
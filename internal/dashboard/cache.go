@@ -0,0 +1,140 @@
+package dashboard
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultCacheTTL = 500 * time.Millisecond
+
+// maxCacheEntries bounds the cache, so one-off query strings can't grow it
+// without limit.
+const maxCacheEntries = 256
+
+// responseCache briefly caches GET responses of read-only endpoints so that
+// several auto-refreshing tabs polling the same URL share one computation.
+// Entries are only invalidated by expiry or by a mutating request.
+type responseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	now     func() time.Time // replaceable in tests
+}
+
+type cacheEntry struct {
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// SetCacheTTL sets how long read-only API responses are cached. Zero
+// disables caching.
+func (d *Dashboard) SetCacheTTL(ttl time.Duration) {
+	d.cache.mu.Lock()
+	defer d.cache.mu.Unlock()
+
+	d.cache.ttl = ttl
+	d.cache.entries = make(map[string]cacheEntry)
+}
+
+// cached wraps a read-only handler, serving repeated identical GETs from the
+// cache within the TTL and marking responses with X-Cache: HIT or MISS.
+func (d *Dashboard) cached(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := d.cache
+		key := r.URL.Path + "?" + r.URL.RawQuery
+
+		c.mu.Lock()
+		ttl := c.ttl
+		entry, ok := c.entries[key]
+		now := c.now()
+		c.mu.Unlock()
+
+		if r.Method != "GET" || ttl <= 0 {
+			h(w, r)
+			return
+		}
+
+		if ok && now.Before(entry.expires) {
+			w.Header().Set("Content-Type", entry.contentType)
+			w.Header().Set("X-Cache", "HIT")
+			w.Write(entry.body)
+			return
+		}
+
+		rec := &recorder{header: make(http.Header), status: http.StatusOK}
+		h(rec, r)
+
+		for name, values := range rec.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("X-Cache", "MISS")
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+
+		if rec.status == http.StatusOK {
+			c.put(key, cacheEntry{
+				contentType: rec.header.Get("Content-Type"),
+				body:        rec.body.Bytes(),
+				expires:     now.Add(ttl),
+			}, now)
+		}
+	}
+}
+
+func (c *responseCache) put(key string, entry cacheEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		c.evict(now)
+	}
+	c.entries[key] = entry
+}
+
+// evict drops expired entries, or failing that the oldest one, to make room
+// for an insert. Callers must hold the lock.
+func (c *responseCache) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldestKey == "" || e.expires.Before(oldest) {
+			oldestKey, oldest = k, e.expires
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+func (c *responseCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]cacheEntry)
+}
+
+// recorder buffers a handler's response so it can be cached.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header         { return r.header }
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *recorder) WriteHeader(status int)      { r.status = status }
@@ -0,0 +1,86 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testClock is a fake clock for the response cache.
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time          { return c.now }
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestResponseCacheEvictsOldestAtCap(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	c := newResponseCache(time.Minute)
+
+	for i := 0; i < maxCacheEntries; i++ {
+		c.put("/api/history?i="+strconv.Itoa(i), cacheEntry{expires: clock.Now().Add(time.Minute)}, clock.Now())
+		clock.Advance(time.Millisecond)
+	}
+	if len(c.entries) != maxCacheEntries {
+		t.Fatalf("entries = %d, want %d", len(c.entries), maxCacheEntries)
+	}
+
+	// Refreshing a cached key at the cap evicts nothing
+	c.put("/api/history?i=5", cacheEntry{expires: clock.Now().Add(time.Minute)}, clock.Now())
+	if _, ok := c.entries["/api/history?i=0"]; !ok {
+		t.Fatal("refreshing an existing key evicted another")
+	}
+
+	// Nothing has expired, so a new key evicts the oldest
+	c.put("/api/history?new", cacheEntry{expires: clock.Now().Add(time.Minute)}, clock.Now())
+	if len(c.entries) != maxCacheEntries {
+		t.Errorf("entries = %d after insert at cap, want %d", len(c.entries), maxCacheEntries)
+	}
+	if _, ok := c.entries["/api/history?i=0"]; ok {
+		t.Error("oldest entry kept at cap")
+	}
+	if _, ok := c.entries["/api/history?i=1"]; !ok {
+		t.Error("second oldest entry evicted")
+	}
+
+	// Once entries have expired, they go first
+	clock.Advance(2 * time.Minute)
+	c.put("/api/history?later", cacheEntry{expires: clock.Now().Add(time.Minute)}, clock.Now())
+	if len(c.entries) != 1 {
+		t.Errorf("entries = %d after expiry, want only the new one", len(c.entries))
+	}
+}
+
+func TestCachedExpiresOnClock(t *testing.T) {
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	d, _, _, _ := newTestDashboard(t)
+	d.SetCacheTTL(time.Second)
+	d.cache.now = clock.Now
+
+	calls := 0
+	h := d.cached(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, calls)
+	})
+	get := func() string {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+		return rec.Header().Get("X-Cache")
+	}
+
+	if got := get(); got != "MISS" {
+		t.Errorf("first GET X-Cache = %q, want MISS", got)
+	}
+	clock.Advance(999 * time.Millisecond)
+	if got := get(); got != "HIT" {
+		t.Errorf("GET within the TTL X-Cache = %q, want HIT", got)
+	}
+	clock.Advance(time.Millisecond)
+	if got := get(); got != "MISS" {
+		t.Errorf("GET after the TTL X-Cache = %q, want MISS", got)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,79 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultCORSOrigin lets any origin call the API, which suits a relay only
+// reachable locally.
+const DefaultCORSOrigin = "*"
+
+// CORSDisabled as the CORS origin sends no CORS headers, so browsers only
+// allow same-origin calls.
+const CORSDisabled = "none"
+
+// routeMethods lists the methods each route accepts, for CORS preflights,
+// keyed by mux pattern. Routes not listed only serve GET.
+var routeMethods = map[string]string{
+	"/api/message":   "GET, PATCH, DELETE",
+	"/api/message/":  "GET, PATCH, DELETE",
+	"/api/messages/": "GET, PATCH, DELETE",
+	"/api/clear":     "POST, DELETE",
+	"/api/marker":    "POST",
+	"/api/import":    "POST",
+	"/api/session":   "GET, POST, DELETE",
+	"/api/drain":     "POST",
+	"/api/replay":    "POST",
+	"/api/tag/bulk":  "POST",
+	"/graphql":       "GET, POST",
+	"/api/latency":   "GET, POST, DELETE",
+	"/api/assert":    "POST",
+}
+
+// SetCORSOrigin sets the origin allowed to call the API from a browser:
+// "*" for any, a single origin such as "http://localhost:3000", or
+// CORSDisabled for none.
+func (d *Dashboard) SetCORSOrigin(origin string) {
+	d.corsOrigin = origin
+}
+
+// setCORSHeaders adds the CORS headers for r and reports whether r was a
+// preflight, which needs no further handling.
+func (d *Dashboard) setCORSHeaders(w http.ResponseWriter, r *http.Request) bool {
+	if d.corsOrigin == CORSDisabled {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", d.corsOrigin)
+	if d.corsOrigin != "*" {
+		w.Header().Add("Vary", "Origin")
+	}
+	if r.Method != "OPTIONS" {
+		return false
+	}
+
+	_, pattern := d.mux.Handler(r)
+	methods, ok := routeMethods[pattern]
+	if !ok {
+		methods = "GET"
+	}
+	w.Header().Set("Access-Control-Allow-Methods", methods+", OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.WriteHeader(http.StatusOK)
+	return true
+}
+
+// originAllowed reports whether a browser page at r's Origin may open a
+// WebSocket, which CORS doesn't cover: the page's own origin, the CORS origin
+// and, if that is "*", any. Requests without an Origin don't come from a
+// browser page and are allowed.
+func (d *Dashboard) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || d.corsOrigin == "*" || origin == d.corsOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
@@ -2,44 +2,108 @@ package dashboard
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"aws-relay/internal/jsondiff"
+	"aws-relay/internal/proxy"
 	"aws-relay/internal/store"
 )
 
 type Dashboard struct {
 	store *store.Store
+	proxy *proxy.Proxy
 	mux   *http.ServeMux
+	cache *responseCache
+
+	corsOrigin string
+
+	// SHA-256 digests of the Basic auth credentials, nil if auth is off
+	authUser, authPass []byte
 }
 
-func New(s *store.Store) *Dashboard {
+func New(s *store.Store, p *proxy.Proxy) *Dashboard {
 	d := &Dashboard{
 		store: s,
+		proxy: p,
 		mux:   http.NewServeMux(),
+		cache: newResponseCache(defaultCacheTTL),
+
+		corsOrigin: DefaultCORSOrigin,
 	}
 
 	d.mux.HandleFunc("/", d.handleIndex)
-	d.mux.HandleFunc("/api/stats", d.handleStats)
-	d.mux.HandleFunc("/api/messages", d.handleMessages)
-	d.mux.HandleFunc("/api/history", d.handleHistory)
+	d.mux.HandleFunc("/api/stats", d.cached(d.handleStats))
+	d.mux.HandleFunc("/api/topics", d.cached(d.handleTopics))
+	d.mux.HandleFunc("/api/messages", d.cached(d.handleMessages))
+	d.mux.HandleFunc("/api/message", d.handleMessage)
+	d.mux.HandleFunc("/api/message/", d.handleMessage)
+	d.mux.HandleFunc("/api/messages/", d.handleMessage)
+	d.mux.HandleFunc("/api/history", d.cached(d.handleHistory))
+	d.mux.HandleFunc("/api/timeline", d.cached(d.handleTimeline))
+	d.mux.HandleFunc("/api/search", d.cached(d.handleSearch))
+	d.mux.HandleFunc("/api/stream", d.handleStream)
+	d.mux.HandleFunc("/ws", d.handleWebSocket)
 	d.mux.HandleFunc("/api/clear", d.handleClear)
+	d.mux.HandleFunc("/api/marker", d.handleMarker)
+	d.mux.HandleFunc("/api/dlq-graph", d.cached(d.handleDLQGraph))
+	d.mux.HandleFunc("/api/topology", d.cached(d.handleTopology))
+	d.mux.HandleFunc("/api/dlq", d.cached(d.handleDLQArrivals))
+	d.mux.HandleFunc("/api/queue-attributes", d.cached(d.handleQueueAttributes))
+	d.mux.HandleFunc("/api/move-tasks", d.cached(d.handleMoveTasks))
+	d.mux.HandleFunc("/api/depth", d.cached(d.handleDepth))
+	d.mux.HandleFunc("/api/clock-skew", d.cached(d.handleClockSkew))
+	d.mux.HandleFunc("/api/har", d.handleHAR)
+	d.mux.HandleFunc("/api/export", d.handleExport)
+	d.mux.HandleFunc("/api/import", d.handleImport)
+	d.mux.HandleFunc("/api/attributes.csv", d.handleAttributesCSV)
+	d.mux.HandleFunc("/api/anomalies", d.cached(d.handleAnomalies))
+	d.mux.HandleFunc("/api/sparkline", d.cached(d.handleSparkline))
+	d.mux.HandleFunc("/api/sizes", d.cached(d.handleSizes))
+	d.mux.HandleFunc("/api/session", d.handleSession)
+	d.mux.HandleFunc("/api/sessions", d.cached(d.handleSessions))
+	d.mux.HandleFunc("/api/subscribers", d.handleSubscribers)
+	d.mux.HandleFunc("/api/stuck", d.cached(d.handleStuck))
+	d.mux.HandleFunc("/api/ordering-violations", d.cached(d.handleOrderingViolations))
+	d.mux.HandleFunc("/api/drain", d.handleDrain)
+	d.mux.HandleFunc("/api/replay", d.handleReplay)
+	d.mux.HandleFunc("/api/at", d.cached(d.handleAt))
+	d.mux.HandleFunc("/api/tag/bulk", d.handleBulkTag)
+	d.mux.HandleFunc("/graphql", d.handleGraphQL)
+	d.mux.HandleFunc("/api/capture-scope", d.handleCaptureScope)
+	d.mux.HandleFunc("/api/latency", d.handleLatency)
+	d.mux.HandleFunc("/api/assert", d.handleAssert)
+	d.mux.HandleFunc("/metrics", d.handleMetrics)
+	d.mux.HandleFunc("/healthz", d.handleHealthz)
+	d.mux.HandleFunc("/readyz", d.handleReadyz)
 
 	return d
 }
 
 func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// CORS headers for local development
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	if d.setCORSHeaders(w, r) {
+		return
+	}
+	if !d.authorized(w, r) {
 		return
 	}
 
 	d.mux.ServeHTTP(w, r)
+
+	// Anything that may have changed state invalidates cached reads;
+	// GraphQL and assertions are read-only even when POSTed
+	if r.Method != "GET" && r.Method != "HEAD" && r.Method != "OPTIONS" && !readOnlyPOST[r.URL.Path] {
+		d.cache.invalidate()
+	}
+}
+
+// readOnlyPOST lists endpoints that take POST bodies without changing state.
+var readOnlyPOST = map[string]bool{
+	"/graphql":    true,
+	"/api/assert": true,
 }
 
 func (d *Dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
@@ -68,21 +132,167 @@ func (d *Dashboard) handleMessages(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, messages)
 }
 
+// messageDetail is a stored message with its send/receive/delete timeline
+// plus, when it was re-sent under the same correlation ID, a diff against
+// the previous send.
+type messageDetail struct {
+	*store.Message
+	Events            []*store.Message  `json:"events"`
+	PreviousMessageID string            `json:"previousMessageId,omitempty"`
+	PrevDiff          []jsondiff.Change `json:"prevDiff,omitempty"`
+}
+
+// handleMessage serves /api/message?id=<messageId>, /api/message/<messageId>
+// and /api/messages/<messageId>. PATCH with {"note": "..."} appends a note to
+// the message, or replaces its notes if "replace" is true. DELETE removes the
+// message from the relay, not the upstream.
+func (d *Dashboard) handleMessage(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		id = r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+	case "PATCH":
+		var req struct {
+			Note    string `json:"note"`
+			Replace bool   `json:"replace"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if req.Note == "" && !req.Replace {
+			http.Error(w, "Missing note", http.StatusBadRequest)
+			return
+		}
+		if _, ok := d.store.AnnotateMessage(id, req.Note, req.Replace); !ok {
+			http.NotFound(w, r)
+			return
+		}
+	case "DELETE":
+		if !d.store.DeleteMessage(id) {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]string{"status": "removed"})
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg, ok := d.store.GetMessage(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	detail := messageDetail{Message: msg, Events: d.store.GetMessageEvents(id)}
+	if prev, ok := d.store.PreviousSend(id); ok {
+		detail.PreviousMessageID = prev.MessageID
+		detail.PrevDiff = jsondiff.Strings(prev.ComparableBody(), msg.ComparableBody())
+	}
+	writeJSON(w, detail)
+}
+
+// handleTimeline serves the lifecycle of the message named by the id
+// parameter: its send, receives and delete with the durations between them.
+func (d *Dashboard) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id", http.StatusBadRequest)
+		return
+	}
+	timeline, ok := d.store.Timeline(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, timeline)
+}
+
+// handleHistory serves a page of history, newest first. The queue, action,
+// session, upstream and topic parameters and the RFC 3339 since and until
+// times filter it; offset and limit page through the matches.
 func (d *Dashboard) handleHistory(w http.ResponseWriter, r *http.Request) {
-	limit := 100
-	if l := r.URL.Query().Get("limit"); l != "" {
+	query := r.URL.Query()
+	q := store.HistoryQuery{
+		MessageFilter: store.MessageFilter{
+			QueueName: query.Get("queue"),
+			Action:    store.MessageAction(query.Get("action")),
+			Session:   query.Get("session"),
+			Upstream:  query.Get("upstream"),
+			Topic:     query.Get("topic"),
+			Service:   query.Get("service"),
+		},
+		Limit: 100,
+	}
+	if l := query.Get("limit"); l != "" {
 		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
+			q.Limit = parsed
+		}
+	}
+	if o := query.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			q.Offset = parsed
+		}
+	}
+	for _, bound := range []struct {
+		param string
+		t     *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		v := query.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid "+bound.param+" time (RFC 3339)", http.StatusBadRequest)
+			return
 		}
+		*bound.t = parsed
 	}
 
-	history := d.store.GetHistory(limit)
+	history := d.store.QueryHistory(q)
 	if history == nil {
 		history = []*store.Message{}
 	}
 	writeJSON(w, history)
 }
 
+// handleSearch finds stored messages whose body or an attribute value
+// contains q, or matches it as a regular expression with regex=true.
+func (d *Dashboard) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+
+	opts := store.SearchOptions{
+		Regex:     r.URL.Query().Get("regex") == "true",
+		QueueName: r.URL.Query().Get("queue"),
+		Limit:     100,
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			opts.Limit = parsed
+		}
+	}
+
+	results, err := d.store.Search(query, opts)
+	if err != nil {
+		http.Error(w, "Invalid regex: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if results == nil {
+		results = []store.SearchResult{}
+	}
+	writeJSON(w, results)
+}
+
 func (d *Dashboard) handleClear(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" && r.Method != "DELETE" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -93,6 +303,313 @@ func (d *Dashboard) handleClear(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]string{"status": "cleared"})
 }
 
+// handleMarker adds a timeline marker to history. The label is taken from
+// the label query parameter or a JSON body of the form {"label": "..."}.
+func (d *Dashboard) handleMarker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		var req struct {
+			Label string `json:"label"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		label = req.Label
+	}
+	if label == "" {
+		http.Error(w, "Missing marker label", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, d.store.AddMarker(label))
+}
+
+func (d *Dashboard) handleStuck(w http.ResponseWriter, r *http.Request) {
+	olderThan := 5 * time.Minute
+	if o := r.URL.Query().Get("olderThan"); o != "" {
+		parsed, err := time.ParseDuration(o)
+		if err != nil {
+			http.Error(w, "Invalid olderThan duration", http.StatusBadRequest)
+			return
+		}
+		olderThan = parsed
+	}
+
+	stuck := d.store.GetStuck(r.URL.Query().Get("queue"), olderThan)
+	if stuck == nil {
+		stuck = []*store.Message{}
+	}
+	writeJSON(w, stuck)
+}
+
+func (d *Dashboard) handleOrderingViolations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetOrderingViolations())
+}
+
+// handleDrain deletes all captured-but-undeleted messages of a queue from
+// the upstream, to clean up after debugging.
+func (d *Dashboard) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queueName := r.URL.Query().Get("queue")
+	if queueName == "" {
+		http.Error(w, "Missing queue parameter", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, d.proxy.Drain(queueName))
+}
+
+// handleReplay re-sends a captured message to its queue. The message ID is
+// taken from the id query parameter or a JSON body of the form {"id": "..."}.
+func (d *Dashboard) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		var req struct {
+			ID string `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		id = req.ID
+	}
+	if id == "" {
+		http.Error(w, "Missing message id", http.StatusBadRequest)
+		return
+	}
+
+	result, err := d.proxy.Replay(id)
+	switch {
+	case errors.Is(err, proxy.ErrReplayUnknownMessage):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, proxy.ErrReplayNoBody), errors.Is(err, proxy.ErrReplayNoQueueURL):
+		http.Error(w, "Cannot replay: "+err.Error(), http.StatusUnprocessableEntity)
+	case err != nil:
+		http.Error(w, "Replay failed: "+err.Error(), http.StatusBadGateway)
+	default:
+		writeJSON(w, result)
+	}
+}
+
+// bulkTagRequest is the body of POST /api/tag/bulk. Omitted filter fields
+// match anything.
+type bulkTagRequest struct {
+	Tag    string    `json:"tag"`
+	Queue  string    `json:"queue"`
+	Action string    `json:"action"`
+	Body   string    `json:"body"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+}
+
+// handleBulkTag tags every stored message matching a filter.
+func (d *Dashboard) handleBulkTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req bulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Tag == "" {
+		http.Error(w, "Missing tag", http.StatusBadRequest)
+		return
+	}
+
+	tagged := d.store.TagMessages(store.MessageFilter{
+		QueueName:    req.Queue,
+		Action:       store.MessageAction(req.Action),
+		BodyContains: req.Body,
+		Since:        req.Since,
+		Until:        req.Until,
+	}, req.Tag)
+	writeJSON(w, map[string]int{"tagged": tagged})
+}
+
+// handleAt serves /api/at?time=<rfc3339>&window=5s, returning the events
+// within window either side of time.
+func (d *Dashboard) handleAt(w http.ResponseWriter, r *http.Request) {
+	at, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("time"))
+	if err != nil {
+		http.Error(w, "Invalid or missing time (RFC 3339)", http.StatusBadRequest)
+		return
+	}
+
+	window := 5 * time.Second
+	if v := r.URL.Query().Get("window"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "Invalid window duration", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	writeJSON(w, d.store.EventsAt(at, window))
+}
+
+func (d *Dashboard) handleSession(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if name := r.URL.Query().Get("name"); name != "" {
+			d.store.StartSession(name)
+		} else {
+			d.store.EndSession()
+		}
+	case "DELETE":
+		d.store.EndSession()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, map[string]string{"session": d.store.ActiveSession()})
+}
+
+func (d *Dashboard) handleCaptureScope(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]proxy.CaptureScope{"scope": d.proxy.CaptureScope()})
+}
+
+// handleLatency serves the proxy's latency rules. POST replaces them with
+// the JSON array in the body, and DELETE removes them all.
+func (d *Dashboard) handleLatency(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var rules []proxy.LatencyRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "Invalid latency rules: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.proxy.SetLatency(rules)
+	case "DELETE":
+		d.proxy.SetLatency(nil)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rules := d.proxy.Latency()
+	if rules == nil {
+		rules = []proxy.LatencyRule{}
+	}
+	writeJSON(w, rules)
+}
+
+func (d *Dashboard) handleSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetSessions())
+}
+
+func (d *Dashboard) handleSubscribers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetSubscriberStats())
+}
+
+// handleDLQGraph serves the redrive graph, or with ?dlq= just the source
+// queues known to redrive into that dead-letter queue.
+func (d *Dashboard) handleDLQGraph(w http.ResponseWriter, r *http.Request) {
+	dlq := r.URL.Query().Get("dlq")
+	if dlq == "" {
+		writeJSON(w, d.store.GetDLQGraph())
+		return
+	}
+
+	sources := d.store.GetDeadLetterSources(dlq)
+	if sources == nil {
+		sources = []string{}
+	}
+	writeJSON(w, map[string]interface{}{
+		"deadLetterQueue": dlq,
+		"sources":         sources,
+	})
+}
+
+func (d *Dashboard) handleTopology(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetTopology())
+}
+
+// handleDLQArrivals serves the messages seen arriving in a dead-letter queue
+// and the originals they were linked to.
+func (d *Dashboard) handleDLQArrivals(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetDLQArrivals())
+}
+
+// handleQueueAttributes serves the latest observed attributes of the queue
+// named by the queue parameter.
+func (d *Dashboard) handleQueueAttributes(w http.ResponseWriter, r *http.Request) {
+	queueName := r.URL.Query().Get("queue")
+	attrs, ok := d.store.GetQueueAttributes(queueName)
+	if !ok {
+		http.Error(w, "No attributes observed for queue "+queueName, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, attrs)
+}
+
+func (d *Dashboard) handleMoveTasks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetMoveTasks())
+}
+
+// handleTopics serves the publish totals of each SNS topic.
+func (d *Dashboard) handleTopics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetTopicStats())
+}
+
+// handleClockSkew serves the estimated clock skew of each upstream.
+func (d *Dashboard) handleClockSkew(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetClockSkew())
+}
+
+// handleDepth serves the estimated visible and in-flight message counts of
+// each queue.
+func (d *Dashboard) handleDepth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetQueueDepths())
+}
+
+func (d *Dashboard) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetAnomalies())
+}
+
+func (d *Dashboard) handleSparkline(w http.ResponseWriter, r *http.Request) {
+	minutes := 10
+	if m := r.URL.Query().Get("minutes"); m != "" {
+		if parsed, err := strconv.Atoi(m); err == nil && parsed > 0 {
+			minutes = parsed
+		}
+	}
+
+	buckets := 60
+	if b := r.URL.Query().Get("buckets"); b != "" {
+		if parsed, err := strconv.Atoi(b); err == nil && parsed > 0 && parsed <= 1000 {
+			buckets = parsed
+		}
+	}
+
+	queueName := r.URL.Query().Get("queue")
+	window := time.Duration(minutes) * time.Minute
+	if r.URL.Query().Get("metric") == "body_size" {
+		writeJSON(w, d.store.BodySizeTrend(queueName, window, buckets))
+		return
+	}
+	writeJSON(w, d.store.Sparkline(queueName, window, buckets))
+}
+
+func (d *Dashboard) handleSizes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.store.GetSizeStats())
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
@@ -134,7 +651,7 @@ const indexHTML = `<!DOCTYPE html>
         }
         .stat-numbers {
             display: grid;
-            grid-template-columns: repeat(4, 1fr);
+            grid-template-columns: repeat(5, 1fr);
             gap: 10px;
             text-align: center;
         }
@@ -144,6 +661,11 @@ const indexHTML = `<!DOCTYPE html>
         .received span { color: #60a5fa; }
         .deleted span { color: #f87171; }
         .pending span { color: #fbbf24; }
+        .in-flight span { color: #c084fc; }
+        .upstream-counts { margin-top: 10px; font-size: 0.8em; color: #888; }
+        .upstream-counts.discrepancy { color: #fbbf24; }
+        .size-bar { margin-top: 6px; height: 4px; background: #333; border-radius: 2px; overflow: hidden; }
+        .size-bar div { height: 100%; background: #f44336; }
         .controls {
             margin-bottom: 20px;
             display: flex;
@@ -176,6 +698,12 @@ const indexHTML = `<!DOCTYPE html>
             cursor: pointer;
         }
         .history-item:hover { background: #1a1a2e; }
+        .history-marker {
+            padding: 6px 15px;
+            border-top: 2px dashed #c084fc;
+            color: #c084fc;
+            font-size: 0.85em;
+        }
         .history-item:last-child { border-bottom: none; }
         .history-header {
             display: flex;
@@ -192,9 +720,28 @@ const indexHTML = `<!DOCTYPE html>
         .action-send { background: #4ade80; color: #000; }
         .action-receive { background: #60a5fa; color: #000; }
         .action-delete { background: #f87171; color: #000; }
+        .action-control { background: #c084fc; color: #000; }
+        .action-change_visibility { background: #fbbf24; color: #000; }
+        .action-purge { background: #f87171; color: #000; }
+        .action-publish { background: #38bdf8; color: #000; }
+        .action-fault { background: #ef4444; color: #fff; }
+        .action-removed { background: #6b7280; color: #fff; }
+        .action-generic { background: #475569; color: #fff; }
         .queue-name { color: #888; font-size: 0.85em; }
         .timestamp { color: #666; font-size: 0.8em; }
+        .receive-count { color: #888; font-size: 0.8em; }
+        .timeline-list { list-style: none; margin: 10px 0 0 8px; padding-left: 14px; border-left: 2px solid #444; font-size: 0.8em; }
+        .timeline-list li { position: relative; padding: 3px 0; }
+        .timeline-list li::before { content: ''; position: absolute; left: -20px; top: 8px; width: 10px; height: 10px; border-radius: 50%; background: #888; }
+        .timeline-list li.tl-send::before { background: #4ade80; }
+        .timeline-list li.tl-receive::before { background: #60a5fa; }
+        .timeline-list li.tl-delete::before { background: #f87171; }
+        .timeline-summary { color: #aaa; font-size: 0.8em; margin-top: 8px; }
+        .item-button { background: none; border: 1px solid #444; color: #aaa; border-radius: 4px; font-size: 0.75em; padding: 1px 6px; cursor: pointer; }
+        .receive-count.redelivered { color: #f44336; font-weight: bold; }
         .message-id { color: #888; font-size: 0.8em; font-family: monospace; }
+        .dlq-badge { background: #7f1d1d; color: #fca5a5; border-radius: 4px; font-size: 0.75em; padding: 1px 6px; }
+        .group-header { color: #aaa; font-size: 0.85em; font-weight: bold; padding: 8px 4px 4px; border-bottom: 1px solid #333; }
         .message-body {
             margin-top: 8px;
             padding: 10px;
@@ -214,6 +761,21 @@ const indexHTML = `<!DOCTYPE html>
             text-align: center;
             color: #666;
         }
+        .anomaly-list {
+            background: #16213e;
+            border-radius: 8px;
+            border-left: 4px solid #fbbf24;
+            max-height: 200px;
+            overflow-y: auto;
+        }
+        .anomaly-item {
+            padding: 8px 15px;
+            border-bottom: 1px solid #1a1a2e;
+            font-size: 0.85em;
+            display: flex;
+            gap: 10px;
+        }
+        .anomaly-kind { color: #fbbf24; font-weight: bold; }
         .refresh-indicator {
             color: #666;
             font-size: 0.8em;
@@ -221,20 +783,40 @@ const indexHTML = `<!DOCTYPE html>
     </style>
 </head>
 <body>
-    <h1>AWS Relay Dashboard</h1>
+    <h1>AWS Relay Dashboard <span class="refresh-indicator" id="captureScope"></span></h1>
 
     <h2>Queue Statistics</h2>
     <div id="stats" class="stats-grid">
         <div class="no-data">Loading...</div>
     </div>
 
+    <div id="topicsSection" style="display: none">
+        <h2>SNS Topics</h2>
+        <div id="topics" class="stats-grid"></div>
+    </div>
+
+    <div id="anomaliesSection" style="display: none">
+        <h2>Anomalies</h2>
+        <div id="anomalies" class="anomaly-list"></div>
+    </div>
+
     <h2>Message History</h2>
     <div class="controls">
         <button onclick="refreshData()">Refresh</button>
         <button onclick="clearData()">Clear All</button>
+        <button onclick="addMarker()">Add Marker</button>
+        <button onclick="exportCapture('json')">Export JSON</button>
+        <button onclick="exportCapture('csv')">Export CSV</button>
+        <button onclick="document.getElementById('importFile').click()">Import</button>
+        <input type="file" id="importFile" accept=".json,application/json" style="display: none" onchange="importCapture(this)">
         <select id="queueFilter" onchange="refreshData()">
             <option value="">All Queues</option>
         </select>
+        <select id="trafficFilter" onchange="refreshData()">
+            <option value="">All traffic</option>
+            <option value="sqs">SQS only</option>
+            <option value="generic">Other services</option>
+        </select>
         <label>
             <input type="checkbox" id="showDeleted" onchange="refreshData()"> Show deleted
         </label>
@@ -243,12 +825,25 @@ const indexHTML = `<!DOCTYPE html>
         </label>
         <span class="refresh-indicator" id="refreshIndicator"></span>
     </div>
+    <div class="controls">
+        <input type="text" id="latencyRules" size="60"
+            placeholder='[{"action":"ReceiveMessage","min":"1s","max":"3s"}]'>
+        <button onclick="setLatency()">Set latency</button>
+        <button onclick="clearLatency()">No latency</button>
+        <span class="refresh-indicator" id="latencyStatus"></span>
+    </div>
     <div id="history" class="history-list">
         <div class="no-data">No messages yet</div>
     </div>
 
     <script>
         let autoRefreshInterval = null;
+        let eventSource = null;
+        let streamRefresh = null;
+        let historyItems = [];
+        // openTimelines holds the rendered timeline of each history item
+        // showing one, so refreshes keep them open.
+        const openTimelines = {};
         let knownQueues = new Set();
 
         async function fetchJSON(url) {
@@ -257,14 +852,16 @@ const indexHTML = `<!DOCTYPE html>
         }
 
         async function refreshData() {
-            await Promise.all([refreshStats(), refreshHistory()]);
+            await Promise.all([refreshStats(), refreshTopics(), refreshHistory(), refreshAnomalies()]);
             document.getElementById('refreshIndicator').textContent =
                 'Last updated: ' + new Date().toLocaleTimeString();
         }
 
         async function refreshStats() {
-            const stats = await fetchJSON('/api/stats');
+            const [stats, sizes] = await Promise.all([fetchJSON('/api/stats'), fetchJSON('/api/sizes')]);
             const container = document.getElementById('stats');
+            const sizeOf = {};
+            (sizes || []).forEach(z => sizeOf[z.queueName] = z);
 
             if (!stats || stats.length === 0) {
                 container.innerHTML = '<div class="no-data">No queue activity yet</div>';
@@ -284,13 +881,68 @@ const indexHTML = `<!DOCTYPE html>
             });
 
             container.innerHTML = stats.map(s => ` + "`" + `
-                <div class="stat-card">
+                <div class="stat-card" style="border-left: 4px solid ${s.color}">
                     <h3>${s.queueName}</h3>
                     <div class="stat-numbers">
                         <div class="sent"><span>${s.totalSent}</span>Sent</div>
                         <div class="received"><span>${s.totalReceived}</span>Received</div>
                         <div class="deleted"><span>${s.totalDeleted}</span>Deleted</div>
                         <div class="pending"><span>${s.pending}</span>Pending</div>
+                        <div class="in-flight"><span>${s.inFlight}</span>In Flight</div>
+                    </div>
+                    ${s.upstreamApproximate !== undefined ? ` + "`" + `
+                        <div class="upstream-counts ${s.discrepancy ? 'discrepancy' : ''}">
+                            Upstream: ${s.upstreamApproximate} visible, ${s.upstreamNotVisible} in flight, ${s.upstreamDelayed} delayed
+                            ${s.discrepancy ? ' &ndash; differs from relay pending' : ''}
+                        </div>
+                    ` + "`" + ` : ''}
+                    ${s.visibilityTimeout !== undefined || s.deadLetterQueue ? ` + "`" + `
+                        <div class="upstream-counts" title="${s.attributesObservedAt ? 'Attributes observed at ' + new Date(s.attributesObservedAt).toLocaleTimeString() : ''}">
+                            ${s.visibilityTimeout !== undefined ? ` + "`" + `Visibility timeout: ${s.visibilityTimeout}s` + "`" + ` : ''}
+                            ${s.visibilityTimeout !== undefined && s.deadLetterQueue ? ' &middot; ' : ''}
+                            ${s.deadLetterQueue ? ` + "`" + `DLQ: ${s.deadLetterQueue}${s.maxReceiveCount ? ` + "`" + ` after ${s.maxReceiveCount} receives` + "`" + ` : ''}` + "`" + ` : ''}
+                        </div>
+                    ` + "`" + ` : ''}
+                    ${s.receivedOnly ? ` + "`" + `
+                        <div class="upstream-counts">Received only: ${s.receivedOnly} message(s) sent before the relay saw them</div>
+                    ` + "`" + ` : ''}
+                    ${s.redelivered ? ` + "`" + `
+                        <div class="upstream-counts discrepancy">Redelivered: ${s.redelivered} message(s) received more than once</div>
+                    ` + "`" + ` : ''}
+                    ${s.nextPurgeAllowedAt && new Date(s.nextPurgeAllowedAt) > new Date() ? ` + "`" + `
+                        <div class="upstream-counts">Purged; next purge allowed at ${new Date(s.nextPurgeAllowedAt).toLocaleTimeString()}</div>
+                    ` + "`" + ` : ''}
+                    ${s.maxBodyBytes ? ` + "`" + `
+                        <div class="upstream-counts">Body size: ${s.avgBodyBytes} B avg, ${s.maxBodyBytes} B max</div>
+                    ` + "`" + ` : ''}
+                    ${sizeOf[s.queueName]?.overThreshold ? ` + "`" + `
+                        <div class="upstream-counts discrepancy">
+                            ${sizeOf[s.queueName].overThreshold} message(s) over ${Math.round(sizeOf[s.queueName].threshold / 1024)} KB; largest ${Math.round(sizeOf[s.queueName].maxBytes / 1024)} KB of the 256 KB limit
+                        </div>
+                        <div class="size-bar"><div style="width: ${Math.min(100, sizeOf[s.queueName].maxBytes / (256 * 1024) * 100)}%"></div></div>
+                    ` + "`" + ` : ''}
+                    ${s.ackRatio !== undefined ? ` + "`" + `
+                        <div class="upstream-counts">Acked: ${Math.round(s.ackRatio * 100)}% of received</div>
+                    ` + "`" + ` : ''}
+                </div>
+            ` + "`" + `).join('');
+        }
+
+        async function refreshTopics() {
+            const topics = await fetchJSON('/api/topics');
+            const section = document.getElementById('topicsSection');
+
+            if (!topics || topics.length === 0) {
+                section.style.display = 'none';
+                return;
+            }
+
+            section.style.display = '';
+            document.getElementById('topics').innerHTML = topics.map(t => ` + "`" + `
+                <div class="stat-card" style="border-left: 4px solid ${t.color}">
+                    <h3>${t.topicName}</h3>
+                    <div class="stat-numbers">
+                        <div class="sent"><span>${t.published}</span>Published</div>
                     </div>
                 </div>
             ` + "`" + `).join('');
@@ -298,10 +950,20 @@ const indexHTML = `<!DOCTYPE html>
 
         async function refreshHistory() {
             const queue = document.getElementById('queueFilter').value;
-            const includeDeleted = document.getElementById('showDeleted').checked;
-
+            const traffic = document.getElementById('trafficFilter').value;
             let url = '/api/history?limit=200';
-            const history = await fetchJSON(url);
+            if (queue) url += '&queue=' + encodeURIComponent(queue);
+            if (traffic === 'sqs') url += '&service=sqs';
+            if (traffic === 'generic') url += '&action=generic';
+            historyItems = await fetchJSON(url) || [];
+            renderHistory();
+        }
+
+        function renderHistory() {
+            const queue = document.getElementById('queueFilter').value;
+            const includeDeleted = document.getElementById('showDeleted').checked;
+            const traffic = document.getElementById('trafficFilter').value;
+            const history = historyItems;
             const container = document.getElementById('history');
 
             if (!history || history.length === 0) {
@@ -310,7 +972,9 @@ const indexHTML = `<!DOCTYPE html>
             }
 
             const filtered = history.filter(m => {
+                if (m.action === 'marker') return true;
                 if (queue && m.queueName !== queue) return false;
+                if (traffic && (m.action === 'generic') !== (traffic === 'generic')) return false;
                 if (!includeDeleted && m.action === 'delete') return false;
                 return true;
             });
@@ -320,21 +984,135 @@ const indexHTML = `<!DOCTYPE html>
                 return;
             }
 
-            container.innerHTML = filtered.map(m => {
-                const time = new Date(m.timestamp).toLocaleTimeString();
-                const bodyPreview = m.body ? formatBody(m.body) : '[no body]';
-                return ` + "`" + `
-                    <div class="history-item" onclick="this.classList.toggle('expanded')">
-                        <div class="history-header">
-                            <span class="action-badge action-${m.action}">${m.action.toUpperCase()}</span>
-                            <span class="queue-name">${m.queueName}</span>
-                            <span class="timestamp">${time}</span>
-                        </div>
-                        <div class="message-id">${m.messageId || m.receiptHandle?.substring(0, 50) + '...' || 'N/A'}</div>
-                        <div class="message-body">${bodyPreview}</div>
+            // A FIFO queue only orders messages within a group, so show it
+            // group by group.
+            if (queue.endsWith('.fifo')) {
+                const groups = new Map();
+                filtered.forEach(m => {
+                    const group = messageGroup(m);
+                    if (!groups.has(group)) groups.set(group, []);
+                    groups.get(group).push(m);
+                });
+                container.innerHTML = Array.from(groups, ([group, items]) =>
+                    ` + "`" + `<div class="group-header">${group ? 'Group ' + group : 'No message group'} (${items.length})</div>` + "`" + ` +
+                    items.map(renderHistoryItem).join('')
+                ).join('');
+                return;
+            }
+
+            container.innerHTML = filtered.map(renderHistoryItem).join('');
+        }
+
+        // messageGroup returns the FIFO message group of an event: named by a
+        // send, or reported by SQS on a receive.
+        function messageGroup(m) {
+            return m.messageGroupId || (m.systemAttributes || {}).MessageGroupId || '';
+        }
+
+        function renderHistoryItem(m) {
+            const time = new Date(m.timestamp).toLocaleTimeString();
+            if (m.action === 'marker') {
+                return ` + "`" + `<div class="history-marker">${time} &mdash; ${escapeHTML(m.label)}</div>` + "`" + `;
+            }
+            let bodyPreview = m.body ? formatBody(m.body) : '[no body]';
+            if (m.action === 'removed') bodyPreview = m.label;
+            if (m.action === 'purge') bodyPreview = ` + "`" + `Purged ${m.purgedCount || 0} captured message(s)` + "`" + `;
+            if (m.action === 'fault') bodyPreview = ` + "`" + `Injected ${m.faultStatus} ${m.faultCode}` + "`" + `;
+            if (m.action === 'generic') {
+                bodyPreview = ` + "`" + `${m.httpMethod} ${m.httpPath} &rarr; ${m.httpStatus}\n\n${m.body || '[no body]'}` + "`" + `;
+                if (m.bodySize > (m.body || '').length) bodyPreview += ` + "`" + `... [${m.bodySize} bytes]` + "`" + `;
+                if (m.uninspected) bodyPreview = '[not inspected: body beyond the JSON limits]\n' + bodyPreview;
+            }
+            const approxReceives = Number((m.systemAttributes || {}).ApproximateReceiveCount || 0);
+            const receiveCount = approxReceives ? ` + "`" + `<span class="receive-count ${approxReceives > 1 ? 'redelivered' : ''}" title="ApproximateReceiveCount reported by SQS">receive #${approxReceives}</span>` + "`" + ` : '';
+            bodyPreview += formatAttributes(m);
+            if (m.bodySampled) bodyPreview += ` + "`" + `... [${m.bodySize} bytes, md5 ${m.bodyMd5}]` + "`" + `;
+            return ` + "`" + `
+                <div class="history-item" onclick="this.classList.toggle('expanded')">
+                    <div class="history-header">
+                        <span class="action-badge action-${m.action}">${(m.operation || m.action).toUpperCase()}</span>
+                        <span class="queue-name">${m.queueName || m.service || (m.topicArn || '').split(':').pop()}</span>
+                        ${receiveCount}
+                        ${formatDeadLetter(m)}
+                        ${m.action === 'send' && m.body && !m.bodySampled ? ` + "`" + `<button class="item-button" onclick="event.stopPropagation(); replayMessage('${m.messageId}')">Replay</button>` + "`" + ` : ''}
+                        ${m.messageId && m.action !== 'removed' ? ` + "`" + `<button class="item-button" onclick="event.stopPropagation(); toggleTimeline('${m.messageId}', '${m.id}')">Timeline</button>` + "`" + ` : ''}
+                        ${m.messageId && m.action !== 'removed' ? ` + "`" + `<button class="item-button" onclick="event.stopPropagation(); removeMessage('${m.messageId}')">Remove</button>` + "`" + ` : ''}
+                        <span class="timestamp">${time}</span>
                     </div>
-                ` + "`" + `;
-            }).join('');
+                    <div class="message-id">${m.messageId || m.receiptHandle?.substring(0, 50) + '...' || 'N/A'}${m.replayOf ? ` + "`" + ` (replay of ${m.replayOf})` + "`" + ` : ''}${formatFifo(m)}</div>
+                    <div class="message-body">${bodyPreview}</div>
+                    <div class="timeline" id="timeline-${m.id}">${openTimelines[m.id] || ''}</div>
+                </div>
+            ` + "`" + `;
+        }
+
+        async function refreshAnomalies() {
+            const anomalies = await fetchJSON('/api/anomalies');
+            const section = document.getElementById('anomaliesSection');
+
+            if (!anomalies || anomalies.length === 0) {
+                section.style.display = 'none';
+                return;
+            }
+
+            section.style.display = '';
+            document.getElementById('anomalies').innerHTML = anomalies.slice(0, 50).map(a => ` + "`" + `
+                <div class="anomaly-item">
+                    <span class="anomaly-kind">${a.kind}</span>
+                    <span class="queue-name">${a.queueName || ''}</span>
+                    <span>${escapeHTML(a.detail)}</span>
+                    <span class="timestamp">${new Date(a.timestamp).toLocaleTimeString()}</span>
+                </div>
+            ` + "`" + `).join('');
+        }
+
+        // formatDeadLetter badges a message's arrival in a dead-letter queue
+        // with where it came from.
+        function formatDeadLetter(m) {
+            const dl = m.deadLetter;
+            if (!dl) return '';
+            const from = dl.sourceQueue ? ` + "`" + `from ${dl.sourceQueue}` + "`" + ` : 'original unknown';
+            const title = dl.originalMessageId ? ` + "`" + `original ${dl.originalMessageId}, matched by ${dl.matchedBy}, ${dl.sourceReceives || 0} receive(s) before the move` + "`" + ` : '';
+            return ` + "`" + `<span class="dlq-badge" title="${title}">DLQ ${from}</span>` + "`" + `;
+        }
+
+        // formatFifo notes the FIFO sequence number and deduplication ID of a
+        // message, if it has them.
+        function formatFifo(m) {
+            const sequence = m.sequenceNumber || (m.systemAttributes || {}).SequenceNumber;
+            const dedup = m.messageDeduplicationId || (m.systemAttributes || {}).MessageDeduplicationId;
+            let text = '';
+            if (sequence) text += ` + "`" + ` seq ${sequence}` + "`" + `;
+            if (dedup) text += ` + "`" + ` dedup ${dedup}` + "`" + `;
+            return text;
+        }
+
+        // formatAttributes lists a message's attributes under its body. Binary
+        // values are captured as base64 and shown in hex too.
+        function formatAttributes(m) {
+            const names = Object.keys(m.attributes || {}).sort();
+            if (names.length === 0) return '';
+            const types = m.attributeTypes || {};
+            return '\n\nAttributes:\n' + names.map(name => {
+                const type = types[name] || 'String';
+                const value = m.attributes[name];
+                if (type === 'Binary' || type.startsWith('Binary.')) {
+                    let hex = '';
+                    try {
+                        hex = Array.from(atob(value), c => c.charCodeAt(0).toString(16).padStart(2, '0')).join(' ');
+                    } catch {}
+                    return ` + "`" + `  ${name} (${type}): base64 ${value}${hex ? ` + "`" + `, hex ${hex}` + "`" + ` : ''}` + "`" + `;
+                }
+                return ` + "`" + `  ${name} (${type}): ${value}` + "`" + `;
+            }).join('\n');
+        }
+
+        // escapeHTML makes captured text, which clients control, safe to
+        // insert as markup.
+        function escapeHTML(text) {
+            return String(text).replace(/[&<>"']/g, c => ({
+                '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'
+            })[c]);
         }
 
         function formatBody(body) {
@@ -355,15 +1133,180 @@ const indexHTML = `<!DOCTYPE html>
             }
         }
 
+        // exportCapture downloads the history of the selected queue, or of
+        // all queues.
+        function exportCapture(format) {
+            const queue = document.getElementById('queueFilter').value;
+            window.location = '/api/export?format=' + format + (queue ? '&queue=' + encodeURIComponent(queue) : '');
+        }
+
+        async function importCapture(input) {
+            const file = input.files[0];
+            input.value = '';
+            if (!file || !confirm('Replace the current capture with ' + file.name + '?')) return;
+            const resp = await fetch('/api/import', { method: 'POST', body: file });
+            if (!resp.ok) {
+                alert(await resp.text());
+                return;
+            }
+            knownQueues.clear();
+            document.getElementById('queueFilter').innerHTML = '<option value="">All Queues</option>';
+            refreshData();
+        }
+
+        async function removeMessage(id) {
+            if (!confirm('Remove message ' + id + ' from the relay? It stays in the upstream queue.')) return;
+            await fetch('/api/messages/' + encodeURIComponent(id), { method: 'DELETE' });
+            refreshData();
+        }
+
+        async function toggleTimeline(messageId, itemId) {
+            const el = document.getElementById('timeline-' + itemId);
+            if (openTimelines[itemId]) {
+                delete openTimelines[itemId];
+                el.innerHTML = '';
+                return;
+            }
+            const resp = await fetch('/api/timeline?id=' + encodeURIComponent(messageId));
+            if (!resp.ok) {
+                alert(await resp.text());
+                return;
+            }
+            openTimelines[itemId] = renderTimeline(await resp.json());
+            el.innerHTML = openTimelines[itemId];
+        }
+
+        // renderTimeline draws a message's lifecycle as a vertical list of
+        // its events under a summary of the time between them.
+        function renderTimeline(t) {
+            const secs = ms => ms === undefined ? '?' : (ms / 1000).toFixed(1) + 's';
+            const running = t.deleted ? '' : ' so far';
+            const summary = [];
+            if (t.timeToFirstReceiveMs !== undefined) summary.push('first receive after ' + secs(t.timeToFirstReceiveMs));
+            if (t.timeInFlightMs !== undefined) summary.push('in flight ' + secs(t.timeInFlightMs) + running);
+            if (t.lifetimeMs !== undefined) summary.push('lifetime ' + secs(t.lifetimeMs) + running);
+            if (t.purged) summary.push('purged');
+            const events = t.events.map(e => ` + "`" + `
+                <li class="tl-${e.action}">
+                    ${new Date(e.timestamp).toLocaleTimeString()} &mdash; ${(e.operation || e.action).toUpperCase()}
+                    ${e.receiptHandle ? ` + "`" + `<span class="message-id">${e.receiptHandle.substring(0, 40)}...</span>` + "`" + ` : ''}
+                </li>
+            ` + "`" + `).join('');
+            return ` + "`" + `<div class="timeline-summary">${summary.join(' &middot; ') || 'No durations yet'}</div><ol class="timeline-list">${events}</ol>` + "`" + `;
+        }
+
+        async function replayMessage(id) {
+            const resp = await fetch('/api/replay?id=' + encodeURIComponent(id), { method: 'POST' });
+            if (!resp.ok) {
+                alert(await resp.text());
+                return;
+            }
+            refreshData();
+        }
+
+        async function addMarker() {
+            const label = prompt('Marker label');
+            if (label) {
+                await fetch('/api/marker?label=' + encodeURIComponent(label), { method: 'POST' });
+                refreshData();
+            }
+        }
+
         function toggleAutoRefresh() {
             if (document.getElementById('autoRefresh').checked) {
-                autoRefreshInterval = setInterval(refreshData, 2000);
+                if (window.EventSource) {
+                    startStream();
+                } else {
+                    startPolling();
+                }
             } else {
+                stopStream();
                 clearInterval(autoRefreshInterval);
+                autoRefreshInterval = null;
             }
         }
 
+        function startPolling() {
+            if (!autoRefreshInterval) {
+                autoRefreshInterval = setInterval(refreshData, 2000);
+            }
+        }
+
+        // Live updates: each streamed event is added to the history straight
+        // away, while stats and anomalies are refetched at most once a second.
+        // If the stream can't be kept open, fall back to polling.
+        function startStream() {
+            eventSource = new EventSource('/api/stream');
+            eventSource.onopen = () => refreshData();
+            eventSource.onmessage = e => {
+                historyItems.unshift(JSON.parse(e.data));
+                historyItems.length = Math.min(historyItems.length, 200);
+                renderHistory();
+                if (!streamRefresh) {
+                    streamRefresh = setTimeout(async () => {
+                        streamRefresh = null;
+                        await Promise.all([refreshStats(), refreshTopics(), refreshAnomalies()]);
+                        document.getElementById('refreshIndicator').textContent =
+                            'Live: ' + new Date().toLocaleTimeString();
+                    }, 1000);
+                }
+            };
+            eventSource.addEventListener('evicted', () => {
+                // Fell behind; reconnecting reloads everything
+                stopStream();
+                startStream();
+            });
+            eventSource.onerror = () => {
+                if (eventSource.readyState === EventSource.CLOSED) {
+                    stopStream();
+                    startPolling();
+                }
+            };
+        }
+
+        function stopStream() {
+            if (eventSource) {
+                eventSource.close();
+                eventSource = null;
+            }
+        }
+
+        function showLatency(rules) {
+            document.getElementById('latencyRules').value = rules.length ? JSON.stringify(rules) : '';
+            document.getElementById('latencyStatus').textContent =
+                rules.length ? 'Latency injection on (' + rules.length + ' rule(s))' : '';
+        }
+
+        async function refreshLatency() {
+            showLatency(await fetchJSON('/api/latency'));
+        }
+
+        async function setLatency() {
+            const res = await fetch('/api/latency', {
+                method: 'POST',
+                body: document.getElementById('latencyRules').value || '[]',
+            });
+            if (!res.ok) {
+                alert(await res.text());
+                return;
+            }
+            showLatency(await res.json());
+        }
+
+        async function clearLatency() {
+            const res = await fetch('/api/latency', { method: 'DELETE' });
+            showLatency(await res.json());
+        }
+
+        async function refreshCaptureScope() {
+            const { scope } = await fetchJSON('/api/capture-scope');
+            document.getElementById('captureScope').textContent =
+                scope === 'all' ? '' : 'Capturing ' + scope + '-plane actions only';
+        }
+
         // Initial load
+        refreshCaptureScope();
+        refreshLatency();
         refreshData();
     </script>
 </body>
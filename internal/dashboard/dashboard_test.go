@@ -0,0 +1,479 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-relay/internal/proxy"
+	"aws-relay/internal/store"
+)
+
+// getJSON fetches path from srv and decodes its JSON body into v, returning
+// the response.
+func getJSON(t *testing.T, srv *httptest.Server, path string, v interface{}) *http.Response {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	return resp
+}
+
+func TestDLQGraphSources(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	s.RecordDeadLetterSources("orders-dlq", []string{"orders"})
+
+	var sources struct {
+		DeadLetterQueue string   `json:"deadLetterQueue"`
+		Sources         []string `json:"sources"`
+	}
+	getJSON(t, srv, "/api/dlq-graph?dlq=orders-dlq", &sources)
+	if sources.DeadLetterQueue != "orders-dlq" || len(sources.Sources) != 1 || sources.Sources[0] != "orders" {
+		t.Errorf("sources = %+v", sources)
+	}
+
+	var graph struct {
+		Nodes []string `json:"nodes"`
+	}
+	getJSON(t, srv, "/api/dlq-graph", &graph)
+	if len(graph.Nodes) != 2 {
+		t.Errorf("graph nodes = %v, want both queues", graph.Nodes)
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", "payload with needle", nil, nil)
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantHits   int
+	}{
+		{"match", "/api/search?q=NEEDLE", http.StatusOK, 1},
+		{"empty results are a list", "/api/search?q=haystack", http.StatusOK, 0},
+		{"regex", "/api/search?q=need.e&regex=true", http.StatusOK, 1},
+		{"other queue", "/api/search?q=needle&queue=billing", http.StatusOK, 0},
+		{"missing query", "/api/search", http.StatusBadRequest, 0},
+		{"invalid regex", "/api/search?q=(&regex=true", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []store.SearchResult
+			resp := getJSON(t, srv, tt.path, &results)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && (results == nil || len(results) != tt.wantHits) {
+				t.Errorf("results = %v, want a list of %d", results, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestIndexEscapesCapturedText(t *testing.T) {
+	_, _, _, srv := newTestDashboard(t)
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Anomaly details quote request paths, which any client can set, and
+	// marker labels are whatever was posted
+	for _, want := range []string{"function escapeHTML(", "${escapeHTML(a.detail)}", "${escapeHTML(m.label)}"} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("index page doesn't contain %q", want)
+		}
+	}
+}
+
+func TestMarkerPlacedChronologically(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", "first", nil, nil)
+	status, body := postBody(t, srv, "/api/marker?label="+url.QueryEscape("<b>deployed v2</b>"), "")
+	if status != http.StatusOK {
+		t.Fatalf("marker status = %d: %s", status, body)
+	}
+	s.RecordSend(store.Meta{}, "", "orders", "m-2", "second", nil, nil)
+
+	var history []store.Message
+	getJSON(t, srv, "/api/history", &history)
+	var got []string
+	for _, m := range history {
+		got = append(got, string(m.Action)+":"+m.MessageID+m.Label)
+	}
+	want := []string{"send:m-2", "marker:<b>deployed v2</b>", "send:m-1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("history = %v, want %v", got, want)
+	}
+}
+
+func TestSessionsPartitionHistory(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	send := func(id string) { s.RecordSend(store.Meta{}, "", "orders", id, "body of "+id, nil, nil) }
+
+	send("before")
+	postBody(t, srv, "/api/session?name=first", "")
+	send("a-1")
+	send("a-2")
+	postBody(t, srv, "/api/session?name=second", "")
+	send("b-1")
+	postBody(t, srv, "/api/session", "")
+	send("after")
+
+	tests := []struct {
+		session string
+		want    []string
+	}{
+		{"first", []string{"a-2", "a-1"}},
+		{"second", []string{"b-1"}},
+		{"", []string{"after", "b-1", "a-2", "a-1", "before"}},
+	}
+	for _, tt := range tests {
+		var history []store.Message
+		getJSON(t, srv, "/api/history?session="+tt.session, &history)
+		var got []string
+		for _, m := range history {
+			got = append(got, m.MessageID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("session %q history = %v, want %v", tt.session, got, tt.want)
+		}
+	}
+
+	var sessions []store.Session
+	getJSON(t, srv, "/api/sessions", &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %+v, want first and second", sessions)
+	}
+	for i, want := range []struct {
+		name   string
+		events int
+	}{{"first", 2}, {"second", 1}} {
+		if got := sessions[i]; got.Name != want.name || got.Events != want.events || got.Active || got.EndedAt == nil {
+			t.Errorf("session %d = %+v, want %s ended with %d events", i, got, want.name, want.events)
+		}
+	}
+}
+
+func TestMessageDetailDiffsPreviousSend(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	attrs := map[string]string{store.DefaultCorrelationAttribute: "order-1"}
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", `{"status":"new","total":3,"note":"x"}`, attrs, nil)
+	s.RecordSend(store.Meta{}, "", "orders", "m-other", `{"status":"other"}`, map[string]string{store.DefaultCorrelationAttribute: "order-2"}, nil)
+	s.RecordSend(store.Meta{}, "", "orders", "m-2", `{"status":"paid","total":3,"paidAt":"today"}`, attrs, nil)
+
+	var detail struct {
+		PreviousMessageID string `json:"previousMessageId"`
+		PrevDiff          []struct {
+			Op   string      `json:"op"`
+			Path string      `json:"path"`
+			Old  interface{} `json:"old"`
+			New  interface{} `json:"new"`
+		} `json:"prevDiff"`
+	}
+	getJSON(t, srv, "/api/message/m-2", &detail)
+	if detail.PreviousMessageID != "m-1" {
+		t.Errorf("previousMessageId = %q, want m-1", detail.PreviousMessageID)
+	}
+	var got []string
+	for _, c := range detail.PrevDiff {
+		got = append(got, fmt.Sprintf("%s %s %v→%v", c.Op, c.Path, c.Old, c.New))
+	}
+	want := []string{"remove /note x→<nil>", "add /paidAt <nil>→today", "replace /status new→paid"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("prevDiff = %q, want %q", got, want)
+	}
+
+	// The first send has nothing to compare against
+	var first map[string]interface{}
+	getJSON(t, srv, "/api/message/m-1", &first)
+	if _, ok := first["prevDiff"]; ok {
+		t.Errorf("first send has prevDiff %v", first["prevDiff"])
+	}
+}
+
+func TestStuckMessagesFollowClock(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	s.SetClock(clock)
+
+	for _, id := range []string{"acked", "stuck"} {
+		s.RecordSend(store.Meta{}, "", "orders", id, "body of "+id, nil, nil)
+		s.RecordReceive(store.Meta{}, "", "orders", id, "r-"+id, "body of "+id, nil, nil)
+	}
+	s.RecordDelete(store.Meta{}, "", "orders", "r-acked")
+	clock.Advance(10 * time.Minute)
+	s.RecordSend(store.Meta{}, "", "orders", "fresh", "body of fresh", nil, nil)
+	s.RecordReceive(store.Meta{}, "", "orders", "fresh", "r-fresh", "body of fresh", nil, nil)
+
+	tests := []struct {
+		olderThan string
+		want      []string
+	}{
+		{"5m", []string{"stuck"}},
+		{"0s", []string{"stuck", "fresh"}},
+		{"1h", nil},
+	}
+	for _, tt := range tests {
+		var stuck []store.Message
+		getJSON(t, srv, "/api/stuck?olderThan="+tt.olderThan, &stuck)
+		var got []string
+		for _, m := range stuck {
+			got = append(got, m.MessageID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("olderThan=%s stuck = %v, want %v", tt.olderThan, got, tt.want)
+		}
+	}
+
+	if resp := getJSON(t, srv, "/api/stuck?olderThan=soon", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid olderThan status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestEventsAtTimeWindow(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := &testClock{now: start}
+	s.SetClock(clock)
+
+	// One send a second: m-0 at start, m-1 a second later, and so on
+	for i := 0; i < 20; i++ {
+		s.RecordSend(store.Meta{}, "", "orders", fmt.Sprintf("m-%d", i), "body", nil, nil)
+		clock.Advance(time.Second)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		want   []string
+		status int
+	}{
+		{"default window", "time=" + start.Add(10*time.Second).Format(time.RFC3339), []string{"m-5", "m-6", "m-7", "m-8", "m-9", "m-10", "m-11", "m-12", "m-13", "m-14", "m-15"}, http.StatusOK},
+		{"narrow window", "time=" + start.Add(10*time.Second).Format(time.RFC3339) + "&window=1s", []string{"m-9", "m-10", "m-11"}, http.StatusOK},
+		{"before the capture", "time=" + start.Add(-time.Hour).Format(time.RFC3339), nil, http.StatusOK},
+		{"missing time", "", nil, http.StatusBadRequest},
+		{"invalid window", "time=" + start.Format(time.RFC3339) + "&window=wide", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []store.Message
+			resp := getJSON(t, srv, "/api/at?"+tt.query, &events)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, e.MessageID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBulkTagByBody(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", `{"status":"failed","id":1}`, nil, nil)
+	s.RecordSend(store.Meta{}, "", "orders", "m-2", `{"status":"ok","id":2}`, nil, nil)
+	s.RecordSend(store.Meta{}, "", "payments", "m-3", `{"status":"failed","id":3}`, nil, nil)
+	s.RecordSend(store.Meta{}, "", "orders", "m-4", `{"status":"failed","id":4}`, nil, nil)
+
+	status, body := postBody(t, srv, "/api/tag/bulk", `{"tag":"bad-status","queue":"orders","body":"failed"}`)
+	if status != http.StatusOK || strings.TrimSpace(body) != `{"tagged":2}` {
+		t.Fatalf("bulk tag = %d %s, want 2 tagged", status, body)
+	}
+
+	var tagged []string
+	for _, m := range s.GetMessages("", true) {
+		for _, tag := range m.Tags {
+			if tag == "bad-status" {
+				tagged = append(tagged, m.MessageID)
+			}
+		}
+	}
+	sort.Strings(tagged)
+	if want := []string{"m-1", "m-4"}; strings.Join(tagged, ",") != strings.Join(want, ",") {
+		t.Errorf("tagged = %v, want %v", tagged, want)
+	}
+
+	if status, _ := postBody(t, srv, "/api/tag/bulk", `{"body":"failed"}`); status != http.StatusBadRequest {
+		t.Errorf("untagged request status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestGraphQLQueueWithRecentMessages(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	s.SetClock(clock)
+	for _, id := range []string{"m-1", "m-2", "m-3"} {
+		s.RecordSend(store.Meta{}, "", "orders", id, "body of "+id, nil, nil)
+		clock.Advance(time.Second)
+	}
+	s.RecordReceive(store.Meta{}, "", "orders", "m-3", "r-3", "body of m-3", nil, nil)
+	s.RecordSend(store.Meta{}, "", "payments", "p-1", "elsewhere", nil, nil)
+
+	query, _ := json.Marshal(map[string]interface{}{
+		"query":     `query($name: String!) { queue(name: $name) { name totalSent messages(limit: 2) { messageId body events { action } } } }`,
+		"variables": map[string]string{"name": "orders"},
+	})
+	status, body := postBody(t, srv, "/graphql", string(query))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+
+	want := `{"data":{"queue":{"name":"orders","totalSent":3,"messages":[` +
+		`{"messageId":"m-3","body":"body of m-3","events":[{"action":"receive"},{"action":"send"}]},` +
+		`{"messageId":"m-2","body":"body of m-2","events":[{"action":"send"}]}]}}}`
+	if strings.TrimSpace(body) != want {
+		t.Errorf("response:\n%s\nwant:\n%s", body, want)
+	}
+
+	status, body = postBody(t, srv, "/graphql", `{"query":"{ queue(name: \"orders\") { nope } }"}`)
+	if status != http.StatusOK || !strings.Contains(body, `"errors"`) {
+		t.Errorf("unknown field = %d %s, want a GraphQL error", status, body)
+	}
+}
+
+func TestAssertExpectations(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	for _, id := range []string{"m-1", "m-2", "m-3"} {
+		s.RecordSend(store.Meta{}, "", "orders", id, "body", nil, nil)
+		s.RecordReceive(store.Meta{}, "", "orders", id, "r-"+id, "body", nil, nil)
+		s.RecordDelete(store.Meta{}, "", "orders", "r-"+id)
+	}
+	s.RecordSend(store.Meta{}, "", "payments", "p-1", "body", nil, nil)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"satisfied", `{"orders":{"sent":3,"deleted":3,"pending":0},"payments":{"pending":1}}`, http.StatusOK,
+			`{"mismatches":[],"ok":true}`},
+		{"unsatisfied", `{"orders":{"sent":3,"received":2},"payments":{"pending":0},"refunds":{"sent":1}}`, http.StatusUnprocessableEntity,
+			`{"mismatches":[` +
+				`{"queue":"orders","field":"received","expected":2,"actual":3},` +
+				`{"queue":"payments","field":"pending","expected":0,"actual":1},` +
+				`{"queue":"refunds","field":"sent","expected":1,"actual":0}],"ok":false}`},
+		{"malformed", `{"orders":`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := postBody(t, srv, "/api/assert", tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHistoryProvenance(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+
+	// Two listeners, each relaying to its own upstream, share the store
+	type relay struct{ listen, upstream string }
+	var relays []relay
+	for i := 0; i < 2; i++ {
+		messageID := fmt.Sprintf("m-%d", i)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"MessageId":%q}`, messageID)
+		}))
+		t.Cleanup(upstream.Close)
+		listener := httptest.NewServer(proxy.New(upstream.URL, s))
+		t.Cleanup(listener.Close)
+		relays = append(relays, relay{listener.Listener.Addr().String(), upstream.URL})
+
+		req, _ := http.NewRequest(http.MethodPost, listener.URL+"/", strings.NewReader(`{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi"}`))
+		req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+		req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	for i, r := range relays {
+		var history []store.Message
+		getJSON(t, srv, "/api/history?upstream="+url.QueryEscape(r.upstream), &history)
+		if len(history) != 1 {
+			t.Fatalf("history of upstream %s = %+v, want one send", r.upstream, history)
+		}
+		if got := history[0]; got.MessageID != fmt.Sprintf("m-%d", i) || got.ListenAddr != r.listen || got.Upstream != r.upstream {
+			t.Errorf("send = %s via %s to %s, want m-%d via %s to %s", got.MessageID, got.ListenAddr, got.Upstream, i, r.listen, r.upstream)
+		}
+	}
+}
+
+func TestMessageNotes(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", "hi", nil, nil)
+
+	patch := func(id, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/api/message/"+id, strings.NewReader(body))
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	notes := func() []string {
+		var detail struct {
+			Notes []string `json:"notes"`
+		}
+		getJSON(t, srv, "/api/message/m-1", &detail)
+		return detail.Notes
+	}
+
+	for _, note := range []string{"seen twice", "retry from worker-2"} {
+		if status := patch("m-1", `{"note":"`+note+`"}`); status != http.StatusOK {
+			t.Fatalf("PATCH note %q: status %d", note, status)
+		}
+	}
+	if got := notes(); strings.Join(got, "|") != "seen twice|retry from worker-2" {
+		t.Errorf("notes = %q, want both notes in order", got)
+	}
+
+	if status := patch("m-1", `{"note":"only this","replace":true}`); status != http.StatusOK {
+		t.Fatalf("PATCH replace: status %d", status)
+	}
+	if got := notes(); strings.Join(got, "|") != "only this" {
+		t.Errorf("notes after replace = %q, want [only this]", got)
+	}
+
+	if status := patch("m-1", `{}`); status != http.StatusBadRequest {
+		t.Errorf("PATCH without note: status %d, want 400", status)
+	}
+	if status := patch("m-missing", `{"note":"x"}`); status != http.StatusNotFound {
+		t.Errorf("PATCH unknown message: status %d, want 404", status)
+	}
+}
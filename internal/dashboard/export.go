@@ -0,0 +1,226 @@
+package dashboard
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+const (
+	// exportChunk is how many history events are copied per read-lock
+	// window.
+	exportChunk = 500
+
+	// maxAttributeColumns caps the attribute columns of attributes.csv.
+	maxAttributeColumns = 200
+)
+
+// handleExport streams the capture as a download, by default as one JSON
+// document:
+//
+//	{"exportedAt": ..., "stats": [...], "history": [...]}
+//
+// With format=csv it is one row per history event instead. The q, regex and
+// queue parameters of /api/search narrow the events exported.
+//
+// History is written incrementally, chunk by chunk, so a large capture is
+// never held in memory or under the store lock in full. Events recorded
+// after the export starts are left out.
+func (d *Dashboard) handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	match, err := store.SearchFilter(query.Get("q"), store.SearchOptions{
+		Regex:     query.Get("regex") == "true",
+		QueueName: query.Get("queue"),
+	})
+	if err != nil {
+		http.Error(w, "Invalid regex: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		d.exportJSON(w, r, match)
+	case "csv":
+		d.exportCSV(w, r, match)
+	default:
+		http.Error(w, "Invalid format; use json or csv", http.StatusBadRequest)
+	}
+}
+
+func (d *Dashboard) exportJSON(w http.ResponseWriter, r *http.Request, match func(*store.Message) bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="aws-relay-export.json"`)
+
+	header, err := json.Marshal(map[string]interface{}{
+		"exportedAt": time.Now(),
+		"stats":      d.store.GetQueueStats(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Reopen the header object to append the streamed history array
+	w.Write(header[:len(header)-1])
+	w.Write([]byte(`,"history":[`))
+
+	first := true
+	complete := d.eachExportEvent(w, r, match, func(event *store.Message) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		if !first {
+			w.Write([]byte(","))
+		}
+		w.Write(data)
+		first = false
+	})
+	if complete {
+		w.Write([]byte("]}\n"))
+	}
+}
+
+// exportCSV writes one row per event. deleted is whether the event's
+// message has since been deleted, not just the event's own flag.
+func (d *Dashboard) exportCSV(w http.ResponseWriter, r *http.Request, match func(*store.Message) bool) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="aws-relay-export.csv"`)
+
+	// Rows go straight to w, which the chunk loop flushes
+	out := csv.NewWriter(w)
+	defer out.Flush()
+	out.Write([]string{"timestamp", "action", "queue", "messageId", "receiptHandle", "bodyLength", "deleted"})
+
+	d.eachExportEvent(w, r, match, func(event *store.Message) {
+		bodyLength := len(event.Body)
+		if event.BodySampled {
+			bodyLength = event.BodySize
+		}
+		deleted := event.Deleted
+		if msg, ok := d.store.GetMessage(event.MessageID); ok {
+			deleted = msg.Deleted
+		}
+		out.Write([]string{
+			event.Timestamp.Format(time.RFC3339Nano),
+			string(event.Action),
+			event.QueueName,
+			event.MessageID,
+			event.ReceiptHandle,
+			strconv.Itoa(bodyLength),
+			strconv.FormatBool(deleted),
+		})
+		out.Flush()
+	})
+}
+
+// eachExportEvent calls fn with each history event that satisfies match,
+// oldest first, copying history a chunk at a time and flushing w after each
+// chunk. It reports false if the client went away before the end.
+func (d *Dashboard) eachExportEvent(w http.ResponseWriter, r *http.Request, match func(*store.Message) bool, fn func(*store.Message)) bool {
+	flusher, _ := w.(http.Flusher)
+
+	total := d.store.HistoryLen()
+	for pos := 0; pos < total; {
+		chunk := d.store.HistoryRange(pos, min(exportChunk, total-pos))
+		if len(chunk) == 0 {
+			break // history was cleared or pruned mid-export
+		}
+		for i := range chunk {
+			pos++
+			if event := &chunk[i]; match(event) {
+				fn(event)
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if r.Context().Err() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// handleImport replaces the capture with the history of a JSON export
+// POSTed as the request body. Malformed JSON, a missing history array or
+// events the store can't use are rejected with a 400 before anything
+// changes.
+func (d *Dashboard) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var export struct {
+		History *[]*store.Message `json:"history"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		http.Error(w, "Invalid export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if export.History == nil {
+		http.Error(w, "Invalid export: missing history", http.StatusBadRequest)
+		return
+	}
+
+	messages, err := d.store.Import(*export.History)
+	if err != nil {
+		http.Error(w, "Invalid export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]int{"messages": messages, "events": len(*export.History)})
+}
+
+// handleAttributesCSV serves /api/attributes.csv?queue=, one row per message
+// with a column for every attribute key seen on the queue, blank where a
+// message lacks the key. Keys beyond maxAttributeColumns are dropped, which
+// the X-Attribute-Columns-Dropped header reports.
+func (d *Dashboard) handleAttributesCSV(w http.ResponseWriter, r *http.Request) {
+	messages := d.store.GetMessages(r.URL.Query().Get("queue"), true)
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+
+	seen := make(map[string]bool)
+	for _, msg := range messages {
+		for key := range msg.Attributes {
+			seen[key] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > maxAttributeColumns {
+		w.Header().Set("X-Attribute-Columns-Dropped", strconv.Itoa(len(keys)-maxAttributeColumns))
+		keys = keys[:maxAttributeColumns]
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="attributes.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write(append([]string{"messageId", "timestamp"}, keys...))
+
+	row := make([]string, 2+len(keys))
+	for i, msg := range messages {
+		row[0] = msg.MessageID
+		row[1] = msg.Timestamp.Format(time.RFC3339Nano)
+		for j, key := range keys {
+			row[2+j] = msg.Attributes[key]
+		}
+		out.Write(row)
+
+		if i%exportChunk == exportChunk-1 {
+			out.Flush()
+		}
+	}
+	out.Flush()
+}
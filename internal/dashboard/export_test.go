@@ -0,0 +1,217 @@
+package dashboard
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+// postBody POSTs body to path on srv, returning the status and response.
+func postBody(t *testing.T, srv *httptest.Server, path, body string) (int, string) {
+	t.Helper()
+	resp, err := srv.Client().Post(srv.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+// storeJSON returns the messages, ordered by ID, and history of s as JSON,
+// for comparison.
+func storeJSON(t *testing.T, s *store.Store) (string, string) {
+	t.Helper()
+	messages := s.GetMessages("", true)
+	sort.Slice(messages, func(i, j int) bool { return messages[i].MessageID < messages[j].MessageID })
+	m, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := json.Marshal(s.GetHistory(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(m), string(h)
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	_, src, _, srcSrv := newTestDashboard(t)
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	src.RecordSend(store.Meta{}, ordersURL, "orders", "m-1", "first", map[string]string{"kind": "a"}, nil)
+	src.RecordSend(store.Meta{}, ordersURL, "orders", "m-2", "second", nil, nil)
+	src.RecordReceive(store.Meta{}, ordersURL, "orders", "m-1", "r-1", "first", nil, nil)
+	src.RecordDelete(store.Meta{}, ordersURL, "orders", "r-1")
+	src.AddMarker("checkpoint")
+	src.RecordGeneric(store.Meta{}, store.GenericCall{Service: "sns", Operation: "Publish", Method: http.MethodPost, Path: "/", Status: 200, Body: "Action=Publish", BodySize: 14})
+
+	resp, err := srcSrv.Client().Get(srcSrv.URL + "/api/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	export, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	_, dst, _, dstSrv := newTestDashboard(t)
+	dst.RecordSend(store.Meta{}, "", "stale", "old", "replaced by the import", nil, nil)
+	status, body := postBody(t, dstSrv, "/api/import", string(export))
+	if status != http.StatusOK {
+		t.Fatalf("import status = %d: %s", status, body)
+	}
+	var counts map[string]int
+	json.Unmarshal([]byte(body), &counts)
+	if counts["messages"] != 2 || counts["events"] != 6 {
+		t.Errorf("import counts = %v, want 2 messages and 6 events", counts)
+	}
+
+	wantMessages, wantHistory := storeJSON(t, src)
+	gotMessages, gotHistory := storeJSON(t, dst)
+	if gotMessages != wantMessages {
+		t.Errorf("imported messages:\n%s\nwant:\n%s", gotMessages, wantMessages)
+	}
+	if gotHistory != wantHistory {
+		t.Errorf("imported history:\n%s\nwant:\n%s", gotHistory, wantHistory)
+	}
+}
+
+func TestImportRejectsMalformedExports(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not JSON", "{"},
+		{"no history", `{"stats":[]}`},
+		{"null event", `{"history":[null]}`},
+		{"unknown action", `{"history":[{"id":"e-1","action":"teleport","timestamp":"2024-01-02T03:04:05Z"}]}`},
+		{"send without a queue", `{"history":[{"id":"e-1","action":"send","messageId":"m-1","timestamp":"2024-01-02T03:04:05Z"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, _, srv := newTestDashboard(t)
+			s.RecordSend(store.Meta{}, "", "orders", "m-1", "kept", nil, nil)
+
+			if status, body := postBody(t, srv, "/api/import", tt.body); status != http.StatusBadRequest {
+				t.Errorf("status = %d (%s), want 400", status, body)
+			}
+			if n := s.HistoryLen(); n != 1 {
+				t.Errorf("rejected import changed history to %d events", n)
+			}
+		})
+	}
+}
+
+func TestExportStreamsLargeHistory(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	total := 2*exportChunk + 7
+	for i := 0; i < total; i++ {
+		body := "plain"
+		if i%100 == 0 {
+			body = "needle"
+		}
+		s.RecordSend(store.Meta{}, "", "orders", fmt.Sprintf("m-%d", i), body, nil, nil)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", total},
+		{"?q=needle", (total + 99) / 100},
+	}
+	for _, tt := range tests {
+		resp, err := srv.Client().Get(srv.URL + "/api/export" + tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var export struct {
+			Stats   []store.QueueStats `json:"stats"`
+			History []store.Message    `json:"history"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&export)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("export%s is not valid JSON: %v", tt.query, err)
+		}
+		if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+			t.Errorf("export%s transfer encoding = %v, want chunked", tt.query, resp.TransferEncoding)
+		}
+		if len(export.Stats) != 1 || len(export.History) != tt.want {
+			t.Fatalf("export%s has %d stats and %d events, want 1 and %d", tt.query, len(export.Stats), len(export.History), tt.want)
+		}
+		for i := 1; i < len(export.History); i++ {
+			if export.History[i].Timestamp.Before(export.History[i-1].Timestamp) || export.History[i].ID == export.History[i-1].ID {
+				t.Fatalf("export%s history out of order at %d", tt.query, i)
+			}
+		}
+	}
+}
+
+func TestAttributesCSVColumns(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	s.SetClock(clock)
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", "body", map[string]string{"region": "eu", "priority": "high"}, nil)
+	clock.Advance(time.Second)
+	s.RecordSend(store.Meta{}, "", "orders", "m-2", "body", map[string]string{"customer": "c-9"}, nil)
+	clock.Advance(time.Second)
+	s.RecordSend(store.Meta{}, "", "orders", "m-3", "body", nil, nil)
+	s.RecordSend(store.Meta{}, "", "payments", "p-1", "body", map[string]string{"currency": "EUR"}, nil)
+
+	resp, err := srv.Client().Get(srv.URL + "/api/attributes.csv?queue=orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"messageId", "timestamp", "customer", "priority", "region"},
+		{"m-1", "2024-01-02T03:04:05Z", "", "high", "eu"},
+		{"m-2", "2024-01-02T03:04:06Z", "c-9", "", ""},
+		{"m-3", "2024-01-02T03:04:07Z", "", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+	if dropped := resp.Header.Get("X-Attribute-Columns-Dropped"); dropped != "" {
+		t.Errorf("dropped columns = %s, want none", dropped)
+	}
+}
+
+func TestAttributesCSVCapsColumns(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	attrs := make(map[string]string)
+	for i := 0; i < maxAttributeColumns+5; i++ {
+		attrs[fmt.Sprintf("key-%03d", i)] = "v"
+	}
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", "body", attrs, nil)
+
+	resp, err := srv.Client().Get(srv.URL + "/api/attributes.csv?queue=orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || len(rows[0]) != 2+maxAttributeColumns {
+		t.Fatalf("got %d rows of %d columns, want 2 of %d", len(rows), len(rows[0]), 2+maxAttributeColumns)
+	}
+	if dropped := resp.Header.Get("X-Attribute-Columns-Dropped"); dropped != "5" {
+		t.Errorf("dropped columns = %q, want 5", dropped)
+	}
+}
@@ -0,0 +1,267 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"aws-relay/internal/graphql"
+	"aws-relay/internal/store"
+)
+
+// The /graphql schema, read-only:
+//
+//	type Query {
+//	  queues: [Queue]
+//	  queue(name: String!): Queue
+//	  messages(queue: String, limit: Int, includeDeleted: Boolean): [Message]
+//	  message(id: String!): Message
+//	  events(queue: String, limit: Int): [Event]
+//	}
+//	type Queue {
+//	  name, url, color: String
+//	  totalSent, totalReceived, totalDeleted, pending, inFlight, redelivered: Int
+//	  receivedOnly, visibilityTimeout, maxReceiveCount: Int
+//	  deadLetterQueue: String
+//	  avgBodyBytes, maxBodyBytes: Int
+//	  ackRatio: Float
+//	  messages(limit: Int, includeDeleted: Boolean): [Message]
+//	  events(limit: Int): [Event]
+//	}
+//	type Message {
+//	  id, messageId, queueName, queueUrl, body, action, timestamp: String
+//	  deleted: Boolean
+//	  deletedAt, traceId: String
+//	  messageGroupId, messageDeduplicationId, sequenceNumber: String
+//	  receiveCount: Int
+//	  attributes, systemAttributes: JSON
+//	  tags, notes, receiptHandles: [String]
+//	  queue: Queue
+//	  events: [Event]
+//	}
+//	type Event {
+//	  id, action, messageId, queueName, receiptHandle, body, timestamp: String
+//	  traceId, session, operation: String
+//	  staleHandle: Boolean
+//	  message: Message
+//	}
+//
+// List fields return the most recent items first and default to 100.
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// handleGraphQL serves GraphQL queries, POSTed as JSON or passed as the
+// query parameter of a GET.
+func (d *Dashboard) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	switch r.Method {
+	case "GET":
+		req.Query = r.URL.Query().Get("query")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	case "POST":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, graphql.Execute(req.Query, req.Variables, d.graphqlQuery()))
+}
+
+func (d *Dashboard) graphqlQuery() *graphql.Object {
+	return &graphql.Object{
+		Type: "Query",
+		Fields: map[string]graphql.Resolver{
+			"queues": func(args map[string]interface{}) (interface{}, error) {
+				stats := d.store.GetQueueStats()
+				sort.Slice(stats, func(i, j int) bool { return stats[i].QueueName < stats[j].QueueName })
+
+				queues := make([]*graphql.Object, 0, len(stats))
+				for _, qs := range stats {
+					queues = append(queues, d.graphqlQueue(qs))
+				}
+				return queues, nil
+			},
+			"queue": func(args map[string]interface{}) (interface{}, error) {
+				return d.graphqlQueueNamed(graphql.StringArg(args, "name")), nil
+			},
+			"messages": func(args map[string]interface{}) (interface{}, error) {
+				return d.graphqlMessages(graphql.StringArg(args, "queue"), args), nil
+			},
+			"message": func(args map[string]interface{}) (interface{}, error) {
+				msg, ok := d.store.GetMessage(graphql.StringArg(args, "id"))
+				if !ok {
+					return (*graphql.Object)(nil), nil
+				}
+				return d.graphqlMessage(msg), nil
+			},
+			"events": func(args map[string]interface{}) (interface{}, error) {
+				return d.graphqlEvents(graphql.StringArg(args, "queue"), "", args), nil
+			},
+		},
+	}
+}
+
+func (d *Dashboard) graphqlQueueNamed(name string) *graphql.Object {
+	for _, qs := range d.store.GetQueueStats() {
+		if qs.QueueName == name {
+			return d.graphqlQueue(qs)
+		}
+	}
+	return nil
+}
+
+func (d *Dashboard) graphqlQueue(qs store.QueueStats) *graphql.Object {
+	return &graphql.Object{
+		Type: "Queue",
+		Fields: map[string]graphql.Resolver{
+			"name":          scalar(qs.QueueName),
+			"url":           scalar(qs.QueueURL),
+			"color":         scalar(qs.Color),
+			"totalSent":     scalar(qs.TotalSent),
+			"totalReceived": scalar(qs.TotalReceived),
+			"totalDeleted":  scalar(qs.TotalDeleted),
+			"pending":       scalar(qs.Pending),
+			"inFlight":      scalar(qs.InFlight),
+			"redelivered":   scalar(qs.Redelivered),
+			"receivedOnly":  scalar(qs.ReceivedOnly),
+			"avgBodyBytes":  scalar(qs.AvgBodyBytes),
+			"maxBodyBytes":  scalar(qs.MaxBodyBytes),
+			"ackRatio":      scalar(qs.AckRatio),
+
+			"visibilityTimeout": scalar(qs.VisibilityTimeout),
+			"deadLetterQueue":   scalar(qs.DeadLetterQueue),
+			"maxReceiveCount":   scalar(qs.MaxReceiveCount),
+
+			"messages": func(args map[string]interface{}) (interface{}, error) {
+				return d.graphqlMessages(qs.QueueName, args), nil
+			},
+			"events": func(args map[string]interface{}) (interface{}, error) {
+				return d.graphqlEvents(qs.QueueName, "", args), nil
+			},
+		},
+	}
+}
+
+func (d *Dashboard) graphqlMessage(msg *store.Message) *graphql.Object {
+	return &graphql.Object{
+		Type: "Message",
+		Fields: map[string]graphql.Resolver{
+			"id":             scalar(msg.ID),
+			"messageId":      scalar(msg.MessageID),
+			"queueName":      scalar(msg.QueueName),
+			"queueUrl":       scalar(msg.QueueURL),
+			"body":           scalar(msg.Body),
+			"action":         scalar(msg.Action),
+			"timestamp":      scalar(msg.Timestamp),
+			"deleted":        scalar(msg.Deleted),
+			"deletedAt":      scalar(msg.DeletedAt),
+			"traceId":        scalar(msg.TraceID),
+			"attributes":     scalar(msg.Attributes),
+			"tags":           scalar(msg.Tags),
+			"notes":          scalar(msg.Notes),
+			"receiptHandles": scalar(msg.ReceiptHandles),
+			"receiveCount":   scalar(msg.ReceiveCount),
+
+			"systemAttributes": scalar(msg.SystemAttributes),
+
+			"messageGroupId":         scalar(msg.MessageGroupID),
+			"messageDeduplicationId": scalar(msg.MessageDeduplicationID),
+			"sequenceNumber":         scalar(msg.SequenceNumber),
+
+			"queue": func(args map[string]interface{}) (interface{}, error) {
+				return d.graphqlQueueNamed(msg.QueueName), nil
+			},
+			"events": func(args map[string]interface{}) (interface{}, error) {
+				return d.graphqlEvents("", msg.MessageID, args), nil
+			},
+		},
+	}
+}
+
+func (d *Dashboard) graphqlEvent(event *store.Message) *graphql.Object {
+	return &graphql.Object{
+		Type: "Event",
+		Fields: map[string]graphql.Resolver{
+			"id":            scalar(event.ID),
+			"action":        scalar(event.Action),
+			"messageId":     scalar(event.MessageID),
+			"queueName":     scalar(event.QueueName),
+			"receiptHandle": scalar(event.ReceiptHandle),
+			"body":          scalar(event.Body),
+			"timestamp":     scalar(event.Timestamp),
+			"traceId":       scalar(event.TraceID),
+			"session":       scalar(event.Session),
+			"operation":     scalar(event.Operation),
+			"staleHandle":   scalar(event.StaleHandle),
+			"message": func(args map[string]interface{}) (interface{}, error) {
+				msg, ok := d.store.GetMessage(event.MessageID)
+				if !ok {
+					return (*graphql.Object)(nil), nil
+				}
+				return d.graphqlMessage(msg), nil
+			},
+		},
+	}
+}
+
+// graphqlMessages returns the messages of queueName (all queues if empty),
+// most recent first, limited by the limit and includeDeleted arguments.
+func (d *Dashboard) graphqlMessages(queueName string, args map[string]interface{}) []*graphql.Object {
+	messages := d.store.GetMessages(queueName, graphql.BoolArg(args, "includeDeleted"))
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Timestamp.After(messages[j].Timestamp)
+	})
+
+	limit := graphql.IntArg(args, "limit", 100)
+	objects := make([]*graphql.Object, 0, max(0, min(limit, len(messages))))
+	for _, msg := range messages {
+		if len(objects) >= limit {
+			break
+		}
+		objects = append(objects, d.graphqlMessage(msg))
+	}
+	return objects
+}
+
+// graphqlEvents returns history events, most recent first, optionally only
+// those of queueName or messageID.
+func (d *Dashboard) graphqlEvents(queueName, messageID string, args map[string]interface{}) []*graphql.Object {
+	limit := graphql.IntArg(args, "limit", 100)
+
+	var objects []*graphql.Object
+	for _, event := range d.store.GetHistory(0) {
+		if len(objects) >= limit {
+			break
+		}
+		if queueName != "" && event.QueueName != queueName {
+			continue
+		}
+		if messageID != "" && event.MessageID != messageID {
+			continue
+		}
+		objects = append(objects, d.graphqlEvent(event))
+	}
+	if objects == nil {
+		objects = []*graphql.Object{}
+	}
+	return objects
+}
+
+// scalar returns a resolver for a fixed value.
+func scalar(v interface{}) graphql.Resolver {
+	return func(map[string]interface{}) (interface{}, error) {
+		return v, nil
+	}
+}
@@ -0,0 +1,172 @@
+package dashboard
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+// HAR 1.2 document types. Only the fields the relay can populate are
+// included; see http://www.softwareishard.com/blog/har-12-spec/.
+
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func (d *Dashboard) handleHAR(w http.ResponseWriter, r *http.Request) {
+	if !d.store.RecordsExchanges() {
+		http.Error(w, "HAR recording is disabled; set AWS_RELAY_HAR=true", http.StatusNotFound)
+		return
+	}
+
+	exchanges := d.store.GetExchanges()
+	doc := harDocument{
+		Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: "aws-relay", Version: "1.0"},
+			Entries: make([]harEntry, 0, len(exchanges)),
+		},
+	}
+	for _, ex := range exchanges {
+		doc.Log.Entries = append(doc.Log.Entries, newHAREntry(ex))
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="aws-relay.har"`)
+	writeJSON(w, doc)
+}
+
+func newHAREntry(ex store.Exchange) harEntry {
+	ms := float64(ex.Duration) / float64(time.Millisecond)
+
+	req := harRequest{
+		Method:      ex.Method,
+		URL:         ex.URL,
+		HTTPVersion: ex.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(ex.RequestHeaders),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(ex.RequestBody),
+	}
+	if ex.RequestBody != "" {
+		req.PostData = &harPostData{
+			MimeType: ex.RequestHeaders.Get("Content-Type"),
+			Text:     ex.RequestBody,
+		}
+	}
+
+	return harEntry{
+		StartedDateTime: ex.StartedAt.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request:         req,
+		Response: harResponse{
+			Status:      ex.Status,
+			StatusText:  ex.StatusText,
+			HTTPVersion: ex.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(ex.ResponseHeaders),
+			Content: harContent{
+				Size:     len(ex.ResponseBody),
+				MimeType: ex.ResponseHeaders.Get("Content-Type"),
+				Text:     ex.ResponseBody,
+			},
+			HeadersSize: -1,
+			BodySize:    len(ex.ResponseBody),
+		},
+		Timings: harTimings{Wait: ms},
+	}
+}
+
+// harRedacted lists, in canonical form, the headers whose values are
+// credentials. HAR files get shared, so their values are replaced.
+var harRedacted = map[string]bool{
+	"Authorization":        true,
+	"X-Amz-Security-Token": true,
+}
+
+const harRedactedValue = "[redacted]"
+
+func harHeaders(h http.Header) []harNameValue {
+	headers := make([]harNameValue, 0, len(h))
+	for name, values := range h {
+		redact := harRedacted[http.CanonicalHeaderKey(name)]
+		for _, v := range values {
+			if redact {
+				v = harRedactedValue
+			}
+			headers = append(headers, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool {
+		return headers[i].Name < headers[j].Name
+	})
+	return headers
+}
@@ -0,0 +1,142 @@
+package dashboard
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+func TestHARRedactsCredentials(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	s.SetExchangeRecording(true)
+
+	const secret = "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240102/us-east-1/sqs/aws4_request"
+	const token = "FwoGZXIvYXdzEXAMPLETOKEN"
+	s.RecordExchange(store.Exchange{
+		Method: http.MethodPost,
+		URL:    "http://localhost:4566/",
+		Proto:  "HTTP/1.1",
+		RequestHeaders: http.Header{
+			"Authorization":        {secret},
+			"X-Amz-Security-Token": {token},
+			"X-Amz-Target":         {"AmazonSQS.SendMessage"},
+		},
+		Status:          http.StatusOK,
+		ResponseHeaders: http.Header{"Content-Type": {"application/x-amz-json-1.0"}},
+	})
+
+	var doc harDocument
+	resp := getJSON(t, srv, "/api/har", &doc)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if len(doc.Log.Entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(doc.Log.Entries))
+	}
+
+	headers := map[string]string{}
+	for _, h := range doc.Log.Entries[0].Request.Headers {
+		headers[h.Name] = h.Value
+	}
+	for _, name := range []string{"Authorization", "X-Amz-Security-Token"} {
+		if headers[name] != harRedactedValue {
+			t.Errorf("%s = %q, want it redacted", name, headers[name])
+		}
+	}
+	if headers["X-Amz-Target"] != "AmazonSQS.SendMessage" {
+		t.Errorf("X-Amz-Target = %q, want it kept", headers["X-Amz-Target"])
+	}
+}
+
+func TestHARHeadersRedactAnyCase(t *testing.T) {
+	headers := harHeaders(http.Header{"authorization": {"secret"}, "x-amz-security-token": {"token"}})
+	for _, h := range headers {
+		if strings.Contains(h.Value, "secret") || strings.Contains(h.Value, "token") {
+			t.Errorf("%s = %q, want it redacted", h.Name, h.Value)
+		}
+	}
+}
+
+func TestHARDocumentShape(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	s.SetExchangeRecording(true)
+	s.RecordExchange(store.Exchange{
+		StartedAt:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:        1500 * time.Microsecond,
+		Method:          http.MethodPost,
+		URL:             "http://localhost:4566/",
+		Proto:           "HTTP/1.1",
+		RequestHeaders:  http.Header{"Content-Type": {"application/x-amz-json-1.0"}},
+		RequestBody:     `{"QueueUrl":"q","MessageBody":"hi"}`,
+		Status:          http.StatusOK,
+		StatusText:      "OK",
+		ResponseHeaders: http.Header{"Content-Type": {"application/x-amz-json-1.0"}},
+		ResponseBody:    `{"MessageId":"m-1"}`,
+	})
+
+	// Decoded generically, so the JSON names are checked rather than this
+	// package's structs
+	var doc map[string]interface{}
+	getJSON(t, srv, "/api/har", &doc)
+	root, _ := doc["log"].(map[string]interface{})
+	if root == nil {
+		t.Fatalf("no log in %v", doc)
+	}
+	if root["version"] != "1.2" {
+		t.Errorf("log.version = %v, want 1.2", root["version"])
+	}
+	creator, _ := root["creator"].(map[string]interface{})
+	if creator["name"] != "aws-relay" || creator["version"] == "" || creator["version"] == nil {
+		t.Errorf("log.creator = %v", root["creator"])
+	}
+	entries, _ := root["entries"].([]interface{})
+	if len(entries) != 1 {
+		t.Fatalf("log.entries = %v, want one entry", root["entries"])
+	}
+	entry := entries[0].(map[string]interface{})
+
+	tests := []struct {
+		object string
+		keys   []string
+	}{
+		{"entry", []string{"startedDateTime", "time", "request", "response", "cache", "timings"}},
+		{"request", []string{"method", "url", "httpVersion", "cookies", "headers", "queryString", "postData", "headersSize", "bodySize"}},
+		{"response", []string{"status", "statusText", "httpVersion", "cookies", "headers", "content", "redirectURL", "headersSize", "bodySize"}},
+		{"timings", []string{"send", "wait", "receive"}},
+	}
+	for _, tt := range tests {
+		obj := entry
+		if tt.object != "entry" {
+			obj, _ = entry[tt.object].(map[string]interface{})
+		}
+		for _, key := range tt.keys {
+			if _, ok := obj[key]; !ok {
+				t.Errorf("%s has no %s: %v", tt.object, key, obj)
+			}
+		}
+	}
+
+	request := entry["request"].(map[string]interface{})
+	response := entry["response"].(map[string]interface{})
+	content, _ := response["content"].(map[string]interface{})
+	postData, _ := request["postData"].(map[string]interface{})
+	for _, c := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"startedDateTime", entry["startedDateTime"], "2024-01-02T03:04:05Z"},
+		{"time", entry["time"], 1.5},
+		{"request.method", request["method"], "POST"},
+		{"request.postData.text", postData["text"], `{"QueueUrl":"q","MessageBody":"hi"}`},
+		{"response.status", response["status"], float64(http.StatusOK)},
+		{"response.content.text", content["text"], `{"MessageId":"m-1"}`},
+		{"timings.wait", entry["timings"].(map[string]interface{})["wait"], 1.5},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"aws-relay/internal/proxy"
+)
+
+// handleHealthz is the liveness probe: it answers 200 whenever the process
+// is serving.
+func (d *Dashboard) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// readiness is the body of /readyz.
+type readiness struct {
+	Status       string               `json:"status"`
+	Upstream     proxy.UpstreamStatus `json:"upstream"`
+	LastActivity *time.Time           `json:"lastActivity,omitempty"`
+}
+
+// handleReadyz is the readiness probe: it answers 200 if the upstream
+// accepts connections and 503 otherwise, so docker-compose can hold back
+// services that depend on the relay until it can forward their calls.
+func (d *Dashboard) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ready := readiness{
+		Status:   "ready",
+		Upstream: d.proxy.CheckUpstream(r.Context(), proxy.DefaultReadinessTimeout),
+	}
+	if last := d.store.LastActivity(); !last.IsZero() {
+		ready.LastActivity = &last
+	}
+
+	if !ready.Upstream.Reachable {
+		ready.Status = "unavailable"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ready)
+		return
+	}
+	writeJSON(w, ready)
+}
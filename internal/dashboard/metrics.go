@@ -0,0 +1,67 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"aws-relay/internal/store"
+)
+
+// messageMetrics are the per-queue message counters exported alongside
+// aws_relay_events_total, one per message-level action.
+var messageMetrics = []struct {
+	action store.MessageAction
+	name   string
+	help   string
+}{
+	{store.ActionSend, "aws_relay_messages_sent_total", "Messages sent by queue since the relay started."},
+	{store.ActionReceive, "aws_relay_messages_received_total", "Messages received by queue since the relay started."},
+	{store.ActionDelete, "aws_relay_messages_deleted_total", "Messages deleted by queue since the relay started."},
+}
+
+// handleMetrics serves the cumulative event counters in the Prometheus text
+// exposition format. They only reset when the relay restarts, not on Clear,
+// so rate() and increase() stay correct across dashboard clears. The pending
+// gauge does follow Clear, like the dashboard stats.
+func (d *Dashboard) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	counters := d.store.GetCounters()
+
+	fmt.Fprintln(w, "# HELP aws_relay_events_total Captured SQS events by queue and action since the relay started.")
+	fmt.Fprintln(w, "# TYPE aws_relay_events_total counter")
+	for _, c := range counters {
+		fmt.Fprintf(w, "aws_relay_events_total{queue=\"%s\",action=\"%s\"} %d\n", escapeLabel(c.QueueName), escapeLabel(string(c.Action)), c.Value)
+	}
+
+	for _, m := range messageMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", m.name)
+		for _, c := range counters {
+			if c.Action == m.action {
+				fmt.Fprintf(w, "%s{queue=\"%s\"} %d\n", m.name, escapeLabel(c.QueueName), c.Value)
+			}
+		}
+	}
+
+	pending := d.store.GetPendingCounts()
+	queues := make([]string, 0, len(pending))
+	for queueName := range pending {
+		queues = append(queues, queueName)
+	}
+	sort.Strings(queues)
+
+	fmt.Fprintln(w, "# HELP aws_relay_messages_pending Captured messages sent or received but not yet deleted, by queue.")
+	fmt.Fprintln(w, "# TYPE aws_relay_messages_pending gauge")
+	for _, queueName := range queues {
+		fmt.Fprintf(w, "aws_relay_messages_pending{queue=\"%s\"} %d\n", escapeLabel(queueName), pending[queueName])
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
@@ -0,0 +1,60 @@
+package dashboard
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"aws-relay/internal/store"
+)
+
+// getMetrics returns the lines of the /metrics page.
+func getMetrics(t *testing.T, url string) []string {
+	t.Helper()
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(string(body), "\n")
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	s.RecordSend(store.Meta{}, ordersURL, "orders", "m-1", "one", nil, nil)
+	s.RecordSend(store.Meta{}, ordersURL, "orders", "m-2", "two", nil, nil)
+	s.RecordReceive(store.Meta{}, ordersURL, "orders", "m-1", "r-1", "one", nil, nil)
+	s.RecordDelete(store.Meta{}, ordersURL, "orders", "r-1")
+	s.RecordSend(store.Meta{}, "", `say "hi"`, "m-3", "three", nil, nil)
+
+	lines := getMetrics(t, srv.URL)
+	for _, want := range []string{
+		"# TYPE aws_relay_events_total counter",
+		`aws_relay_events_total{queue="orders",action="send"} 2`,
+		`aws_relay_messages_sent_total{queue="orders"} 2`,
+		`aws_relay_messages_received_total{queue="orders"} 1`,
+		`aws_relay_messages_deleted_total{queue="orders"} 1`,
+		"# TYPE aws_relay_messages_pending gauge",
+		`aws_relay_messages_pending{queue="orders"} 1`,
+		`aws_relay_messages_pending{queue="say \"hi\""} 1`,
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
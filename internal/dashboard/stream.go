@@ -0,0 +1,62 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// streamKeepalive is how often an idle event stream sends a comment, so
+// proxies and browsers don't time the connection out.
+const streamKeepalive = 15 * time.Second
+
+// handleStream serves history events as Server-Sent Events as they are
+// recorded. A client that falls too far behind is evicted by the store; the
+// stream then ends with an "evicted" event and the client should reload.
+func (d *Dashboard) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// The stream is meant to stay open, so it is exempt from the server's
+	// write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	sub := d.store.Subscribe(0)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Evicted() {
+					fmt.Fprint(w, "event: evicted\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
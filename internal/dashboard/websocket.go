@@ -0,0 +1,211 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"aws-relay/internal/store"
+	"aws-relay/internal/websocket"
+)
+
+// WebSocket frames on /ws are JSON text messages with a "type" field.
+//
+// The server sends:
+//
+//	{"type":"status","paused":false,"faultsEnabled":true,"filter":{...}}
+//	    on connect and in answer to every command
+//	{"type":"event","event":{...}}
+//	    a history event, as served by /api/history, that passes the filter
+//	{"type":"error","error":"unknown command \"x\""}
+//	    a command was rejected; the connection stays open
+//	{"type":"evicted"}
+//	    the client fell too far behind and should reload; the server then
+//	    closes the connection
+//
+// The client sends commands:
+//
+//	{"type":"pause"}                  pause capture for every client
+//	{"type":"resume"}                 resume capture
+//	{"type":"faults","enabled":false} switch fault injection off or on
+//	{"type":"filter","filter":{"queue":"orders","action":"send"}}
+//	    only stream this connection events matching every set field of
+//	    queue, action, service, session and topic; an empty filter streams
+//	    everything
+//
+// Pause and fault injection are relay-wide, affecting every client and the
+// REST API alike; the filter only applies to the connection that set it.
+// Browser pages may only connect from the dashboard's own origin or the CORS
+// origin.
+
+// wsKeepalive is how often an idle WebSocket is pinged, so proxies don't
+// time the connection out.
+const wsKeepalive = 15 * time.Second
+
+// wsFilter selects the events a WebSocket client is sent.
+type wsFilter struct {
+	Queue   string `json:"queue,omitempty"`
+	Action  string `json:"action,omitempty"`
+	Service string `json:"service,omitempty"`
+	Session string `json:"session,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+}
+
+func (f wsFilter) messageFilter() store.MessageFilter {
+	return store.MessageFilter{
+		QueueName: f.Queue,
+		Action:    store.MessageAction(f.Action),
+		Service:   f.Service,
+		Session:   f.Session,
+		Topic:     f.Topic,
+	}
+}
+
+// wsCommand is a control message from a WebSocket client.
+type wsCommand struct {
+	Type    string   `json:"type"`
+	Enabled *bool    `json:"enabled,omitempty"`
+	Filter  wsFilter `json:"filter"`
+}
+
+// wsFrame is a message to a WebSocket client.
+type wsFrame struct {
+	Type string `json:"type"`
+
+	Event *store.Message `json:"event,omitempty"`
+	Error string         `json:"error,omitempty"`
+
+	Paused        *bool     `json:"paused,omitempty"`
+	FaultsEnabled *bool     `json:"faultsEnabled,omitempty"`
+	Filter        *wsFilter `json:"filter,omitempty"`
+}
+
+// handleWebSocket streams history events over a WebSocket as they are
+// recorded, like /api/stream, and takes control commands from the client.
+// Each connection has its own store subscription, closed when the socket
+// closes.
+func (d *Dashboard) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Browsers let any page open a WebSocket, so without this check a
+	// cross-site page could pause capture
+	if !d.originAllowed(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+
+	sub := d.store.Subscribe(0)
+	defer sub.Close()
+
+	// Read commands until the client leaves; done stops the reader if the
+	// server leaves first
+	commands := make(chan []byte)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			data, err := conn.Read()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case commands <- data:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var filter wsFilter
+	send := func(frame wsFrame) bool {
+		data, err := json.Marshal(frame)
+		if err != nil {
+			return true
+		}
+		return conn.WriteText(data) == nil
+	}
+	status := func() wsFrame {
+		paused, faults := d.proxy.Paused(), d.proxy.FaultsEnabled()
+		current := filter
+		return wsFrame{Type: "status", Paused: &paused, FaultsEnabled: &faults, Filter: &current}
+	}
+	if !send(status()) {
+		return
+	}
+
+	keepalive := time.NewTicker(wsKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			conn.Close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case err := <-readErr:
+			if !errors.Is(err, websocket.ErrClosed) && !errors.Is(err, io.EOF) {
+				log.Printf("WebSocket client %s: %v", r.RemoteAddr, err)
+			}
+			return
+		case <-keepalive.C:
+			if conn.Ping() != nil {
+				return
+			}
+		case data := <-commands:
+			var cmd wsCommand
+			if err := json.Unmarshal(data, &cmd); err != nil {
+				if !send(wsFrame{Type: "error", Error: "invalid command: " + err.Error()}) {
+					return
+				}
+				continue
+			}
+			switch cmd.Type {
+			case "pause":
+				d.proxy.SetPaused(true)
+			case "resume":
+				d.proxy.SetPaused(false)
+			case "faults":
+				if cmd.Enabled == nil {
+					if !send(wsFrame{Type: "error", Error: `faults command needs "enabled"`}) {
+						return
+					}
+					continue
+				}
+				d.proxy.SetFaultsEnabled(*cmd.Enabled)
+			case "filter":
+				filter = cmd.Filter
+			default:
+				if !send(wsFrame{Type: "error", Error: "unknown command " + strconv.Quote(cmd.Type)}) {
+					return
+				}
+				continue
+			}
+			if !send(status()) {
+				return
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				if sub.Evicted() {
+					send(wsFrame{Type: "evicted"})
+					conn.Close(websocket.CloseGoingAway, "evicted")
+				}
+				return
+			}
+			if !filter.messageFilter().Matches(&event) {
+				continue
+			}
+			if !send(wsFrame{Type: "event", Event: &event}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package dashboard
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-relay/internal/proxy"
+	"aws-relay/internal/store"
+)
+
+// newTestDashboard returns a dashboard over a fresh store and a proxy whose
+// upstream is never called, served by a test server.
+func newTestDashboard(t *testing.T) (*Dashboard, *store.Store, *proxy.Proxy, *httptest.Server) {
+	t.Helper()
+	s := store.New()
+	p := proxy.New("http://127.0.0.1:1", s)
+	d := New(s, p)
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	return d, s, p, srv
+}
+
+// wsClient is the client end of a WebSocket to a test server.
+type wsClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialWebSocket opens /ws on srv with the extra request headers, returning
+// the handshake response and, if it succeeded, the client.
+func dialWebSocket(t *testing.T, srv *httptest.Server, header http.Header) (*http.Response, *wsClient) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp, nil
+	}
+	return resp, &wsClient{t: t, conn: conn, reader: reader}
+}
+
+// send writes v as a masked text frame, as clients must.
+func (c *wsClient) send(v interface{}) {
+	c.t.Helper()
+	payload, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.sendText(payload)
+}
+
+// sendText writes payload as a masked text frame.
+func (c *wsClient) sendText(payload []byte) {
+	c.t.Helper()
+	if len(payload) > 125 {
+		c.t.Fatalf("test frame of %d bytes too long", len(payload))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame := []byte{0x81, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readRaw returns the opcode and payload of the next frame from the server.
+func (c *wsClient) readRaw() (byte, []byte) {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// read returns the next JSON frame from the server.
+func (c *wsClient) read() wsFrame {
+	c.t.Helper()
+	opcode, payload := c.readRaw()
+	if opcode != 0x1 {
+		c.t.Fatalf("got opcode %#x (%q), want a text frame", opcode, payload)
+	}
+	var frame wsFrame
+	if err := json.Unmarshal(payload, &frame); err != nil {
+		c.t.Fatalf("frame %q: %v", payload, err)
+	}
+	return frame
+}
+
+func TestWebSocketOriginCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		corsOrigin string
+		origin     string
+		want       int
+	}{
+		{"no origin", CORSDisabled, "", http.StatusSwitchingProtocols},
+		{"same origin", CORSDisabled, "SAME", http.StatusSwitchingProtocols},
+		{"cross origin, CORS disabled", CORSDisabled, "http://evil.example", http.StatusForbidden},
+		{"CORS origin", "http://localhost:3000", "http://localhost:3000", http.StatusSwitchingProtocols},
+		{"other origin", "http://localhost:3000", "http://evil.example", http.StatusForbidden},
+		{"any origin", "*", "http://evil.example", http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _, _, srv := newTestDashboard(t)
+			d.SetCORSOrigin(tt.corsOrigin)
+
+			header := http.Header{}
+			if tt.origin == "SAME" {
+				header.Set("Origin", srv.URL)
+			} else if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			resp, client := dialWebSocket(t, srv, header)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if client != nil {
+				if frame := client.read(); frame.Type != "status" {
+					t.Errorf("first frame %+v, want status", frame)
+				}
+			}
+		})
+	}
+}
+
+func TestWebSocketCommands(t *testing.T) {
+	_, _, p, srv := newTestDashboard(t)
+	_, client := dialWebSocket(t, srv, nil)
+	if frame := client.read(); frame.Type != "status" || *frame.Paused || !*frame.FaultsEnabled {
+		t.Fatalf("first frame %+v, want an unpaused status", frame)
+	}
+
+	tests := []struct {
+		name          string
+		command       string
+		wantType      string
+		wantPaused    bool
+		wantFaults    bool
+		wantErrorPart string
+	}{
+		{"pause", `{"type":"pause"}`, "status", true, true, ""},
+		{"faults off", `{"type":"faults","enabled":false}`, "status", true, false, ""},
+		{"resume", `{"type":"resume"}`, "status", false, false, ""},
+		{"faults on", `{"type":"faults","enabled":true}`, "status", false, true, ""},
+		{"faults without enabled", `{"type":"faults"}`, "error", false, true, "enabled"},
+		{"unknown command", `{"type":"reboot"}`, "error", false, true, "unknown command"},
+		{"invalid JSON", `{"type":`, "error", false, true, "invalid command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.sendText([]byte(tt.command))
+			frame := client.read()
+			if frame.Type != tt.wantType {
+				t.Fatalf("frame %+v, want type %s", frame, tt.wantType)
+			}
+			if tt.wantType == "error" && !strings.Contains(frame.Error, tt.wantErrorPart) {
+				t.Errorf("error %q, want it to mention %q", frame.Error, tt.wantErrorPart)
+			}
+			if tt.wantType == "status" && (*frame.Paused != tt.wantPaused || *frame.FaultsEnabled != tt.wantFaults) {
+				t.Errorf("status paused=%v faults=%v, want %v, %v", *frame.Paused, *frame.FaultsEnabled, tt.wantPaused, tt.wantFaults)
+			}
+			if p.Paused() != tt.wantPaused || p.FaultsEnabled() != tt.wantFaults {
+				t.Errorf("proxy paused=%v faults=%v, want %v, %v", p.Paused(), p.FaultsEnabled(), tt.wantPaused, tt.wantFaults)
+			}
+		})
+	}
+}
+
+func TestWebSocketStreamsFilteredEvents(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	_, client := dialWebSocket(t, srv, nil)
+	client.read() // status
+
+	s.RecordSend(store.Meta{}, "", "orders", "m-1", "first", nil, nil)
+	if frame := client.read(); frame.Type != "event" || frame.Event.MessageID != "m-1" {
+		t.Fatalf("frame %+v, want the m-1 event", frame)
+	}
+
+	client.send(wsCommand{Type: "filter", Filter: wsFilter{Queue: "billing"}})
+	if frame := client.read(); frame.Type != "status" || frame.Filter.Queue != "billing" {
+		t.Fatalf("frame %+v, want a status with the filter", frame)
+	}
+
+	// Only the billing event gets through
+	s.RecordSend(store.Meta{}, "", "orders", "m-2", "second", nil, nil)
+	s.RecordSend(store.Meta{}, "", "billing", "m-3", "third", nil, nil)
+	if frame := client.read(); frame.Type != "event" || frame.Event.MessageID != "m-3" {
+		t.Fatalf("frame %+v, want the m-3 event", frame)
+	}
+}
+
+func TestWebSocketUnsubscribesOnClose(t *testing.T) {
+	_, s, _, srv := newTestDashboard(t)
+	_, client := dialWebSocket(t, srv, nil)
+	client.read() // status
+	if active := s.GetSubscriberStats().Active; active != 1 {
+		t.Fatalf("active subscribers = %d, want 1", active)
+	}
+
+	// A close frame from the client is answered in kind
+	client.conn.Write([]byte{0x88, 0x82, 0, 0, 0, 0, 0x03, 0xE8})
+	if opcode, _ := client.readRaw(); opcode != 0x8 {
+		t.Errorf("got opcode %#x, want a close frame", opcode)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.GetSubscriberStats().Active != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription still active after the socket closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
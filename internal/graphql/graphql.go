@@ -0,0 +1,191 @@
+// Package graphql executes read-only GraphQL queries against a schema built
+// from resolver functions. It covers the query subset dashboard clients
+// need: nested selections, aliases, arguments and variables.
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Resolver produces the value of a field given its arguments. The value is
+// a scalar (anything encoding/json accepts), an *Object, a []*Object, or nil.
+type Resolver func(args map[string]interface{}) (interface{}, error)
+
+// Object is a value of an object type: its type name and the resolvers of
+// the fields that may be selected on it.
+type Object struct {
+	Type   string
+	Fields map[string]Resolver
+}
+
+// Error is a GraphQL error, located by the response path of the failed
+// field when there is one.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response is a GraphQL response document.
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// Execute runs query against root, the Query object. A field whose resolver
+// fails is returned as null with an entry in Errors; a query that does not
+// parse yields no data at all.
+func Execute(query string, variables map[string]interface{}, root *Object) Response {
+	fields, err := Parse(query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	e := &executor{variables: variables}
+	data := e.object(root, fields, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+type executor struct {
+	variables map[string]interface{}
+	errors    []Error
+}
+
+func (e *executor) fail(path []interface{}, format string, args ...interface{}) {
+	e.errors = append(e.errors, Error{
+		Message: fmt.Sprintf(format, args...),
+		Path:    append([]interface{}(nil), path...),
+	})
+}
+
+func (e *executor) object(obj *Object, fields []Field, path []interface{}) result {
+	out := make(result, 0, len(fields))
+	for _, f := range fields {
+		fieldPath := append(path, f.key())
+
+		if f.Name == "__typename" {
+			out = append(out, resultField{f.key(), obj.Type})
+			continue
+		}
+
+		resolve, ok := obj.Fields[f.Name]
+		if !ok {
+			e.fail(fieldPath, "cannot query field %q on type %s", f.Name, obj.Type)
+			out = append(out, resultField{f.key(), nil})
+			continue
+		}
+
+		value, err := resolve(e.args(f.Args))
+		if err != nil {
+			e.fail(fieldPath, "%v", err)
+			out = append(out, resultField{f.key(), nil})
+			continue
+		}
+		out = append(out, resultField{f.key(), e.value(value, f, fieldPath)})
+	}
+	return out
+}
+
+func (e *executor) value(value interface{}, f Field, path []interface{}) interface{} {
+	switch v := value.(type) {
+	case *Object:
+		if v == nil {
+			return nil
+		}
+		if len(f.Selections) == 0 {
+			e.fail(path, "field %q of type %s must have a selection of subfields", f.Name, v.Type)
+			return nil
+		}
+		return e.object(v, f.Selections, path)
+	case []*Object:
+		list := make([]interface{}, 0, len(v))
+		for i, item := range v {
+			list = append(list, e.value(item, f, append(path, i)))
+		}
+		return list
+	default:
+		if len(f.Selections) > 0 {
+			e.fail(path, "field %q is a scalar and has no subfields", f.Name)
+			return nil
+		}
+		return value
+	}
+}
+
+// args substitutes variable references in a field's arguments.
+func (e *executor) args(args map[string]interface{}) map[string]interface{} {
+	resolved := make(map[string]interface{}, len(args))
+	for name, v := range args {
+		resolved[name] = e.resolveVariables(v)
+	}
+	return resolved
+}
+
+func (e *executor) resolveVariables(v interface{}) interface{} {
+	switch v := v.(type) {
+	case variable:
+		value := e.variables[string(v)]
+		// JSON numbers arrive as float64; integral ones are Ints
+		if f, ok := value.(float64); ok && f == float64(int(f)) {
+			return int(f)
+		}
+		return value
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.resolveVariables(item)
+		}
+		return list
+	}
+	return v
+}
+
+// result is an object in the response, keeping fields in query order.
+type result []resultField
+
+type resultField struct {
+	key   string
+	value interface{}
+}
+
+func (r result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// StringArg returns the string argument name, or "" if it is absent or not
+// a string.
+func StringArg(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+// IntArg returns the integer argument name, or def if it is absent.
+func IntArg(args map[string]interface{}, name string, def int) int {
+	if n, ok := args[name].(int); ok {
+		return n
+	}
+	return def
+}
+
+// BoolArg returns the boolean argument name, or false if it is absent.
+func BoolArg(args map[string]interface{}, name string) bool {
+	b, _ := args[name].(bool)
+	return b
+}
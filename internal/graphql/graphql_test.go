@@ -0,0 +1,135 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testSchema has queues with pending counts and numbered messages.
+func testSchema() *Object {
+	message := func(id int) *Object {
+		return &Object{Type: "Message", Fields: map[string]Resolver{
+			"id":   func(map[string]interface{}) (interface{}, error) { return fmt.Sprintf("m-%d", id), nil },
+			"body": func(map[string]interface{}) (interface{}, error) { return "body", nil },
+		}}
+	}
+	queue := func(name string, pending int) *Object {
+		return &Object{Type: "Queue", Fields: map[string]Resolver{
+			"name":    func(map[string]interface{}) (interface{}, error) { return name, nil },
+			"pending": func(map[string]interface{}) (interface{}, error) { return pending, nil },
+			"messages": func(args map[string]interface{}) (interface{}, error) {
+				var messages []*Object
+				for i := 1; i <= IntArg(args, "limit", pending) && i <= pending; i++ {
+					messages = append(messages, message(i))
+				}
+				return messages, nil
+			},
+		}}
+	}
+	queues := map[string]*Object{"orders": queue("orders", 3), "audit": queue("audit", 0)}
+
+	return &Object{Type: "Query", Fields: map[string]Resolver{
+		"queue": func(args map[string]interface{}) (interface{}, error) {
+			if q, ok := queues[StringArg(args, "name")]; ok {
+				return q, nil
+			}
+			return (*Object)(nil), nil
+		},
+		"queues": func(map[string]interface{}) (interface{}, error) {
+			return []*Object{queues["audit"], queues["orders"]}, nil
+		},
+		"echo": func(args map[string]interface{}) (interface{}, error) {
+			return args, nil
+		},
+		"fail": func(map[string]interface{}) (interface{}, error) {
+			return nil, errors.New("resolver failed")
+		},
+	}}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      string
+	}{
+		{"shorthand query", `{ queue(name: "orders") { name pending } }`, nil,
+			`{"data":{"queue":{"name":"orders","pending":3}}}`},
+		{"named query with variables", `query Q($name: String!, $limit: Int = 1) { queue(name: $name) { messages(limit: $limit) { id } } }`,
+			map[string]interface{}{"name": "orders", "limit": 2.0},
+			`{"data":{"queue":{"messages":[{"id":"m-1"},{"id":"m-2"}]}}}`},
+		{"aliases keep query order", `{ b: queue(name: "audit") { name } a: queue(name: "orders") { name } }`, nil,
+			`{"data":{"b":{"name":"audit"},"a":{"name":"orders"}}}`},
+		{"lists of objects", `{ queues { name, pending } }`, nil,
+			`{"data":{"queues":[{"name":"audit","pending":0},{"name":"orders","pending":3}]}}`},
+		{"typename", `{ queue(name: "orders") { __typename } }`, nil,
+			`{"data":{"queue":{"__typename":"Queue"}}}`},
+		{"null object", `{ queue(name: "missing") { name } }`, nil,
+			`{"data":{"queue":null}}`},
+		{"argument values", `{ echo(s: "a\"b", i: -2, f: 1.5, b: true, n: null, e: ASC, l: [1 "x" $v]) }`,
+			map[string]interface{}{"v": 3.0},
+			`{"data":{"echo":{"b":true,"e":"ASC","f":1.5,"i":-2,"l":[1,"x",3],"n":null,"s":"a\"b"}}}`},
+		{"comments are ignored", "{\n  # pending only\n  queue(name: \"audit\") { pending }\n}", nil,
+			`{"data":{"queue":{"pending":0}}}`},
+		{"failed resolver", `{ ok: queue(name: "audit") { name } fail }`, nil,
+			`{"data":{"ok":{"name":"audit"},"fail":null},"errors":[{"message":"resolver failed","path":["fail"]}]}`},
+		{"unknown field", `{ queue(name: "orders") { color } }`, nil,
+			`{"data":{"queue":{"color":null}},"errors":[{"message":"cannot query field \"color\" on type Queue","path":["queue","color"]}]}`},
+		{"object without selection", `{ queue(name: "orders") }`, nil,
+			`{"data":{"queue":null},"errors":[{"message":"field \"queue\" of type Queue must have a selection of subfields","path":["queue"]}]}`},
+		{"scalar with selection", `{ queue(name: "orders") { name { x } } }`, nil,
+			`{"data":{"queue":{"name":null}},"errors":[{"message":"field \"name\" is a scalar and has no subfields","path":["queue","name"]}]}`},
+		{"list item path", `{ queues { messages { nope } } }`, nil,
+			`{"data":{"queues":[{"messages":[]},{"messages":[{"nope":null},{"nope":null},{"nope":null}]}]},"errors":[` +
+				`{"message":"cannot query field \"nope\" on type Message","path":["queues",1,"messages",0,"nope"]},` +
+				`{"message":"cannot query field \"nope\" on type Message","path":["queues",1,"messages",1,"nope"]},` +
+				`{"message":"cannot query field \"nope\" on type Message","path":["queues",1,"messages",2,"nope"]}]}`},
+		{"mutation", `mutation { queue }`, nil,
+			`{"data":null,"errors":[{"message":"unsupported operation \"mutation\""}]}`},
+		{"empty selection", `{ }`, nil,
+			`{"data":null,"errors":[{"message":"syntax error at offset 3: empty selection set"}]}`},
+		{"unclosed selection", `{ queue(name: "orders") { name }`, nil,
+			`{"data":null,"errors":[{"message":"syntax error at offset 32: expected field name, got \"\""}]}`},
+		{"unterminated string", `{ queue(name: "orders) { name } }`, nil,
+			`{"data":null,"errors":[{"message":"syntax error at offset 14: unterminated string"}]}`},
+		{"trailing input", `{ queues { name } } }`, nil,
+			`{"data":null,"errors":[{"message":"syntax error at offset 20: unexpected \"}\" after query"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := Execute(tt.query, tt.variables, testSchema())
+			got, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgHelpers(t *testing.T) {
+	args := map[string]interface{}{"s": "text", "i": 3, "b": true, "f": 1.5}
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"StringArg", StringArg(args, "s"), "text"},
+		{"StringArg of another type", StringArg(args, "i"), ""},
+		{"StringArg absent", StringArg(args, "x"), ""},
+		{"IntArg", IntArg(args, "i", 7), 3},
+		{"IntArg of another type", IntArg(args, "f", 7), 7},
+		{"IntArg absent", IntArg(args, "x", 7), 7},
+		{"BoolArg", BoolArg(args, "b"), true},
+		{"BoolArg absent", BoolArg(args, "x"), false},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Field is one selection of a query: a field with its arguments and, for
+// object-valued fields, its own selection set.
+type Field struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Selections []Field
+}
+
+// key is the name the field's value is returned under.
+func (f Field) key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// variable is an argument value referring to a query variable, resolved at
+// execution time.
+type variable string
+
+// Parse parses a query document containing a single query operation, in
+// either shorthand ({ ... }) or named (query Name($v: Type) { ... }) form.
+// Fragments, directives and mutations are not supported.
+func Parse(query string) ([]Field, error) {
+	p := &parser{lex: lexer{src: query}}
+	p.next()
+
+	if p.tok.kind == tokName {
+		if p.tok.text != "query" {
+			return nil, fmt.Errorf("unsupported operation %q", p.tok.text)
+		}
+		p.next()
+		if p.tok.kind == tokName {
+			p.next()
+		}
+		if p.tok.is("(") {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fields, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q after query", p.tok.text)
+	}
+	return fields, nil
+}
+
+type parser struct {
+	lex lexer
+	tok token
+	err error
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		p.tok = token{kind: tokEOF}
+		return
+	}
+	p.tok, p.err = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf("syntax error at offset %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.tok.is(punct) {
+		return p.errorf("expected %q, got %q", punct, p.tok.text)
+	}
+	p.next()
+	return nil
+}
+
+// skipVariableDefinitions skips ($name: Type = default, ...); variable
+// values are taken as given at execution time.
+func (p *parser) skipVariableDefinitions() error {
+	depth := 0
+	for {
+		switch {
+		case p.tok.kind == tokEOF:
+			return p.errorf("unterminated variable definitions")
+		case p.tok.is("("):
+			depth++
+		case p.tok.is(")"):
+			depth--
+			if depth == 0 {
+				p.next()
+				return nil
+			}
+		}
+		p.next()
+	}
+}
+
+func (p *parser) selectionSet() ([]Field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var fields []Field
+	for !p.tok.is("}") {
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+
+	if len(fields) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return fields, nil
+}
+
+func (p *parser) field() (Field, error) {
+	if p.tok.kind != tokName {
+		return Field{}, p.errorf("expected field name, got %q", p.tok.text)
+	}
+	f := Field{Name: p.tok.text}
+	p.next()
+
+	if p.tok.is(":") {
+		p.next()
+		if p.tok.kind != tokName {
+			return Field{}, p.errorf("expected field name after alias %q", f.Name)
+		}
+		f.Alias, f.Name = f.Name, p.tok.text
+		p.next()
+	}
+
+	if p.tok.is("(") {
+		p.next()
+		f.Args = make(map[string]interface{})
+		for !p.tok.is(")") {
+			if p.tok.kind != tokName {
+				return Field{}, p.errorf("expected argument name, got %q", p.tok.text)
+			}
+			name := p.tok.text
+			p.next()
+			if err := p.expect(":"); err != nil {
+				return Field{}, err
+			}
+			value, err := p.value()
+			if err != nil {
+				return Field{}, err
+			}
+			f.Args[name] = value
+		}
+		p.next()
+	}
+
+	if p.tok.is("{") {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return Field{}, err
+		}
+		f.Selections = selections
+	}
+	return f, nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		p.next()
+		return tok.text, nil
+	case tokInt:
+		p.next()
+		return strconv.Atoi(tok.text)
+	case tokFloat:
+		p.next()
+		return strconv.ParseFloat(tok.text, 64)
+	case tokName:
+		p.next()
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return tok.text, nil // enum value
+	case tokPunct:
+		if tok.text == "$" {
+			p.next()
+			if p.tok.kind != tokName {
+				return nil, p.errorf("expected variable name")
+			}
+			name := p.tok.text
+			p.next()
+			return variable(name), nil
+		}
+		if tok.text == "[" {
+			p.next()
+			var list []interface{}
+			for !p.tok.is("]") {
+				v, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		}
+	}
+	return nil, p.errorf("unexpected %q in argument value", tok.text)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokPunct
+	tokString
+	tokInt
+	tokFloat
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokPunct && t.text == punct
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() (token, error) {
+	// Commas are insignificant in GraphQL, like whitespace
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("{}():!$[]=@", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, text: string(c), pos: start}, nil
+	case c == '"':
+		return l.string()
+	case c == '-' || isDigit(c):
+		l.pos++
+		kind := tokInt
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-' {
+				kind = tokFloat
+			} else if !isDigit(c) {
+				break
+			}
+			l.pos++
+		}
+		return token{kind: kind, text: l.src[start:l.pos], pos: start}, nil
+	case isNameStart(c):
+		for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokName, text: l.src[start:l.pos], pos: start}, nil
+	}
+	return token{}, fmt.Errorf("syntax error at offset %d: unexpected character %q", start, c)
+}
+
+func (l *lexer) string() (token, error) {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+			continue
+		case '"':
+			l.pos++
+			text, err := strconv.Unquote(l.src[start:l.pos])
+			if err != nil {
+				return token{}, fmt.Errorf("syntax error at offset %d: invalid string", start)
+			}
+			return token{kind: tokString, text: text, pos: start}, nil
+		case '\n':
+			return token{}, fmt.Errorf("syntax error at offset %d: unterminated string", start)
+		}
+		l.pos++
+	}
+	return token{}, fmt.Errorf("syntax error at offset %d: unterminated string", start)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,116 @@
+// Package jsondiff computes a structural diff between two JSON documents.
+package jsondiff
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Op string
+
+const (
+	OpAdd     Op = "add"
+	OpRemove  Op = "remove"
+	OpReplace Op = "replace"
+)
+
+// Change is a single difference, addressed by a JSON Pointer (RFC 6901)
+// path into the documents.
+type Change struct {
+	Op   Op          `json:"op"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Strings diffs two JSON texts. A text that is not valid JSON is compared as
+// a plain string, so two different non-JSON bodies yield a single root
+// replace.
+func Strings(oldText, newText string) []Change {
+	return Diff(decode(oldText), decode(newText))
+}
+
+// Diff returns the changes that turn oldValue into newValue, both being
+// values as produced by encoding/json. Object keys are visited in sorted
+// order so the result is deterministic.
+func Diff(oldValue, newValue interface{}) []Change {
+	changes := []Change{}
+	diff("", oldValue, newValue, &changes)
+	return changes
+}
+
+func diff(path string, oldValue, newValue interface{}, changes *[]Change) {
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		if n, ok := newValue.(map[string]interface{}); ok {
+			diffObjects(path, o, n, changes)
+			return
+		}
+	case []interface{}:
+		if n, ok := newValue.([]interface{}); ok {
+			diffArrays(path, o, n, changes)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, Change{Op: OpReplace, Path: path, Old: oldValue, New: newValue})
+	}
+}
+
+func diffObjects(path string, o, n map[string]interface{}, changes *[]Change) {
+	keys := make([]string, 0, len(o)+len(n))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	for k := range n {
+		if _, ok := o[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		childPath := path + "/" + escape(k)
+		ov, inOld := o[k]
+		nv, inNew := n[k]
+		switch {
+		case !inNew:
+			*changes = append(*changes, Change{Op: OpRemove, Path: childPath, Old: ov})
+		case !inOld:
+			*changes = append(*changes, Change{Op: OpAdd, Path: childPath, New: nv})
+		default:
+			diff(childPath, ov, nv, changes)
+		}
+	}
+}
+
+func diffArrays(path string, o, n []interface{}, changes *[]Change) {
+	for i := 0; i < len(o) || i < len(n); i++ {
+		childPath := path + "/" + strconv.Itoa(i)
+		switch {
+		case i >= len(n):
+			*changes = append(*changes, Change{Op: OpRemove, Path: childPath, Old: o[i]})
+		case i >= len(o):
+			*changes = append(*changes, Change{Op: OpAdd, Path: childPath, New: n[i]})
+		default:
+			diff(childPath, o[i], n[i], changes)
+		}
+	}
+}
+
+func decode(text string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return text
+	}
+	return v
+}
+
+// escape encodes a key as a JSON Pointer reference token.
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,48 @@
+package jsondiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Change
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, []Change{}},
+		{"replace", `{"a":1}`, `{"a":2}`, []Change{{Op: OpReplace, Path: "/a", Old: 1.0, New: 2.0}}},
+		{"add and remove in key order", `{"b":1,"c":2}`, `{"a":0,"c":2}`, []Change{
+			{Op: OpAdd, Path: "/a", New: 0.0},
+			{Op: OpRemove, Path: "/b", Old: 1.0},
+		}},
+		{"nested", `{"order":{"items":[{"sku":"x"}]}}`, `{"order":{"items":[{"sku":"y"}]}}`, []Change{
+			{Op: OpReplace, Path: "/order/items/0/sku", Old: "x", New: "y"},
+		}},
+		{"array grows", `[1]`, `[1,2,3]`, []Change{
+			{Op: OpAdd, Path: "/1", New: 2.0},
+			{Op: OpAdd, Path: "/2", New: 3.0},
+		}},
+		{"array shrinks", `[1,2]`, `[1]`, []Change{{Op: OpRemove, Path: "/1", Old: 2.0}}},
+		{"type change", `{"a":{"b":1}}`, `{"a":[1]}`, []Change{
+			{Op: OpReplace, Path: "/a", Old: map[string]interface{}{"b": 1.0}, New: []interface{}{1.0}},
+		}},
+		{"pointer escaping", `{"a/b":1,"c~d":1}`, `{"a/b":2,"c~d":2}`, []Change{
+			{Op: OpReplace, Path: "/a~1b", Old: 1.0, New: 2.0},
+			{Op: OpReplace, Path: "/c~0d", Old: 1.0, New: 2.0},
+		}},
+		{"not JSON", `hello`, `goodbye`, []Change{{Op: OpReplace, Path: "", Old: "hello", New: "goodbye"}}},
+		{"same text, not JSON", `hello`, `hello`, []Change{}},
+		{"JSON against text", `{"a":1}`, `a=1`, []Change{
+			{Op: OpReplace, Path: "", Old: map[string]interface{}{"a": 1.0}, New: "a=1"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Strings(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Strings = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Package jsonguard bounds the cost of inspecting untrusted JSON bodies.
+package jsonguard
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Default limits, generous for any SQS envelope or message body.
+const (
+	DefaultMaxDepth = 64
+	DefaultMaxBytes = 8 << 20
+)
+
+var (
+	ErrTooDeep  = errors.New("json nesting too deep")
+	ErrTooLarge = errors.New("json body too large")
+)
+
+// Check reports whether data stays within maxDepth levels of object/array
+// nesting and maxBytes in length. It scans the raw bytes without decoding, so
+// it is cheap to run before handing a body to encoding/json. A limit of zero
+// or less disables that check.
+func Check(data []byte, maxDepth, maxBytes int) error {
+	if maxBytes > 0 && len(data) > maxBytes {
+		return fmt.Errorf("%w: %d bytes exceeds %d", ErrTooLarge, len(data), maxBytes)
+	}
+	if maxDepth <= 0 {
+		return nil
+	}
+
+	depth := 0
+	inString := false
+	escaped := false
+	for _, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("%w: exceeds %d levels", ErrTooDeep, maxDepth)
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package jsonguard
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		maxDepth int
+		maxBytes int
+		want     error
+	}{
+		{"flat object", `{"a":1}`, 1, 100, nil},
+		{"at the depth limit", `{"a":[{"b":1}]}`, 3, 0, nil},
+		{"past the depth limit", `{"a":[{"b":[1]}]}`, 3, 0, ErrTooDeep},
+		{"brackets in strings don't nest", `{"a":"[[[[{{{{"}`, 1, 0, nil},
+		{"escaped quote stays in the string", `{"a":"\"[[[["}`, 1, 0, nil},
+		{"escaped backslash ends the escape", `{"a":"\\"}`, 1, 0, nil},
+		{"closing brackets unwind", `[[1],[2],[3]]`, 2, 0, nil},
+		{"depth check disabled", strings.Repeat("[", 100) + strings.Repeat("]", 100), 0, 0, nil},
+		{"at the size limit", `[1,2]`, 0, 5, nil},
+		{"past the size limit", `[1,2,3]`, 0, 5, ErrTooLarge},
+		{"size checked first", strings.Repeat("[", 10), 1, 5, ErrTooLarge},
+		{"not JSON", `plain text`, 1, 100, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check([]byte(tt.data), tt.maxDepth, tt.maxBytes)
+			if tt.want == nil && err != nil {
+				t.Errorf("Check = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Check = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+
+	"aws-relay/internal/store"
+)
+
+// SQS rejects batches with more entries or a larger total payload than this.
+const (
+	maxBatchEntries = 10
+	maxBatchBytes   = 256 * 1024
+)
+
+// checkBatchLimits flags SendMessageBatch/DeleteMessageBatch requests that
+// SQS will reject for exceeding the entry count or total payload limit.
+func (p *Proxy) checkBatchLimits(action, queueName, body string, form url.Values, isJSON bool) {
+	var entryPrefix string
+	switch action {
+	case "SendMessageBatch":
+		entryPrefix = "SendMessageBatchRequestEntry"
+	case "DeleteMessageBatch":
+		entryPrefix = "DeleteMessageBatchRequestEntry"
+	default:
+		return
+	}
+
+	count, size := parseBatchEntries(body, form, isJSON, entryPrefix)
+	if count > maxBatchEntries {
+		p.flagBatch(queueName, fmt.Sprintf("%s has %d entries; SQS allows at most %d", action, count, maxBatchEntries))
+	}
+	if size > maxBatchBytes {
+		p.flagBatch(queueName, fmt.Sprintf("%s payload is %d bytes; SQS allows at most %d", action, size, maxBatchBytes))
+	}
+}
+
+func (p *Proxy) flagBatch(queueName, detail string) {
+	if !p.Paused() {
+		p.store.RecordAnomaly(store.AnomalyBatchLimit, queueName, detail)
+	}
+	log.Printf("[anomaly] %s", detail)
+}
+
+// parseBatchEntries returns the number of entries in a batch request and the
+// total size of their message bodies.
+func parseBatchEntries(body string, form url.Values, isJSON bool, entryPrefix string) (int, int) {
+	count, size := 0, 0
+
+	if isJSON {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &data); err == nil {
+			if entries, ok := data["Entries"].([]interface{}); ok {
+				count = len(entries)
+				for _, e := range entries {
+					if entry, ok := e.(map[string]interface{}); ok {
+						if b, ok := entry["MessageBody"].(string); ok {
+							size += len(b)
+						}
+					}
+				}
+			}
+		}
+	} else {
+		count = len(formEntries(form, entryPrefix, "Id"))
+		for _, b := range formEntries(form, entryPrefix, "MessageBody") {
+			size += len(b)
+		}
+	}
+
+	return count, size
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// call issues an SQS Query API request straight to the upstream, bypassing
+// the proxy and therefore capture. Requests are unsigned, which LocalStack
+// accepts.
+func (p *Proxy) call(action string, params url.Values) (int, string, error) {
+	return p.callWithHeader(action, params, nil)
+}
+
+// callWithHeader is call with extra request headers.
+func (p *Proxy) callWithHeader(action string, params url.Values, header http.Header) (int, string, error) {
+	params.Set("Action", action)
+	params.Set("Version", "2012-11-05")
+
+	req, err := http.NewRequest(http.MethodPost, p.upstream.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Host = p.forwardedHost()
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, "", fmt.Errorf("%s: %w", action, err)
+	}
+	return resp.StatusCode, string(body), nil
+}
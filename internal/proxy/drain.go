@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"log"
+	"net/url"
+
+	"aws-relay/internal/store"
+)
+
+// maxDrainRounds bounds how many ReceiveMessage calls a drain makes while
+// looking for messages whose captured receipt handle has expired.
+const maxDrainRounds = 10
+
+// DrainResult summarises a Drain run.
+type DrainResult struct {
+	Queue     string `json:"queue"`
+	Deleted   int    `json:"deleted"`
+	Refreshed int    `json:"refreshed"`
+	Failed    int    `json:"failed"`
+}
+
+// Drain deletes every captured-but-undeleted message of queueName from the
+// upstream queue using its captured receipt handle. Messages whose handle is
+// rejected are received again to obtain a fresh handle and then deleted.
+// Successful deletes are recorded in the store.
+func (p *Proxy) Drain(queueName string) DrainResult {
+	result := DrainResult{Queue: queueName}
+	meta := store.Meta{TraceID: newTraceID(), Upstream: p.upstreamOrigin()}
+
+	deletable := p.store.GetDeletable(queueName)
+	expired := make(map[string]store.DeletableMessage)
+	queueURL := ""
+
+	for _, msg := range deletable {
+		queueURL = msg.QueueURL
+		if p.deleteUpstream(msg.QueueURL, msg.ReceiptHandle) {
+			p.store.RecordDelete(meta, msg.QueueURL, queueName, msg.ReceiptHandle)
+			result.Deleted++
+		} else {
+			expired[msg.MessageID] = msg
+		}
+	}
+
+	for round := 0; round < maxDrainRounds && len(expired) > 0; round++ {
+		params := url.Values{}
+		params.Set("QueueUrl", queueURL)
+		params.Set("MaxNumberOfMessages", "10")
+		status, body, err := p.call("ReceiveMessage", params)
+		if err != nil || status >= 300 {
+			break
+		}
+
+		received := decodeReceiveResponse(body, false)
+		if len(received) == 0 {
+			break
+		}
+
+		for _, rm := range received {
+			msg, ok := expired[rm.MessageID]
+			if !ok {
+				// Not ours to delete; make it visible again straight away
+				p.releaseUpstream(queueURL, rm.ReceiptHandle)
+				continue
+			}
+			if p.deleteUpstream(queueURL, rm.ReceiptHandle) {
+				p.store.RecordDelete(meta, queueURL, queueName, msg.ReceiptHandle)
+				result.Refreshed++
+				delete(expired, rm.MessageID)
+			}
+		}
+	}
+
+	result.Failed = len(expired)
+	log.Printf("Drained %s: %d deleted, %d refreshed, %d failed", queueName, result.Deleted, result.Refreshed, result.Failed)
+	return result
+}
+
+func (p *Proxy) deleteUpstream(queueURL, receiptHandle string) bool {
+	params := url.Values{}
+	params.Set("QueueUrl", queueURL)
+	params.Set("ReceiptHandle", receiptHandle)
+
+	status, _, err := p.call("DeleteMessage", params)
+	return err == nil && status < 300
+}
+
+func (p *Proxy) releaseUpstream(queueURL, receiptHandle string) {
+	params := url.Values{}
+	params.Set("QueueUrl", queueURL)
+	params.Set("ReceiptHandle", receiptHandle)
+	params.Set("VisibilityTimeout", "0")
+
+	p.call("ChangeMessageVisibility", params)
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"aws-relay/internal/store"
+)
+
+func TestDrainDeletesCapturedMessages(t *testing.T) {
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+
+	var mu sync.Mutex
+	var calls []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		calls = append(calls, r.Form.Get("Action")+" "+r.Form.Get("ReceiptHandle"))
+		mu.Unlock()
+		if r.Form.Get("QueueUrl") != ordersURL {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Form.Get("Action") {
+		case "DeleteMessage":
+			if r.Form.Get("ReceiptHandle") == "r-expired" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`<ErrorResponse><Error><Code>ReceiptHandleIsInvalid</Code></Error></ErrorResponse>`))
+			}
+		case "ReceiveMessage":
+			w.Write([]byte(`<ReceiveMessageResponse><ReceiveMessageResult>` +
+				`<Message><MessageId>m-expired</MessageId><ReceiptHandle>r-fresh</ReceiptHandle><Body>two</Body></Message>` +
+				`<Message><MessageId>m-stranger</MessageId><ReceiptHandle>r-stranger</ReceiptHandle><Body>three</Body></Message>` +
+				`</ReceiveMessageResult></ReceiveMessageResponse>`))
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	s := store.New()
+	p := New(upstream.URL, s)
+	for _, id := range []string{"m-live", "m-expired", "m-acked"} {
+		handle := "r-" + strings.TrimPrefix(id, "m-")
+		s.RecordSend(store.Meta{}, ordersURL, "orders", id, "body of "+id, nil, nil)
+		s.RecordReceive(store.Meta{}, ordersURL, "orders", id, handle, "body of "+id, nil, nil)
+	}
+	s.RecordDelete(store.Meta{}, ordersURL, "orders", "r-acked")
+
+	result := p.Drain("orders")
+	if want := (DrainResult{Queue: "orders", Deleted: 1, Refreshed: 1}); result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+
+	want := []string{
+		"DeleteMessage r-live",
+		"DeleteMessage r-expired",
+		"ReceiveMessage ",
+		"DeleteMessage r-fresh",
+		"ChangeMessageVisibility r-stranger",
+	}
+	mu.Lock()
+	got := append([]string(nil), calls...)
+	mu.Unlock()
+	// Captured messages are drained in no particular order
+	if len(got) > 1 && got[0] == want[1] {
+		got[0], got[1] = got[1], got[0]
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("upstream calls = %q, want %q", got, want)
+	}
+
+	if deletable := s.GetDeletable("orders"); len(deletable) != 0 {
+		t.Errorf("deletable after drain = %+v, want none", deletable)
+	}
+}
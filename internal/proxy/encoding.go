@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// decodeBody replaces a gzip or deflate encoded response body with its
+// decompressed form so capture can parse it, and strips Content-Encoding so
+// the client is sent plaintext. A decoded response is marked Uncompressed,
+// as the transport marks those it decodes itself, and its length is unknown
+// until setDecodedLength.
+// Bodies that don't look like their declared encoding are left untouched.
+func decodeBody(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "gzip" && encoding != "x-gzip" && encoding != "deflate" {
+		return nil
+	}
+
+	br := bufio.NewReader(resp.Body)
+	header, _ := br.Peek(2)
+	forward := func(r io.Reader) {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{r, resp.Body}
+	}
+
+	var decoded io.Reader
+	if encoding == "deflate" {
+		// Servers send either zlib-wrapped (as the spec says) or raw deflate
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return err
+			}
+			decoded = zr
+		} else {
+			decoded = flate.NewReader(br)
+		}
+	} else {
+		if len(header) < 2 || header[0] != 0x1f || header[1] != 0x8b {
+			forward(br)
+			return nil
+		}
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		decoded = zr
+	}
+
+	forward(decoded)
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// setDecodedLength sets the Content-Length of a decoded response once its
+// whole body has been read.
+func setDecodedLength(resp *http.Response, n int) {
+	resp.ContentLength = int64(n)
+	resp.Header.Set("Content-Length", strconv.Itoa(n))
+}
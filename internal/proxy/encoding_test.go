@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEncodedResponsesCaptured(t *testing.T) {
+	const received = `{"Messages":[{"MessageId":"m-1","ReceiptHandle":"r-1","Body":"hello"},{"MessageId":"m-2","ReceiptHandle":"r-2","Body":"world"}]}`
+	compress := func(newWriter func(io.Writer) io.WriteCloser) string {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		w.Write([]byte(received))
+		w.Close()
+		return buf.String()
+	}
+
+	gzipped := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	tests := []struct {
+		name           string
+		encoding       string
+		body           string
+		acceptEncoding string // sent by the client; otherwise the transport decodes gzip itself
+	}{
+		{"gzip", "gzip", gzipped, "gzip, deflate"},
+		{"gzip decoded by the transport", "gzip", gzipped, ""},
+		{"zlib deflate", "deflate", compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }), "gzip, deflate"},
+		{"raw deflate", "deflate", compress(func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw }), "gzip, deflate"},
+		// Mislabelled plaintext is passed through as sent
+		{"mislabelled gzip", "gzip", received, "gzip, deflate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+				w.Header().Set("Content-Encoding", tt.encoding)
+				w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(upstream.Close)
+			_, s, relay := newTestRelay(t, upstream)
+
+			req, _ := http.NewRequest(http.MethodPost, relay.URL+"/", strings.NewReader(`{"QueueUrl":"http://localhost:4566/000000000000/orders"}`))
+			req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+			req.Header.Set("X-Amz-Target", "AmazonSQS.ReceiveMessage")
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantBody, wantEncoding := received, ""
+			if tt.body == received {
+				wantEncoding = tt.encoding
+			}
+			if string(got) != wantBody || resp.Header.Get("Content-Encoding") != wantEncoding {
+				t.Errorf("client got %q encoded %q, want %q encoded %q", got, resp.Header.Get("Content-Encoding"), wantBody, wantEncoding)
+			}
+			if resp.ContentLength != int64(len(got)) {
+				t.Errorf("Content-Length = %d, want %d", resp.ContentLength, len(got))
+			}
+			if history := s.GetHistory(0); len(history) != 2 {
+				t.Errorf("captured %d receives, want 2", len(history))
+			}
+		})
+	}
+}
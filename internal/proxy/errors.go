@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"aws-relay/internal/store"
+)
+
+// handleErrorResponse records a failed upstream call. Errors with a specific
+// meaning for debugging get their own anomaly kind; everything else is
+// recorded as a generic upstream_error.
+func (p *Proxy) handleErrorResponse(action, queueName string, resp *http.Response, respBody string, isJSON bool) {
+	code, message := parseError(resp, respBody, isJSON)
+
+	kind := store.AnomalyUpstreamError
+	detail := fmt.Sprintf("%s failed: %d %s", action, resp.StatusCode, code)
+	if message != "" {
+		detail += ": " + message
+	}
+
+	switch code {
+	case "PurgeQueueInProgress":
+		kind = store.AnomalyPurgeInProgress
+		detail = "PurgeQueue rejected: a purge of this queue already ran in the last 60 seconds"
+	case "QueueDeletedRecently":
+		kind = store.AnomalyQueueDeletedRecently
+		detail = action + " rejected: a queue of this name was deleted less than 60 seconds ago"
+	}
+
+	p.store.RecordAnomaly(kind, queueName, detail)
+	log.Printf("  ! %s", detail)
+}
+
+// parseError extracts the SQS error code and message from an error response.
+// Codes are normalised by dropping the "AWS.SimpleQueueService." prefix and
+// any JSON "namespace#" prefix.
+func parseError(resp *http.Response, body string, isJSON bool) (string, string) {
+	var code, message string
+
+	if isJSON {
+		code = parseJSONField(body, "__type")
+		message = parseJSONField(body, "message")
+		if message == "" {
+			message = parseJSONField(body, "Message")
+		}
+	} else {
+		code = extractXMLTag(body, "Code")
+		message = extractXMLTag(body, "Message")
+	}
+
+	// The query-compatible header carries the legacy code even for JSON
+	if queryError := resp.Header.Get("X-Amzn-Query-Error"); queryError != "" {
+		code, _, _ = strings.Cut(queryError, ";")
+	}
+
+	if i := strings.LastIndex(code, "#"); i >= 0 {
+		code = code[i+1:]
+	}
+	code = strings.TrimPrefix(code, "AWS.SimpleQueueService.")
+
+	return code, message
+}
+
+// checkUnparsedReceive flags a successful ReceiveMessage response from which
+// no messages could be parsed even though it appears to contain some, or is
+// malformed, so a parse failure isn't mistaken for an empty queue.
+func (p *Proxy) checkUnparsedReceive(queueName string, body []byte, isJSON bool) {
+	if len(bytes.TrimSpace(body)) == 0 || !receiveLooksUnparsed(body, isJSON) {
+		return
+	}
+
+	p.store.RecordAnomaly(store.AnomalyUnparsedReceive, queueName, "no messages parsed from ReceiveMessage response: "+snippet(body))
+	log.Printf("  ! Could not parse any messages from ReceiveMessage response for %s", queueName)
+}
+
+func receiveLooksUnparsed(body []byte, isJSON bool) bool {
+	if isJSON {
+		var resp struct {
+			Messages []json.RawMessage
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return true
+		}
+		return len(resp.Messages) > 0
+	}
+
+	if bytes.Contains(body, []byte("<Message>")) {
+		return true
+	}
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return false
+		}
+		if err != nil {
+			return true
+		}
+	}
+}
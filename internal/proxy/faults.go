@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"path"
+	"strings"
+
+	"aws-relay/internal/store"
+)
+
+// FaultRule answers matching calls with an SQS error instead of forwarding
+// them. An empty Action or Queue matches any; Queue may be a path.Match
+// glob. Probability is the chance a matching call fails, 1 if omitted.
+type FaultRule struct {
+	Action      string  `json:"action,omitempty"`
+	Queue       string  `json:"queue,omitempty"`
+	Status      int     `json:"status"`
+	Code        string  `json:"code"`
+	Message     string  `json:"message,omitempty"`
+	Probability float64 `json:"probability"`
+}
+
+// ParseFaults parses a JSON array of fault rules, for example
+// [{"action":"SendMessage","queue":"orders-*","status":503,"code":"ServiceUnavailable","probability":0.1}].
+func ParseFaults(spec string) ([]FaultRule, error) {
+	var raw []struct {
+		FaultRule
+		Probability *float64 `json:"probability"`
+	}
+	if err := json.Unmarshal([]byte(spec), &raw); err != nil {
+		return nil, fmt.Errorf("invalid fault rules: %w", err)
+	}
+
+	rules := make([]FaultRule, len(raw))
+	for i, r := range raw {
+		rule := r.FaultRule
+		rule.Probability = 1
+		if r.Probability != nil {
+			rule.Probability = *r.Probability
+		}
+		if rule.Status < 400 || rule.Status > 599 {
+			return nil, fmt.Errorf("fault rule %d: status %d is not an error", i, rule.Status)
+		}
+		if rule.Code == "" {
+			return nil, fmt.Errorf("fault rule %d: missing code", i)
+		}
+		if rule.Probability < 0 || rule.Probability > 1 {
+			return nil, fmt.Errorf("fault rule %d: probability %v is not between 0 and 1", i, rule.Probability)
+		}
+		if _, err := path.Match(rule.Queue, ""); err != nil {
+			return nil, fmt.Errorf("fault rule %d: invalid queue pattern %q: %w", i, rule.Queue, err)
+		}
+		rules[i] = rule
+	}
+	return rules, nil
+}
+
+// SetFaults sets the fault injection rules. The first rule matching a call
+// decides whether it fails.
+func (p *Proxy) SetFaults(rules []FaultRule) {
+	p.faults = rules
+}
+
+// SetFaultsEnabled switches fault injection on or off without discarding
+// the rules. It is on by default.
+func (p *Proxy) SetFaultsEnabled(enabled bool) {
+	p.faultsOff.Store(!enabled)
+}
+
+// FaultsEnabled reports whether fault injection is on.
+func (p *Proxy) FaultsEnabled() bool {
+	return !p.faultsOff.Load()
+}
+
+// matchFault returns the rule that fails a call of action on queueName, if
+// any.
+func (p *Proxy) matchFault(action, queueName string) (FaultRule, bool) {
+	if p.faultsOff.Load() {
+		return FaultRule{}, false
+	}
+	for _, rule := range p.faults {
+		if rule.Action != "" && rule.Action != action {
+			continue
+		}
+		if rule.Queue != "" && rule.Queue != queueName {
+			if ok, _ := path.Match(rule.Queue, queueName); !ok {
+				continue
+			}
+		}
+		return rule, rand.Float64() < rule.Probability
+	}
+	return FaultRule{}, false
+}
+
+// injectFault answers r with the error of rule, in the protocol the client
+// used, and records the fault unless capture is paused.
+func (p *Proxy) injectFault(w http.ResponseWriter, r *http.Request, rule FaultRule, action, queueURL, queueName string, isJSON bool) {
+	message := rule.Message
+	if message == "" {
+		message = "Fault injected by aws-relay"
+	}
+	faultType := "Sender"
+	if rule.Status >= 500 {
+		faultType = "Receiver"
+	}
+	requestID := r.Header.Get(TraceHeader)
+
+	w.Header().Set("X-Amzn-Requestid", requestID)
+	if isJSON {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Header().Set("X-Amzn-Query-Error", rule.Code+";"+faultType)
+		w.WriteHeader(rule.Status)
+		json.NewEncoder(w).Encode(map[string]string{
+			"__type":  "com.amazonaws.sqs#" + strings.TrimPrefix(rule.Code, "AWS.SimpleQueueService."),
+			"message": message,
+		})
+	} else {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(rule.Status)
+		xml.NewEncoder(w).Encode(struct {
+			XMLName   xml.Name `xml:"ErrorResponse"`
+			Type      string   `xml:"Error>Type"`
+			Code      string   `xml:"Error>Code"`
+			Message   string   `xml:"Error>Message"`
+			RequestID string   `xml:"RequestId"`
+		}{Type: faultType, Code: rule.Code, Message: message, RequestID: requestID})
+	}
+
+	if !p.Paused() {
+		meta := store.Meta{TraceID: requestID, ListenAddr: listenAddr(r)}
+		p.store.RecordFault(meta, queueURL, queueName, action, rule.Status, rule.Code)
+	}
+	log.Printf("  ! Injected %d %s for %s", rule.Status, rule.Code, action)
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseForm decodes a form-encoded request body. Malformed pairs are skipped
+// rather than failing the whole body. Bodies are parsed once, as the call
+// arrives, and the values passed to whatever reads the request.
+func parseForm(body string) url.Values {
+	values, _ := url.ParseQuery(body)
+	return values
+}
+
+// formEntries returns the values of the prefix.N.field params of a form,
+// keyed by N, as used for the entries of batch and attribute lists. An empty
+// field matches plain prefix.N params, as used for lists of names.
+func formEntries(values url.Values, prefix, field string) map[int]string {
+	entries := make(map[int]string)
+	for key, v := range values {
+		idx, ok := strings.CutPrefix(key, prefix+".")
+		if !ok {
+			continue
+		}
+		if field != "" {
+			if idx, ok = strings.CutSuffix(idx, "."+field); !ok {
+				continue
+			}
+		}
+		if n, err := strconv.Atoi(idx); err == nil && len(v) > 0 {
+			entries[n] = v[0]
+		}
+	}
+	return entries
+}
+
+// entryIndexes returns the indexes of entries in ascending order.
+func entryIndexes(entries map[int]string) []int {
+	indexes := make([]int, 0, len(entries))
+	for n := range entries {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
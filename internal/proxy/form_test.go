@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestExtractNameList(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		isJSON bool
+		want   []string
+	}{
+		{"json", `{"AttributeNames":["All","ApproximateReceiveCount"]}`, true, []string{"All", "ApproximateReceiveCount"}},
+		{"json without the key", `{"QueueUrl":"q"}`, true, nil},
+		{"form in index order", "AttributeName.2=SentTimestamp&AttributeName.1=All&AttributeName.10=SenderId", false, []string{"All", "SentTimestamp", "SenderId"}},
+		{"form ignores other params", "Action=ReceiveMessage&AttributeName.1=All&AttributeName.1.Extra=x&MessageAttributeName.1=trace", false, []string{"All"}},
+		{"form skips malformed pairs", "AttributeName.1=All&%zz&AttributeName.2=SenderId", false, []string{"All", "SenderId"}},
+		{"form without the key", "Action=ReceiveMessage", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			if !tt.isJSON {
+				form = parseForm(tt.body)
+			}
+			got := extractNameList(tt.body, form, tt.isJSON, "AttributeNames", "AttributeName")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormEntries(t *testing.T) {
+	form := parseForm("Entry.1.Id=a&Entry.2.Id=b&Entry.2.Body=x&Entry.3=plain&Entry.x.Id=bad")
+	if got, want := formEntries(form, "Entry", "Id"), map[int]string{1: "a", 2: "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Id entries = %v, want %v", got, want)
+	}
+	if got, want := formEntries(form, "Entry", ""), map[int]string{3: "plain"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("plain entries = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"aws-relay/internal/store"
+)
+
+// genericBodyBytes is how much of a request body a generic event keeps.
+const genericBodyBytes = 1024
+
+// awsService names the AWS service a request is for, in lower case: from
+// the credential scope of its SigV4 Authorization header, else from its
+// X-Amz-Target prefix, else from an <service>.*amazonaws.com host. It
+// returns "" if none of these say.
+func awsService(r *http.Request) string {
+	// AWS4-HMAC-SHA256 Credential=AKID/20240101/us-east-1/dynamodb/aws4_request, ...
+	if _, cred, ok := strings.Cut(r.Header.Get("Authorization"), "Credential="); ok {
+		cred, _, _ = strings.Cut(cred, ",")
+		if scope := strings.Split(cred, "/"); len(scope) == 5 {
+			return strings.ToLower(scope[3])
+		}
+	}
+
+	// AmazonSQS.SendMessage, DynamoDB_20120810.PutItem
+	if prefix, _, ok := strings.Cut(r.Header.Get("X-Amz-Target"), "."); ok {
+		switch prefix {
+		case "AmazonSQS":
+			return "sqs"
+		case "AmazonSNS":
+			return "sns"
+		}
+		prefix, _, _ = strings.Cut(prefix, "_")
+		return strings.ToLower(prefix)
+	}
+
+	host := r.Host
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	if strings.HasSuffix(host, ".amazonaws.com") {
+		labels := strings.Split(host, ".")
+		for _, label := range labels[:len(labels)-2] {
+			if label != "" && !strings.Contains(label, "-") {
+				return label // skip bucket names and regions like us-east-1
+			}
+		}
+	}
+	return ""
+}
+
+// isGeneric reports whether a call with the given service and action is
+// outside what the relay parses: a call to another AWS service, or one
+// whose action isn't a known SQS action (or the SNS Publish).
+func isGeneric(service, action string) bool {
+	switch service {
+	case "", "sqs", "sns":
+		return !dataPlaneActions[action] && !controlPlaneActions[action]
+	}
+	return true
+}
+
+// genericOperation returns the operation a generic call named, if any: the
+// X-Amz-Target action or a form-encoded Action parameter.
+func genericOperation(amzTarget, contentType string, form url.Values) string {
+	if _, action, ok := strings.Cut(amzTarget, "."); ok {
+		return action
+	}
+	if strings.Contains(contentType, "x-www-form-urlencoded") {
+		return form.Get("Action")
+	}
+	return ""
+}
+
+// recordGeneric records a call the relay doesn't parse as a lightweight
+// generic event: its service, operation, method, path, status and the start
+// of its request body.
+func (p *Proxy) recordGeneric(resp *http.Response, meta store.Meta, rc *requestCapture) {
+	service := rc.service
+	if service == "" {
+		service = "unknown"
+	}
+	operation := genericOperation(rc.amzTarget, rc.contentType, rc.form)
+
+	p.store.RecordGeneric(meta, store.GenericCall{
+		Service:   service,
+		Operation: operation,
+		Method:    resp.Request.Method,
+		Path:      resp.Request.URL.Path,
+		Status:    resp.StatusCode,
+		Body:      truncateBody(rc.body, genericBodyBytes),
+		BodySize:  len(rc.body),
+	})
+	log.Printf("  -> %s %s %s %d", service, resp.Request.Method, resp.Request.URL.Path, resp.StatusCode)
+}
+
+// truncateBody returns at most the first n bytes of body, cut on a rune
+// boundary rather than splitting a UTF-8 sequence.
+func truncateBody(body string, n int) string {
+	if len(body) <= n {
+		return body
+	}
+	cut := n
+	for cut > n-utf8.UTFMax && cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return body[:cut]
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"aws-relay/internal/jsonguard"
+	"aws-relay/internal/store"
+)
+
+const snippetLen = 256
+
+// SetJSONLimits bounds the nesting depth and size of JSON bodies the proxy
+// will parse for capture. Bodies beyond either limit are still forwarded but
+// are flagged instead of inspected. Zero disables a limit.
+func (p *Proxy) SetJSONLimits(maxDepth, maxBytes int) {
+	p.maxJSONDepth = maxDepth
+	p.maxJSONBytes = maxBytes
+}
+
+// inspectable reports whether a JSON body is within the configured limits,
+// recording a body_limit anomaly with a snippet of the raw body otherwise,
+// unless capture is paused.
+func (p *Proxy) inspectable(what string, body []byte) bool {
+	err := jsonguard.Check(body, p.maxJSONDepth, p.maxJSONBytes)
+	if err == nil {
+		return true
+	}
+
+	if !p.Paused() {
+		p.store.RecordAnomaly(store.AnomalyBodyLimit, "", fmt.Sprintf("%s not inspected (%v): %s", what, err, snippet(body)))
+	}
+	log.Printf("[anomaly] %s not inspected: %v", what, err)
+	return false
+}
+
+// recordUninspected records a call whose request body was beyond the JSON
+// limits as a generic event flagged as uninspected, holding the raw body up
+// to the capture limit.
+func (p *Proxy) recordUninspected(resp *http.Response, meta store.Meta, rc *requestCapture) {
+	service := rc.service
+	if service == "" {
+		service = "sqs"
+	}
+	body := rc.body
+	if p.maxCaptureBytes > 0 {
+		body = truncateBody(body, p.maxCaptureBytes)
+	}
+
+	meta.Uninspected = true
+	p.store.RecordGeneric(meta, store.GenericCall{
+		Service:   service,
+		Operation: rc.action,
+		Method:    resp.Request.Method,
+		Path:      resp.Request.URL.Path,
+		Status:    resp.StatusCode,
+		Body:      body,
+		BodySize:  len(rc.body),
+	})
+	log.Printf("  -> %s %d, request body kept raw", rc.action, resp.StatusCode)
+}
+
+func snippet(body []byte) string {
+	if len(body) <= snippetLen {
+		return string(body)
+	}
+	return string(body[:snippetLen]) + "..."
+}
+
+const (
+	// DefaultMaxCaptureBytes bounds how much of a response body is read
+	// for capture; SQS responses are at most a few megabytes.
+	DefaultMaxCaptureBytes = 4 << 20
+
+	// DefaultParseTimeout bounds how long forwarding a response waits for
+	// its capture to be parsed and recorded.
+	DefaultParseTimeout = 2 * time.Second
+)
+
+// SetCaptureLimits bounds how many bytes of a response body are read for
+// capture and how long forwarding waits for the capture to be processed.
+// Responses are always forwarded in full. Zero disables a limit.
+func (p *Proxy) SetCaptureLimits(maxBytes int, parseTimeout time.Duration) {
+	p.maxCaptureBytes = maxBytes
+	p.parseTimeout = parseTimeout
+}
+
+// readCapture reads up to the capture limit of resp's body for inspection,
+// leaving resp.Body able to forward the whole body. It reports whether the
+// body was cut short.
+func (p *Proxy) readCapture(resp *http.Response) ([]byte, bool, error) {
+	if p.maxCaptureBytes <= 0 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return body, false, nil
+	}
+
+	prefix, err := io.ReadAll(io.LimitReader(resp.Body, int64(p.maxCaptureBytes)+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(prefix) <= p.maxCaptureBytes {
+		resp.Body = io.NopCloser(bytes.NewReader(prefix))
+		return prefix, false, nil
+	}
+
+	// Forward what was read followed by the unread remainder
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.Body}
+	return prefix[:p.maxCaptureBytes], true, nil
+}
+
+// runCapture runs fn, waiting at most the parse timeout for it to finish. A
+// slow capture carries on in the background rather than holding up the
+// response.
+func (p *Proxy) runCapture(traceID string, fn func()) {
+	if p.parseTimeout <= 0 {
+		fn()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	timer := time.NewTimer(p.parseTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Printf("[anomaly] Capture of trace=%s still running after %s; forwarding without waiting", traceID, p.parseTimeout)
+	}
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+// nestedBody is a SendMessage body whose attribute value nests depth arrays.
+func nestedBody(depth int) string {
+	return `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi","Extra":` +
+		strings.Repeat("[", depth) + strings.Repeat("]", depth) + `}`
+}
+
+func TestNestedRequestBodyIsCapturedRaw(t *testing.T) {
+	var forwarded []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"MessageId":"m-1"}`))
+	}))
+	defer upstream.Close()
+	_, s, relay := newTestRelay(t, upstream)
+
+	body := nestedBody(100000)
+	if status := callJSON(t, relay, "SendMessage", body); status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	if string(forwarded) != body {
+		t.Errorf("upstream got %d bytes, want the %d sent", len(forwarded), len(body))
+	}
+
+	history := s.GetHistory(0)
+	if len(history) != 1 {
+		t.Fatalf("history has %d events, want 1", len(history))
+	}
+	event := history[0]
+	if event.Action != store.ActionGeneric || !event.Uninspected {
+		t.Errorf("event action %q uninspected %v, want an uninspected generic event", event.Action, event.Uninspected)
+	}
+	if event.Operation != "SendMessage" || event.Service != "sqs" {
+		t.Errorf("event operation %q service %q", event.Operation, event.Service)
+	}
+	if event.Body != body || event.BodySize != len(body) {
+		t.Errorf("event body is %d of %d bytes, want the raw body", len(event.Body), event.BodySize)
+	}
+	if msgs := s.GetMessages("", true); len(msgs) != 0 {
+		t.Errorf("uninspected send was parsed into %d message(s)", len(msgs))
+	}
+
+	flagged := false
+	for _, a := range s.GetAnomalies() {
+		flagged = flagged || a.Kind == store.AnomalyBodyLimit
+	}
+	if !flagged {
+		t.Error("no body_limit anomaly recorded")
+	}
+}
+
+func TestNestedRequestBodyStillGetsFaults(t *testing.T) {
+	p, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{}`))
+	p.SetFaults([]FaultRule{{Action: "SendMessage", Status: 503, Code: "ServiceUnavailable", Probability: 1}})
+
+	if status := callJSON(t, relay, "SendMessage", nestedBody(1000)); status != 503 {
+		t.Fatalf("status = %d, want the injected 503", status)
+	}
+	history := s.GetHistory(0)
+	if len(history) != 1 || history[0].Action != store.ActionFault {
+		t.Fatalf("history = %+v, want one fault event", history)
+	}
+}
+
+func TestRawCaptureIsBoundedByCaptureLimit(t *testing.T) {
+	p, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{}`))
+	p.SetJSONLimits(8, 0)
+	p.SetCaptureLimits(16, DefaultParseTimeout)
+
+	body := nestedBody(50)
+	callJSON(t, relay, "SendMessage", body)
+	history := s.GetHistory(0)
+	if len(history) != 1 {
+		t.Fatalf("history has %d events, want 1", len(history))
+	}
+	if got := history[0]; got.Body != body[:16] || got.BodySize != len(body) {
+		t.Errorf("body %q size %d, want the first 16 of %d bytes", got.Body, got.BodySize, len(body))
+	}
+}
+
+func TestLargeReceiveForwardedWhileCaptureBounded(t *testing.T) {
+	const messageBytes = 256 * 1024
+	var resp strings.Builder
+	resp.WriteString(`<ReceiveMessageResponse><ReceiveMessageResult>`)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&resp, `<Message><MessageId>m-%d</MessageId><ReceiptHandle>r-%d</ReceiptHandle><Body>%s</Body></Message>`, i, i, strings.Repeat("x", messageBytes))
+	}
+	resp.WriteString(`</ReceiveMessageResult></ReceiveMessageResponse>`)
+	full := resp.String()
+
+	p, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, full))
+	// Room for the first two messages only
+	p.SetCaptureLimits(2*messageBytes+1024, time.Second)
+
+	got, err := http.PostForm(relay.URL+"/", url.Values{"Action": {"ReceiveMessage"}, "QueueUrl": {"http://localhost:4566/000000000000/orders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarded, err := io.ReadAll(got.Body)
+	got.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(forwarded) != full {
+		t.Fatalf("client got %d bytes, want all %d", len(forwarded), len(full))
+	}
+
+	history := s.GetHistory(0)
+	if len(history) != 2 {
+		t.Fatalf("captured %d receives, want the 2 within the limit", len(history))
+	}
+	for _, event := range history {
+		if !event.PartialCapture || len(event.Body) != messageBytes {
+			t.Errorf("event %s: partial %v, body %d bytes; want a partial capture of the whole body", event.MessageID, event.PartialCapture, len(event.Body))
+		}
+	}
+
+	var partial, unparsed int
+	for _, a := range s.GetAnomalies() {
+		switch a.Kind {
+		case store.AnomalyPartialCapture:
+			partial++
+		case store.AnomalyUnparsedReceive:
+			unparsed++
+		}
+	}
+	if partial != 1 || unparsed != 0 {
+		t.Errorf("got %d partial capture and %d unparsed anomalies, want 1 and 0", partial, unparsed)
+	}
+}
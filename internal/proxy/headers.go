@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ParseResponseHeaders parses a JSON object mapping actions to the headers
+// added to their responses, for example
+// {"SendMessage":{"X-Amzn-Query-Mode":"true"}}. The action "*" applies to
+// every response.
+func ParseResponseHeaders(spec string) (map[string]http.Header, error) {
+	var raw map[string]map[string]string
+	if err := json.Unmarshal([]byte(spec), &raw); err != nil {
+		return nil, fmt.Errorf("invalid response headers: %w", err)
+	}
+
+	headers := make(map[string]http.Header, len(raw))
+	for action, fields := range raw {
+		h := make(http.Header, len(fields))
+		for name, value := range fields {
+			if name == "" {
+				return nil, fmt.Errorf("empty header name for %s", action)
+			}
+			h.Set(name, value)
+		}
+		headers[action] = h
+	}
+	return headers, nil
+}
+
+// SetResponseHeaders sets extra headers to add to responses by action, to
+// work around SDKs that expect something the upstream doesn't send. They
+// replace any upstream header of the same name; those for "*" apply first.
+func (p *Proxy) SetResponseHeaders(headers map[string]http.Header) {
+	p.responseHeaders = headers
+}
+
+// injectHeaders adds the configured extra headers for action to resp.
+func (p *Proxy) injectHeaders(resp *http.Response, action string) {
+	for _, key := range []string{"*", action} {
+		for name, values := range p.responseHeaders[key] {
+			resp.Header[name] = append([]string(nil), values...)
+		}
+	}
+}
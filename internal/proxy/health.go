@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DefaultReadinessTimeout bounds the upstream check behind /readyz.
+const DefaultReadinessTimeout = 2 * time.Second
+
+// UpstreamStatus is the outcome of CheckUpstream.
+type UpstreamStatus struct {
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// CheckUpstream reports whether a TCP connection to the upstream can be
+// opened within timeout. It sends no request, so it is cheap enough for a
+// container healthcheck and needs no credentials.
+func (p *Proxy) CheckUpstream(ctx context.Context, timeout time.Duration) UpstreamStatus {
+	status := UpstreamStatus{URL: p.upstreamOrigin()}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.upstreamAddr())
+	status.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	conn.Close()
+	status.Reachable = true
+	return status
+}
+
+// upstreamAddr returns the host:port to dial for the upstream, defaulting
+// the port from the scheme.
+func (p *Proxy) upstreamAddr() string {
+	if p.upstream.Port() != "" {
+		return p.upstream.Host
+	}
+	port := "80"
+	if p.upstream.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(p.upstream.Hostname(), port)
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"path"
+	"time"
+)
+
+// LatencyRule delays matching calls before they are forwarded, by Min, or
+// by a random duration between Min and Max if Max is larger. An empty Action
+// or Queue matches any; Queue may be a path.Match glob.
+type LatencyRule struct {
+	Action string
+	Queue  string
+	Min    time.Duration
+	Max    time.Duration
+}
+
+type latencyRuleJSON struct {
+	Action string `json:"action,omitempty"`
+	Queue  string `json:"queue,omitempty"`
+	Min    string `json:"min"`
+	Max    string `json:"max,omitempty"`
+}
+
+func (r LatencyRule) MarshalJSON() ([]byte, error) {
+	j := latencyRuleJSON{Action: r.Action, Queue: r.Queue, Min: r.Min.String()}
+	if r.Max > r.Min {
+		j.Max = r.Max.String()
+	}
+	return json.Marshal(j)
+}
+
+func (r *LatencyRule) UnmarshalJSON(data []byte) error {
+	var j latencyRuleJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	min, err := time.ParseDuration(j.Min)
+	if err != nil || min < 0 {
+		return fmt.Errorf("invalid min delay %q", j.Min)
+	}
+	max := min
+	if j.Max != "" {
+		if max, err = time.ParseDuration(j.Max); err != nil || max < min {
+			return fmt.Errorf("invalid max delay %q", j.Max)
+		}
+	}
+	if _, err := path.Match(j.Queue, ""); err != nil {
+		return fmt.Errorf("invalid queue pattern %q: %w", j.Queue, err)
+	}
+
+	*r = LatencyRule{Action: j.Action, Queue: j.Queue, Min: min, Max: max}
+	return nil
+}
+
+// ParseLatency parses a JSON array of latency rules, for example
+// [{"action":"ReceiveMessage","min":"1s","max":"3s"},{"queue":"slow-*","min":"200ms"}].
+func ParseLatency(spec string) ([]LatencyRule, error) {
+	var rules []LatencyRule
+	if err := json.Unmarshal([]byte(spec), &rules); err != nil {
+		return nil, fmt.Errorf("invalid latency rules: %w", err)
+	}
+	return rules, nil
+}
+
+// SetLatency replaces the latency rules. It may be called while the proxy
+// is serving; the first rule matching a call decides its delay.
+func (p *Proxy) SetLatency(rules []LatencyRule) {
+	p.latencyMu.Lock()
+	defer p.latencyMu.Unlock()
+
+	p.latency = rules
+}
+
+// Latency returns the active latency rules.
+func (p *Proxy) Latency() []LatencyRule {
+	p.latencyMu.RLock()
+	defer p.latencyMu.RUnlock()
+
+	return append([]LatencyRule(nil), p.latency...)
+}
+
+// delayFor returns how long to hold a call of action on queueName.
+func (p *Proxy) delayFor(action, queueName string) time.Duration {
+	p.latencyMu.RLock()
+	defer p.latencyMu.RUnlock()
+
+	for _, rule := range p.latency {
+		if rule.Action != "" && rule.Action != action {
+			continue
+		}
+		if rule.Queue != "" && rule.Queue != queueName {
+			if ok, _ := path.Match(rule.Queue, queueName); !ok {
+				continue
+			}
+		}
+		if rule.Max > rule.Min {
+			return rule.Min + time.Duration(rand.Int63n(int64(rule.Max-rule.Min)))
+		}
+		return rule.Min
+	}
+	return 0
+}
+
+// injectLatency holds r for the delay configured for action on queueName,
+// or until the client goes away. It reports whether the call should still
+// be forwarded.
+func (p *Proxy) injectLatency(r *http.Request, action, queueName string) bool {
+	delay := p.delayFor(action, queueName)
+	if delay <= 0 {
+		return true
+	}
+
+	log.Printf("  ~ Delaying %s by %s", action, delay.Round(time.Millisecond))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"sort"
+
+	"aws-relay/internal/store"
+)
+
+// Transport type bytes of the SQS message attribute digest.
+const (
+	stringTransport byte = 1
+	binaryTransport byte = 2
+)
+
+// attributesMD5 computes MD5OfMessageAttributes as SQS does: over the
+// attributes sorted by name, each as its name, data type, transport type
+// byte and value, with names, types and values prefixed by their length as
+// a 4-byte big-endian integer. It returns "" for no attributes.
+func attributesMD5(attrs map[string]jsonAttributeValue) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := md5.New()
+	for _, name := range names {
+		attr := attrs[name]
+		writeLengthPrefixed(h, []byte(name))
+		writeLengthPrefixed(h, []byte(attr.DataType))
+		if attr.StringValue != nil {
+			h.Write([]byte{stringTransport})
+			writeLengthPrefixed(h, []byte(*attr.StringValue))
+		} else {
+			h.Write([]byte{binaryTransport})
+			writeLengthPrefixed(h, attr.BinaryValue)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeLengthPrefixed(h hash.Hash, b []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+	h.Write(n[:])
+	h.Write(b)
+}
+
+// formTypedAttributes returns the typed values of the prefix.N.Name and
+// prefix.N.Value.* params of a form. Binary values are base64 in the form.
+func formTypedAttributes(form url.Values, prefix string) map[string]jsonAttributeValue {
+	names := formEntries(form, prefix, "Name")
+	types := formEntries(form, prefix, "Value.DataType")
+	strs := formEntries(form, prefix, "Value.StringValue")
+	bins := formEntries(form, prefix, "Value.BinaryValue")
+
+	attrs := make(map[string]jsonAttributeValue)
+	for idx, name := range names {
+		attr := jsonAttributeValue{DataType: types[idx]}
+		if v, ok := strs[idx]; ok {
+			attr.StringValue = &v
+		} else if v, ok := bins[idx]; ok {
+			attr.BinaryValue, _ = base64.StdEncoding.DecodeString(v)
+		}
+		attrs[name] = attr
+	}
+	return attrs
+}
+
+// checkAttributesMD5 flags a send whose MD5OfMessageAttributes, as reported
+// by the upstream, differs from the digest of the attributes the client
+// sent, which points at an attribute encoding bug on one side.
+func (p *Proxy) checkAttributesMD5(queueName, messageID string, msg outgoingMessage, reported string) {
+	if msg.AttributesMD5 == "" || reported == "" || msg.AttributesMD5 == reported {
+		return
+	}
+	p.store.RecordAnomaly(store.AnomalyAttributeMD5, queueName, fmt.Sprintf("Message %s: upstream MD5OfMessageAttributes %s, expected %s from the attributes sent", messageID, reported, msg.AttributesMD5))
+}
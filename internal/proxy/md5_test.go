@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"aws-relay/internal/store"
+)
+
+// attributesDigest is MD5OfMessageAttributes of the attributes of
+// TestDecodeTypedAttributes: name, count and blob.
+const attributesDigest = "3ebe06a20a2b2ea5fc8598bf7c3b24a8"
+
+func TestAttributesMD5(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  outgoingMessage
+		want string
+	}{
+		{"JSON", decodeSendRequest(`{"MessageBody":"hi","MessageAttributes":{
+			"name":{"DataType":"String","StringValue":"Acme"},
+			"count":{"DataType":"Number.int","StringValue":"42"},
+			"blob":{"DataType":"Binary","BinaryValue":"`+binaryValue+`"}}}`, nil, true), attributesDigest},
+		{"form", decodeSendRequest("", parseForm("MessageBody=hi"+
+			"&MessageAttribute.3.Name=name&MessageAttribute.3.Value.DataType=String&MessageAttribute.3.Value.StringValue=Acme"+
+			"&MessageAttribute.1.Name=count&MessageAttribute.1.Value.DataType=Number.int&MessageAttribute.1.Value.StringValue=42"+
+			"&MessageAttribute.2.Name=blob&MessageAttribute.2.Value.DataType=Binary&MessageAttribute.2.Value.BinaryValue="+binaryValue), false), attributesDigest},
+		{"single string", decodeSendRequest(`{"MessageAttributes":{"name":{"DataType":"String","StringValue":"Acme"}}}`, nil, true), "e213a5c5f1d31c3b5d448d703b280609"},
+		{"none", decodeSendRequest(`{"MessageBody":"hi"}`, nil, true), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.msg.AttributesMD5 != tt.want {
+				t.Errorf("digest = %q, want %q", tt.msg.AttributesMD5, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttributesMD5Mismatch(t *testing.T) {
+	const send = `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi","MessageAttributes":{
+		"name":{"DataType":"String","StringValue":"Acme"},
+		"count":{"DataType":"Number.int","StringValue":"42"},
+		"blob":{"DataType":"Binary","BinaryValue":"` + binaryValue + `"}}}`
+
+	tests := []struct {
+		name     string
+		reported string
+		want     int // attribute MD5 anomalies
+	}{
+		{"match", attributesDigest, 0},
+		{"corrupted", "0" + attributesDigest[1:], 1},
+		{"not reported", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := testUpstream(t, http.StatusOK, `{"MessageId":"m-1","MD5OfMessageAttributes":"`+tt.reported+`"}`)
+			_, s, relay := newTestRelay(t, upstream)
+			callJSON(t, relay, "SendMessage", send)
+
+			got := 0
+			for _, a := range s.GetAnomalies() {
+				if a.Kind == store.AnomalyAttributeMD5 {
+					got++
+				}
+			}
+			if got != tt.want {
+				t.Errorf("attribute MD5 anomalies = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
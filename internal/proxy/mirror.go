@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"aws-relay/internal/store"
+)
+
+// MirrorHeader marks the SendMessage calls the relay issues to mirror a
+// captured send. Sends carrying it are never mirrored again, so a shadow
+// queue reached through a relay cannot cause a loop.
+const MirrorHeader = "X-Relay-Mirror"
+
+// SetShadowQueue makes the proxy copy every successful SendMessage to the
+// queue at queueURL on the upstream. An empty URL disables mirroring.
+func (p *Proxy) SetShadowQueue(queueURL string) {
+	p.shadowQueueURL = queueURL
+}
+
+// shouldMirror reports whether a send to queueName should be copied to the
+// shadow queue.
+func (p *Proxy) shouldMirror(queueName string, mirrored bool) bool {
+	if p.shadowQueueURL == "" || mirrored {
+		return false
+	}
+	// Sends to the shadow queue itself would otherwise be copied forever
+	return queueName != extractQueueName(p.shadowQueueURL)
+}
+
+// mirrorSend asynchronously sends a copy of a captured message to the shadow
+// queue and records the outcome against the original message.
+func (p *Proxy) mirrorSend(messageID, body string, attributes, types map[string]string) {
+	params := url.Values{}
+	params.Set("QueueUrl", p.shadowQueueURL)
+	params.Set("MessageBody", body)
+	setAttributeParams(params, attributes, types)
+
+	header := http.Header{}
+	header.Set(MirrorHeader, messageID)
+
+	go func() {
+		status, respBody, err := p.callWithHeader("SendMessage", params, header)
+		if err == nil && status >= 300 {
+			err = fmt.Errorf("upstream returned %d", status)
+		}
+
+		shadowID := extractXMLTag(respBody, "MessageId")
+		p.store.RecordMirror(messageID, shadowID, err)
+		if err != nil {
+			log.Printf("  ! Mirroring %s to shadow queue failed: %v", messageID, err)
+			return
+		}
+		log.Printf("  -> Mirrored %s to shadow queue as %s", messageID, shadowID)
+	}()
+}
+
+// setAttributeParams adds captured message attributes to SendMessage params,
+// each with its captured DataType, String if unknown.
+func setAttributeParams(params url.Values, attributes, types map[string]string) {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		prefix := "MessageAttribute." + strconv.Itoa(i+1)
+		dataType := types[name]
+		if dataType == "" {
+			dataType = "String"
+		}
+		params.Set(prefix+".Name", name)
+		params.Set(prefix+".Value.DataType", dataType)
+		if store.IsBinaryType(dataType) {
+			params.Set(prefix+".Value.BinaryValue", attributes[name])
+		} else {
+			params.Set(prefix+".Value.StringValue", attributes[name])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendsMirroredToShadowQueue(t *testing.T) {
+	const shadowURL = "http://localhost:4566/000000000000/orders-shadow"
+
+	type mirror struct {
+		of     string
+		params url.Values
+	}
+	mirrors := make(chan mirror, 10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Header.Get(MirrorHeader) == "" {
+			w.Write([]byte(`{"MessageId":"m-1"}`))
+			return
+		}
+		mirrors <- mirror{of: r.Header.Get(MirrorHeader), params: r.Form}
+		w.Write([]byte(`<SendMessageResponse><SendMessageResult><MessageId>shadow-1</MessageId></SendMessageResult></SendMessageResponse>`))
+	}))
+	t.Cleanup(upstream.Close)
+	p, _, relay := newTestRelay(t, upstream)
+	p.SetShadowQueue(shadowURL)
+
+	callJSON(t, relay, "SendMessage", `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi",
+		"MessageAttributes":{"kind":{"DataType":"String","StringValue":"a"}}}`)
+
+	select {
+	case m := <-mirrors:
+		if m.of != "m-1" || m.params.Get("QueueUrl") != shadowURL || m.params.Get("MessageBody") != "hi" ||
+			m.params.Get("MessageAttribute.1.Name") != "kind" || m.params.Get("MessageAttribute.1.Value.StringValue") != "a" {
+			t.Errorf("mirrored send of %q = %v, want a copy of m-1 to the shadow queue", m.of, m.params)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send was not mirrored")
+	}
+
+	// Neither sends to the shadow queue nor sends that are already mirror
+	// copies are mirrored again
+	callJSON(t, relay, "SendMessage", `{"QueueUrl":"`+shadowURL+`","MessageBody":"hi"}`)
+	req, _ := http.NewRequest(http.MethodPost, relay.URL+"/", strings.NewReader("Action=SendMessage&QueueUrl=http%3A%2F%2Flocalhost%3A4566%2F000000000000%2Forders&MessageBody=hi"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(MirrorHeader, "m-0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// The relayed mirror copy itself reaches the upstream once
+	<-mirrors
+
+	select {
+	case m := <-mirrors:
+		t.Errorf("unexpected mirrored send of %q: %v", m.of, m.params)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
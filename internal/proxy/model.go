@@ -0,0 +1,386 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The message-level handlers first decode requests and responses of either
+// protocol into the types below, then record them through a single code
+// path, so the JSON and XML variants of an operation capture the same data.
+
+// outgoingMessage is a message sent by SendMessage or one entry of
+// SendMessageBatch.
+type outgoingMessage struct {
+	ID               string // batch entry ID
+	Body             string
+	HasBody          bool // MessageBody was given, even if empty
+	GroupID          string
+	DeduplicationID  string
+	Attributes       map[string]string
+	AttributeTypes   map[string]string // DataType of each of Attributes
+	SystemAttributes map[string]string
+
+	// AttributesMD5 is the digest of the typed MessageAttributes, computed
+	// locally to check the upstream's MD5OfMessageAttributes; "" if none
+	AttributesMD5 string
+}
+
+// receivedMessage is a message returned by ReceiveMessage.
+type receivedMessage struct {
+	MessageID        string
+	ReceiptHandle    string
+	Body             string
+	Attributes       map[string]string
+	AttributeTypes   map[string]string // DataType of each of Attributes
+	SystemAttributes map[string]string // e.g. SentTimestamp, if requested
+}
+
+// receiptEntry is an entry of DeleteMessageBatch or
+// ChangeMessageVisibilityBatch.
+type receiptEntry struct {
+	ID                string
+	ReceiptHandle     string
+	VisibilityTimeout int
+}
+
+// batchResult is the response to a batch call: the entries that succeeded,
+// with the message ID SendMessageBatch assigned them, and those that failed.
+type batchResult struct {
+	Successful []batchSuccess
+	Failed     []batchFailure
+}
+
+type batchSuccess struct {
+	ID             string
+	MessageID      string
+	AttributesMD5  string // MD5OfMessageAttributes of a SendMessageBatch entry
+	SequenceNumber string // of a SendMessageBatch entry to a FIFO queue
+}
+
+type batchFailure struct {
+	ID          string
+	Code        string
+	Message     string
+	SenderFault bool
+}
+
+// failed returns the IDs of the failed entries.
+func (r batchResult) failed() map[string]bool {
+	ids := make(map[string]bool, len(r.Failed))
+	for _, f := range r.Failed {
+		ids[f.ID] = true
+	}
+	return ids
+}
+
+func decodeSendRequest(body string, form url.Values, isJSON bool) outgoingMessage {
+	if isJSON {
+		var req jsonOutgoingMessage
+		json.Unmarshal([]byte(body), &req)
+		return req.model()
+	}
+	return formOutgoingMessage(form, "")
+}
+
+func decodeSendBatchRequest(body string, form url.Values, isJSON bool) []outgoingMessage {
+	var entries []outgoingMessage
+	if isJSON {
+		var req struct {
+			Entries []jsonOutgoingMessage
+		}
+		json.Unmarshal([]byte(body), &req)
+		for _, e := range req.Entries {
+			entries = append(entries, e.model())
+		}
+		return entries
+	}
+
+	ids := formEntries(form, "SendMessageBatchRequestEntry", "Id")
+	for _, n := range entryIndexes(ids) {
+		entries = append(entries, formOutgoingMessage(form, fmt.Sprintf("SendMessageBatchRequestEntry.%d.", n)))
+	}
+	return entries
+}
+
+func decodeReceiptBatchRequest(body string, form url.Values, isJSON bool, entryPrefix string) []receiptEntry {
+	var entries []receiptEntry
+	if isJSON {
+		var req struct {
+			Entries []struct {
+				Id                string
+				ReceiptHandle     string
+				VisibilityTimeout int
+			}
+		}
+		json.Unmarshal([]byte(body), &req)
+		for _, e := range req.Entries {
+			entries = append(entries, receiptEntry{e.Id, e.ReceiptHandle, e.VisibilityTimeout})
+		}
+		return entries
+	}
+
+	ids := formEntries(form, entryPrefix, "Id")
+	handles := formEntries(form, entryPrefix, "ReceiptHandle")
+	timeouts := formEntries(form, entryPrefix, "VisibilityTimeout")
+	for _, n := range entryIndexes(handles) {
+		timeout, _ := strconv.Atoi(timeouts[n])
+		entries = append(entries, receiptEntry{ids[n], handles[n], timeout})
+	}
+	return entries
+}
+
+// decodeSendResponse returns the message ID SendMessage assigned, the
+// MD5OfMessageAttributes it reported and, for a FIFO queue, the sequence
+// number.
+func decodeSendResponse(body string, isJSON bool) (messageID, attributesMD5, sequenceNumber string) {
+	if isJSON {
+		return parseJSONField(body, "MessageId"), parseJSONField(body, "MD5OfMessageAttributes"), parseJSONField(body, "SequenceNumber")
+	}
+	var resp struct {
+		MessageID      string `xml:"SendMessageResult>MessageId"`
+		AttributesMD5  string `xml:"SendMessageResult>MD5OfMessageAttributes"`
+		SequenceNumber string `xml:"SendMessageResult>SequenceNumber"`
+	}
+	xml.Unmarshal([]byte(body), &resp)
+	return resp.MessageID, resp.AttributesMD5, resp.SequenceNumber
+}
+
+// decodeReceiveResponse returns the messages of a ReceiveMessage response.
+// A truncated XML response yields the messages before the cut.
+func decodeReceiveResponse(body string, isJSON bool) []receivedMessage {
+	var messages []receivedMessage
+	if isJSON {
+		var resp struct {
+			Messages []struct {
+				MessageId         string
+				ReceiptHandle     string
+				Body              string
+				MessageAttributes map[string]jsonAttributeValue
+				Attributes        map[string]string
+			}
+		}
+		json.Unmarshal([]byte(body), &resp)
+		for _, m := range resp.Messages {
+			messages = append(messages, receivedMessage{
+				MessageID:        m.MessageId,
+				ReceiptHandle:    m.ReceiptHandle,
+				Body:             m.Body,
+				Attributes:       attributeValues(m.MessageAttributes),
+				AttributeTypes:   attributeTypes(m.MessageAttributes),
+				SystemAttributes: m.Attributes,
+			})
+		}
+		return messages
+	}
+
+	forEachXMLElement(body, func(name string) bool { return name == "Message" }, func(dec *xml.Decoder, start xml.StartElement) error {
+		var m struct {
+			MessageId         string
+			ReceiptHandle     string
+			Body              string
+			MessageAttributes []struct {
+				Name        string
+				DataType    string  `xml:"Value>DataType"`
+				StringValue *string `xml:"Value>StringValue"`
+				BinaryValue *string `xml:"Value>BinaryValue"` // base64
+			} `xml:"MessageAttribute"`
+			Attributes []struct {
+				Name  string
+				Value string
+			} `xml:"Attribute"`
+		}
+		if err := dec.DecodeElement(&m, &start); err != nil {
+			return err
+		}
+		// Error responses have a <Message> too
+		if m.MessageId == "" {
+			return nil
+		}
+
+		msg := receivedMessage{
+			MessageID:        m.MessageId,
+			ReceiptHandle:    m.ReceiptHandle,
+			Body:             m.Body,
+			Attributes:       make(map[string]string),
+			AttributeTypes:   make(map[string]string),
+			SystemAttributes: make(map[string]string),
+		}
+		for _, attr := range m.MessageAttributes {
+			switch {
+			case attr.StringValue != nil:
+				msg.Attributes[attr.Name] = *attr.StringValue
+			case attr.BinaryValue != nil:
+				msg.Attributes[attr.Name] = strings.TrimSpace(*attr.BinaryValue)
+			default:
+				continue
+			}
+			msg.AttributeTypes[attr.Name] = attr.DataType
+		}
+		for _, attr := range m.Attributes {
+			msg.SystemAttributes[attr.Name] = attr.Value
+		}
+		messages = append(messages, msg)
+		return nil
+	})
+	return messages
+}
+
+// decodeBatchResponse returns the outcome of each entry of a batch call.
+func decodeBatchResponse(body string, isJSON bool) batchResult {
+	var result batchResult
+	if isJSON {
+		var resp struct {
+			Successful []struct {
+				Id                     string
+				MessageId              string
+				MD5OfMessageAttributes string
+				SequenceNumber         string
+			}
+			Failed []struct {
+				Id          string
+				Code        string
+				Message     string
+				SenderFault bool
+			}
+		}
+		json.Unmarshal([]byte(body), &resp)
+		for _, s := range resp.Successful {
+			result.Successful = append(result.Successful, batchSuccess{s.Id, s.MessageId, s.MD5OfMessageAttributes, s.SequenceNumber})
+		}
+		for _, f := range resp.Failed {
+			result.Failed = append(result.Failed, batchFailure{f.Id, f.Code, f.Message, f.SenderFault})
+		}
+		return result
+	}
+
+	isEntry := func(name string) bool {
+		return name == "BatchResultErrorEntry" || strings.HasSuffix(name, "BatchResultEntry")
+	}
+	forEachXMLElement(body, isEntry, func(dec *xml.Decoder, start xml.StartElement) error {
+		var e struct {
+			Id                     string
+			MessageId              string
+			MD5OfMessageAttributes string
+			SequenceNumber         string
+			Code                   string
+			Message                string
+			SenderFault            bool
+		}
+		if err := dec.DecodeElement(&e, &start); err != nil {
+			return err
+		}
+		if start.Name.Local == "BatchResultErrorEntry" {
+			result.Failed = append(result.Failed, batchFailure{e.Id, e.Code, e.Message, e.SenderFault})
+		} else {
+			result.Successful = append(result.Successful, batchSuccess{e.Id, e.MessageId, e.MD5OfMessageAttributes, e.SequenceNumber})
+		}
+		return nil
+	})
+	return result
+}
+
+// jsonOutgoingMessage is a SendMessage request or SendMessageBatch entry in
+// the JSON protocol.
+type jsonOutgoingMessage struct {
+	Id                      string
+	MessageBody             *string
+	MessageGroupId          string
+	MessageDeduplicationId  string
+	MessageAttributes       map[string]jsonAttributeValue
+	MessageSystemAttributes map[string]jsonAttributeValue
+}
+
+func (m jsonOutgoingMessage) model() outgoingMessage {
+	msg := outgoingMessage{
+		ID:               m.Id,
+		HasBody:          m.MessageBody != nil,
+		GroupID:          m.MessageGroupId,
+		DeduplicationID:  m.MessageDeduplicationId,
+		Attributes:       attributeValues(m.MessageAttributes),
+		AttributeTypes:   attributeTypes(m.MessageAttributes),
+		SystemAttributes: attributeValues(m.MessageSystemAttributes),
+		AttributesMD5:    attributesMD5(m.MessageAttributes),
+	}
+	if m.MessageBody != nil {
+		msg.Body = *m.MessageBody
+	}
+	return msg
+}
+
+// formOutgoingMessage reads the SendMessage params under prefix, "" for a
+// SendMessage request or "SendMessageBatchRequestEntry.N." for a batch entry.
+func formOutgoingMessage(form url.Values, prefix string) outgoingMessage {
+	_, hasBody := form[prefix+"MessageBody"]
+	attrs := formTypedAttributes(form, prefix+"MessageAttribute")
+	return outgoingMessage{
+		ID:               form.Get(prefix + "Id"),
+		Body:             form.Get(prefix + "MessageBody"),
+		HasBody:          hasBody,
+		GroupID:          form.Get(prefix + "MessageGroupId"),
+		DeduplicationID:  form.Get(prefix + "MessageDeduplicationId"),
+		Attributes:       attributeValues(attrs),
+		AttributeTypes:   attributeTypes(attrs),
+		SystemAttributes: attributeValues(formTypedAttributes(form, prefix+"MessageSystemAttribute")),
+		AttributesMD5:    attributesMD5(attrs),
+	}
+}
+
+// jsonAttributeValue is a typed message attribute value. BinaryValue is
+// base64 in JSON, which encoding/json decodes.
+type jsonAttributeValue struct {
+	DataType    string
+	StringValue *string
+	BinaryValue []byte
+}
+
+// attributeValues returns the value of each attribute as captured: string
+// values (of the String and Number types) as is, binary values base64
+// encoded. Attributes with neither are dropped.
+func attributeValues(attrs map[string]jsonAttributeValue) map[string]string {
+	values := make(map[string]string)
+	for name, v := range attrs {
+		switch {
+		case v.StringValue != nil:
+			values[name] = *v.StringValue
+		case v.BinaryValue != nil:
+			values[name] = base64.StdEncoding.EncodeToString(v.BinaryValue)
+		}
+	}
+	return values
+}
+
+// attributeTypes returns the DataType of each attribute attributeValues
+// keeps, which tells binary values apart from strings.
+func attributeTypes(attrs map[string]jsonAttributeValue) map[string]string {
+	types := make(map[string]string)
+	for name, v := range attrs {
+		if v.StringValue != nil || v.BinaryValue != nil {
+			types[name] = v.DataType
+		}
+	}
+	return types
+}
+
+// forEachXMLElement calls fn with each element of an XML document whose
+// local name satisfies match, leaving fn to decode it. Decoding stops at the
+// first error, so a truncated document still yields the elements before it.
+func forEachXMLElement(body string, match func(name string) bool, fn func(dec *xml.Decoder, start xml.StartElement) error) {
+	dec := xml.NewDecoder(strings.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		if start, ok := tok.(xml.StartElement); ok && match(start.Name.Local) {
+			if fn(dec, start) != nil {
+				return
+			}
+		}
+	}
+}
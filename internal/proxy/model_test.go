@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// binaryValue is the base64 of the bytes 0x00 0xff 0x10, which aren't text.
+const binaryValue = "AP8Q"
+
+func TestDecodeTypedAttributes(t *testing.T) {
+	wantValues := map[string]string{"name": "Acme", "count": "42", "blob": binaryValue}
+	wantTypes := map[string]string{"name": "String", "count": "Number.int", "blob": "Binary"}
+
+	tests := []struct {
+		name   string
+		decode func() (map[string]string, map[string]string)
+	}{
+		{"JSON send", func() (map[string]string, map[string]string) {
+			msg := decodeSendRequest(`{"MessageBody":"hi","MessageAttributes":{
+				"name":{"DataType":"String","StringValue":"Acme"},
+				"count":{"DataType":"Number.int","StringValue":"42"},
+				"blob":{"DataType":"Binary","BinaryValue":"`+binaryValue+`"}}}`, nil, true)
+			return msg.Attributes, msg.AttributeTypes
+		}},
+		{"form send", func() (map[string]string, map[string]string) {
+			msg := decodeSendRequest("", parseForm("Action=SendMessage&MessageBody=hi"+
+				"&MessageAttribute.1.Name=name&MessageAttribute.1.Value.DataType=String&MessageAttribute.1.Value.StringValue=Acme"+
+				"&MessageAttribute.2.Name=count&MessageAttribute.2.Value.DataType=Number.int&MessageAttribute.2.Value.StringValue=42"+
+				"&MessageAttribute.3.Name=blob&MessageAttribute.3.Value.DataType=Binary&MessageAttribute.3.Value.BinaryValue="+binaryValue), false)
+			return msg.Attributes, msg.AttributeTypes
+		}},
+		{"JSON receive", func() (map[string]string, map[string]string) {
+			msgs := decodeReceiveResponse(`{"Messages":[{"MessageId":"m-1","ReceiptHandle":"r-1","Body":"hi","MessageAttributes":{
+				"name":{"DataType":"String","StringValue":"Acme"},
+				"count":{"DataType":"Number.int","StringValue":"42"},
+				"blob":{"DataType":"Binary","BinaryValue":"`+binaryValue+`"}}}]}`, true)
+			if len(msgs) != 1 {
+				return nil, nil
+			}
+			return msgs[0].Attributes, msgs[0].AttributeTypes
+		}},
+		{"XML receive", func() (map[string]string, map[string]string) {
+			msgs := decodeReceiveResponse(`<ReceiveMessageResponse><ReceiveMessageResult><Message>
+				<MessageId>m-1</MessageId><ReceiptHandle>r-1</ReceiptHandle><Body>hi</Body>
+				<MessageAttribute><Name>name</Name><Value><DataType>String</DataType><StringValue>Acme</StringValue></Value></MessageAttribute>
+				<MessageAttribute><Name>count</Name><Value><DataType>Number.int</DataType><StringValue>42</StringValue></Value></MessageAttribute>
+				<MessageAttribute><Name>blob</Name><Value><DataType>Binary</DataType><BinaryValue>
+					`+binaryValue+`
+				</BinaryValue></Value></MessageAttribute>
+			</Message></ReceiveMessageResult></ReceiveMessageResponse>`, false)
+			if len(msgs) != 1 {
+				return nil, nil
+			}
+			return msgs[0].Attributes, msgs[0].AttributeTypes
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, types := tt.decode()
+			if !reflect.DeepEqual(values, wantValues) {
+				t.Errorf("values = %v, want %v", values, wantValues)
+			}
+			if !reflect.DeepEqual(types, wantTypes) {
+				t.Errorf("types = %v, want %v", types, wantTypes)
+			}
+		})
+	}
+}
+
+func TestSendCapturesBinaryAttributes(t *testing.T) {
+	_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{"MessageId":"m-1"}`))
+
+	callJSON(t, relay, "SendMessage", `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi",
+		"MessageAttributes":{"blob":{"DataType":"Binary","BinaryValue":"`+binaryValue+`"}}}`)
+	messages := s.GetMessages("orders", true)
+	if len(messages) != 1 {
+		t.Fatalf("messages = %+v, want one", messages)
+	}
+	msg := messages[0]
+	if msg.Attributes["blob"] != binaryValue || msg.AttributeTypes["blob"] != "Binary" {
+		t.Errorf("attribute blob = %q of type %q, want %q of type Binary", msg.Attributes["blob"], msg.AttributeTypes["blob"], binaryValue)
+	}
+}
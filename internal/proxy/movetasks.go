@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+func (p *Proxy) handleStartMessageMoveTask(reqBody string, form url.Values, respBody string, isJSON bool) {
+	var e moveTaskEntry
+	if isJSON {
+		json.Unmarshal([]byte(reqBody), &e)
+		e.TaskHandle = parseJSONField(respBody, "TaskHandle")
+	} else {
+		e.SourceArn = form.Get("SourceArn")
+		e.DestinationArn = form.Get("DestinationArn")
+		e.MaxNumberOfMessagesPerSecond, _ = strconv.Atoi(form.Get("MaxNumberOfMessagesPerSecond"))
+		e.TaskHandle = extractXMLTag(respBody, "TaskHandle")
+	}
+	e.Status = "RUNNING"
+	task := e.task()
+
+	if task.TaskHandle == "" {
+		return
+	}
+	p.store.RecordMoveTask(task)
+	log.Printf("  -> Move task started from %s", task.SourceArn)
+}
+
+func (p *Proxy) handleCancelMessageMoveTask(reqBody string, form url.Values, respBody string, isJSON bool) {
+	var e moveTaskEntry
+	if isJSON {
+		json.Unmarshal([]byte(respBody), &e)
+		e.TaskHandle = parseJSONField(reqBody, "TaskHandle")
+	} else {
+		e.TaskHandle = form.Get("TaskHandle")
+		e.ApproximateNumberOfMessagesMoved, _ = strconv.Atoi(extractXMLTag(respBody, "ApproximateNumberOfMessagesMoved"))
+	}
+	e.Status = "CANCELLING"
+	task := e.task()
+
+	if task.TaskHandle == "" {
+		return
+	}
+	p.store.RecordMoveTask(task)
+	log.Printf("  -> Move task cancelled after %d message(s)", task.MessagesMoved)
+}
+
+func (p *Proxy) handleListMessageMoveTasks(respBody string, isJSON bool) {
+	var tasks []store.MoveTask
+	if isJSON {
+		tasks = parseMoveTasksJSON(respBody)
+	} else {
+		tasks = parseMoveTasksXML(respBody)
+	}
+
+	for _, task := range tasks {
+		p.store.RecordMoveTask(task)
+	}
+	log.Printf("  -> Observed %d move task(s)", len(tasks))
+}
+
+// moveTaskEntry holds the move task fields of a request or response, named
+// as in the JSON protocol.
+type moveTaskEntry struct {
+	TaskHandle                        string
+	Status                            string
+	SourceArn                         string
+	DestinationArn                    string
+	MaxNumberOfMessagesPerSecond      int
+	ApproximateNumberOfMessagesMoved  int
+	ApproximateNumberOfMessagesToMove int
+	FailureReason                     string
+	StartedTimestamp                  int64
+}
+
+func (e moveTaskEntry) task() store.MoveTask {
+	task := store.MoveTask{
+		TaskHandle:     e.TaskHandle,
+		Status:         e.Status,
+		SourceArn:      e.SourceArn,
+		DestinationArn: e.DestinationArn,
+		MaxPerSecond:   e.MaxNumberOfMessagesPerSecond,
+		MessagesMoved:  e.ApproximateNumberOfMessagesMoved,
+		MessagesToMove: e.ApproximateNumberOfMessagesToMove,
+		FailureReason:  e.FailureReason,
+	}
+	if e.StartedTimestamp > 0 {
+		task.StartedAt = time.UnixMilli(e.StartedTimestamp)
+	}
+	return task
+}
+
+func parseMoveTasksJSON(body string) []store.MoveTask {
+	var resp struct {
+		Results []moveTaskEntry
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil
+	}
+
+	tasks := make([]store.MoveTask, 0, len(resp.Results))
+	for _, e := range resp.Results {
+		tasks = append(tasks, e.task())
+	}
+	return tasks
+}
+
+func parseMoveTasksXML(body string) []store.MoveTask {
+	entryRe := regexp.MustCompile(`(?s)<ListMessageMoveTasksResultEntry>(.*?)</ListMessageMoveTasksResultEntry>`)
+
+	var tasks []store.MoveTask
+	for _, match := range entryRe.FindAllStringSubmatch(body, -1) {
+		xml := match[1]
+		e := moveTaskEntry{
+			TaskHandle:     extractXMLTag(xml, "TaskHandle"),
+			Status:         extractXMLTag(xml, "Status"),
+			SourceArn:      extractXMLTag(xml, "SourceArn"),
+			DestinationArn: extractXMLTag(xml, "DestinationArn"),
+			FailureReason:  extractXMLTag(xml, "FailureReason"),
+		}
+		e.MaxNumberOfMessagesPerSecond, _ = strconv.Atoi(extractXMLTag(xml, "MaxNumberOfMessagesPerSecond"))
+		e.ApproximateNumberOfMessagesMoved, _ = strconv.Atoi(extractXMLTag(xml, "ApproximateNumberOfMessagesMoved"))
+		e.ApproximateNumberOfMessagesToMove, _ = strconv.Atoi(extractXMLTag(xml, "ApproximateNumberOfMessagesToMove"))
+		e.StartedTimestamp, _ = strconv.ParseInt(extractXMLTag(xml, "StartedTimestamp"), 10, 64)
+		tasks = append(tasks, e.task())
+	}
+	return tasks
+}
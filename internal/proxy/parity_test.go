@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"aws-relay/internal/store"
+)
+
+// scriptedUpstream answers each call with the response set for its action,
+// whichever protocol it used.
+type scriptedUpstream struct {
+	mu        sync.Mutex
+	responses map[string]string
+}
+
+func (u *scriptedUpstream) set(action, body string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.responses[action] = body
+}
+
+func (u *scriptedUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := parseActionFromTarget(r.Header.Get("X-Amz-Target"))
+	if action == "" {
+		r.ParseForm()
+		action = r.PostForm.Get("Action")
+	}
+	u.mu.Lock()
+	body := u.responses[action]
+	u.mu.Unlock()
+	io.WriteString(w, body)
+}
+
+// parityEvent is what an event records of a call, leaving out what differs
+// from one call to the next, such as IDs, times and trace IDs.
+type parityEvent struct {
+	Action           store.MessageAction
+	MessageID        string
+	ReceiptHandle    string
+	QueueURL         string
+	QueueName        string
+	Body             string
+	Deleted          bool
+	Attributes       map[string]string
+	AttributeTypes   map[string]string
+	SystemAttributes map[string]string
+	SendSystemAttrs  map[string]string
+}
+
+func parityEvents(s *store.Store) []parityEvent {
+	orNil := func(m map[string]string) map[string]string {
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	}
+	var events []parityEvent
+	for _, e := range s.GetHistory(0) {
+		events = append(events, parityEvent{
+			Action:           e.Action,
+			MessageID:        e.MessageID,
+			ReceiptHandle:    e.ReceiptHandle,
+			QueueURL:         e.QueueURL,
+			QueueName:        e.QueueName,
+			Body:             e.Body,
+			Deleted:          e.Deleted,
+			Attributes:       orNil(e.Attributes),
+			AttributeTypes:   orNil(e.AttributeTypes),
+			SystemAttributes: orNil(e.SystemAttributes),
+			SendSystemAttrs:  orNil(e.MessageSystemAttributes),
+		})
+	}
+	return events
+}
+
+func anomalyDetails(s *store.Store) []string {
+	var details []string
+	for _, a := range s.GetAnomalies() {
+		details = append(details, string(a.Kind)+": "+a.Detail)
+	}
+	return details
+}
+
+func TestJSONAndQueryProtocolsRecordTheSame(t *testing.T) {
+	const queueURL = "http://localhost:4566/000000000000/orders"
+	steps := []struct {
+		action   string
+		jsonBody string
+		jsonResp string
+		form     url.Values
+		xmlResp  string
+	}{
+		{
+			action:   "SendMessage",
+			jsonBody: `{"QueueUrl":"` + queueURL + `","MessageBody":"hello","MessageAttributes":{"trace":{"DataType":"String","StringValue":"t-1"}},"MessageSystemAttributes":{"AWSTraceHeader":{"DataType":"String","StringValue":"Root=1"}}}`,
+			jsonResp: `{"MessageId":"m-1"}`,
+			form: url.Values{
+				"QueueUrl":                                   {queueURL},
+				"MessageBody":                                {"hello"},
+				"MessageAttribute.1.Name":                    {"trace"},
+				"MessageAttribute.1.Value.DataType":          {"String"},
+				"MessageAttribute.1.Value.StringValue":       {"t-1"},
+				"MessageSystemAttribute.1.Name":              {"AWSTraceHeader"},
+				"MessageSystemAttribute.1.Value.DataType":    {"String"},
+				"MessageSystemAttribute.1.Value.StringValue": {"Root=1"},
+			},
+			xmlResp: `<SendMessageResponse><SendMessageResult><MessageId>m-1</MessageId></SendMessageResult></SendMessageResponse>`,
+		},
+		{
+			action:   "SendMessageBatch",
+			jsonBody: `{"QueueUrl":"` + queueURL + `","Entries":[{"Id":"e1","MessageBody":"second"},{"Id":"e2","MessageBody":"third"}]}`,
+			jsonResp: `{"Successful":[{"Id":"e1","MessageId":"m-2"}],"Failed":[{"Id":"e2","Code":"InvalidParameterValue","Message":"bad","SenderFault":true}]}`,
+			form: url.Values{
+				"QueueUrl":                                   {queueURL},
+				"SendMessageBatchRequestEntry.1.Id":          {"e1"},
+				"SendMessageBatchRequestEntry.1.MessageBody": {"second"},
+				"SendMessageBatchRequestEntry.2.Id":          {"e2"},
+				"SendMessageBatchRequestEntry.2.MessageBody": {"third"},
+			},
+			xmlResp: `<SendMessageBatchResponse><SendMessageBatchResult>` +
+				`<SendMessageBatchResultEntry><Id>e1</Id><MessageId>m-2</MessageId></SendMessageBatchResultEntry>` +
+				`<BatchResultErrorEntry><Id>e2</Id><Code>InvalidParameterValue</Code><Message>bad</Message><SenderFault>true</SenderFault></BatchResultErrorEntry>` +
+				`</SendMessageBatchResult></SendMessageBatchResponse>`,
+		},
+		{
+			action:   "ReceiveMessage",
+			jsonBody: `{"QueueUrl":"` + queueURL + `","AttributeNames":["All"],"MessageAttributeNames":["All"]}`,
+			jsonResp: `{"Messages":[` +
+				`{"MessageId":"m-1","ReceiptHandle":"r-1","Body":"hello","Attributes":{"ApproximateReceiveCount":"1","SentTimestamp":"1704164645000"},"MessageAttributes":{"trace":{"DataType":"String","StringValue":"t-1"}}},` +
+				`{"MessageId":"m-2","ReceiptHandle":"r-2","Body":"second","Attributes":{"ApproximateReceiveCount":"2"}}]}`,
+			form: url.Values{
+				"QueueUrl":               {queueURL},
+				"AttributeName.1":        {"All"},
+				"MessageAttributeName.1": {"All"},
+			},
+			xmlResp: `<ReceiveMessageResponse><ReceiveMessageResult>` +
+				`<Message><MessageId>m-1</MessageId><ReceiptHandle>r-1</ReceiptHandle><Body>hello</Body>` +
+				`<Attribute><Name>ApproximateReceiveCount</Name><Value>1</Value></Attribute>` +
+				`<Attribute><Name>SentTimestamp</Name><Value>1704164645000</Value></Attribute>` +
+				`<MessageAttribute><Name>trace</Name><Value><StringValue>t-1</StringValue><DataType>String</DataType></Value></MessageAttribute></Message>` +
+				`<Message><MessageId>m-2</MessageId><ReceiptHandle>r-2</ReceiptHandle><Body>second</Body>` +
+				`<Attribute><Name>ApproximateReceiveCount</Name><Value>2</Value></Attribute></Message>` +
+				`</ReceiveMessageResult></ReceiveMessageResponse>`,
+		},
+		{
+			action:   "DeleteMessage",
+			jsonBody: `{"QueueUrl":"` + queueURL + `","ReceiptHandle":"r-1"}`,
+			jsonResp: `{}`,
+			form:     url.Values{"QueueUrl": {queueURL}, "ReceiptHandle": {"r-1"}},
+			xmlResp:  `<DeleteMessageResponse></DeleteMessageResponse>`,
+		},
+		{
+			action:   "DeleteMessageBatch",
+			jsonBody: `{"QueueUrl":"` + queueURL + `","Entries":[{"Id":"d1","ReceiptHandle":"r-2"},{"Id":"d2","ReceiptHandle":"r-gone"}]}`,
+			jsonResp: `{"Successful":[{"Id":"d1"}],"Failed":[{"Id":"d2","Code":"ReceiptHandleIsInvalid","Message":"gone","SenderFault":true}]}`,
+			form: url.Values{
+				"QueueUrl":                                       {queueURL},
+				"DeleteMessageBatchRequestEntry.1.Id":            {"d1"},
+				"DeleteMessageBatchRequestEntry.1.ReceiptHandle": {"r-2"},
+				"DeleteMessageBatchRequestEntry.2.Id":            {"d2"},
+				"DeleteMessageBatchRequestEntry.2.ReceiptHandle": {"r-gone"},
+			},
+			xmlResp: `<DeleteMessageBatchResponse><DeleteMessageBatchResult>` +
+				`<DeleteMessageBatchResultEntry><Id>d1</Id></DeleteMessageBatchResultEntry>` +
+				`<BatchResultErrorEntry><Id>d2</Id><Code>ReceiptHandleIsInvalid</Code><Message>gone</Message><SenderFault>true</SenderFault></BatchResultErrorEntry>` +
+				`</DeleteMessageBatchResult></DeleteMessageBatchResponse>`,
+		},
+	}
+
+	jsonUpstream := &scriptedUpstream{responses: make(map[string]string)}
+	xmlUpstream := &scriptedUpstream{responses: make(map[string]string)}
+	jsonServer, xmlServer := httptest.NewServer(jsonUpstream), httptest.NewServer(xmlUpstream)
+	defer jsonServer.Close()
+	defer xmlServer.Close()
+	_, jsonStore, jsonRelay := newTestRelay(t, jsonServer)
+	_, xmlStore, xmlRelay := newTestRelay(t, xmlServer)
+
+	for _, step := range steps {
+		jsonUpstream.set(step.action, step.jsonResp)
+		xmlUpstream.set(step.action, step.xmlResp)
+		callJSON(t, jsonRelay, step.action, step.jsonBody)
+		form := url.Values{"Action": {step.action}}
+		for k, v := range step.form {
+			form[k] = v
+		}
+		callForm(t, xmlRelay, form)
+
+		jsonEvents, xmlEvents := parityEvents(jsonStore), parityEvents(xmlStore)
+		if !reflect.DeepEqual(jsonEvents, xmlEvents) {
+			t.Errorf("after %s:\nJSON recorded %+v\nquery recorded %+v", step.action, jsonEvents, xmlEvents)
+		}
+		if got, want := anomalyDetails(xmlStore), anomalyDetails(jsonStore); !reflect.DeepEqual(got, want) {
+			t.Errorf("after %s: query anomalies %q, JSON anomalies %q", step.action, got, want)
+		}
+	}
+
+	// The steps did record something worth comparing
+	events := parityEvents(jsonStore)
+	var actions []string
+	for _, e := range events {
+		actions = append(actions, string(e.Action))
+	}
+	if got, want := strings.Join(actions, ","), "delete,delete,receive,receive,send,send"; got != want {
+		t.Errorf("recorded %s, want %s", got, want)
+	}
+	if len(anomalyDetails(jsonStore)) != 2 {
+		t.Errorf("anomalies = %q, want one for each failed batch entry", anomalyDetails(jsonStore))
+	}
+}
@@ -2,22 +2,78 @@ package proxy
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"aws-relay/internal/jsonguard"
 	"aws-relay/internal/store"
 )
 
+// DefaultUnknownQueue is the queue name given to captures whose QueueUrl
+// could not be parsed.
+const DefaultUnknownQueue = "(unknown)"
+
+// TraceHeader carries the relay-generated trace ID of a proxied call on both
+// the upstream request and the client response.
+const TraceHeader = "X-Relay-Trace-Id"
+
+// requestCapture is what capturing a response needs to know about the
+// request it answers, carried in the request context under captureKey.
+type requestCapture struct {
+	body        string
+	form        url.Values // parsed body of a form-encoded request
+	contentType string
+	amzTarget   string
+	action      string
+	service     string // AWS service, if the request names one
+	generic     bool   // not a call the relay parses
+	uninspected bool   // body beyond the JSON limits, captured raw
+	started     time.Time
+}
+
+type captureKey struct{}
+
 type Proxy struct {
 	upstream *url.URL
 	proxy    *httputil.ReverseProxy
 	store    *store.Store
+	client   *http.Client
+
+	transport *http.Transport // shared by proxy and client
+
+	upstreamHost string // Host header sent upstream, if not the dial target's
+	unknownQueue string
+	strictMethod bool
+	maxJSONDepth int
+	maxJSONBytes int
+
+	upstreamTimeout time.Duration // deadline for calls other than long polls
+	shadowQueueURL  string
+	scope           CaptureScope
+	maxCaptureBytes int
+	parseTimeout    time.Duration
+
+	responseHeaders map[string]http.Header // extra response headers by action
+	faults          []FaultRule
+	faultsOff       atomic.Bool // faults can be switched off while serving
+	paused          atomic.Bool // capture can be paused while serving
+
+	latencyMu sync.RWMutex // latency is adjustable while serving
+	latency   []LatencyRule
 }
 
 func New(upstreamURL string, s *store.Store) *Proxy {
@@ -26,24 +82,89 @@ func New(upstreamURL string, s *store.Store) *Proxy {
 		log.Fatalf("Invalid upstream URL: %v", err)
 	}
 
+	transport := newUpstreamTransport()
 	p := &Proxy{
-		upstream: upstream,
-		store:    s,
+		upstream:     upstream,
+		store:        s,
+		client:       &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		transport:    transport,
+		unknownQueue: DefaultUnknownQueue,
+		maxJSONDepth: jsonguard.DefaultMaxDepth,
+		maxJSONBytes: jsonguard.DefaultMaxBytes,
+
+		upstreamTimeout: DefaultUpstreamTimeout,
+		scope:           ScopeAll,
+		maxCaptureBytes: DefaultMaxCaptureBytes,
+		parseTimeout:    DefaultParseTimeout,
 	}
 
 	p.proxy = &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
 			req.URL.Scheme = upstream.Scheme
 			req.URL.Host = upstream.Host
-			req.Host = upstream.Host
+			req.Host = p.forwardedHost()
 		},
 		ModifyResponse: p.modifyResponse,
+		Transport:      transport,
 	}
 
 	return p
 }
 
+// SetUpstreamHost overrides the Host header sent upstream, for upstreams
+// that route on virtual host while being dialled by another address. An
+// empty host restores the default of the upstream URL's host.
+func (p *Proxy) SetUpstreamHost(host string) {
+	p.upstreamHost = host
+}
+
+func (p *Proxy) forwardedHost() string {
+	if p.upstreamHost != "" {
+		return p.upstreamHost
+	}
+	return p.upstream.Host
+}
+
+// SetUnknownQueueName sets the queue name that captures without a parseable
+// QueueUrl are grouped under.
+func (p *Proxy) SetUnknownQueueName(name string) {
+	p.unknownQueue = name
+}
+
+// queueName returns the queue name of queueURL, or the unknown-queue name if
+// there is none.
+func (p *Proxy) queueName(queueURL string) string {
+	if name := extractQueueName(queueURL); name != "" {
+		return name
+	}
+	return p.unknownQueue
+}
+
+// SetStrictMethod makes the proxy reject non-POST requests instead of
+// forwarding them after flagging the anomaly.
+func (p *Proxy) SetStrictMethod(strict bool) {
+	p.strictMethod = strict
+}
+
+// SetPaused pauses or resumes capture. Paused calls are still forwarded,
+// delayed and failed by the latency and fault rules, but nothing about them
+// is recorded: no events, injected faults or anomalies.
+func (p *Proxy) SetPaused(paused bool) {
+	p.paused.Store(paused)
+}
+
+// Paused reports whether capture is paused.
+func (p *Proxy) Paused() bool {
+	return p.paused.Load()
+}
+
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Tag the call with a relay-side trace ID, visible upstream, to the
+	// client, in the log, and on captured events
+	traceID := newTraceID()
+	r.Header.Set(TraceHeader, traceID)
+	w.Header().Set(TraceHeader, traceID)
+
 	// Read and buffer the request body for inspection
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -52,66 +173,250 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	r.Body = io.NopCloser(bytes.NewReader(body))
 
-	// Store request body and content type in headers for response handling
-	r.Header.Set("X-SQS-Relay-Request-Body", string(body))
-	r.Header.Set("X-SQS-Relay-Content-Type", r.Header.Get("Content-Type"))
-	r.Header.Set("X-SQS-Relay-Amz-Target", r.Header.Get("X-Amz-Target"))
+	// Bodies too deep or large to inspect safely are forwarded and captured
+	// raw, but never parsed
+	isJSON := strings.Contains(r.Header.Get("Content-Type"), "json")
+	uninspected := isJSON && !p.inspectable("request body", body)
+	inspected := string(body)
+	if uninspected {
+		inspected = ""
+	}
+	var form url.Values
+	if !isJSON {
+		form = parseForm(inspected)
+	}
+
+	// Calls to other AWS services, such as S3, are only logged
+	service := awsService(r)
+	action := p.parseAction(r, form)
+	generic := isGeneric(service, action)
+
+	// SQS only uses POST; anything else is almost certainly a misconfigured
+	// client, unless it's a call to another service
+	if r.Method != http.MethodPost && (service == "" || service == "sqs") {
+		if !p.Paused() {
+			p.store.RecordAnomaly(store.AnomalyMethod, "", r.Method+" "+r.URL.Path)
+		}
+		log.Printf("[anomaly] Non-POST request: %s %s", r.Method, r.URL.Path)
+		if p.strictMethod {
+			http.Error(w, "SQS requests must use POST, got "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+	}
+
+	// Pass the request details to modifyResponse in the context rather than
+	// headers, which would be forwarded upstream and are size-limited. While
+	// capture is paused, calls are forwarded uninspected.
+	if !p.Paused() {
+		r = r.WithContext(context.WithValue(r.Context(), captureKey{}, &requestCapture{
+			body:        string(body),
+			form:        form,
+			contentType: r.Header.Get("Content-Type"),
+			amzTarget:   r.Header.Get("X-Amz-Target"),
+			action:      action,
+			service:     service,
+			generic:     generic,
+			uninspected: uninspected,
+			started:     time.Now(),
+		}))
+	}
 
 	// Log the action
-	action := p.parseAction(r, string(body))
-	queueURL := p.parseQueueURL(r, string(body))
-	log.Printf("[%s] %s %s", action, r.Method, queueURL)
+	queueURL := p.parseQueueURL(r, inspected, form)
+	log.Printf("[%s] %s %s trace=%s", action, r.Method, queueURL, traceID)
+
+	if !p.injectLatency(r, action, p.queueName(queueURL)) {
+		return
+	}
+	if rule, ok := p.matchFault(action, p.queueName(queueURL)); ok {
+		p.injectFault(w, r, rule, action, queueURL, p.queueName(queueURL), isJSON)
+		return
+	}
+	p.checkBatchLimits(action, p.queueName(queueURL), inspected, form, isJSON)
+
+	r, cancel := p.withUpstreamDeadline(r, action, p.queueName(queueURL), inspected, form, isJSON)
+	defer cancel()
 
 	p.proxy.ServeHTTP(w, r)
 }
 
 func (p *Proxy) modifyResponse(resp *http.Response) error {
-	// Get original request info
-	reqBody := resp.Request.Header.Get("X-SQS-Relay-Request-Body")
-	contentType := resp.Request.Header.Get("X-SQS-Relay-Content-Type")
-	amzTarget := resp.Request.Header.Get("X-SQS-Relay-Amz-Target")
-	resp.Request.Header.Del("X-SQS-Relay-Request-Body")
-	resp.Request.Header.Del("X-SQS-Relay-Content-Type")
-	resp.Request.Header.Del("X-SQS-Relay-Amz-Target")
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	// Requests without capture details are forwarded uninspected
+	rc, ok := resp.Request.Context().Value(captureKey{}).(*requestCapture)
+	if !ok {
+		return nil
+	}
+	reqBody, form, contentType, amzTarget, started := rc.body, rc.form, rc.contentType, rc.amzTarget, rc.started
+	p.injectHeaders(resp, rc.action)
+
+	// Compressed bodies are forwarded decompressed, so they can be parsed
+	if err := decodeBody(resp); err != nil {
+		return err
+	}
+
+	// Read as much of the response body as capture may inspect
+	body, partial, err := p.readCapture(resp)
 	if err != nil {
 		return err
 	}
-	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// Bodies decoded here or transparently by the transport have no length
+	if resp.Uncompressed && !partial {
+		setDecodedLength(resp, len(body))
+	}
+
+	if p.store.RecordsExchanges() {
+		p.store.RecordExchange(store.Exchange{
+			StartedAt:       started,
+			Duration:        time.Since(started),
+			Method:          resp.Request.Method,
+			URL:             resp.Request.URL.String(),
+			Proto:           resp.Request.Proto,
+			RequestHeaders:  resp.Request.Header.Clone(),
+			RequestBody:     reqBody,
+			Status:          resp.StatusCode,
+			StatusText:      http.StatusText(resp.StatusCode),
+			ResponseHeaders: resp.Header.Clone(),
+			ResponseBody:    string(body),
+		})
+	}
+
+	if rc.generic || rc.uninspected {
+		if !p.captures(rc.action) {
+			return nil
+		}
+		meta := store.Meta{
+			TraceID:    resp.Request.Header.Get(TraceHeader),
+			Partial:    partial,
+			ListenAddr: listenAddr(resp.Request),
+			Upstream:   p.upstreamOrigin(),
+		}
+		if rc.uninspected {
+			p.recordUninspected(resp, meta, rc)
+		} else {
+			p.recordGeneric(resp, meta, rc)
+		}
+		return nil
+	}
 
 	isJSON := strings.Contains(contentType, "json")
+	if isJSON && !p.inspectable("response body", body) {
+		return nil
+	}
+
 	action := parseActionFromTarget(amzTarget)
 	if action == "" {
-		action = parseActionFromForm(reqBody)
+		action = parseActionFromForm(form)
 	}
 
 	queueURL := ""
 	if isJSON {
 		queueURL = parseJSONField(reqBody, "QueueUrl")
 	} else {
-		queueURL = parseFormField(reqBody, "QueueUrl")
+		queueURL = form.Get("QueueUrl")
+	}
+	queueName := p.queueName(queueURL)
+	meta := store.Meta{
+		TraceID:    resp.Request.Header.Get(TraceHeader),
+		Partial:    partial,
+		ListenAddr: listenAddr(resp.Request),
+		Upstream:   p.upstreamOrigin(),
+	}
+
+	if !p.captures(action) {
+		return nil
+	}
+
+	if partial {
+		p.store.RecordAnomaly(store.AnomalyPartialCapture, queueName, fmt.Sprintf("%s response larger than %d bytes; only the start was captured", action, p.maxCaptureBytes))
+	}
+
+	// Parse from a snapshot so a capture outliving the timeout doesn't race
+	// the proxy's use of resp
+	snapshot := &http.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Request:    resp.Request.Clone(resp.Request.Context()),
+	}
+	p.runCapture(meta.TraceID, func() {
+		p.captureResponse(snapshot, meta, action, queueURL, queueName, reqBody, form, body, isJSON)
+	})
+	return nil
+}
+
+// captureResponse records what a proxied call did, according to its action.
+func (p *Proxy) captureResponse(resp *http.Response, meta store.Meta, action, queueURL, queueName, reqBody string, form url.Values, body []byte, isJSON bool) {
+	if resp.StatusCode >= 400 {
+		errQueue := queueName
+		if action == "CreateQueue" {
+			// CreateQueue names the queue rather than addressing it by URL
+			if isJSON {
+				errQueue = parseJSONField(reqBody, "QueueName")
+			} else {
+				errQueue = form.Get("QueueName")
+			}
+		} else if action == "Publish" {
+			errQueue = store.TopicName(decodePublishRequest(reqBody, form, isJSON).TopicArn)
+		}
+		p.handleErrorResponse(action, errQueue, resp, string(body), isJSON)
 	}
-	queueName := extractQueueName(queueURL)
 
 	switch action {
 	case "SendMessage":
-		p.handleSendMessage(queueURL, queueName, reqBody, string(body), isJSON)
+		mirrored := resp.Request.Header.Get(MirrorHeader) != ""
+		p.handleSendMessage(meta, queueURL, queueName, reqBody, form, string(body), isJSON, mirrored)
 	case "SendMessageBatch":
-		p.handleSendMessageBatch(queueURL, queueName, reqBody, string(body), isJSON)
+		mirrored := resp.Request.Header.Get(MirrorHeader) != ""
+		p.handleSendMessageBatch(meta, queueURL, queueName, reqBody, form, string(body), isJSON, mirrored)
 	case "ReceiveMessage":
-		p.handleReceiveMessage(queueURL, queueName, string(body), isJSON)
+		n := p.handleReceiveMessage(meta, queueURL, queueName, reqBody, form, string(body), isJSON)
+		if n == 0 && resp.StatusCode < 300 && !meta.Partial {
+			p.checkUnparsedReceive(queueName, body, isJSON)
+		}
 	case "DeleteMessage":
-		p.handleDeleteMessage(queueURL, queueName, reqBody, isJSON)
+		p.handleDeleteMessage(meta, queueURL, queueName, reqBody, form, isJSON)
 	case "DeleteMessageBatch":
-		p.handleDeleteMessageBatch(queueURL, queueName, reqBody, isJSON)
-	}
+		p.handleDeleteMessageBatch(meta, queueURL, queueName, reqBody, form, string(body), isJSON)
+	case "Publish":
+		p.handlePublish(meta, reqBody, form, string(body), isJSON)
+	case "CreateQueue":
+		p.handleCreateQueue(reqBody, form, string(body), isJSON)
+	case "GetQueueUrl":
+		p.handleGetQueueURL(reqBody, form, string(body), isJSON)
+	case "GetQueueAttributes":
+		p.handleGetQueueAttributes(queueName, string(body), isJSON)
+	}
+
+	if resp.StatusCode < 300 {
+		if controlPlaneActions[action] {
+			p.recordControl(meta, action, queueURL, queueName, reqBody, form, string(body), isJSON)
+		}
 
-	return nil
+		switch action {
+		case "SetQueueAttributes":
+			p.handleSetQueueAttributes(queueName, reqBody, form, isJSON)
+		case "ListDeadLetterSourceQueues":
+			p.handleListDeadLetterSourceQueues(queueName, string(body), isJSON)
+		case "ChangeMessageVisibility":
+			p.handleChangeMessageVisibility(meta, queueURL, queueName, reqBody, form, isJSON)
+		case "ChangeMessageVisibilityBatch":
+			p.handleChangeMessageVisibilityBatch(meta, queueURL, queueName, reqBody, form, string(body), isJSON)
+		case "StartMessageMoveTask":
+			p.handleStartMessageMoveTask(reqBody, form, string(body), isJSON)
+		case "CancelMessageMoveTask":
+			p.handleCancelMessageMoveTask(reqBody, form, string(body), isJSON)
+		case "ListMessageMoveTasks":
+			p.handleListMessageMoveTasks(string(body), isJSON)
+		case "PurgeQueue":
+			p.store.RecordPurge(meta, queueURL, queueName)
+			log.Printf("  X Purged %s", queueName)
+		case "DeleteQueue":
+			p.store.RemoveQueue(queueName)
+			log.Printf("  X Removed deleted queue %s", queueName)
+		}
+	}
 }
 
-func (p *Proxy) parseAction(r *http.Request, body string) string {
+func (p *Proxy) parseAction(r *http.Request, form url.Values) string {
 	// Try X-Amz-Target header first (JSON API)
 	if target := r.Header.Get("X-Amz-Target"); target != "" {
 		action := parseActionFromTarget(target)
@@ -120,44 +425,60 @@ func (p *Proxy) parseAction(r *http.Request, body string) string {
 		}
 	}
 	// Fall back to form-encoded Action parameter
-	return parseActionFromForm(body)
+	return parseActionFromForm(form)
 }
 
-func (p *Proxy) parseQueueURL(r *http.Request, body string) string {
+func (p *Proxy) parseQueueURL(r *http.Request, body string, form url.Values) string {
 	contentType := r.Header.Get("Content-Type")
 	if strings.Contains(contentType, "json") {
 		return parseJSONField(body, "QueueUrl")
 	}
-	return parseFormField(body, "QueueUrl")
+	return form.Get("QueueUrl")
 }
 
-func parseActionFromTarget(target string) string {
-	// X-Amz-Target format: "AmazonSQS.SendMessage"
-	if strings.HasPrefix(target, "AmazonSQS.") {
-		return strings.TrimPrefix(target, "AmazonSQS.")
+// upstreamOrigin returns the scheme and host calls are forwarded to.
+func (p *Proxy) upstreamOrigin() string {
+	return p.upstream.Scheme + "://" + p.upstream.Host
+}
+
+// listenAddr returns the relay address req arrived on.
+func listenAddr(req *http.Request) string {
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr.String()
 	}
 	return ""
 }
 
-func parseActionFromForm(body string) string {
-	re := regexp.MustCompile(`Action=([^&]+)`)
-	matches := re.FindStringSubmatch(body)
-	if len(matches) > 1 {
-		return matches[1]
+// newTraceID returns a random RFC 4122 version 4 UUID.
+func newTraceID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Printf("Failed to generate trace ID: %v", err)
 	}
-	return "Unknown"
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
-func parseFormField(body, field string) string {
-	re := regexp.MustCompile(field + `=([^&]+)`)
-	matches := re.FindStringSubmatch(body)
-	if len(matches) > 1 {
-		decoded, _ := url.QueryUnescape(matches[1])
-		return decoded
+func parseActionFromTarget(target string) string {
+	// X-Amz-Target format: "AmazonSQS.SendMessage", or "AmazonSNS.Publish"
+	// for SNS
+	if action, ok := strings.CutPrefix(target, "AmazonSQS."); ok {
+		return action
+	}
+	if action, ok := strings.CutPrefix(target, "AmazonSNS."); ok {
+		return action
 	}
 	return ""
 }
 
+func parseActionFromForm(form url.Values) string {
+	if action := form.Get("Action"); action != "" {
+		return action
+	}
+	return "Unknown"
+}
+
 func parseJSONField(body, field string) string {
 	var data map[string]interface{}
 	if err := json.Unmarshal([]byte(body), &data); err != nil {
@@ -169,106 +490,124 @@ func parseJSONField(body, field string) string {
 	return ""
 }
 
-func (p *Proxy) handleSendMessage(queueURL, queueName, reqBody, respBody string, isJSON bool) {
-	var msgBody, messageID string
+func (p *Proxy) handleSendMessage(meta store.Meta, queueURL, queueName, reqBody string, form url.Values, respBody string, isJSON, mirrored bool) {
+	msg := decodeSendRequest(reqBody, form, isJSON)
+	p.checkEmptyBody(queueName, msg)
+	messageID, attributesMD5, sequenceNumber := decodeSendResponse(respBody, isJSON)
+	p.checkAttributesMD5(queueName, messageID, msg, attributesMD5)
+	meta.SequenceNumber = sequenceNumber
+	p.recordSend(meta, queueURL, queueName, messageID, msg, mirrored)
+}
 
-	if isJSON {
-		msgBody = parseJSONField(reqBody, "MessageBody")
-		messageID = parseJSONField(respBody, "MessageId")
-	} else {
-		msgBody = parseFormField(reqBody, "MessageBody")
-		messageID = extractXMLTag(respBody, "MessageId")
+func (p *Proxy) handleSendMessageBatch(meta store.Meta, queueURL, queueName, reqBody string, form url.Values, respBody string, isJSON, mirrored bool) {
+	entries := make(map[string]outgoingMessage)
+	for _, msg := range decodeSendBatchRequest(reqBody, form, isJSON) {
+		p.checkEmptyBody(queueName, msg)
+		entries[msg.ID] = msg
 	}
 
-	attrs := extractMessageAttributes(reqBody, isJSON)
-
-	if messageID != "" {
-		p.store.RecordSend(queueURL, queueName, messageID, msgBody, attrs)
-		log.Printf("  -> Sent message %s to %s", messageID, queueName)
+	result := decodeBatchResponse(respBody, isJSON)
+	for _, s := range result.Successful {
+		msg, ok := entries[s.ID]
+		if !ok {
+			msg = outgoingMessage{Body: "[batch message]"}
+		}
+		p.checkAttributesMD5(queueName, s.MessageID, msg, s.AttributesMD5)
+		meta.SequenceNumber = s.SequenceNumber
+		p.recordSend(meta, queueURL, queueName, s.MessageID, msg, mirrored)
 	}
+	p.recordBatchFailures("SendMessageBatch", queueName, result.Failed)
 }
 
-func (p *Proxy) handleSendMessageBatch(queueURL, queueName, reqBody, respBody string, isJSON bool) {
-	var messageIDs []string
+// checkEmptyBody flags a message sent with an empty or missing body, whether
+// or not the upstream accepted it.
+func (p *Proxy) checkEmptyBody(queueName string, msg outgoingMessage) {
+	if msg.Body == "" {
+		p.store.RecordEmptyBody(queueName, !msg.HasBody)
+	}
+}
 
-	if isJSON {
-		var resp map[string]interface{}
-		if err := json.Unmarshal([]byte(respBody), &resp); err == nil {
-			if successful, ok := resp["Successful"].([]interface{}); ok {
-				for _, s := range successful {
-					if entry, ok := s.(map[string]interface{}); ok {
-						if id, ok := entry["MessageId"].(string); ok {
-							messageIDs = append(messageIDs, id)
-						}
-					}
-				}
-			}
-		}
-	} else {
-		messageIDs = extractAllXMLTags(respBody, "MessageId")
+// recordSend records a message the upstream accepted under messageID, and
+// mirrors it to the shadow queue if configured.
+func (p *Proxy) recordSend(meta store.Meta, queueURL, queueName, messageID string, msg outgoingMessage, mirrored bool) {
+	if messageID == "" {
+		return
 	}
 
-	for _, messageID := range messageIDs {
-		p.store.RecordSend(queueURL, queueName, messageID, "[batch message]", nil)
-		log.Printf("  -> Sent batch message %s to %s", messageID, queueName)
+	meta.MessageGroupID = msg.GroupID
+	meta.MessageDeduplicationID = msg.DeduplicationID
+	meta.AttributeTypes = msg.AttributeTypes
+	p.store.RecordSend(meta, queueURL, queueName, messageID, msg.Body, msg.Attributes, msg.SystemAttributes)
+	log.Printf("  -> Sent message %s to %s", messageID, queueName)
+
+	if p.shouldMirror(queueName, mirrored) {
+		p.mirrorSend(messageID, msg.Body, msg.Attributes, msg.AttributeTypes)
 	}
 }
 
-func (p *Proxy) handleReceiveMessage(queueURL, queueName, respBody string, isJSON bool) {
-	var messages []receivedMessage
+// recordBatchFailures records an anomaly for each failed entry of a batch
+// call.
+func (p *Proxy) recordBatchFailures(action, queueName string, failures []batchFailure) {
+	for _, f := range failures {
+		detail := fmt.Sprintf("%s entry %s failed: %s", action, f.ID, f.Code)
+		if f.Message != "" {
+			detail += ": " + f.Message
+		}
+		p.store.RecordAnomaly(store.AnomalyUpstreamError, queueName, detail)
+		log.Printf("  ! %s", detail)
+	}
+}
 
+// handleReceiveMessage records each received message and returns how many
+// were parsed from the response.
+func (p *Proxy) handleReceiveMessage(meta store.Meta, queueURL, queueName, reqBody string, form url.Values, respBody string, isJSON bool) int {
+	// SQS only returns the attributes a consumer asks for
+	meta.RequestedAttributeNames = extractNameList(reqBody, form, isJSON, "AttributeNames", "AttributeName")
+	meta.RequestedMessageAttributeNames = extractNameList(reqBody, form, isJSON, "MessageAttributeNames", "MessageAttributeName")
+	meta.VisibilityTimeout = requestedVisibilityTimeout(reqBody, form, isJSON)
 	if isJSON {
-		messages = parseReceiveMessageResponseJSON(respBody)
+		meta.ReceiveRequestAttemptID = parseJSONField(reqBody, "ReceiveRequestAttemptId")
 	} else {
-		messages = parseReceiveMessageResponseXML(respBody)
+		meta.ReceiveRequestAttemptID = form.Get("ReceiveRequestAttemptId")
 	}
 
+	messages := decodeReceiveResponse(respBody, isJSON)
 	for _, msg := range messages {
-		p.store.RecordReceive(queueURL, queueName, msg.MessageID, msg.ReceiptHandle, msg.Body, msg.Attributes)
+		meta.AttributeTypes = msg.AttributeTypes
+		p.store.RecordReceive(meta, queueURL, queueName, msg.MessageID, msg.ReceiptHandle, msg.Body, msg.Attributes, msg.SystemAttributes)
+		if ms, err := strconv.ParseInt(msg.SystemAttributes["SentTimestamp"], 10, 64); err == nil {
+			p.store.RecordSentTimestamp(meta.Upstream, msg.MessageID, time.UnixMilli(ms))
+		}
 		log.Printf("  <- Received message %s from %s", msg.MessageID, queueName)
 	}
+	return len(messages)
 }
 
-func (p *Proxy) handleDeleteMessage(queueURL, queueName, reqBody string, isJSON bool) {
+func (p *Proxy) handleDeleteMessage(meta store.Meta, queueURL, queueName, reqBody string, form url.Values, isJSON bool) {
 	var receiptHandle string
 	if isJSON {
 		receiptHandle = parseJSONField(reqBody, "ReceiptHandle")
 	} else {
-		receiptHandle = parseFormField(reqBody, "ReceiptHandle")
+		receiptHandle = form.Get("ReceiptHandle")
 	}
 
 	if receiptHandle != "" {
-		p.store.RecordDelete(queueURL, queueName, receiptHandle)
+		p.store.RecordDelete(meta, queueURL, queueName, receiptHandle)
 		log.Printf("  X Deleted message from %s", queueName)
 	}
 }
 
-func (p *Proxy) handleDeleteMessageBatch(queueURL, queueName, reqBody string, isJSON bool) {
-	if isJSON {
-		var data map[string]interface{}
-		if err := json.Unmarshal([]byte(reqBody), &data); err == nil {
-			if entries, ok := data["Entries"].([]interface{}); ok {
-				for _, e := range entries {
-					if entry, ok := e.(map[string]interface{}); ok {
-						if rh, ok := entry["ReceiptHandle"].(string); ok {
-							p.store.RecordDelete(queueURL, queueName, rh)
-							log.Printf("  X Deleted batch message from %s", queueName)
-						}
-					}
-				}
-			}
-		}
-	} else {
-		re := regexp.MustCompile(`DeleteMessageBatchRequestEntry\.\d+\.ReceiptHandle=([^&]+)`)
-		matches := re.FindAllStringSubmatch(reqBody, -1)
-		for _, match := range matches {
-			if len(match) > 1 {
-				receiptHandle, _ := url.QueryUnescape(match[1])
-				p.store.RecordDelete(queueURL, queueName, receiptHandle)
-				log.Printf("  X Deleted batch message from %s", queueName)
-			}
+func (p *Proxy) handleDeleteMessageBatch(meta store.Meta, queueURL, queueName, reqBody string, form url.Values, respBody string, isJSON bool) {
+	result := decodeBatchResponse(respBody, isJSON)
+	failed := result.failed()
+	for _, entry := range decodeReceiptBatchRequest(reqBody, form, isJSON, "DeleteMessageBatchRequestEntry") {
+		if failed[entry.ID] {
+			continue
 		}
+		p.store.RecordDelete(meta, queueURL, queueName, entry.ReceiptHandle)
+		log.Printf("  X Deleted batch message from %s", queueName)
 	}
+	p.recordBatchFailures("DeleteMessageBatch", queueName, result.Failed)
 }
 
 func extractQueueName(queueURL string) string {
@@ -300,140 +639,28 @@ func extractAllXMLTags(xml, tag string) []string {
 	return results
 }
 
-func extractMessageAttributes(body string, isJSON bool) map[string]string {
-	attrs := make(map[string]string)
+// extractNameList returns a list of names, read from the jsonKey array in
+// JSON bodies or formPrefix.N params (in N order) in form-encoded bodies.
+func extractNameList(body string, form url.Values, isJSON bool, jsonKey, formPrefix string) []string {
+	var names []string
 
 	if isJSON {
 		var data map[string]interface{}
 		if err := json.Unmarshal([]byte(body), &data); err == nil {
-			if msgAttrs, ok := data["MessageAttributes"].(map[string]interface{}); ok {
-				for name, v := range msgAttrs {
-					if attr, ok := v.(map[string]interface{}); ok {
-						if sv, ok := attr["StringValue"].(string); ok {
-							attrs[name] = sv
-						}
-					}
-				}
-			}
-		}
-	} else {
-		nameRe := regexp.MustCompile(`MessageAttribute\.(\d+)\.Name=([^&]+)`)
-		valueRe := regexp.MustCompile(`MessageAttribute\.(\d+)\.Value\.StringValue=([^&]+)`)
-
-		names := make(map[string]string)
-		values := make(map[string]string)
-
-		for _, match := range nameRe.FindAllStringSubmatch(body, -1) {
-			if len(match) > 2 {
-				decoded, _ := url.QueryUnescape(match[2])
-				names[match[1]] = decoded
-			}
-		}
-
-		for _, match := range valueRe.FindAllStringSubmatch(body, -1) {
-			if len(match) > 2 {
-				decoded, _ := url.QueryUnescape(match[2])
-				values[match[1]] = decoded
-			}
-		}
-
-		for idx, name := range names {
-			if val, ok := values[idx]; ok {
-				attrs[name] = val
-			}
-		}
-	}
-
-	return attrs
-}
-
-type receivedMessage struct {
-	MessageID     string
-	ReceiptHandle string
-	Body          string
-	Attributes    map[string]string
-}
-
-func parseReceiveMessageResponseJSON(body string) []receivedMessage {
-	var messages []receivedMessage
-
-	var resp map[string]interface{}
-	if err := json.Unmarshal([]byte(body), &resp); err != nil {
-		return messages
-	}
-
-	msgList, ok := resp["Messages"].([]interface{})
-	if !ok {
-		return messages
-	}
-
-	for _, m := range msgList {
-		msg, ok := m.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		rm := receivedMessage{
-			Attributes: make(map[string]string),
-		}
-
-		if id, ok := msg["MessageId"].(string); ok {
-			rm.MessageID = id
-		}
-		if rh, ok := msg["ReceiptHandle"].(string); ok {
-			rm.ReceiptHandle = rh
-		}
-		if b, ok := msg["Body"].(string); ok {
-			rm.Body = b
-		}
-
-		if attrs, ok := msg["MessageAttributes"].(map[string]interface{}); ok {
-			for name, v := range attrs {
-				if attr, ok := v.(map[string]interface{}); ok {
-					if sv, ok := attr["StringValue"].(string); ok {
-						rm.Attributes[name] = sv
+			if list, ok := data[jsonKey].([]interface{}); ok {
+				for _, v := range list {
+					if name, ok := v.(string); ok {
+						names = append(names, name)
 					}
 				}
 			}
 		}
-
-		messages = append(messages, rm)
+		return names
 	}
 
-	return messages
-}
-
-func parseReceiveMessageResponseXML(xml string) []receivedMessage {
-	var messages []receivedMessage
-
-	msgRe := regexp.MustCompile(`(?s)<Message>(.*?)</Message>`)
-	msgMatches := msgRe.FindAllStringSubmatch(xml, -1)
-
-	for _, match := range msgMatches {
-		if len(match) > 1 {
-			msgXML := match[1]
-			msg := receivedMessage{
-				MessageID:     extractXMLTag(msgXML, "MessageId"),
-				ReceiptHandle: extractXMLTag(msgXML, "ReceiptHandle"),
-				Body:          extractXMLTag(msgXML, "Body"),
-				Attributes:    make(map[string]string),
-			}
-
-			attrRe := regexp.MustCompile(`(?s)<MessageAttribute>(.*?)</MessageAttribute>`)
-			attrMatches := attrRe.FindAllStringSubmatch(msgXML, -1)
-			for _, attrMatch := range attrMatches {
-				if len(attrMatch) > 1 {
-					name := extractXMLTag(attrMatch[1], "Name")
-					value := extractXMLTag(attrMatch[1], "StringValue")
-					if name != "" {
-						msg.Attributes[name] = value
-					}
-				}
-			}
-
-			messages = append(messages, msg)
-		}
+	indexed := formEntries(form, formPrefix, "")
+	for _, n := range entryIndexes(indexed) {
+		names = append(names, indexed[n])
 	}
-
-	return messages
+	return names
 }
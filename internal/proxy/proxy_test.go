@@ -0,0 +1,883 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+// testUpstream answers every call with status and body, as JSON.
+func testUpstream(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+// newTestRelay returns a proxy in front of upstream, its store, and a server
+// to send calls through.
+func newTestRelay(t *testing.T, upstream *httptest.Server) (*Proxy, *store.Store, *httptest.Server) {
+	t.Helper()
+	s := store.New()
+	p := New(upstream.URL, s)
+	relay := httptest.NewServer(p)
+	t.Cleanup(relay.Close)
+	return p, s, relay
+}
+
+// callJSON makes an SQS JSON protocol call of action through relay and
+// returns the response status.
+func callJSON(t *testing.T, relay *httptest.Server, action, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, relay.URL+"/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// callForm makes an SQS query protocol call through relay with the given
+// form params and returns the response status.
+func callForm(t *testing.T, relay *httptest.Server, params url.Values) int {
+	t.Helper()
+	resp, err := http.PostForm(relay.URL+"/", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// fixedClock is a store clock stopped at one time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+const rejected = `{"__type":"com.amazonaws.sqs#InvalidAttributeValue","message":"Invalid value for the parameter RedrivePolicy."}`
+
+func TestRejectedSetQueueAttributesRecordsNoRedriveEdge(t *testing.T) {
+	_, s, relay := newTestRelay(t, testUpstream(t, http.StatusBadRequest, rejected))
+
+	status := callJSON(t, relay, "SetQueueAttributes", `{
+		"QueueUrl": "http://localhost:4566/000000000000/orders",
+		"Attributes": {"RedrivePolicy": "{\"deadLetterTargetArn\":\"arn:aws:sqs:us-east-1:000000000000:orders-dlq\",\"maxReceiveCount\":\"3\"}"}
+	}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", status)
+	}
+	if graph := s.GetDLQGraph(); len(graph.Edges) != 0 {
+		t.Errorf("rejected call recorded edges %+v", graph.Edges)
+	}
+}
+
+func TestRejectedListDeadLetterSourceQueuesRecordsNothing(t *testing.T) {
+	_, s, relay := newTestRelay(t, testUpstream(t, http.StatusBadRequest, rejected))
+
+	callJSON(t, relay, "ListDeadLetterSourceQueues", `{"QueueUrl": "http://localhost:4566/000000000000/orders-dlq"}`)
+	if graph := s.GetDLQGraph(); len(graph.Nodes) != 0 || len(graph.Edges) != 0 {
+		t.Errorf("rejected call recorded graph %+v", graph)
+	}
+}
+
+func TestAcceptedSetQueueAttributesRecordsRedriveEdge(t *testing.T) {
+	_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{}`))
+
+	callJSON(t, relay, "SetQueueAttributes", `{
+		"QueueUrl": "http://localhost:4566/000000000000/orders",
+		"Attributes": {"RedrivePolicy": "{\"deadLetterTargetArn\":\"arn:aws:sqs:us-east-1:000000000000:orders-dlq\",\"maxReceiveCount\":\"3\"}"}
+	}`)
+	graph := s.GetDLQGraph()
+	if len(graph.Edges) != 1 {
+		t.Fatalf("edges = %+v, want one", graph.Edges)
+	}
+	edge := graph.Edges[0]
+	if edge.Source != "orders" || edge.DeadLetterQueue != "orders-dlq" || edge.MaxReceiveCount != 3 {
+		t.Errorf("edge = %+v", edge)
+	}
+}
+
+func TestPausedCallsRecordNothing(t *testing.T) {
+	p, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{"MessageId":"m-1"}`))
+	p.SetFaults([]FaultRule{{Action: "PurgeQueue", Status: 503, Code: "ServiceUnavailable", Probability: 1}})
+	p.SetPaused(true)
+
+	// An injected fault, a non-POST call, an uninspectable body and an
+	// oversized batch would each be recorded if capture weren't paused
+	if status := callJSON(t, relay, "PurgeQueue", `{"QueueUrl":"http://localhost:4566/000000000000/orders"}`); status != 503 {
+		t.Errorf("PurgeQueue status = %d, want the injected 503 while paused", status)
+	}
+	resp, err := http.Get(relay.URL + "/?Action=ListQueues")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callJSON(t, relay, "SendMessage", nestedBody(1000))
+	entries := make([]string, 11)
+	for i := range entries {
+		entries[i] = `{"Id":"e` + strconv.Itoa(i) + `","MessageBody":"x"}`
+	}
+	batch := `{"QueueUrl":"http://localhost:4566/000000000000/orders","Entries":[` + strings.Join(entries, ",") + `]}`
+	callJSON(t, relay, "SendMessageBatch", batch)
+	callJSON(t, relay, "SendMessage", `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi"}`)
+
+	if history := s.GetHistory(0); len(history) != 0 {
+		t.Errorf("paused calls recorded %d event(s): %+v", len(history), history)
+	}
+	if anomalies := s.GetAnomalies(); len(anomalies) != 0 {
+		t.Errorf("paused calls recorded %d anomalies: %+v", len(anomalies), anomalies)
+	}
+
+	p.SetPaused(false)
+	callJSON(t, relay, "PurgeQueue", `{"QueueUrl":"http://localhost:4566/000000000000/orders"}`)
+	callJSON(t, relay, "SendMessageBatch", batch)
+	if history := s.GetHistory(0); len(history) == 0 || history[len(history)-1].Action != store.ActionFault {
+		t.Errorf("resumed fault not recorded: %+v", history)
+	}
+	if anomalies := s.GetAnomalies(); len(anomalies) == 0 {
+		t.Error("resumed oversized batch not flagged")
+	}
+}
+
+func TestNonPostRequestsAreFlagged(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		wantStatus int
+	}{
+		{"forwarded", false, http.StatusOK},
+		{"rejected in strict mode", true, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{}`))
+			p.SetStrictMethod(tt.strict)
+
+			resp, err := http.Get(relay.URL + "/000000000000/orders?Action=SendMessage")
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			anomalies := s.GetAnomalies()
+			if len(anomalies) != 1 || anomalies[0].Kind != store.AnomalyMethod {
+				t.Fatalf("anomalies = %+v, want one %q", anomalies, store.AnomalyMethod)
+			}
+			if want := "GET /000000000000/orders"; anomalies[0].Detail != want {
+				t.Errorf("detail = %q, want %q", anomalies[0].Detail, want)
+			}
+		})
+	}
+}
+
+func TestFormMessageBodiesSurviveDecoding(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"ampersand", "fish & chips&Action=DeleteQueue"},
+		{"equals", "a=b=c"},
+		{"JSON", `{"order":"o-1","note":"50% off & free=yes","items":[1,2]}`},
+		{"percent-encoded JSON", url.QueryEscape(`{"order":"o-1"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := testUpstream(t, http.StatusOK, `<SendMessageResponse><SendMessageResult><MessageId>m-1</MessageId></SendMessageResult></SendMessageResponse>`)
+			_, s, relay := newTestRelay(t, upstream)
+
+			callForm(t, relay, url.Values{
+				"Action":      {"SendMessage"},
+				"QueueUrl":    {"http://localhost:4566/000000000000/orders"},
+				"MessageBody": {tt.body},
+			})
+
+			history := s.GetHistory(0)
+			if len(history) != 1 {
+				t.Fatalf("recorded %d events, want 1", len(history))
+			}
+			if got := history[0]; got.Action != store.ActionSend || got.QueueName != "orders" || got.Body != tt.body {
+				t.Errorf("recorded %s to %q with body %q, want send to orders with %q", got.Action, got.QueueName, got.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestSendSystemAttributesKeptApart(t *testing.T) {
+	const queueURL = "http://localhost:4566/000000000000/orders"
+	tests := []struct {
+		name string
+		send func(relay *httptest.Server)
+		resp string
+	}{
+		{"JSON", func(relay *httptest.Server) {
+			callJSON(t, relay, "SendMessage", `{"QueueUrl":"`+queueURL+`","MessageBody":"hi",
+				"MessageAttributes":{"trace":{"DataType":"String","StringValue":"user"}},
+				"MessageSystemAttributes":{"AWSTraceHeader":{"DataType":"String","StringValue":"Root=1-abc"}}}`)
+		}, `{"MessageId":"m-1"}`},
+		{"query", func(relay *httptest.Server) {
+			callForm(t, relay, url.Values{
+				"Action":                                     {"SendMessage"},
+				"QueueUrl":                                   {queueURL},
+				"MessageBody":                                {"hi"},
+				"MessageAttribute.1.Name":                    {"trace"},
+				"MessageAttribute.1.Value.DataType":          {"String"},
+				"MessageAttribute.1.Value.StringValue":       {"user"},
+				"MessageSystemAttribute.1.Name":              {"AWSTraceHeader"},
+				"MessageSystemAttribute.1.Value.DataType":    {"String"},
+				"MessageSystemAttribute.1.Value.StringValue": {"Root=1-abc"},
+			})
+		}, `<SendMessageResponse><SendMessageResult><MessageId>m-1</MessageId></SendMessageResult></SendMessageResponse>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, tt.resp))
+			tt.send(relay)
+
+			msg, ok := s.GetMessage("m-1")
+			if !ok {
+				t.Fatal("message not captured")
+			}
+			if got := msg.MessageSystemAttributes; len(got) != 1 || got["AWSTraceHeader"] != "Root=1-abc" {
+				t.Errorf("system attributes = %v, want only AWSTraceHeader", got)
+			}
+			if got := msg.Attributes; len(got) != 1 || got["trace"] != "user" {
+				t.Errorf("attributes = %v, want only the user's trace", got)
+			}
+		})
+	}
+}
+
+func TestPurgeInProgressRecordedDistinctly(t *testing.T) {
+	const queueURL = "http://localhost:4566/000000000000/orders"
+	tests := []struct {
+		name string
+		call func(relay *httptest.Server)
+		resp string
+		want store.AnomalyKind
+	}{
+		{"JSON purge in progress", func(relay *httptest.Server) {
+			callJSON(t, relay, "PurgeQueue", `{"QueueUrl":"`+queueURL+`"}`)
+		}, `{"__type":"com.amazonaws.sqs#PurgeQueueInProgress","message":"Only one PurgeQueue operation on orders is allowed every 60 seconds."}`, store.AnomalyPurgeInProgress},
+		{"query purge in progress", func(relay *httptest.Server) {
+			callForm(t, relay, url.Values{"Action": {"PurgeQueue"}, "QueueUrl": {queueURL}})
+		}, `<ErrorResponse><Error><Type>Sender</Type><Code>AWS.SimpleQueueService.PurgeQueueInProgress</Code><Message>Only one PurgeQueue operation on orders is allowed every 60 seconds.</Message></Error></ErrorResponse>`, store.AnomalyPurgeInProgress},
+		{"other purge error", func(relay *httptest.Server) {
+			callJSON(t, relay, "PurgeQueue", `{"QueueUrl":"`+queueURL+`"}`)
+		}, `{"__type":"com.amazonaws.sqs#AccessDenied","message":"denied"}`, store.AnomalyUpstreamError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, http.StatusBadRequest, tt.resp))
+			clock := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			s.SetClock(fixedClock(clock))
+			tt.call(relay)
+
+			anomalies := s.GetAnomalies()
+			if len(anomalies) != 1 {
+				t.Fatalf("anomalies = %+v, want one", anomalies)
+			}
+			if a := anomalies[0]; a.Kind != tt.want || a.QueueName != "orders" || !a.Timestamp.Equal(clock) {
+				t.Errorf("anomaly = %+v, want %s on orders at %s", a, tt.want, clock)
+			}
+		})
+	}
+}
+
+func TestQueueDeletedRecentlyRecordedDistinctly(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(relay *httptest.Server)
+		resp string
+		want store.AnomalyKind
+	}{
+		{"JSON", func(relay *httptest.Server) {
+			callJSON(t, relay, "CreateQueue", `{"QueueName":"orders"}`)
+		}, `{"__type":"com.amazonaws.sqs#QueueDeletedRecently","message":"You must wait 60 seconds after deleting a queue before you can create another with the same name."}`, store.AnomalyQueueDeletedRecently},
+		{"query", func(relay *httptest.Server) {
+			callForm(t, relay, url.Values{"Action": {"CreateQueue"}, "QueueName": {"orders"}})
+		}, `<ErrorResponse><Error><Type>Sender</Type><Code>AWS.SimpleQueueService.QueueDeletedRecently</Code><Message>You must wait 60 seconds after deleting a queue before you can create another with the same name.</Message></Error></ErrorResponse>`, store.AnomalyQueueDeletedRecently},
+		{"other create error", func(relay *httptest.Server) {
+			callJSON(t, relay, "CreateQueue", `{"QueueName":"orders"}`)
+		}, `{"__type":"com.amazonaws.sqs#QueueNameExists","message":"exists"}`, store.AnomalyUpstreamError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, http.StatusBadRequest, tt.resp))
+			clock := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			s.SetClock(fixedClock(clock))
+			tt.call(relay)
+
+			anomalies := s.GetAnomalies()
+			if len(anomalies) != 1 {
+				t.Fatalf("anomalies = %+v, want one", anomalies)
+			}
+			if a := anomalies[0]; a.Kind != tt.want || a.QueueName != "orders" || !a.Timestamp.Equal(clock) {
+				t.Errorf("anomaly = %+v, want %s on orders at %s", a, tt.want, clock)
+			}
+		})
+	}
+}
+
+func TestTraceIDFollowsTheCall(t *testing.T) {
+	var upstreamTrace string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTrace = r.Header.Get(TraceHeader)
+		io.WriteString(w, `{"MessageId":"m-1"}`)
+	}))
+	defer upstream.Close()
+	_, s, relay := newTestRelay(t, upstream)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	req, err := http.NewRequest(http.MethodPost, relay.URL+"/", strings.NewReader(`{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS.SendMessage")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	traceID := resp.Header.Get(TraceHeader)
+	if len(traceID) != 36 {
+		t.Fatalf("response %s = %q, want a UUID", TraceHeader, traceID)
+	}
+	if upstreamTrace != traceID {
+		t.Errorf("upstream saw trace %q, client %q", upstreamTrace, traceID)
+	}
+	if !strings.Contains(logs.String(), "trace="+traceID) {
+		t.Errorf("log doesn't mention trace=%s:\n%s", traceID, logs.String())
+	}
+	if msg, ok := s.GetMessage("m-1"); !ok || msg.TraceID != traceID {
+		t.Errorf("stored event trace = %q, want %q", msg.TraceID, traceID)
+	}
+}
+
+func TestOversizedBatchFlagged(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		flagged bool
+	}{
+		{"at the limit", 10, false},
+		{"over the limit", 11, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{"Successful":[]}`))
+			entries := make([]string, tt.entries)
+			for i := range entries {
+				entries[i] = `{"Id":"e` + strconv.Itoa(i) + `","MessageBody":"x"}`
+			}
+			callJSON(t, relay, "SendMessageBatch", `{"QueueUrl":"http://localhost:4566/000000000000/orders","Entries":[`+strings.Join(entries, ",")+`]}`)
+
+			var flagged []store.Anomaly
+			for _, a := range s.GetAnomalies() {
+				if a.Kind == store.AnomalyBatchLimit {
+					flagged = append(flagged, a)
+				}
+			}
+			if !tt.flagged {
+				if len(flagged) != 0 {
+					t.Errorf("anomalies = %+v, want none", flagged)
+				}
+				return
+			}
+			if len(flagged) != 1 || flagged[0].QueueName != "orders" || !strings.Contains(flagged[0].Detail, "11 entries") {
+				t.Errorf("anomalies = %+v, want one %q for 11 entries on orders", flagged, store.AnomalyBatchLimit)
+			}
+		})
+	}
+}
+
+func TestUnparsedReceiveFlagged(t *testing.T) {
+	tests := []struct {
+		name    string
+		isJSON  bool
+		resp    string
+		flagged bool
+	}{
+		{"malformed XML", false, `<ReceiveMessageResponse><ReceiveMessageResult><Mess`, true},
+		{"unrecognised XML message", false, `<ReceiveMessageResponse><ReceiveMessageResult><Message><Id>m-1</Id></Message></ReceiveMessageResult></ReceiveMessageResponse>`, true},
+		{"empty XML result", false, `<ReceiveMessageResponse><ReceiveMessageResult/></ReceiveMessageResponse>`, false},
+		{"malformed JSON", true, `{"Messages":[{"MessageId":`, true},
+		{"empty JSON result", true, `{}`, false},
+		{"empty body", true, ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, tt.resp))
+			const ordersURL = "http://localhost:4566/000000000000/orders"
+			if tt.isJSON {
+				callJSON(t, relay, "ReceiveMessage", `{"QueueUrl":"`+ordersURL+`"}`)
+			} else {
+				callForm(t, relay, url.Values{"Action": {"ReceiveMessage"}, "QueueUrl": {ordersURL}})
+			}
+
+			var flagged []store.Anomaly
+			for _, a := range s.GetAnomalies() {
+				if a.Kind == store.AnomalyUnparsedReceive {
+					flagged = append(flagged, a)
+				}
+			}
+			if !tt.flagged {
+				if len(flagged) != 0 {
+					t.Errorf("anomalies = %+v, want none", flagged)
+				}
+				return
+			}
+			if len(flagged) != 1 || flagged[0].QueueName != "orders" || !strings.Contains(flagged[0].Detail, tt.resp) {
+				t.Errorf("anomalies = %+v, want one on orders quoting the body", flagged)
+			}
+		})
+	}
+}
+
+func TestUpstreamHostOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		wantHost func(upstream *httptest.Server) string
+	}{
+		{"default", "", func(upstream *httptest.Server) string { return upstream.Listener.Addr().String() }},
+		{"override", "sqs.localstack", func(*httptest.Server) string { return "sqs.localstack" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hosts []string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hosts = append(hosts, r.Host)
+				w.Write([]byte(`{}`))
+			}))
+			t.Cleanup(upstream.Close)
+			p, _, relay := newTestRelay(t, upstream)
+			p.SetUpstreamHost(tt.host)
+
+			// Both forwarded calls and the relay's own calls reach the
+			// upstream's address carrying the configured Host
+			callJSON(t, relay, "ListQueues", `{}`)
+			p.call("ListQueues", url.Values{})
+
+			want := tt.wantHost(upstream)
+			if len(hosts) != 2 || hosts[0] != want || hosts[1] != want {
+				t.Errorf("upstream saw Host %q, want %q twice", hosts, want)
+			}
+		})
+	}
+}
+
+func TestUnparseableQueueURLGroupedUnderFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		body     string
+		want     string
+	}{
+		{"missing QueueUrl", "", `{"MessageBody":"hi"}`, DefaultUnknownQueue},
+		{"trailing slash", "", `{"QueueUrl":"http://localhost:4566/","MessageBody":"hi"}`, DefaultUnknownQueue},
+		{"configured fallback", "unaddressed", `{"MessageBody":"hi"}`, "unaddressed"},
+		{"parseable", "", `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi"}`, "orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{"MessageId":"m-1"}`))
+			if tt.fallback != "" {
+				p.SetUnknownQueueName(tt.fallback)
+			}
+			callJSON(t, relay, "SendMessage", tt.body)
+
+			messages := s.GetMessages("", true)
+			if len(messages) != 1 || messages[0].QueueName != tt.want {
+				t.Fatalf("messages = %+v, want one under %q", messages, tt.want)
+			}
+			if len(s.GetMessages(tt.want, true)) != 1 {
+				t.Errorf("no message listed under %q", tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveTaskCaptured(t *testing.T) {
+	const (
+		source      = "arn:aws:sqs:us-east-1:000000000000:orders-dlq"
+		destination = "arn:aws:sqs:us-east-1:000000000000:orders"
+	)
+	tests := []struct {
+		name   string
+		isJSON bool
+		start  string
+		cancel string
+	}{
+		{"JSON", true, `{"TaskHandle":"task-1"}`, `{"ApproximateNumberOfMessagesMoved":7}`},
+		{"query", false,
+			`<StartMessageMoveTaskResponse><StartMessageMoveTaskResult><TaskHandle>task-1</TaskHandle></StartMessageMoveTaskResult></StartMessageMoveTaskResponse>`,
+			`<CancelMessageMoveTaskResponse><CancelMessageMoveTaskResult><ApproximateNumberOfMessagesMoved>7</ApproximateNumberOfMessagesMoved></CancelMessageMoveTaskResult></CancelMessageMoveTaskResponse>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.start
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(resp))
+			}))
+			t.Cleanup(upstream.Close)
+			_, s, relay := newTestRelay(t, upstream)
+
+			if tt.isJSON {
+				callJSON(t, relay, "StartMessageMoveTask", `{"SourceArn":"`+source+`","DestinationArn":"`+destination+`","MaxNumberOfMessagesPerSecond":5}`)
+			} else {
+				callForm(t, relay, url.Values{"Action": {"StartMessageMoveTask"}, "SourceArn": {source}, "DestinationArn": {destination}, "MaxNumberOfMessagesPerSecond": {"5"}})
+			}
+			want := store.MoveTask{
+				TaskHandle:       "task-1",
+				SourceArn:        source,
+				DestinationArn:   destination,
+				SourceQueue:      "orders-dlq",
+				DestinationQueue: "orders",
+				Status:           "RUNNING",
+				MaxPerSecond:     5,
+			}
+			checkMoveTask(t, s, want)
+
+			resp = tt.cancel
+			if tt.isJSON {
+				callJSON(t, relay, "CancelMessageMoveTask", `{"TaskHandle":"task-1"}`)
+			} else {
+				callForm(t, relay, url.Values{"Action": {"CancelMessageMoveTask"}, "TaskHandle": {"task-1"}})
+			}
+			want.Status = "CANCELLING"
+			want.MessagesMoved = 7
+			checkMoveTask(t, s, want)
+		})
+	}
+}
+
+// checkMoveTask checks s holds exactly one move task, want, ignoring its
+// timestamps.
+func checkMoveTask(t *testing.T, s *store.Store, want store.MoveTask) {
+	t.Helper()
+	tasks := s.GetMoveTasks()
+	if len(tasks) != 1 {
+		t.Fatalf("move tasks = %+v, want one", tasks)
+	}
+	got := tasks[0]
+	got.StartedAt, got.UpdatedAt = time.Time{}, time.Time{}
+	if got != want {
+		t.Errorf("move task = %+v, want %+v", got, want)
+	}
+}
+
+func TestEmptyBodySendsFlagged(t *testing.T) {
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	tests := []struct {
+		name string
+		send func(t *testing.T, relay *httptest.Server)
+		want store.AnomalyKind // empty for none
+	}{
+		{"JSON empty body", func(t *testing.T, relay *httptest.Server) {
+			callJSON(t, relay, "SendMessage", `{"QueueUrl":"`+ordersURL+`","MessageBody":""}`)
+		}, store.AnomalyEmptyBody},
+		{"JSON missing body", func(t *testing.T, relay *httptest.Server) {
+			callJSON(t, relay, "SendMessage", `{"QueueUrl":"`+ordersURL+`"}`)
+		}, store.AnomalyMissingBody},
+		{"query empty body", func(t *testing.T, relay *httptest.Server) {
+			callForm(t, relay, url.Values{"Action": {"SendMessage"}, "QueueUrl": {ordersURL}, "MessageBody": {""}})
+		}, store.AnomalyEmptyBody},
+		{"query missing body", func(t *testing.T, relay *httptest.Server) {
+			callForm(t, relay, url.Values{"Action": {"SendMessage"}, "QueueUrl": {ordersURL}})
+		}, store.AnomalyMissingBody},
+		{"normal send", func(t *testing.T, relay *httptest.Server) {
+			callJSON(t, relay, "SendMessage", `{"QueueUrl":"`+ordersURL+`","MessageBody":"hi"}`)
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{"MessageId":"m-1"}`))
+			tt.send(t, relay)
+			tt.send(t, relay)
+
+			var flagged []store.Anomaly
+			for _, a := range s.GetAnomalies() {
+				if a.Kind == store.AnomalyEmptyBody || a.Kind == store.AnomalyMissingBody {
+					flagged = append(flagged, a)
+				}
+			}
+			if tt.want == "" {
+				if len(flagged) != 0 {
+					t.Errorf("anomalies = %+v, want none", flagged)
+				}
+				return
+			}
+			if len(flagged) != 2 || flagged[0].Kind != tt.want || flagged[0].QueueName != "orders" {
+				t.Fatalf("anomalies = %+v, want two %q on orders", flagged, tt.want)
+			}
+			if !strings.HasSuffix(flagged[0].Detail, "(2 on this queue)") {
+				t.Errorf("latest detail = %q, want a count of 2", flagged[0].Detail)
+			}
+		})
+	}
+}
+
+func TestCaptureScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  []string // captured operations, oldest first
+	}{
+		{"all", []string{"CreateQueue", "send"}},
+		{"control", []string{"CreateQueue"}},
+		{"data", []string{"send"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			scope, err := ParseCaptureScope(tt.scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Amz-Target") == "AmazonSQS.CreateQueue" {
+					w.Write([]byte(`{"QueueUrl":"http://localhost:4566/000000000000/orders"}`))
+					return
+				}
+				w.Write([]byte(`{"MessageId":"m-1"}`))
+			}))
+			t.Cleanup(upstream.Close)
+			p, s, relay := newTestRelay(t, upstream)
+			p.SetCaptureScope(scope)
+
+			for _, call := range []struct{ action, body string }{
+				{"CreateQueue", `{"QueueName":"orders"}`},
+				{"SendMessage", `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi"}`},
+			} {
+				if status := callJSON(t, relay, call.action, call.body); status != http.StatusOK {
+					t.Errorf("%s status = %d, want it forwarded", call.action, status)
+				}
+			}
+
+			history := s.GetHistory(0)
+			var got []string
+			for i := len(history) - 1; i >= 0; i-- {
+				if history[i].Action == store.ActionControl {
+					got = append(got, history[i].Operation)
+				} else {
+					got = append(got, string(history[i].Action))
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("captured %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseCaptureScope("everything"); err == nil {
+		t.Error("ParseCaptureScope accepted an unknown scope")
+	}
+}
+
+func TestReceiveRequestAttemptIdReuseFlagged(t *testing.T) {
+	const queueURL = "http://localhost:4566/000000000000/jobs.fifo"
+	tests := []struct {
+		name         string
+		retryReturns string
+		wantMismatch bool
+	}{
+		{"retry returns the same message", "m-1", false},
+		{"retry returns another message", "m-2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				id := "m-1"
+				if calls > 1 {
+					id = tt.retryReturns
+				}
+				w.Write([]byte(`{"Messages":[{"MessageId":"` + id + `","ReceiptHandle":"r-` + strconv.Itoa(calls) + `","Body":"job"}]}`))
+			}))
+			t.Cleanup(upstream.Close)
+			_, s, relay := newTestRelay(t, upstream)
+
+			for i := 0; i < 2; i++ {
+				callJSON(t, relay, "ReceiveMessage", `{"QueueUrl":"`+queueURL+`","ReceiveRequestAttemptId":"attempt-1"}`)
+			}
+
+			history := s.GetHistory(0)
+			if len(history) != 2 {
+				t.Fatalf("history has %d events, want 2 receives", len(history))
+			}
+			retry, first := history[0], history[1]
+			if first.ReceiveRequestAttemptID != "attempt-1" || retry.ReceiveRequestAttemptID != "attempt-1" {
+				t.Errorf("attempt IDs = %q, %q; want attempt-1 on both", first.ReceiveRequestAttemptID, retry.ReceiveRequestAttemptID)
+			}
+			if first.AttemptReused || !retry.AttemptReused {
+				t.Errorf("reused = %v, %v; want only the retry flagged", first.AttemptReused, retry.AttemptReused)
+			}
+
+			var mismatches int
+			for _, a := range s.GetAnomalies() {
+				if a.Kind == store.AnomalyAttemptMismatch {
+					mismatches++
+				}
+			}
+			if (mismatches == 1) != tt.wantMismatch || mismatches > 1 {
+				t.Errorf("got %d attempt mismatch anomalies, want mismatch %v", mismatches, tt.wantMismatch)
+			}
+		})
+	}
+}
+
+func TestLargeRequestBodyCapturedWithoutHeaderBloat(t *testing.T) {
+	large := strings.Repeat("x", 1<<20)
+	tests := []struct {
+		name string
+		call func(relay *httptest.Server)
+	}{
+		{"JSON", func(relay *httptest.Server) {
+			callJSON(t, relay, "SendMessage", `{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"`+large+`"}`)
+		}},
+		{"query", func(relay *httptest.Server) {
+			callForm(t, relay, url.Values{"Action": {"SendMessage"}, "QueueUrl": {"http://localhost:4566/000000000000/orders"}, "MessageBody": {large}})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headerBytes, bodyBytes int
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range r.Header {
+					for _, v := range values {
+						headerBytes += len(name) + len(v)
+					}
+				}
+				body, _ := io.ReadAll(r.Body)
+				bodyBytes = len(body)
+				if strings.Contains(r.Header.Get("Content-Type"), "json") {
+					w.Write([]byte(`{"MessageId":"m-1"}`))
+				} else {
+					w.Write([]byte(`<SendMessageResponse><SendMessageResult><MessageId>m-1</MessageId></SendMessageResult></SendMessageResponse>`))
+				}
+			}))
+			t.Cleanup(upstream.Close)
+			_, s, relay := newTestRelay(t, upstream)
+			tt.call(relay)
+
+			if headerBytes > 1024 {
+				t.Errorf("upstream got %d bytes of headers, want the body kept out of them", headerBytes)
+			}
+			if bodyBytes < len(large) {
+				t.Errorf("upstream got a %d byte body, want all of it", bodyBytes)
+			}
+			if msg, ok := s.GetMessage("m-1"); !ok || msg.Body != large {
+				t.Errorf("captured send missing or its body cut short")
+			}
+		})
+	}
+}
+
+func TestInjectedResponseHeaders(t *testing.T) {
+	headers, err := ParseResponseHeaders(`{"SendMessage":{"X-Amzn-Query-Error":"AWS.SimpleQueueService.Patched;Sender"},"*":{"X-Relay-Patched":"yes"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Query-Error", "Upstream;Sender")
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(upstream.Close)
+	p, _, relay := newTestRelay(t, upstream)
+
+	tests := []struct {
+		action     string
+		queryError string
+	}{
+		{"SendMessage", "AWS.SimpleQueueService.Patched;Sender"},
+		{"ReceiveMessage", "Upstream;Sender"},
+	}
+	for _, configured := range []bool{false, true} {
+		if configured {
+			p.SetResponseHeaders(headers)
+		}
+		for _, tt := range tests {
+			req, _ := http.NewRequest(http.MethodPost, relay.URL+"/", strings.NewReader(`{"QueueUrl":"http://localhost:4566/000000000000/orders","MessageBody":"hi"}`))
+			req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+			req.Header.Set("X-Amz-Target", "AmazonSQS."+tt.action)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			wantError, wantPatched := tt.queryError, "yes"
+			if !configured {
+				wantError, wantPatched = "Upstream;Sender", ""
+			}
+			if got := resp.Header.Get("X-Amzn-Query-Error"); got != wantError {
+				t.Errorf("configured %v, %s X-Amzn-Query-Error = %q, want %q", configured, tt.action, got, wantError)
+			}
+			if got := resp.Header.Get("X-Relay-Patched"); got != wantPatched {
+				t.Errorf("configured %v, %s X-Relay-Patched = %q, want %q", configured, tt.action, got, wantPatched)
+			}
+		}
+	}
+
+	if _, err := ParseResponseHeaders(`{"SendMessage":{"":"x"}}`); err == nil {
+		t.Error("ParseResponseHeaders accepted an empty header name")
+	}
+}
+
+func TestDeleteQueueRemovesQueueFromStats(t *testing.T) {
+	_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{"MessageId":"m-1"}`))
+	const queueURL = "http://localhost:4566/000000000000/orders"
+	callJSON(t, relay, "SendMessage", `{"QueueUrl":"`+queueURL+`","MessageBody":"hi"}`)
+	callJSON(t, relay, "SendMessage", `{"QueueUrl":"http://localhost:4566/000000000000/payments","MessageBody":"hi"}`)
+
+	callJSON(t, relay, "DeleteQueue", `{"QueueUrl":"`+queueURL+`"}`)
+
+	for _, qs := range s.GetQueueStats() {
+		if qs.QueueName == "orders" {
+			t.Errorf("deleted queue still in stats: %+v", qs)
+		}
+	}
+	if _, ok := s.GetMessage("m-1"); ok {
+		t.Error("message of the deleted queue is still stored")
+	}
+	var deleted bool
+	for _, event := range s.GetHistory(0) {
+		if event.QueueName == "orders" && event.Action != store.ActionControl {
+			t.Errorf("history keeps %s event of the deleted queue", event.Action)
+		}
+		deleted = deleted || event.QueueName == "orders" && event.Operation == "DeleteQueue"
+	}
+	if !deleted {
+		t.Error("DeleteQueue event missing from history")
+	}
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"encoding/json"
+	"html"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func (p *Proxy) handleGetQueueURL(reqBody string, form url.Values, respBody string, isJSON bool) {
+	var queueName, queueURL string
+	if isJSON {
+		queueName = parseJSONField(reqBody, "QueueName")
+		queueURL = parseJSONField(respBody, "QueueUrl")
+	} else {
+		queueName = form.Get("QueueName")
+		queueURL = extractXMLTag(respBody, "QueueUrl")
+	}
+
+	if queueName != "" && queueURL != "" {
+		p.store.MarkQueueKnown(queueName)
+	}
+}
+
+func (p *Proxy) handleCreateQueue(reqBody string, form url.Values, respBody string, isJSON bool) {
+	var queueName, queueURL string
+	if isJSON {
+		queueName = parseJSONField(reqBody, "QueueName")
+		queueURL = parseJSONField(respBody, "QueueUrl")
+	} else {
+		queueName = form.Get("QueueName")
+		queueURL = extractXMLTag(respBody, "QueueUrl")
+	}
+	if queueName == "" || queueURL == "" {
+		return
+	}
+
+	attrs := extractQueueAttributes(reqBody, form, isJSON)
+	p.store.RecordQueueCreate(queueName, queueURL, attrs)
+	p.recordRedrivePolicy(queueName, attrs)
+	log.Printf("  -> Created queue %s with %d attribute(s)", queueName, len(attrs))
+}
+
+// handleSetQueueAttributes records the attributes a SetQueueAttributes call
+// set. It is only called for calls the upstream accepted, so the observed
+// configuration never shows values the queue refused.
+func (p *Proxy) handleSetQueueAttributes(queueName, reqBody string, form url.Values, isJSON bool) {
+	attrs := extractQueueAttributes(reqBody, form, isJSON)
+	if len(attrs) > 0 {
+		p.store.RecordQueueAttributes(queueName, attrs)
+	}
+	p.recordRedrivePolicy(queueName, attrs)
+}
+
+func (p *Proxy) handleGetQueueAttributes(queueName, respBody string, isJSON bool) {
+	var attrs map[string]string
+	if isJSON {
+		attrs = extractQueueAttributes(respBody, nil, true)
+	} else {
+		attrs = extractXMLAttributes(respBody)
+	}
+
+	if len(attrs) > 0 {
+		p.store.RecordQueueAttributes(queueName, attrs)
+		log.Printf("  -> Observed %d attribute(s) of %s", len(attrs), queueName)
+	}
+	p.recordRedrivePolicy(queueName, attrs)
+}
+
+func (p *Proxy) handleListDeadLetterSourceQueues(queueName, respBody string, isJSON bool) {
+	var sourceURLs []string
+
+	if isJSON {
+		var resp map[string]interface{}
+		if err := json.Unmarshal([]byte(respBody), &resp); err == nil {
+			if urls, ok := resp["queueUrls"].([]interface{}); ok {
+				for _, u := range urls {
+					if s, ok := u.(string); ok {
+						sourceURLs = append(sourceURLs, s)
+					}
+				}
+			}
+		}
+	} else {
+		sourceURLs = extractAllXMLTags(respBody, "QueueUrl")
+	}
+
+	sources := make([]string, 0, len(sourceURLs))
+	for _, u := range sourceURLs {
+		sources = append(sources, extractQueueName(u))
+	}
+
+	p.store.RecordDeadLetterSources(queueName, sources)
+	log.Printf("  -> %d source queue(s) use %s as DLQ", len(sources), queueName)
+}
+
+func (p *Proxy) recordRedrivePolicy(queueName string, attrs map[string]string) {
+	policy, ok := attrs["RedrivePolicy"]
+	if !ok {
+		return
+	}
+
+	dlqName, maxReceiveCount, ok := parseRedrivePolicy(policy)
+	if !ok {
+		return
+	}
+
+	p.store.RecordRedrivePolicy(queueName, dlqName, maxReceiveCount)
+	log.Printf("  -> %s redrives to %s after %d receives", queueName, dlqName, maxReceiveCount)
+}
+
+// extractQueueAttributes returns the queue Attributes map from a CreateQueue
+// or SetQueueAttributes request.
+func extractQueueAttributes(body string, form url.Values, isJSON bool) map[string]string {
+	attrs := make(map[string]string)
+
+	if isJSON {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(body), &data); err == nil {
+			if a, ok := data["Attributes"].(map[string]interface{}); ok {
+				for name, v := range a {
+					if sv, ok := v.(string); ok {
+						attrs[name] = sv
+					}
+				}
+			}
+		}
+	} else {
+		names := formEntries(form, "Attribute", "Name")
+		values := formEntries(form, "Attribute", "Value")
+
+		for idx, name := range names {
+			if val, ok := values[idx]; ok {
+				attrs[name] = val
+			}
+		}
+	}
+
+	return attrs
+}
+
+// extractXMLAttributes returns the <Attribute><Name/><Value/></Attribute>
+// pairs of a GetQueueAttributes XML response.
+func extractXMLAttributes(xml string) map[string]string {
+	attrs := make(map[string]string)
+
+	attrRe := regexp.MustCompile(`(?s)<Attribute>(.*?)</Attribute>`)
+	for _, match := range attrRe.FindAllStringSubmatch(xml, -1) {
+		name := extractXMLTag(match[1], "Name")
+		if name != "" {
+			attrs[name] = html.UnescapeString(extractXMLTag(match[1], "Value"))
+		}
+	}
+
+	return attrs
+}
+
+// parseRedrivePolicy extracts the DLQ name and maxReceiveCount from a
+// RedrivePolicy attribute value such as
+// {"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:orders-dlq","maxReceiveCount":"5"}.
+func parseRedrivePolicy(policy string) (string, int, bool) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(policy), &data); err != nil {
+		return "", 0, false
+	}
+
+	arn, _ := data["deadLetterTargetArn"].(string)
+	if arn == "" {
+		return "", 0, false
+	}
+	dlqName := arn[strings.LastIndex(arn, ":")+1:]
+
+	maxReceiveCount := 0
+	switch v := data["maxReceiveCount"].(type) {
+	case float64:
+		maxReceiveCount = int(v)
+	case string:
+		maxReceiveCount, _ = strconv.Atoi(v)
+	}
+
+	return dlqName, maxReceiveCount, true
+}
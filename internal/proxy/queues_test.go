@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"aws-relay/internal/store"
+)
+
+const setVisibilityTimeout = `{
+	"QueueUrl": "http://localhost:4566/000000000000/orders",
+	"Attributes": {"VisibilityTimeout": "45"}
+}`
+
+func TestSetQueueAttributesRecordsObservedConfiguration(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		recorded bool
+	}{
+		{"accepted", http.StatusOK, `{}`, true},
+		{"rejected", http.StatusBadRequest, rejected, false},
+		{"upstream error", http.StatusInternalServerError, `{"__type":"com.amazonaws.sqs#InternalError"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, tt.status, tt.body))
+
+			callJSON(t, relay, "SetQueueAttributes", setVisibilityTimeout)
+			attrs, ok := s.GetQueueAttributes("orders")
+			if ok != tt.recorded {
+				t.Fatalf("recorded = %v, want %v (attributes %v)", ok, tt.recorded, attrs)
+			}
+			if tt.recorded && attrs["VisibilityTimeout"] != "45" {
+				t.Errorf("VisibilityTimeout = %q, want 45", attrs["VisibilityTimeout"])
+			}
+		})
+	}
+}
+
+func TestUpstreamCountsShownBesidePending(t *testing.T) {
+	tests := []struct {
+		name        string
+		visible     string
+		discrepancy bool
+	}{
+		{"agree", "1", false},
+		{"relay missed traffic", "5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, s, relay := newTestRelay(t, testUpstream(t, http.StatusOK, `{"Attributes":{
+				"ApproximateNumberOfMessages": "`+tt.visible+`",
+				"ApproximateNumberOfMessagesNotVisible": "1",
+				"ApproximateNumberOfMessagesDelayed": "0"}}`))
+			s.RecordSend(store.Meta{}, "", "orders", "m-1", "one", nil, nil)
+			s.RecordSend(store.Meta{}, "", "orders", "m-2", "two", nil, nil)
+
+			callJSON(t, relay, "GetQueueAttributes", `{"QueueUrl":"http://localhost:4566/000000000000/orders","AttributeNames":["All"]}`)
+
+			var stats store.QueueStats
+			for _, qs := range s.GetQueueStats() {
+				if qs.QueueName == "orders" {
+					stats = qs
+				}
+			}
+			if stats.UpstreamApproximate == nil || stats.UpstreamNotVisible == nil {
+				t.Fatalf("stats = %+v, want the upstream counts", stats)
+			}
+			if got := strconv.Itoa(*stats.UpstreamApproximate); got != tt.visible || *stats.UpstreamNotVisible != 1 {
+				t.Errorf("upstream counts = %d visible, %d not visible; want %s and 1", *stats.UpstreamApproximate, *stats.UpstreamNotVisible, tt.visible)
+			}
+			if stats.Pending != 2 || stats.Discrepancy != tt.discrepancy {
+				t.Errorf("pending = %d, discrepancy = %v; want 2 and %v", stats.Pending, stats.Discrepancy, tt.discrepancy)
+			}
+		})
+	}
+}
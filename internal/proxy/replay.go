@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"aws-relay/internal/store"
+)
+
+// Reasons Replay refuses a message.
+var (
+	ErrReplayUnknownMessage = errors.New("message not captured")
+	ErrReplayNoBody         = errors.New("message body not captured in full")
+	ErrReplayNoQueueURL     = errors.New("queue URL of message unknown")
+)
+
+// ReplayResult is the outcome of a successful Replay.
+type ReplayResult struct {
+	MessageID  string `json:"messageId"`
+	Queue      string `json:"queue"`
+	ReplayedAs string `json:"replayedAs"`
+}
+
+// Replay sends a copy of the captured message with messageID to its queue
+// on the upstream, with the captured body, attributes and message group,
+// and records the new send. FIFO copies get a fresh deduplication ID so the
+// upstream doesn't discard them as duplicates of the original.
+func (p *Proxy) Replay(messageID string) (ReplayResult, error) {
+	msg, ok := p.store.GetMessage(messageID)
+	if !ok {
+		return ReplayResult{}, ErrReplayUnknownMessage
+	}
+	if msg.Body == "" || msg.BodySampled {
+		return ReplayResult{}, ErrReplayNoBody
+	}
+	if msg.QueueURL == "" {
+		return ReplayResult{}, ErrReplayNoQueueURL
+	}
+
+	params := url.Values{}
+	params.Set("QueueUrl", msg.QueueURL)
+	params.Set("MessageBody", msg.Body)
+	setAttributeParams(params, msg.Attributes, msg.AttributeTypes)
+	if msg.MessageGroupID != "" {
+		params.Set("MessageGroupId", msg.MessageGroupID)
+	}
+	var dedupID string
+	if strings.HasSuffix(msg.QueueName, ".fifo") {
+		dedupID = newTraceID()
+		params.Set("MessageDeduplicationId", dedupID)
+	}
+
+	status, body, err := p.call("SendMessage", params)
+	if err == nil && status >= 300 {
+		err = fmt.Errorf("upstream returned %d %s", status, extractXMLTag(body, "Code"))
+	}
+	if err != nil {
+		return ReplayResult{}, err
+	}
+
+	replayedAs := extractXMLTag(body, "MessageId")
+	meta := store.Meta{
+		TraceID:        newTraceID(),
+		Upstream:       p.upstreamOrigin(),
+		MessageGroupID: msg.MessageGroupID,
+		AttributeTypes: msg.AttributeTypes,
+		ReplayOf:       messageID,
+
+		MessageDeduplicationID: dedupID,
+		SequenceNumber:         extractXMLTag(body, "SequenceNumber"),
+	}
+	p.store.RecordSend(meta, msg.QueueURL, msg.QueueName, replayedAs, msg.Body, msg.Attributes, nil)
+	log.Printf("  -> Replayed %s to %s as %s", messageID, msg.QueueName, replayedAs)
+
+	return ReplayResult{MessageID: messageID, Queue: msg.QueueName, ReplayedAs: replayedAs}, nil
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+
+	"aws-relay/internal/store"
+)
+
+// CaptureScope selects which SQS actions the proxy captures. Uncaptured
+// actions are still forwarded.
+type CaptureScope string
+
+const (
+	ScopeAll     CaptureScope = "all"
+	ScopeControl CaptureScope = "control" // queue lifecycle and configuration
+	ScopeData    CaptureScope = "data"    // message traffic
+)
+
+// ParseCaptureScope validates a capture scope name.
+func ParseCaptureScope(s string) (CaptureScope, error) {
+	switch scope := CaptureScope(s); scope {
+	case ScopeAll, ScopeControl, ScopeData:
+		return scope, nil
+	}
+	return "", fmt.Errorf("unknown capture scope %q (want all, control or data)", s)
+}
+
+// dataPlaneActions operate on messages; controlPlaneActions on queues.
+var (
+	dataPlaneActions = map[string]bool{
+		"SendMessage":                  true,
+		"SendMessageBatch":             true,
+		"ReceiveMessage":               true,
+		"DeleteMessage":                true,
+		"DeleteMessageBatch":           true,
+		"ChangeMessageVisibility":      true,
+		"ChangeMessageVisibilityBatch": true,
+		"PurgeQueue":                   true,
+		"Publish":                      true, // SNS, tracked for fan-out to queues
+	}
+	controlPlaneActions = map[string]bool{
+		"CreateQueue":                true,
+		"DeleteQueue":                true,
+		"GetQueueUrl":                true,
+		"ListQueues":                 true,
+		"GetQueueAttributes":         true,
+		"SetQueueAttributes":         true,
+		"TagQueue":                   true,
+		"UntagQueue":                 true,
+		"ListQueueTags":              true,
+		"AddPermission":              true,
+		"RemovePermission":           true,
+		"ListDeadLetterSourceQueues": true,
+		"StartMessageMoveTask":       true,
+		"CancelMessageMoveTask":      true,
+		"ListMessageMoveTasks":       true,
+	}
+)
+
+// SetCaptureScope limits capture to control-plane or data-plane actions.
+func (p *Proxy) SetCaptureScope(scope CaptureScope) {
+	p.scope = scope
+}
+
+// CaptureScope returns the active capture scope.
+func (p *Proxy) CaptureScope() CaptureScope {
+	return p.scope
+}
+
+// captures reports whether action falls within the capture scope. Actions
+// of neither plane are only captured when the scope is all.
+func (p *Proxy) captures(action string) bool {
+	switch p.scope {
+	case ScopeControl:
+		return controlPlaneActions[action]
+	case ScopeData:
+		return dataPlaneActions[action]
+	}
+	return true
+}
+
+// recordControl records a successful control-plane call as a history event.
+// Calls that name no queue, such as ListQueues, are not recorded.
+func (p *Proxy) recordControl(meta store.Meta, action, queueURL, queueName, reqBody string, form url.Values, respBody string, isJSON bool) {
+	if action == "CreateQueue" || action == "GetQueueUrl" {
+		if isJSON {
+			queueName = parseJSONField(reqBody, "QueueName")
+			queueURL = parseJSONField(respBody, "QueueUrl")
+		} else {
+			queueName = form.Get("QueueName")
+			queueURL = extractXMLTag(respBody, "QueueUrl")
+		}
+	} else if queueURL == "" {
+		return
+	}
+	if queueName == "" {
+		return
+	}
+
+	p.store.RecordControl(meta, queueURL, queueName, action)
+	log.Printf("  -> %s on %s", action, queueName)
+}
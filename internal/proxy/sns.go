@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/url"
+
+	"aws-relay/internal/store"
+)
+
+// publishedMessage is an SNS Publish request.
+type publishedMessage struct {
+	TopicArn   string
+	Body       string
+	Attributes map[string]string
+	Types      map[string]string // DataType of each of Attributes
+}
+
+func decodePublishRequest(body string, form url.Values, isJSON bool) publishedMessage {
+	if isJSON {
+		var req struct {
+			TopicArn          string
+			TargetArn         string
+			Message           string
+			MessageAttributes map[string]jsonAttributeValue
+		}
+		json.Unmarshal([]byte(body), &req)
+		if req.TopicArn == "" {
+			req.TopicArn = req.TargetArn
+		}
+		return publishedMessage{req.TopicArn, req.Message, attributeValues(req.MessageAttributes), attributeTypes(req.MessageAttributes)}
+	}
+
+	topicArn := form.Get("TopicArn")
+	if topicArn == "" {
+		topicArn = form.Get("TargetArn")
+	}
+	attrs := formTypedAttributes(form, "MessageAttributes.entry")
+	return publishedMessage{
+		TopicArn:   topicArn,
+		Body:       form.Get("Message"),
+		Attributes: attributeValues(attrs),
+		Types:      attributeTypes(attrs),
+	}
+}
+
+// decodePublishResponse returns the message ID SNS assigned a Publish.
+func decodePublishResponse(body string, isJSON bool) string {
+	if isJSON {
+		return parseJSONField(body, "MessageId")
+	}
+	var resp struct {
+		MessageID string `xml:"PublishResult>MessageId"`
+	}
+	xml.Unmarshal([]byte(body), &resp)
+	return resp.MessageID
+}
+
+func (p *Proxy) handlePublish(meta store.Meta, reqBody string, form url.Values, respBody string, isJSON bool) {
+	msg := decodePublishRequest(reqBody, form, isJSON)
+	messageID := decodePublishResponse(respBody, isJSON)
+	if messageID == "" || msg.TopicArn == "" {
+		return
+	}
+
+	meta.AttributeTypes = msg.Types
+	p.store.RecordPublish(meta, msg.TopicArn, messageID, msg.Body, msg.Attributes)
+	log.Printf("  -> Published message %s to %s", messageID, store.TopicName(msg.TopicArn))
+}
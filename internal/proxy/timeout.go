@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultUpstreamTimeout bounds upstream calls other than long polls.
+	DefaultUpstreamTimeout = 10 * time.Second
+
+	// receiveTimeoutBuffer is added to a ReceiveMessage's wait time to
+	// allow for the upstream's own processing.
+	receiveTimeoutBuffer = 5 * time.Second
+
+	// maxWaitTimeSeconds is the longest long poll SQS allows.
+	maxWaitTimeSeconds = 20
+)
+
+// SetUpstreamTimeout sets the deadline for upstream calls other than
+// ReceiveMessage, whose deadline follows its long-poll wait time. Zero or
+// less leaves those calls without a deadline.
+func (p *Proxy) SetUpstreamTimeout(d time.Duration) {
+	p.upstreamTimeout = d
+}
+
+// withUpstreamDeadline returns r with a context deadline suited to action,
+// and the function releasing it.
+func (p *Proxy) withUpstreamDeadline(r *http.Request, action, queueName, body string, form url.Values, isJSON bool) (*http.Request, context.CancelFunc) {
+	timeout := p.upstreamTimeout
+	if action == "ReceiveMessage" {
+		wait := time.Duration(p.receiveWaitSeconds(queueName, body, form, isJSON)) * time.Second
+		timeout = wait + receiveTimeoutBuffer
+	}
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		return r.WithContext(ctx), cancel
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return r.WithContext(ctx), cancel
+}
+
+// receiveWaitSeconds returns how long a ReceiveMessage may long-poll: its
+// WaitTimeSeconds if given, else the queue's ReceiveMessageWaitTimeSeconds
+// if known, else the SQS maximum.
+func (p *Proxy) receiveWaitSeconds(queueName, body string, form url.Values, isJSON bool) int {
+	if isJSON {
+		var req struct {
+			WaitTimeSeconds *int
+		}
+		if err := json.Unmarshal([]byte(body), &req); err == nil && req.WaitTimeSeconds != nil {
+			return *req.WaitTimeSeconds
+		}
+	} else if n, err := strconv.Atoi(form.Get("WaitTimeSeconds")); err == nil {
+		return n
+	}
+
+	if attrs, ok := p.store.GetQueueAttributes(queueName); ok {
+		if n, err := strconv.Atoi(attrs["ReceiveMessageWaitTimeSeconds"]); err == nil {
+			return n
+		}
+	}
+	return maxWaitTimeSeconds
+}
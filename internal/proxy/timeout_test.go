@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+func TestUpstreamDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		action   string
+		body     string
+		isJSON   bool
+		want     time.Duration // 0 for no deadline
+		queueSet bool          // queue's ReceiveMessageWaitTimeSeconds is 3
+	}{
+		{"send", DefaultUpstreamTimeout, "SendMessage", `{"MessageBody":"hi"}`, true, DefaultUpstreamTimeout, false},
+		{"JSON receive waits", DefaultUpstreamTimeout, "ReceiveMessage", `{"WaitTimeSeconds":10}`, true, 10*time.Second + receiveTimeoutBuffer, false},
+		{"form receive waits", DefaultUpstreamTimeout, "ReceiveMessage", "Action=ReceiveMessage&WaitTimeSeconds=10", false, 10*time.Second + receiveTimeoutBuffer, false},
+		{"short poll", DefaultUpstreamTimeout, "ReceiveMessage", `{"WaitTimeSeconds":0}`, true, receiveTimeoutBuffer, false},
+		{"queue wait time", DefaultUpstreamTimeout, "ReceiveMessage", `{}`, true, 3*time.Second + receiveTimeoutBuffer, true},
+		{"longest wait", DefaultUpstreamTimeout, "ReceiveMessage", `{}`, true, maxWaitTimeSeconds*time.Second + receiveTimeoutBuffer, false},
+		{"zero timeout", 0, "SendMessage", `{"MessageBody":"hi"}`, true, 0, false},
+		{"negative timeout", -time.Second, "SendMessage", `{"MessageBody":"hi"}`, true, 0, false},
+		{"zero timeout receive", 0, "ReceiveMessage", `{"WaitTimeSeconds":10}`, true, 10*time.Second + receiveTimeoutBuffer, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.New()
+			if tt.queueSet {
+				s.RecordQueueAttributes("orders", map[string]string{"ReceiveMessageWaitTimeSeconds": "3"})
+			}
+			p := New("http://localhost:4566", s)
+			p.SetUpstreamTimeout(tt.timeout)
+
+			var form url.Values
+			if !tt.isJSON {
+				form = parseForm(tt.body)
+			}
+			start := time.Now()
+			r, cancel := p.withUpstreamDeadline(httptest.NewRequest(http.MethodPost, "/", nil), tt.action, "orders", tt.body, form, tt.isJSON)
+			defer cancel()
+
+			deadline, ok := r.Context().Deadline()
+			if tt.want == 0 {
+				if ok {
+					t.Errorf("deadline in %s, want none", deadline.Sub(start))
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no deadline, want %s", tt.want)
+			}
+			if got := deadline.Sub(start); got < tt.want-time.Second || got > tt.want+time.Second {
+				t.Errorf("deadline in %s, want about %s", got, tt.want)
+			}
+		})
+	}
+}
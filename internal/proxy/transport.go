@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	upstreamDialTimeout         = 5 * time.Second
+	upstreamTLSHandshakeTimeout = 10 * time.Second
+
+	// upstreamHeaderTimeout bounds the wait for response headers. It must
+	// outlast the longest long poll; per-call deadlines are usually tighter.
+	upstreamHeaderTimeout = maxWaitTimeSeconds*time.Second + receiveTimeoutBuffer
+)
+
+// newUpstreamTransport returns the transport for calls to the upstream,
+// plaintext or TLS.
+func newUpstreamTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   upstreamDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   upstreamTLSHandshakeTimeout,
+		ResponseHeaderTimeout: upstreamHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+}
+
+// SetInsecureTLS turns off verification of the upstream's TLS certificate,
+// for development upstreams with self-signed certificates. It has no effect
+// on an http upstream.
+func (p *Proxy) SetInsecureTLS(insecure bool) {
+	p.transport.TLSClientConfig.InsecureSkipVerify = insecure
+}
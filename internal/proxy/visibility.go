@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"strconv"
+
+	"aws-relay/internal/store"
+)
+
+func (p *Proxy) handleChangeMessageVisibility(meta store.Meta, queueURL, queueName, reqBody string, form url.Values, isJSON bool) {
+	var receiptHandle string
+	var timeout int
+	if isJSON {
+		var req struct {
+			ReceiptHandle     string
+			VisibilityTimeout int
+		}
+		if err := json.Unmarshal([]byte(reqBody), &req); err != nil {
+			return
+		}
+		receiptHandle, timeout = req.ReceiptHandle, req.VisibilityTimeout
+	} else {
+		receiptHandle = form.Get("ReceiptHandle")
+		timeout, _ = strconv.Atoi(form.Get("VisibilityTimeout"))
+	}
+
+	if receiptHandle != "" {
+		p.store.RecordChangeVisibility(meta, queueURL, queueName, receiptHandle, timeout)
+		log.Printf("  ~ Changed visibility of a message in %s to %ds", queueName, timeout)
+	}
+}
+
+func (p *Proxy) handleChangeMessageVisibilityBatch(meta store.Meta, queueURL, queueName, reqBody string, form url.Values, respBody string, isJSON bool) {
+	result := decodeBatchResponse(respBody, isJSON)
+	failed := result.failed()
+	changed := 0
+	for _, entry := range decodeReceiptBatchRequest(reqBody, form, isJSON, "ChangeMessageVisibilityBatchRequestEntry") {
+		if failed[entry.ID] {
+			continue
+		}
+		p.store.RecordChangeVisibility(meta, queueURL, queueName, entry.ReceiptHandle, entry.VisibilityTimeout)
+		changed++
+	}
+	log.Printf("  ~ Changed visibility of %d message(s) in %s", changed, queueName)
+	p.recordBatchFailures("ChangeMessageVisibilityBatch", queueName, result.Failed)
+}
+
+// requestedVisibilityTimeout returns the VisibilityTimeout a ReceiveMessage
+// asked for, or nil if it used the queue's.
+func requestedVisibilityTimeout(reqBody string, form url.Values, isJSON bool) *int {
+	if isJSON {
+		var req struct {
+			VisibilityTimeout *int
+		}
+		if err := json.Unmarshal([]byte(reqBody), &req); err == nil {
+			return req.VisibilityTimeout
+		}
+		return nil
+	}
+	if n, err := strconv.Atoi(form.Get("VisibilityTimeout")); err == nil {
+		return &n
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package store
+
+import "time"
+
+// DefaultAckGrace is how long a received message may go undeleted before it
+// counts against the queue's ack ratio.
+const DefaultAckGrace = 30 * time.Second
+
+// SetAckGrace sets how long received messages are given to be deleted before
+// they count as unacknowledged in AckRatio.
+func (s *Store) SetAckGrace(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ackGrace = d
+}
+
+// applyAckRatio sets stats.AckRatio to the fraction of received messages
+// that were later deleted. Messages received within the ack grace period and
+// not yet deleted are left out, since their consumer may still be working on
+// them. Callers must hold the lock.
+func (s *Store) applyAckRatio(stats *QueueStats, c *queueCounts) {
+	cutoff := s.now().Add(-s.ackGrace)
+	settled := c.acked
+	for _, receivedAt := range c.unacked {
+		if receivedAt.Before(cutoff) {
+			settled++
+		}
+	}
+	if settled == 0 {
+		return
+	}
+
+	ratio := float64(c.acked) / float64(settled)
+	stats.AckRatio = &ratio
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+type AnomalyKind string
+
+const (
+	AnomalyMethod          AnomalyKind = "method"
+	AnomalyQueueFirstSeen  AnomalyKind = "queue_first_seen"
+	AnomalyBodyLimit       AnomalyKind = "body_limit"
+	AnomalyUpstreamError   AnomalyKind = "upstream_error"
+	AnomalyPurgeInProgress AnomalyKind = "purge_in_progress"
+	AnomalyBatchLimit      AnomalyKind = "batch_limit"
+	AnomalyOversized       AnomalyKind = "oversized"
+	AnomalyAttributeCasing AnomalyKind = "attribute_casing"
+	AnomalyUnparsedReceive AnomalyKind = "unparsed_receive"
+	AnomalyEmptyBody       AnomalyKind = "empty_body"
+	AnomalyMissingBody     AnomalyKind = "missing_body"
+	AnomalyPartialCapture  AnomalyKind = "partial_capture"
+	AnomalyAttemptMismatch AnomalyKind = "attempt_mismatch"
+	AnomalyAttributeMD5    AnomalyKind = "attribute_md5"
+
+	// AnomalyQueueDeletedRecently is a CreateQueue rejected because the
+	// name was freed less than 60 seconds earlier, typically a race between
+	// test teardown and setup.
+	AnomalyQueueDeletedRecently AnomalyKind = "queue_deleted_recently"
+
+	// AnomalyClockSkew is an upstream whose SentTimestamps disagree with the
+	// relay's clock by more than the skew threshold.
+	AnomalyClockSkew AnomalyKind = "clock_skew"
+)
+
+const maxAnomalies = 1000
+
+// Anomaly is a suspicious condition observed in proxied traffic, such as a
+// misconfigured client, that is worth surfacing next to the captured events.
+type Anomaly struct {
+	ID        string      `json:"id"`
+	Kind      AnomalyKind `json:"kind"`
+	QueueName string      `json:"queueName,omitempty"`
+	Detail    string      `json:"detail"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+func (s *Store) RecordAnomaly(kind AnomalyKind, queueName, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addAnomaly(kind, queueName, detail)
+}
+
+// RecordEmptyBody flags a SendMessage to queueName whose MessageBody was
+// empty or, if missing is set, absent altogether. The detail carries how many
+// such sends the queue has seen since the last clear.
+func (s *Store) RecordEmptyBody(queueName string, missing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kind, what := AnomalyEmptyBody, "an empty MessageBody"
+	if missing {
+		kind, what = AnomalyMissingBody, "no MessageBody"
+	}
+
+	if s.emptyBodies[queueName] == nil {
+		s.emptyBodies[queueName] = make(map[AnomalyKind]int)
+	}
+	s.emptyBodies[queueName][kind]++
+	s.addAnomaly(kind, queueName, fmt.Sprintf("SendMessage with %s (%d on this queue)", what, s.emptyBodies[queueName][kind]))
+}
+
+// addAnomaly appends an anomaly, keeping at most maxAnomalies. Callers must
+// hold the write lock.
+func (s *Store) addAnomaly(kind AnomalyKind, queueName, detail string) {
+	if len(s.anomalies) >= maxAnomalies {
+		s.anomalies = s.anomalies[1:]
+	}
+	s.anomalies = append(s.anomalies, &Anomaly{
+		ID:        generateID(),
+		Kind:      kind,
+		QueueName: queueName,
+		Detail:    detail,
+		Timestamp: s.now(),
+	})
+}
+
+// GetAnomalies returns anomalies derived from the current capture, such as
+// attribute casing conflicts, followed by recorded anomalies, most recent
+// first.
+func (s *Store) GetAnomalies() []Anomaly {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := s.attributeCasingAnomalies()
+	for i := len(s.anomalies) - 1; i >= 0; i-- {
+		result = append(result, *s.anomalies[i])
+	}
+	if result == nil {
+		result = []Anomaly{}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendToUnknownQueueFlagged(t *testing.T) {
+	tests := []struct {
+		name  string
+		flag  bool
+		known bool
+		want  int
+	}{
+		{"never seen", true, false, 1},
+		{"created first", true, true, 0},
+		{"flagging off", false, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			s := New()
+			s.SetClock(clock)
+			s.SetFlagNewQueues(tt.flag)
+			if tt.known {
+				s.MarkQueueKnown("orders")
+			}
+
+			s.RecordSend(Meta{}, "", "orders", "m-1", "one", nil, nil)
+			clock.Advance(time.Second)
+			s.RecordSend(Meta{}, "", "orders", "m-2", "two", nil, nil)
+
+			var flagged []Anomaly
+			for _, a := range s.GetAnomalies() {
+				if a.Kind == AnomalyQueueFirstSeen {
+					flagged = append(flagged, a)
+				}
+			}
+			if len(flagged) != tt.want {
+				t.Fatalf("first-seen anomalies = %+v, want %d", flagged, tt.want)
+			}
+			if tt.want > 0 && (flagged[0].QueueName != "orders" || !flagged[0].Timestamp.Equal(newFakeClock().Now())) {
+				t.Errorf("anomaly = %+v, want orders at the first send", flagged[0])
+			}
+		})
+	}
+}
+
+func TestAttributeCasingInconsistencyReported(t *testing.T) {
+	s := New()
+	s.RecordSend(Meta{}, "", "orders", "m-1", "one", map[string]string{"orderId": "1"}, nil)
+	s.RecordSend(Meta{}, "", "orders", "m-2", "two", map[string]string{"orderId": "2"}, nil)
+	s.RecordSend(Meta{}, "", "orders", "m-3", "three", map[string]string{"OrderId": "3"}, nil)
+	// The same casing split across queues is not a conflict
+	s.RecordSend(Meta{}, "", "payments", "m-4", "four", map[string]string{"orderId": "4"}, nil)
+	s.RecordSend(Meta{}, "", "refunds", "m-5", "five", map[string]string{"OrderId": "5"}, nil)
+
+	var flagged []Anomaly
+	for _, a := range s.GetAnomalies() {
+		if a.Kind == AnomalyAttributeCasing {
+			flagged = append(flagged, a)
+		}
+	}
+	if len(flagged) != 1 {
+		t.Fatalf("casing anomalies = %+v, want one", flagged)
+	}
+	if want := "attribute keys differ only by case: OrderId (1), orderId (2)"; flagged[0].QueueName != "orders" || flagged[0].Detail != want {
+		t.Errorf("anomaly = %+v, want %q on orders", flagged[0], want)
+	}
+}
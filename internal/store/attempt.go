@@ -0,0 +1,44 @@
+package store
+
+import "fmt"
+
+// receiveAttempt is what the first ReceiveMessage carrying a
+// ReceiveRequestAttemptId returned.
+type receiveAttempt struct {
+	traceID    string
+	messageIDs map[string]bool
+}
+
+type attemptKey struct {
+	queueName string
+	attemptID string
+}
+
+// checkReceiveAttempt marks a receive event whose ReceiveRequestAttemptId was
+// already used by an earlier ReceiveMessage call on the queue. A retry should
+// return the same messages as the first attempt, so any other message is
+// flagged as an anomaly. Callers must hold the lock.
+func (s *Store) checkReceiveAttempt(event *Message) {
+	if event.ReceiveRequestAttemptID == "" {
+		return
+	}
+
+	key := attemptKey{event.QueueName, event.ReceiveRequestAttemptID}
+	attempt, ok := s.receiveAttempts[key]
+	if !ok {
+		attempt = &receiveAttempt{traceID: event.TraceID, messageIDs: make(map[string]bool)}
+		s.receiveAttempts[key] = attempt
+	}
+	if attempt.traceID == event.TraceID {
+		// Another message of the first attempt's response
+		attempt.messageIDs[event.MessageID] = true
+		return
+	}
+
+	event.AttemptReused = true
+	if !attempt.messageIDs[event.MessageID] {
+		s.addAnomaly(AnomalyAttemptMismatch, event.QueueName, fmt.Sprintf(
+			"retry with ReceiveRequestAttemptId %s returned message %s, which the first attempt did not",
+			event.ReceiveRequestAttemptID, event.MessageID))
+	}
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultSizeThreshold is the body size above which sends are counted
+	// as large in size stats, well ahead of the 256 KiB SQS limit.
+	DefaultSizeThreshold = 200 * 1024
+
+	// sizeWindowSize is how many recent body sizes per queue the
+	// percentiles of size stats are taken over.
+	sizeWindowSize = 1000
+)
+
+// bodySizes are the running body size totals of a queue's sends since the
+// last clear.
+type bodySizes struct {
+	count int
+	total int
+	min   int
+	max   int
+	over  int // sends above the size threshold
+
+	recent []int // ring of at most sizeWindowSize sizes
+	next   int
+}
+
+// SizeStats summarises the body sizes sent to a queue since the last clear.
+// P95Bytes is taken over the most recent sends only.
+type SizeStats struct {
+	QueueName     string `json:"queueName"`
+	Sends         int    `json:"sends"`
+	TotalBytes    int    `json:"totalBytes"`
+	MinBytes      int    `json:"minBytes"`
+	MaxBytes      int    `json:"maxBytes"`
+	AvgBytes      int    `json:"avgBytes"`
+	P95Bytes      int    `json:"p95Bytes"`
+	OverThreshold int    `json:"overThreshold"` // sends above Threshold
+	Threshold     int    `json:"threshold"`
+}
+
+// BodySizeBucket is the average and largest body size of the sends in one
+// bucket of a body size trend; both are zero for a bucket without sends.
+type BodySizeBucket struct {
+	Sends    int `json:"sends"`
+	AvgBytes int `json:"avgBytes"`
+	MaxBytes int `json:"maxBytes"`
+}
+
+// sentBodySize returns the size of a send event's full body, which a sampled
+// event no longer holds.
+func sentBodySize(event *Message) int {
+	if event.BodySampled {
+		return event.BodySize
+	}
+	return len(event.Body)
+}
+
+// countBodySize adds a sent body of size bytes to queueName's totals.
+// Callers must hold the write lock.
+func (s *Store) countBodySize(queueName string, size int) {
+	b, ok := s.bodySizes[queueName]
+	if !ok {
+		b = &bodySizes{}
+		s.bodySizes[queueName] = b
+	}
+	if b.count == 0 || size < b.min {
+		b.min = size
+	}
+	b.count++
+	b.total += size
+	b.max = max(b.max, size)
+	if s.sizeThreshold > 0 && size > s.sizeThreshold {
+		b.over++
+	}
+
+	if len(b.recent) < sizeWindowSize {
+		b.recent = append(b.recent, size)
+	} else {
+		b.recent[b.next] = size
+		b.next = (b.next + 1) % sizeWindowSize
+	}
+}
+
+// SetSizeThreshold sets the body size above which sends are counted in
+// SizeStats.OverThreshold. Zero disables the count.
+func (s *Store) SetSizeThreshold(bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sizeThreshold = bytes
+}
+
+// GetSizeStats returns the body size stats of each queue sent to since the
+// last clear, ordered by queue name.
+func (s *Store) GetSizeStats() []SizeStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]SizeStats, 0, len(s.bodySizes))
+	for queueName, b := range s.bodySizes {
+		if b.count == 0 {
+			continue
+		}
+		result = append(result, SizeStats{
+			QueueName:     queueName,
+			Sends:         b.count,
+			TotalBytes:    b.total,
+			MinBytes:      b.min,
+			MaxBytes:      b.max,
+			AvgBytes:      b.total / b.count,
+			P95Bytes:      percentile(b.recent, 0.95),
+			OverThreshold: b.over,
+			Threshold:     s.sizeThreshold,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].QueueName < result[j].QueueName
+	})
+	return result
+}
+
+// percentile returns the nearest-rank percentile p (0 < p <= 1) of sizes,
+// or 0 if there are none.
+func percentile(sizes []int, p float64) int {
+	if len(sizes) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), sizes...)
+	sort.Ints(sorted)
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// applyBodySizes sets the body size fields of stats. Callers must hold the
+// lock.
+func (s *Store) applyBodySizes(stats *QueueStats) {
+	b, ok := s.bodySizes[stats.QueueName]
+	if !ok || b.count == 0 {
+		return
+	}
+	stats.AvgBodyBytes = b.total / b.count
+	stats.MaxBodyBytes = b.max
+}
+
+// BodySizeTrend returns the average and largest body sent per bucket over
+// the trailing window, oldest bucket first, like Sparkline. An empty
+// queueName covers all queues.
+func (s *Store) BodySizeTrend(queueName string, window time.Duration, buckets int) []BodySizeBucket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	trend := make([]BodySizeBucket, max(buckets, 0))
+	if buckets <= 0 || window <= 0 {
+		return trend
+	}
+
+	end := s.now()
+	start := end.Add(-window)
+	width := max(window/time.Duration(buckets), 1)
+
+	totals := make([]int, buckets)
+	for i := s.history.len() - 1; i >= 0; i-- {
+		event := s.history.at(i)
+		if event.Timestamp.Before(start) {
+			break
+		}
+		if event.Action != ActionSend || queueName != "" && event.QueueName != queueName {
+			continue
+		}
+		idx := min(int(event.Timestamp.Sub(start)/width), buckets-1)
+		size := sentBodySize(event)
+		trend[idx].Sends++
+		trend[idx].MaxBytes = max(trend[idx].MaxBytes, size)
+		totals[idx] += size
+	}
+	for i := range trend {
+		if trend[i].Sends > 0 {
+			trend[i].AvgBytes = totals[i] / trend[i].Sends
+		}
+	}
+	return trend
+}
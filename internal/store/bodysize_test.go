@@ -0,0 +1,189 @@
+package store
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queueStats returns the stats of queueName.
+func queueStats(t *testing.T, s *Store, queueName string) QueueStats {
+	t.Helper()
+	for _, qs := range s.GetQueueStats() {
+		if qs.QueueName == queueName {
+			return qs
+		}
+	}
+	t.Fatalf("no stats for %s", queueName)
+	return QueueStats{}
+}
+
+func TestBodySizeStatsGrow(t *testing.T) {
+	s := New()
+	sizes := []int{10, 20, 30, 100}
+	wantAvg := []int{10, 15, 20, 40}
+	for i, size := range sizes {
+		s.RecordSend(Meta{}, "", "orders", "m-"+strconv.Itoa(i), strings.Repeat("x", size), nil, nil)
+		qs := queueStats(t, s, "orders")
+		if qs.AvgBodyBytes != wantAvg[i] || qs.MaxBodyBytes != size {
+			t.Errorf("after a %d byte send: avg %d, max %d; want %d, %d", size, qs.AvgBodyBytes, qs.MaxBodyBytes, wantAvg[i], size)
+		}
+	}
+
+	// A smaller send lowers the average but not the max
+	s.RecordSend(Meta{}, "", "orders", "m-small", "", nil, nil)
+	if qs := queueStats(t, s, "orders"); qs.AvgBodyBytes != 32 || qs.MaxBodyBytes != 100 {
+		t.Errorf("after an empty send: avg %d, max %d; want 32, 100", qs.AvgBodyBytes, qs.MaxBodyBytes)
+	}
+
+	s.Clear()
+	s.RecordSend(Meta{}, "", "orders", "m-after", "abc", nil, nil)
+	if qs := queueStats(t, s, "orders"); qs.AvgBodyBytes != 3 || qs.MaxBodyBytes != 3 {
+		t.Errorf("after Clear: avg %d, max %d; want 3, 3", qs.AvgBodyBytes, qs.MaxBodyBytes)
+	}
+}
+
+func TestBodySizeTrend(t *testing.T) {
+	s := New()
+	clock := newFakeClock()
+	s.SetClock(clock)
+
+	// Two sends in the first 30s bucket, one in the second, on two queues
+	s.RecordSend(Meta{}, "", "orders", "m-1", strings.Repeat("x", 10), nil, nil)
+	s.RecordSend(Meta{}, "", "orders", "m-2", strings.Repeat("x", 30), nil, nil)
+	clock.Advance(40 * time.Second)
+	s.RecordSend(Meta{}, "", "billing", "m-3", strings.Repeat("x", 200), nil, nil)
+	s.RecordReceive(Meta{}, "", "billing", "m-3", "r-3", strings.Repeat("x", 200), nil, nil)
+	clock.Advance(10 * time.Second)
+
+	tests := []struct {
+		name  string
+		queue string
+		want  []BodySizeBucket
+	}{
+		{"all queues", "", []BodySizeBucket{{Sends: 2, AvgBytes: 20, MaxBytes: 30}, {Sends: 1, AvgBytes: 200, MaxBytes: 200}}},
+		{"one queue", "orders", []BodySizeBucket{{Sends: 2, AvgBytes: 20, MaxBytes: 30}, {}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.BodySizeTrend(tt.queue, time.Minute, 2); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("trend = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if got := s.BodySizeTrend("", time.Minute, 0); len(got) != 0 {
+		t.Errorf("trend with no buckets = %+v", got)
+	}
+}
+
+func TestSizeStatsPercentiles(t *testing.T) {
+	s := New()
+	s.SetSizeThreshold(90)
+
+	// Bodies of 1 to 100 bytes, in shuffled order, and one of 0 elsewhere
+	for i := 0; i < 100; i++ {
+		size := (i*37)%100 + 1
+		s.RecordSend(Meta{}, "", "orders", "m-"+strconv.Itoa(i), strings.Repeat("x", size), nil, nil)
+	}
+	s.RecordSend(Meta{}, "", "billing", "b-1", "", nil, nil)
+
+	want := []SizeStats{
+		{QueueName: "billing", Sends: 1, Threshold: 90},
+		{QueueName: "orders", Sends: 100, TotalBytes: 5050, MinBytes: 1, MaxBytes: 100, AvgBytes: 50, P95Bytes: 95, OverThreshold: 10, Threshold: 90},
+	}
+	if got := s.GetSizeStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("size stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sizes []int
+		p     float64
+		want  int
+	}{
+		{nil, 0.95, 0},
+		{[]int{7}, 0.95, 7},
+		{[]int{5, 1, 4, 2, 3}, 0.5, 3},
+		{[]int{5, 1, 4, 2, 3}, 0.95, 5},
+		{[]int{5, 1, 4, 2, 3}, 0.01, 1},
+		{[]int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120, 130, 140, 150, 160, 170, 180, 190, 200}, 0.95, 190},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sizes, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %d, want %d", tt.sizes, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestOversizedAgainstQueueLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		attrs   map[string]string
+		size    int
+		flagged bool
+	}{
+		{"within the queue limit", map[string]string{"MaximumMessageSize": "1024"}, 1024, false},
+		{"over the queue limit", map[string]string{"MaximumMessageSize": "1024"}, 2048, true},
+		{"no queue limit", nil, 2048, false},
+		{"over the SQS limit", nil, MaxMessageSize + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			if tt.attrs != nil {
+				s.RecordQueueAttributes("orders", tt.attrs)
+			}
+			s.RecordSend(Meta{}, "", "orders", "m-1", strings.Repeat("x", tt.size), nil, nil)
+			s.RecordSend(Meta{}, "", "other", "m-2", strings.Repeat("x", 2048), nil, nil)
+
+			var flagged []Anomaly
+			for _, a := range s.GetAnomalies() {
+				if a.Kind == AnomalyOversized {
+					flagged = append(flagged, a)
+				}
+			}
+			if !tt.flagged {
+				if len(flagged) != 0 {
+					t.Errorf("anomalies = %+v, want none", flagged)
+				}
+				return
+			}
+			if len(flagged) != 1 || flagged[0].QueueName != "orders" || !strings.Contains(flagged[0].Detail, strconv.Itoa(tt.size)+" bytes") {
+				t.Errorf("anomalies = %+v, want one for the %d byte send to orders", flagged, tt.size)
+			}
+		})
+	}
+}
+
+func TestBodySamplingBySize(t *testing.T) {
+	s := New()
+	s.SetBodySampling(100, 10)
+	small := strings.Repeat("s", 100)
+	large := strings.Repeat("0123456789", 50)
+	s.RecordSend(Meta{}, "", "orders", "m-small", small, nil, nil)
+	s.RecordSend(Meta{}, "", "orders", "m-large", large, nil, nil)
+	s.RecordReceive(Meta{}, "", "orders", "m-large", "r-large", large, nil, nil)
+
+	msg, _ := s.GetMessage("m-small")
+	if msg.Body != small || msg.BodySampled || msg.BodySize != 0 || msg.BodyMD5 != "" {
+		t.Errorf("small message = %q sampled %v size %d md5 %q; want the full body unsampled", msg.Body, msg.BodySampled, msg.BodySize, msg.BodyMD5)
+	}
+
+	const largeMD5 = "a65d3aa5a434f44ec9cdb75c16978033"
+	for _, event := range s.GetMessageEvents("m-large") {
+		if event.Body != "0123456789" || !event.BodySampled || event.BodySize != 500 || event.BodyMD5 != largeMD5 {
+			t.Errorf("large %s = %q sampled %v size %d md5 %q; want a 10 byte preview of 500 bytes", event.Action, event.Body, event.BodySampled, event.BodySize, event.BodyMD5)
+		}
+	}
+	if msg, _ := s.GetMessage("m-large"); msg.Body != "0123456789" || !msg.BodySampled {
+		t.Errorf("large message = %q sampled %v; want the preview only", msg.Body, msg.BodySampled)
+	}
+
+	// Size stats still see the full body
+	if qs := queueStats(t, s, "orders"); qs.MaxBodyBytes != 500 {
+		t.Errorf("max body = %d, want 500", qs.MaxBodyBytes)
+	}
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"aws-relay/internal/jsonguard"
+)
+
+// SetCanonicalJSON enables storing a canonical copy of JSON bodies alongside
+// the raw body, so semantically identical payloads compare equal.
+func (s *Store) SetCanonicalJSON(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.canonicalJSON = enabled
+}
+
+// ComparableBody returns the body to use when comparing or grouping
+// messages: the canonical form when one was stored, otherwise the raw body.
+func (m *Message) ComparableBody() string {
+	if m.CanonicalBody != "" {
+		return m.CanonicalBody
+	}
+	return m.Body
+}
+
+// canonicalBody returns body re-encoded with sorted object keys and no
+// insignificant whitespace, or "" if canonicalisation is disabled or body is
+// not a JSON object or array. Callers must hold the lock.
+func (s *Store) canonicalBody(body string) string {
+	if !s.canonicalJSON {
+		return ""
+	}
+	return CanonicalizeJSON(body)
+}
+
+// CanonicalizeJSON returns the canonical form of a JSON object or array, or
+// "" if body is not one. Numbers keep their original text.
+func CanonicalizeJSON(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return ""
+	}
+	if jsonguard.Check([]byte(trimmed), jsonguard.DefaultMaxDepth, jsonguard.DefaultMaxBytes) != nil {
+		return ""
+	}
+
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return ""
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return ""
+	}
+
+	// encoding/json sorts map keys, which is all canonicalisation needs
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
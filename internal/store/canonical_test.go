@@ -0,0 +1,57 @@
+package store
+
+import "testing"
+
+func TestCanonicalizeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"sorted keys", `{"b":1,"a":{"d":2,"c":3}}`, `{"a":{"c":3,"d":2},"b":1}`},
+		{"whitespace", " {\n  \"a\" : [ 1, 2 ]\n} ", `{"a":[1,2]}`},
+		{"numbers keep their text", `{"n":1.50,"big":12345678901234567890}`, `{"big":12345678901234567890,"n":1.50}`},
+		{"HTML left unescaped", `{"h":"<b>&</b>"}`, `{"h":"<b>&</b>"}`},
+		{"array", `[{"b":1,"a":2}]`, `[{"a":2,"b":1}]`},
+		{"scalar", `"text"`, ""},
+		{"not JSON", `hello`, ""},
+		{"trailing data", `{"a":1} {"b":2}`, ""},
+		{"too deep", nestedArrays(100), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanonicalizeJSON(tt.body); got != tt.want {
+				t.Errorf("CanonicalizeJSON = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func nestedArrays(depth int) string {
+	b := make([]byte, 0, 2*depth)
+	for i := 0; i < depth; i++ {
+		b = append(b, '[')
+	}
+	for i := 0; i < depth; i++ {
+		b = append(b, ']')
+	}
+	return string(b)
+}
+
+func TestReorderedBodiesCompareEqual(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		s := New()
+		s.SetCanonicalJSON(enabled)
+		s.RecordSend(Meta{}, "", "orders", "m-1", `{"order":"o-1","items":[1,2],"total":3}`, nil, nil)
+		s.RecordSend(Meta{}, "", "orders", "m-2", `{ "total": 3, "items": [1, 2], "order": "o-1" }`, nil, nil)
+
+		first, _ := s.GetMessage("m-1")
+		second, _ := s.GetMessage("m-2")
+		if equal := first.ComparableBody() == second.ComparableBody(); equal != enabled {
+			t.Errorf("canonical JSON %v: bodies compare equal = %v", enabled, equal)
+		}
+		if second.Body != `{ "total": 3, "items": [1, 2], "order": "o-1" }` {
+			t.Errorf("canonical JSON %v: raw body = %q, want it kept", enabled, second.Body)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// attributeCasingAnomalies computes, per queue, the message attribute keys
+// that differ only by case (e.g. orderId vs OrderId). They are derived from
+// stored messages on demand rather than recorded, since a conflict only
+// exists once both variants have been seen. Callers must hold the lock.
+func (s *Store) attributeCasingAnomalies() []Anomaly {
+	type variants struct {
+		counts map[string]int
+		latest time.Time
+	}
+	byQueue := make(map[string]map[string]*variants) // queue -> lowercased key -> variants
+
+	for _, msg := range s.messages {
+		for key := range msg.Attributes {
+			keys := byQueue[msg.QueueName]
+			if keys == nil {
+				keys = make(map[string]*variants)
+				byQueue[msg.QueueName] = keys
+			}
+			lower := strings.ToLower(key)
+			v := keys[lower]
+			if v == nil {
+				v = &variants{counts: make(map[string]int)}
+				keys[lower] = v
+			}
+			v.counts[key]++
+			if msg.Timestamp.After(v.latest) {
+				v.latest = msg.Timestamp
+			}
+		}
+	}
+
+	var result []Anomaly
+	for queueName, keys := range byQueue {
+		for lower, v := range keys {
+			if len(v.counts) < 2 {
+				continue
+			}
+			names := make([]string, 0, len(v.counts))
+			for name := range v.counts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			parts := make([]string, len(names))
+			for i, name := range names {
+				parts[i] = fmt.Sprintf("%s (%d)", name, v.counts[name])
+			}
+			result = append(result, Anomaly{
+				ID:        "attribute-casing:" + queueName + ":" + lower,
+				Kind:      AnomalyAttributeCasing,
+				QueueName: queueName,
+				Detail:    "attribute keys differ only by case: " + strings.Join(parts, ", "),
+				Timestamp: v.latest,
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.After(result[j].Timestamp)
+	})
+	return result
+}
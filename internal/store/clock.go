@@ -0,0 +1,71 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+// Clock is the store's source of time, replaceable so that time-dependent
+// behaviour such as auto-clear and stuck detection can be tested.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SetClock replaces the store's clock. It should be called before the store
+// is in use.
+func (s *Store) SetClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clock = c
+	s.clearedAt = c.Now()
+}
+
+func (s *Store) now() time.Time {
+	return s.clock.Now()
+}
+
+// StartAutoClear clears the store every interval, measured on the store's
+// clock from the last clear (automatic or manual). It returns a function
+// that stops the background checker.
+func (s *Store) StartAutoClear(interval time.Duration) (stop func()) {
+	checkEvery := interval
+	if checkEvery > time.Second {
+		checkEvery = time.Second
+	}
+
+	ticker := time.NewTicker(checkEvery)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if s.clearIfDue(interval) {
+					log.Printf("Auto-cleared captures (interval %s)", interval)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// clearIfDue clears the store if interval has elapsed since the last clear.
+func (s *Store) clearIfDue(interval time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.now().Sub(s.clearedAt) < interval {
+		return false
+	}
+	s.clear()
+	return true
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestAutoClearFollowsClock(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+
+	s.RecordSend(Meta{}, "", "orders", "m-1", "hi", nil, nil)
+	if history := s.GetHistory(0); len(history) != 1 || !history[0].Timestamp.Equal(clock.Now()) {
+		t.Fatalf("history = %+v, want one event stamped %v", history, clock.Now())
+	}
+
+	clock.Advance(59 * time.Second)
+	if s.clearIfDue(time.Minute) {
+		t.Fatal("cleared before the interval elapsed")
+	}
+
+	// A manual clear restarts the interval
+	s.Clear()
+	s.RecordSend(Meta{}, "", "orders", "m-2", "hi", nil, nil)
+	clock.Advance(59 * time.Second)
+	if s.clearIfDue(time.Minute) {
+		t.Fatal("cleared less than an interval after a manual clear")
+	}
+	clock.Advance(time.Second)
+	if !s.clearIfDue(time.Minute) {
+		t.Fatal("not cleared once the interval elapsed")
+	}
+	if n := s.HistoryLen(); n != 0 {
+		t.Errorf("history has %d events after auto-clear", n)
+	}
+}
+
+func TestStartAutoClear(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+	stop := s.StartAutoClear(10 * time.Millisecond)
+	defer stop()
+
+	// The checker ticks in real time but only clears once the store's clock
+	// says the interval is up
+	s.RecordSend(Meta{}, "", "orders", "m-1", "hi", nil, nil)
+	time.Sleep(50 * time.Millisecond)
+	if n := s.HistoryLen(); n != 1 {
+		t.Fatalf("history has %d events before the clock moved, want 1", n)
+	}
+
+	clock.Advance(10 * time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.HistoryLen() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("store not auto-cleared")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
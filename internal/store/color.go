@@ -0,0 +1,14 @@
+package store
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// QueueColor returns a stable CSS colour for queueName, derived from a hash
+// of the name so it does not depend on which other queues exist.
+func QueueColor(queueName string) string {
+	h := fnv.New32a()
+	h.Write([]byte(queueName))
+	return fmt.Sprintf("hsl(%d, 65%%, 60%%)", h.Sum32()%360)
+}
@@ -0,0 +1,70 @@
+package store
+
+// DefaultCorrelationAttribute is the message attribute used to recognise
+// re-sends of the same logical message.
+const DefaultCorrelationAttribute = "correlationId"
+
+// SetCorrelationAttribute sets the message attribute whose value identifies
+// re-sends of the same logical message.
+func (s *Store) SetCorrelationAttribute(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.correlationAttr = name
+}
+
+// GetMessage returns the stored message with the given SQS message ID.
+func (s *Store) GetMessage(messageID string) (*Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msg, ok := s.messages[messageID]
+	return msg, ok
+}
+
+// GetMessageEvents returns every history event of messageID, oldest first.
+func (s *Store) GetMessageEvents(messageID string) []*Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []*Message{}
+	for i := 0; i < s.history.len(); i++ {
+		if event := s.history.at(i); event.MessageID == messageID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// PreviousSend returns the most recent send recorded before messageID that
+// carries the same correlation attribute value.
+func (s *Store) PreviousSend(messageID string) (*Message, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msg, ok := s.messages[messageID]
+	if !ok || s.correlationAttr == "" {
+		return nil, false
+	}
+	correlationID, ok := msg.Attributes[s.correlationAttr]
+	if !ok {
+		return nil, false
+	}
+
+	// Find the message's own send, then keep walking back for an earlier one
+	found := false
+	for i := s.history.len() - 1; i >= 0; i-- {
+		event := s.history.at(i)
+		if event.Action != ActionSend {
+			continue
+		}
+		if !found {
+			found = event.MessageID == messageID
+			continue
+		}
+		if event.Attributes[s.correlationAttr] == correlationID {
+			return event, true
+		}
+	}
+	return nil, false
+}
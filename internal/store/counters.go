@@ -0,0 +1,75 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// Counter is a cumulative count of events of one action on one queue since
+// the process started. Unlike the dashboard stats, counters survive Clear,
+// retention and history eviction, as Prometheus rate() requires.
+type Counter struct {
+	QueueName string
+	Action    MessageAction
+	Value     uint64
+}
+
+// countEvent adds event to the cumulative counters. Callers must hold the
+// write lock.
+func (s *Store) countEvent(event *Message) {
+	if event.QueueName == "" {
+		return // markers and SNS publishes belong to no queue
+	}
+	if event.Action == ActionRemoved {
+		return // relay housekeeping, not SQS traffic
+	}
+	key := counterKey{event.QueueName, event.Action}
+	s.counters[key]++
+}
+
+type counterKey struct {
+	queueName string
+	action    MessageAction
+}
+
+// GetCounters returns the cumulative event counters, ordered by queue and
+// action.
+func (s *Store) GetCounters() []Counter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Counter, 0, len(s.counters))
+	for key, value := range s.counters {
+		result = append(result, Counter{key.queueName, key.action, value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].QueueName != result[j].QueueName {
+			return result[i].QueueName < result[j].QueueName
+		}
+		return result[i].Action < result[j].Action
+	})
+	return result
+}
+
+// GetPendingCounts returns the number of captured, undeleted messages of
+// each queue GetQueueStats lists. It reads the same running totals, so it
+// stays cheap to call on every metrics scrape.
+func (s *Store) GetPendingCounts() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending := make(map[string]int, len(s.queueCounts))
+	for queueName, c := range s.queueCounts {
+		pending[queueName] = c.pending
+	}
+	return pending
+}
+
+// LastActivity returns when the newest event was captured, or the zero time
+// if none has been since the relay started. Timeline markers don't count.
+func (s *Store) LastActivity() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lastActivity
+}
@@ -0,0 +1,63 @@
+package store
+
+import "testing"
+
+func TestPendingCountsMatchQueueStats(t *testing.T) {
+	s := New()
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	for _, id := range []string{"m-1", "m-2", "m-3"} {
+		s.RecordSend(Meta{}, ordersURL, "orders", id, "body of "+id, nil, nil)
+	}
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-1", "r-1", "body of m-1", nil, nil)
+	s.RecordDelete(Meta{}, ordersURL, "orders", "r-1")
+	s.DeleteMessage("m-2")
+	s.RecordSend(Meta{}, "", "audit", "a-1", "audit", nil, nil)
+	s.RecordReceive(Meta{}, "", "audit", "a-1", "r-a1", "audit", nil, nil)
+	s.RecordDelete(Meta{}, "", "audit", "r-a1")
+
+	pending := s.GetPendingCounts()
+	stats := s.GetQueueStats()
+	if len(pending) != len(stats) {
+		t.Errorf("pending counts for %d queues, stats for %d", len(pending), len(stats))
+	}
+	for _, qs := range stats {
+		if got, ok := pending[qs.QueueName]; !ok || got != qs.Pending {
+			t.Errorf("%s pending = %d (listed %v), stats say %d", qs.QueueName, got, ok, qs.Pending)
+		}
+	}
+	if pending["orders"] != 1 || pending["audit"] != 0 {
+		t.Errorf("pending = %v, want orders 1 and audit 0", pending)
+	}
+}
+
+func TestClearKeepsCounters(t *testing.T) {
+	s := New()
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	s.RecordSend(Meta{}, ordersURL, "orders", "m-1", "one", nil, nil)
+	s.RecordSend(Meta{}, ordersURL, "orders", "m-2", "two", nil, nil)
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-1", "r-1", "one", nil, nil)
+	s.RecordDelete(Meta{}, ordersURL, "orders", "r-1")
+	before := s.GetCounters()
+
+	s.Clear()
+	if stats := s.GetQueueStats(); len(stats) != 0 {
+		t.Errorf("stats after Clear = %+v, want none", stats)
+	}
+	after := s.GetCounters()
+	if len(after) != len(before) {
+		t.Fatalf("counters after Clear = %+v, want %+v", after, before)
+	}
+	for i := range before {
+		if after[i] != before[i] {
+			t.Errorf("counter after Clear = %+v, want %+v", after[i], before[i])
+		}
+	}
+
+	// New traffic counts on from where the counters were
+	s.RecordSend(Meta{}, ordersURL, "orders", "m-3", "three", nil, nil)
+	for _, c := range s.GetCounters() {
+		if c.QueueName == "orders" && c.Action == ActionSend && c.Value != 3 {
+			t.Errorf("sends after Clear = %d, want 3", c.Value)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+// DeletableMessage is a captured message that has not been deleted and whose
+// most recent receipt handle is known, so it can be deleted upstream.
+type DeletableMessage struct {
+	MessageID     string
+	QueueURL      string
+	QueueName     string
+	ReceiptHandle string
+}
+
+// GetDeletable returns the undeleted messages of queueName that have a known
+// receipt handle, using the handle from their latest receive.
+func (s *Store) GetDeletable(queueName string) []DeletableMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := make(map[string]string)
+	for i := 0; i < s.history.len(); i++ {
+		event := s.history.at(i)
+		if event.Action == ActionReceive && event.QueueName == queueName && event.ReceiptHandle != "" {
+			latest[event.MessageID] = event.ReceiptHandle
+		}
+	}
+
+	var result []DeletableMessage
+	for messageID, handle := range latest {
+		msg, ok := s.messages[messageID]
+		if !ok || msg.Deleted {
+			continue
+		}
+		result = append(result, DeletableMessage{
+			MessageID:     messageID,
+			QueueURL:      msg.QueueURL,
+			QueueName:     queueName,
+			ReceiptHandle: handle,
+		})
+	}
+	return result
+}
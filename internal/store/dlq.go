@@ -0,0 +1,110 @@
+package store
+
+import "sort"
+
+// DLQEdge links a source queue to the dead-letter queue its redrive policy
+// points at.
+type DLQEdge struct {
+	Source          string   `json:"source"`
+	DeadLetterQueue string   `json:"deadLetterQueue"`
+	MaxReceiveCount int      `json:"maxReceiveCount,omitempty"`
+	Via             []string `json:"via"`
+}
+
+// DLQGraph is the set of queues involved in redrive relationships and the
+// edges between them.
+type DLQGraph struct {
+	Nodes []string  `json:"nodes"`
+	Edges []DLQEdge `json:"edges"`
+}
+
+const (
+	viaRedrivePolicy    = "redrivePolicy"
+	viaListSourceQueues = "listDeadLetterSourceQueues"
+)
+
+// RecordRedrivePolicy records that sourceQueue redrives into deadLetterQueue
+// after maxReceiveCount receives, as declared by its RedrivePolicy attribute.
+func (s *Store) RecordRedrivePolicy(sourceQueue, deadLetterQueue string, maxReceiveCount int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	edge := s.dlqEdge(sourceQueue, deadLetterQueue)
+	edge.MaxReceiveCount = maxReceiveCount
+	edge.addVia(viaRedrivePolicy)
+}
+
+// RecordDeadLetterSources records the queues a ListDeadLetterSourceQueues
+// call reported as using deadLetterQueue as their DLQ.
+func (s *Store) RecordDeadLetterSources(deadLetterQueue string, sourceQueues []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, source := range sourceQueues {
+		s.dlqEdge(source, deadLetterQueue).addVia(viaListSourceQueues)
+	}
+}
+
+// GetDeadLetterSources returns the queues known to redrive into
+// deadLetterQueue.
+func (s *Store) GetDeadLetterSources(deadLetterQueue string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sources []string
+	for source, edge := range s.dlqEdges {
+		if edge.DeadLetterQueue == deadLetterQueue {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+func (s *Store) GetDLQGraph() DLQGraph {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	graph := DLQGraph{
+		Nodes: []string{},
+		Edges: []DLQEdge{},
+	}
+	seen := make(map[string]bool)
+	for _, edge := range s.dlqEdges {
+		for _, name := range []string{edge.Source, edge.DeadLetterQueue} {
+			if !seen[name] {
+				seen[name] = true
+				graph.Nodes = append(graph.Nodes, name)
+			}
+		}
+		e := *edge
+		e.Via = append([]string(nil), edge.Via...)
+		graph.Edges = append(graph.Edges, e)
+	}
+
+	sort.Strings(graph.Nodes)
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		return graph.Edges[i].Source < graph.Edges[j].Source
+	})
+	return graph
+}
+
+// dlqEdge returns the edge for sourceQueue, replacing it if the source now
+// points at a different DLQ. Callers must hold the write lock.
+func (s *Store) dlqEdge(sourceQueue, deadLetterQueue string) *DLQEdge {
+	edge, ok := s.dlqEdges[sourceQueue]
+	if !ok || edge.DeadLetterQueue != deadLetterQueue {
+		edge = &DLQEdge{Source: sourceQueue, DeadLetterQueue: deadLetterQueue}
+		s.dlqEdges[sourceQueue] = edge
+	}
+	return edge
+}
+
+func (e *DLQEdge) addVia(via string) {
+	for _, v := range e.Via {
+		if v == via {
+			return
+		}
+	}
+	e.Via = append(e.Via, via)
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeadLetterSources(t *testing.T) {
+	s := New()
+	s.RecordRedrivePolicy("orders", "orders-dlq", 5)
+	s.RecordDeadLetterSources("orders-dlq", []string{"orders", "billing"})
+	s.RecordDeadLetterSources("other-dlq", []string{"audit"})
+
+	if got, want := s.GetDeadLetterSources("orders-dlq"), []string{"billing", "orders"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sources of orders-dlq = %v, want %v", got, want)
+	}
+	if got := s.GetDeadLetterSources("unknown-dlq"); len(got) != 0 {
+		t.Errorf("sources of unknown-dlq = %v, want none", got)
+	}
+
+	graph := s.GetDLQGraph()
+	if want := []string{"audit", "billing", "orders", "orders-dlq", "other-dlq"}; !reflect.DeepEqual(graph.Nodes, want) {
+		t.Errorf("nodes = %v, want %v", graph.Nodes, want)
+	}
+	for _, edge := range graph.Edges {
+		if edge.Source != "orders" {
+			continue
+		}
+		// Seen both ways, the edge keeps the policy's receive count
+		if edge.MaxReceiveCount != 5 || !reflect.DeepEqual(edge.Via, []string{viaRedrivePolicy, viaListSourceQueues}) {
+			t.Errorf("orders edge = %+v", edge)
+		}
+	}
+}
+
+func TestRedrivePolicyChangeReplacesEdge(t *testing.T) {
+	s := New()
+	s.RecordRedrivePolicy("orders", "orders-dlq", 5)
+	s.RecordRedrivePolicy("orders", "orders-dlq-2", 3)
+
+	if got := s.GetDeadLetterSources("orders-dlq"); len(got) != 0 {
+		t.Errorf("old DLQ still has sources %v", got)
+	}
+	if got, want := s.GetDeadLetterSources("orders-dlq-2"), []string{"orders"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sources of orders-dlq-2 = %v, want %v", got, want)
+	}
+}
+
+func TestTopologyChainsTopicQueueAndDLQ(t *testing.T) {
+	const topicArn = "arn:aws:sns:us-east-1:000000000000:order-events"
+	s := New()
+	s.RecordPublish(Meta{}, topicArn, "sns-1", "placed", nil)
+	s.RecordReceive(Meta{}, "", "orders", "m-1", "r-1",
+		`{"Type":"Notification","MessageId":"sns-1","TopicArn":"`+topicArn+`","Message":"placed"}`, nil, nil)
+	s.RecordRedrivePolicy("orders", "orders-dlq", 5)
+	s.RecordSend(Meta{}, "", "audit", "m-2", "unrelated", nil, nil)
+
+	want := Topology{
+		Nodes: []TopologyNode{
+			{ID: "queue:audit", Kind: NodeQueue, Name: "audit"},
+			{ID: "queue:orders", Kind: NodeQueue, Name: "orders"},
+			{ID: "queue:orders-dlq", Kind: NodeQueue, Name: "orders-dlq", DeadLetter: true},
+			{ID: "topic:order-events", Kind: NodeTopic, Name: "order-events"},
+		},
+		Edges: []TopologyEdge{
+			{From: "queue:orders", To: "queue:orders-dlq", Kind: EdgeRedrive, MaxReceiveCount: 5},
+			{From: "topic:order-events", To: "queue:orders", Kind: EdgeSubscription},
+		},
+	}
+	if got := s.GetTopology(); !reflect.DeepEqual(got, want) {
+		t.Errorf("topology = %+v\nwant %+v", got, want)
+	}
+}
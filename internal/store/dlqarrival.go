@@ -0,0 +1,189 @@
+package store
+
+import (
+	"path"
+	"sort"
+	"time"
+)
+
+// DefaultDLQPatterns are the queue names, as path.Match globs, treated as
+// dead-letter queues besides those named by a redrive edge.
+var DefaultDLQPatterns = []string{"*-dlq", "*-dead-letter", "*-dlq.fifo", "*-dead-letter.fifo"}
+
+// How a DLQ arrival was linked to its original message.
+const (
+	MatchedByMessageID = "messageId"
+	MatchedByBody      = "body"
+)
+
+// DLQArrival is a message first seen in a dead-letter queue, linked to the
+// message it was most likely moved from. SQS keeps the message ID when it
+// redrives a message; otherwise the original is the most recent message of
+// another queue with the same body and attributes, preferring queues known
+// to redrive into the DLQ. MatchedBy is empty if no original was found.
+type DLQArrival struct {
+	MessageID         string    `json:"messageId"`
+	DeadLetterQueue   string    `json:"deadLetterQueue"`
+	OriginalMessageID string    `json:"originalMessageId,omitempty"`
+	SourceQueue       string    `json:"sourceQueue,omitempty"`
+	SourceReceives    int       `json:"sourceReceives,omitempty"` // receives of the original before the move
+	MatchedBy         string    `json:"matchedBy,omitempty"`
+	ArrivedAt         time.Time `json:"arrivedAt"`
+}
+
+// SetDLQPatterns sets the queue names, exactly or as path.Match globs,
+// treated as dead-letter queues.
+func (s *Store) SetDLQPatterns(patterns []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dlqPatterns = patterns
+}
+
+// GetDLQArrivals returns the DLQ arrivals of the stored messages, newest
+// first.
+func (s *Store) GetDLQArrivals() []DLQArrival {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	arrivals := []DLQArrival{}
+	for _, msg := range s.messages {
+		if msg.DeadLetter != nil {
+			arrivals = append(arrivals, *msg.DeadLetter)
+		}
+	}
+	sort.Slice(arrivals, func(i, j int) bool {
+		return arrivals[i].ArrivedAt.After(arrivals[j].ArrivedAt)
+	})
+	return arrivals
+}
+
+// isDLQ reports whether queueName is the target of a redrive edge or
+// matches a DLQ pattern. Callers must hold the lock.
+func (s *Store) isDLQ(queueName string) bool {
+	for _, edge := range s.dlqEdges {
+		if edge.DeadLetterQueue == queueName {
+			return true
+		}
+	}
+	for _, pattern := range s.dlqPatterns {
+		if pattern == queueName {
+			return true
+		}
+		if ok, _ := path.Match(pattern, queueName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dlqArrival returns the DLQ arrival event marks, or nil if event isn't the
+// first sight of its message in a dead-letter queue. Callers must hold the
+// lock, and call it before event's message is stored.
+func (s *Store) dlqArrival(event *Message) *DLQArrival {
+	if !s.isDLQ(event.QueueName) {
+		return nil
+	}
+	arrival := &DLQArrival{
+		MessageID:       event.MessageID,
+		DeadLetterQueue: event.QueueName,
+		ArrivedAt:       event.Timestamp,
+	}
+
+	if msg, ok := s.messages[event.MessageID]; ok {
+		if msg.QueueName == event.QueueName {
+			return nil
+		}
+		arrival.OriginalMessageID = msg.MessageID
+		arrival.SourceQueue = msg.QueueName
+		arrival.SourceReceives = msg.ReceiveCount
+		arrival.MatchedBy = MatchedByMessageID
+		return arrival
+	}
+
+	if original := s.dlqOriginal(event); original != nil {
+		arrival.OriginalMessageID = original.MessageID
+		arrival.SourceQueue = original.QueueName
+		arrival.SourceReceives = original.ReceiveCount
+		arrival.MatchedBy = MatchedByBody
+	}
+	return arrival
+}
+
+// dlqOriginal returns the most recent undeleted message outside any DLQ, not
+// already linked to an arrival, with the body and attributes of event. Callers must
+// hold the lock.
+func (s *Store) dlqOriginal(event *Message) *Message {
+	linked := make(map[string]bool)
+	for _, msg := range s.messages {
+		if msg.DeadLetter != nil {
+			linked[msg.DeadLetter.OriginalMessageID] = true
+		}
+	}
+	sources := make(map[string]bool)
+	for source, edge := range s.dlqEdges {
+		if edge.DeadLetterQueue == event.QueueName {
+			sources[source] = true
+		}
+	}
+
+	var best *Message
+	for _, msg := range s.messages {
+		if msg.Deleted || msg.QueueName == event.QueueName || linked[msg.MessageID] || s.isDLQ(msg.QueueName) {
+			continue
+		}
+		if msg.Body != event.Body || msg.BodyMD5 != event.BodyMD5 || !sameAttributes(msg.Attributes, event.Attributes) {
+			continue
+		}
+		if best == nil {
+			best = msg
+			continue
+		}
+		preferred, bestPreferred := sources[msg.QueueName], sources[best.QueueName]
+		if preferred != bestPreferred {
+			if preferred {
+				best = msg
+			}
+			continue
+		}
+		if msg.Timestamp.After(best.Timestamp) {
+			best = msg
+		}
+	}
+	return best
+}
+
+// moveToDLQ moves msg, redriven with its message ID intact, into the
+// dead-letter queue queueName. Callers must hold the write lock.
+func (s *Store) moveToDLQ(msg *Message, queueURL, queueName string) {
+	s.untrackMessage(msg)
+	if ids := s.queues[msg.QueueName]; ids != nil {
+		delete(ids, msg.MessageID)
+		if len(ids) == 0 {
+			delete(s.queues, msg.QueueName)
+		}
+	}
+
+	// Its receives in the DLQ count afresh; the arrival keeps the earlier ones
+	msg.QueueURL = queueURL
+	msg.QueueName = queueName
+	msg.ReceiveCount = 0
+	msg.LastReceivedAt = nil
+	if s.queues[queueName] == nil {
+		s.queues[queueName] = make(map[string]bool)
+	}
+	s.queues[queueName][msg.MessageID] = true
+	s.trackMessage(msg)
+}
+
+func sameAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"net/http"
+	"time"
+)
+
+const maxExchanges = 1000
+
+// Exchange is the raw HTTP request/response pair of a proxied call. Exchanges
+// are only retained when recording is enabled, since they hold full headers
+// and bodies.
+type Exchange struct {
+	StartedAt       time.Time
+	Duration        time.Duration
+	Method          string
+	URL             string
+	Proto           string
+	RequestHeaders  http.Header
+	RequestBody     string
+	Status          int
+	StatusText      string
+	ResponseHeaders http.Header
+	ResponseBody    string
+}
+
+// SetExchangeRecording enables or disables retention of raw exchanges.
+func (s *Store) SetExchangeRecording(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recordExchanges = enabled
+	if !enabled {
+		s.exchanges = nil
+	}
+}
+
+func (s *Store) RecordsExchanges() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.recordExchanges
+}
+
+// RecordExchange retains ex if recording is enabled, keeping at most the
+// most recent maxExchanges.
+func (s *Store) RecordExchange(ex Exchange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recordExchanges {
+		return
+	}
+	if len(s.exchanges) >= maxExchanges {
+		s.exchanges = s.exchanges[1:]
+	}
+	s.exchanges = append(s.exchanges, &ex)
+}
+
+// GetExchanges returns the retained exchanges in chronological order.
+func (s *Store) GetExchanges() []Exchange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Exchange, len(s.exchanges))
+	for i, ex := range s.exchanges {
+		result[i] = *ex
+	}
+	return result
+}
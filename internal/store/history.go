@@ -0,0 +1,90 @@
+package store
+
+// DefaultMaxHistory is how many events the store keeps by default.
+const DefaultMaxHistory = 10000
+
+// historyRing holds events in chronological order. Once full, each new event
+// overwrites the oldest. A capacity of zero means unbounded.
+type historyRing struct {
+	buf      []*Message
+	head     int // index in buf of the oldest event
+	capacity int
+}
+
+func newHistoryRing(capacity int) *historyRing {
+	return &historyRing{capacity: capacity}
+}
+
+func (r *historyRing) len() int {
+	return len(r.buf)
+}
+
+// at returns the i'th oldest event.
+func (r *historyRing) at(i int) *Message {
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+// push appends event, returning the event it evicted, if any.
+func (r *historyRing) push(event *Message) *Message {
+	if r.capacity <= 0 || len(r.buf) < r.capacity {
+		r.buf = append(r.buf, event)
+		return nil
+	}
+
+	evicted := r.buf[r.head]
+	r.buf[r.head] = event
+	r.head = (r.head + 1) % len(r.buf)
+	return evicted
+}
+
+// events returns the events oldest first, as a new slice.
+func (r *historyRing) events() []*Message {
+	result := make([]*Message, 0, len(r.buf))
+	for i := range r.buf {
+		result = append(result, r.at(i))
+	}
+	return result
+}
+
+// reset replaces the contents with events, oldest first, returning those
+// that did not fit.
+func (r *historyRing) reset(events []*Message) []*Message {
+	var evicted []*Message
+	if r.capacity > 0 && len(events) > r.capacity {
+		evicted = events[:len(events)-r.capacity]
+		events = events[len(events)-r.capacity:]
+	}
+	r.buf = append(make([]*Message, 0, len(events)), events...)
+	r.head = 0
+	return evicted
+}
+
+// SetMaxHistory caps how many events are kept, dropping the oldest beyond
+// it, along with messages none of whose events remain. Zero means
+// unbounded.
+func (s *Store) SetMaxHistory(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history.capacity = n
+	for _, event := range s.history.reset(s.history.events()) {
+		s.releaseEvent(event)
+	}
+}
+
+// releaseEvent notes that event has left history, forgetting its message
+// once no events of it remain. Callers must hold the write lock.
+func (s *Store) releaseEvent(event *Message) {
+	s.countHistoryEvent(event, -1)
+	if event.MessageID == "" {
+		return
+	}
+	s.eventCounts[event.MessageID]--
+	if s.eventCounts[event.MessageID] > 0 {
+		return
+	}
+	delete(s.eventCounts, event.MessageID)
+	if msg, ok := s.messages[event.MessageID]; ok {
+		s.forgetMessage(msg)
+	}
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ringIDs returns the IDs of events, in order.
+func ringIDs(events []*Message) []string {
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+// sameIDs reports whether two ID lists match, treating nil as empty.
+func sameIDs(a, b []string) bool {
+	return len(a) == 0 && len(b) == 0 || reflect.DeepEqual(a, b)
+}
+
+func numberedEvents(n int) []*Message {
+	events := make([]*Message, n)
+	for i := range events {
+		events[i] = &Message{ID: strconv.Itoa(i + 1)}
+	}
+	return events
+}
+
+func TestHistoryRingPush(t *testing.T) {
+	tests := []struct {
+		name        string
+		capacity    int
+		pushes      int
+		wantEvents  []string
+		wantEvicted []string
+	}{
+		{"unbounded", 0, 5, []string{"1", "2", "3", "4", "5"}, nil},
+		{"below capacity", 3, 2, []string{"1", "2"}, nil},
+		{"at capacity", 3, 3, []string{"1", "2", "3"}, nil},
+		{"past the wrap point", 3, 4, []string{"2", "3", "4"}, []string{"1"}},
+		{"wrapped fully", 3, 6, []string{"4", "5", "6"}, []string{"1", "2", "3"}},
+		{"wrapped twice and more", 3, 8, []string{"6", "7", "8"}, []string{"1", "2", "3", "4", "5"}},
+		{"capacity one", 1, 3, []string{"3"}, []string{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newHistoryRing(tt.capacity)
+			var evicted []*Message
+			for _, event := range numberedEvents(tt.pushes) {
+				if e := r.push(event); e != nil {
+					evicted = append(evicted, e)
+				}
+			}
+			if got := ringIDs(r.events()); !sameIDs(got, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", got, tt.wantEvents)
+			}
+			for i, want := range tt.wantEvents {
+				if got := r.at(i).ID; got != want {
+					t.Errorf("at(%d) = %s, want %s", i, got, want)
+				}
+			}
+			if got := ringIDs(evicted); !sameIDs(got, tt.wantEvicted) {
+				t.Errorf("evicted = %v, want %v", got, tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestHistoryRingReset(t *testing.T) {
+	tests := []struct {
+		name        string
+		capacity    int
+		pushes      int // before the reset, to move head off zero
+		reset       int
+		wantEvents  []string
+		wantEvicted []string
+	}{
+		{"unbounded", 0, 0, 4, []string{"1", "2", "3", "4"}, nil},
+		{"fits", 5, 0, 4, []string{"1", "2", "3", "4"}, nil},
+		{"too many", 3, 0, 5, []string{"3", "4", "5"}, []string{"1", "2"}},
+		{"after wrapping", 3, 4, 2, []string{"1", "2"}, nil},
+		{"too many after wrapping", 3, 5, 4, []string{"2", "3", "4"}, []string{"1"}},
+		{"empty", 3, 4, 0, []string{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newHistoryRing(tt.capacity)
+			for _, event := range numberedEvents(tt.pushes) {
+				event.ID = "old-" + event.ID
+				r.push(event)
+			}
+			evicted := r.reset(numberedEvents(tt.reset))
+			if got := ringIDs(r.events()); !sameIDs(got, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", got, tt.wantEvents)
+			}
+			if got := ringIDs(evicted); !sameIDs(got, tt.wantEvicted) {
+				t.Errorf("evicted = %v, want %v", got, tt.wantEvicted)
+			}
+
+			// Pushing after a reset keeps the order
+			r.push(&Message{ID: "next"})
+			if got := r.at(r.len() - 1).ID; got != "next" {
+				t.Errorf("newest after push = %s, want next", got)
+			}
+		})
+	}
+}
+
+func TestSetMaxHistoryShrinks(t *testing.T) {
+	tests := []struct {
+		name         string
+		max          int
+		wantEvents   int
+		wantMessages []string
+	}{
+		// m-1 has a send and a receive, m-2 and m-3 a send each, in that
+		// order: send m-1, send m-2, receive m-1, send m-3
+		{"unbounded", 0, 4, []string{"m-1", "m-2", "m-3"}},
+		{"keeps all", 4, 4, []string{"m-1", "m-2", "m-3"}},
+		{"drops the first send; m-1 keeps its receive", 3, 3, []string{"m-1", "m-2", "m-3"}},
+		{"drops m-2 with its only event", 2, 2, []string{"m-1", "m-3"}},
+		{"drops m-1 once its receive goes too", 1, 1, []string{"m-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			s.RecordSend(Meta{}, "", "orders", "m-1", "a", nil, nil)
+			s.RecordSend(Meta{}, "", "orders", "m-2", "b", nil, nil)
+			s.RecordReceive(Meta{}, "", "orders", "m-1", "r-1", "a", nil, nil)
+			s.RecordSend(Meta{}, "", "orders", "m-3", "c", nil, nil)
+
+			s.SetMaxHistory(tt.max)
+			if n := s.HistoryLen(); n != tt.wantEvents {
+				t.Errorf("history has %d events, want %d", n, tt.wantEvents)
+			}
+			var ids []string
+			for _, msg := range s.GetMessages("orders", true) {
+				ids = append(ids, msg.MessageID)
+			}
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.wantMessages) {
+				t.Errorf("messages = %v, want %v", ids, tt.wantMessages)
+			}
+		})
+	}
+}
+
+func TestEvictionForgetsMessages(t *testing.T) {
+	s := New()
+	s.SetMaxHistory(2)
+	s.RecordSend(Meta{}, "", "orders", "m-1", "a", nil, nil)
+	s.RecordReceive(Meta{}, "", "orders", "m-1", "r-1", "a", nil, nil)
+	s.RecordSend(Meta{}, "", "orders", "m-2", "b", nil, nil)
+
+	// m-1's receive is still in history, so it is kept
+	if len(s.GetMessages("orders", true)) != 2 {
+		t.Fatalf("messages = %+v, want m-1 and m-2", s.GetMessages("orders", true))
+	}
+
+	s.RecordSend(Meta{}, "", "orders", "m-3", "c", nil, nil)
+	messages := s.GetMessages("orders", true)
+	if len(messages) != 2 {
+		t.Fatalf("messages = %d, want m-2 and m-3", len(messages))
+	}
+	for _, msg := range messages {
+		if msg.MessageID == "m-1" {
+			t.Error("m-1 kept after its last event was evicted")
+		}
+	}
+
+	// Its receipt handle went with it
+	s.RecordDelete(Meta{}, "", "orders", "r-1")
+	if history := s.GetHistory(1); history[0].MessageID != "" {
+		t.Errorf("delete by an evicted message's handle matched %s", history[0].MessageID)
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []RetentionRule
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"critical=all, debug-*=100,*=1h", []RetentionRule{
+			{Pattern: "critical"},
+			{Pattern: "debug-*", MaxEvents: 100},
+			{Pattern: "*", MaxAge: time.Hour},
+		}, false},
+		{"critical", nil, true},
+		{"=10", nil, true},
+		{"[=10", nil, true},
+		{"debug=-1", nil, true},
+		{"debug=soon", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRetention(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRetention(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRetention(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestPruneAppliesEachQueuesRetention(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+	rules, err := ParseRetention("critical=all,debug-*=3,*=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRetention(rules)
+
+	for i := 0; i < 5; i++ {
+		n := strconv.Itoa(i)
+		s.RecordSend(Meta{}, "", "critical", "c-"+n, "body", nil, nil)
+		s.RecordSend(Meta{}, "", "debug-orders", "d-"+n, "body", nil, nil)
+		s.RecordSend(Meta{}, "", "payments", "p-"+n, "body", nil, nil)
+		clock.Advance(30 * time.Minute)
+	}
+
+	// payments keeps only the last hour: p-3 (60m old) and p-4 (30m old)
+	if removed := s.Prune(); removed != 5 {
+		t.Errorf("Prune removed %d events, want 5", removed)
+	}
+
+	kept := make(map[string][]string)
+	for _, event := range s.GetHistory(0) {
+		kept[event.QueueName] = append(kept[event.QueueName], event.MessageID)
+	}
+	for queue, want := range map[string][]string{
+		"critical":     {"c-4", "c-3", "c-2", "c-1", "c-0"},
+		"debug-orders": {"d-4", "d-3", "d-2"},
+		"payments":     {"p-4", "p-3"},
+	} {
+		if !reflect.DeepEqual(kept[queue], want) {
+			t.Errorf("%s kept %v, want %v", queue, kept[queue], want)
+		}
+	}
+	if len(s.GetMessages("debug-orders", true)) != 3 {
+		t.Errorf("pruned debug-orders messages still stored: %+v", s.GetMessages("debug-orders", true))
+	}
+
+	if removed := s.Prune(); removed != 0 {
+		t.Errorf("second Prune removed %d events, want 0", removed)
+	}
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+)
+
+// knownActions are the event actions Import accepts.
+var knownActions = map[MessageAction]bool{
+	ActionSend:             true,
+	ActionReceive:          true,
+	ActionDelete:           true,
+	ActionControl:          true,
+	ActionChangeVisibility: true,
+	ActionFault:            true,
+	ActionMarker:           true,
+	ActionPublish:          true,
+	ActionPurge:            true,
+	ActionRemoved:          true,
+	ActionGeneric:          true,
+}
+
+// Import replaces the captured state with history, the events of an
+// export, so a capture can be browsed without re-running its traffic. The
+// message records are rebuilt from the events: an exported send event is
+// its message's record, with its final state, and messages first seen by a
+// receive get a record from that receive and the events after it. Invalid
+// history is rejected before anything changes. It returns the number of
+// messages imported.
+func (s *Store) Import(history []*Message) (int, error) {
+	if err := validateImport(history); err != nil {
+		return 0, err
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Timestamp.Before(history[j].Timestamp)
+	})
+
+	snap := snapshot{
+		Messages: make(map[string]*Message),
+		Queues:   make(map[string]map[string]bool),
+		History:  history,
+		Receipts: make(map[string]string),
+	}
+	for _, event := range history {
+		if event.Action == ActionSend {
+			snap.Messages[event.MessageID] = event
+		}
+	}
+
+	// Messages the capture never saw sent
+	received := make(map[string]*Message)
+	lastReceive := make(map[string]*Message)
+	for _, event := range history {
+		switch event.Action {
+		case ActionReceive:
+			snap.Receipts[event.ReceiptHandle] = event.MessageID
+			if _, ok := snap.Messages[event.MessageID]; ok {
+				continue
+			}
+			msg, ok := received[event.MessageID]
+			if !ok {
+				copied := *event
+				msg = &copied
+				msg.ReceiveCount = 0
+				msg.ReceiptHandles = nil
+				msg.ReceivedOnly = true
+				received[event.MessageID] = msg
+			}
+			receivedAt := event.Timestamp
+			lastReceive[event.MessageID] = event
+			msg.LastReceivedAt = &receivedAt
+			msg.ReceiveCount++
+			msg.ReceiptHandles = append(msg.ReceiptHandles, event.ReceiptHandle)
+		case ActionDelete:
+			if msg, ok := received[event.MessageID]; ok {
+				deletedAt := event.Timestamp
+				msg.Deleted = true
+				msg.DeletedAt = &deletedAt
+			}
+		}
+	}
+	for id, msg := range received {
+		snap.Messages[id] = msg
+	}
+
+	// Messages removed from the relay and not seen since
+	last := make(map[string]MessageAction)
+	for _, event := range history {
+		if event.MessageID != "" {
+			last[event.MessageID] = event.Action
+		}
+	}
+	for id, action := range last {
+		if action == ActionRemoved {
+			delete(snap.Messages, id)
+		}
+	}
+	for id, msg := range snap.Messages {
+		if snap.Queues[msg.QueueName] == nil {
+			snap.Queues[msg.QueueName] = make(map[string]bool)
+		}
+		snap.Queues[msg.QueueName][id] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, msg := range received {
+		event := lastReceive[id]
+		hiddenUntil := event.Timestamp.Add(s.visibilityTimeout(msg.QueueName, event.VisibilityTimeout))
+		msg.InFlightUntil = &hiddenUntil
+	}
+	s.clear()
+	s.restore(snap)
+	s.dirty.Store(true)
+	return len(s.messages), nil
+}
+
+// validateImport checks that every event has the fields the store relies
+// on.
+func validateImport(history []*Message) error {
+	for i, event := range history {
+		switch {
+		case event == nil:
+			return fmt.Errorf("history[%d]: null event", i)
+		case event.ID == "":
+			return fmt.Errorf("history[%d]: missing id", i)
+		case !knownActions[event.Action]:
+			return fmt.Errorf("history[%d]: unknown action %q", i, event.Action)
+		case event.Timestamp.IsZero():
+			return fmt.Errorf("history[%d]: missing timestamp", i)
+		case (event.Action == ActionSend || event.Action == ActionReceive) && (event.QueueName == "" || event.MessageID == ""):
+			return fmt.Errorf("history[%d]: %s event without queueName or messageId", i, event.Action)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// MoveTask is an SQS-managed DLQ redrive, started with StartMessageMoveTask
+// and followed through CancelMessageMoveTask and ListMessageMoveTasks.
+type MoveTask struct {
+	TaskHandle       string    `json:"taskHandle,omitempty"`
+	SourceArn        string    `json:"sourceArn"`
+	DestinationArn   string    `json:"destinationArn,omitempty"`
+	SourceQueue      string    `json:"sourceQueue"`
+	DestinationQueue string    `json:"destinationQueue,omitempty"`
+	Status           string    `json:"status"`
+	MaxPerSecond     int       `json:"maxNumberOfMessagesPerSecond,omitempty"`
+	MessagesMoved    int       `json:"approximateNumberOfMessagesMoved"`
+	MessagesToMove   int       `json:"approximateNumberOfMessagesToMove,omitempty"`
+	FailureReason    string    `json:"failureReason,omitempty"`
+	StartedAt        time.Time `json:"startedAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// RecordMoveTask merges an observation of a move task into the task it
+// describes, identified by its handle or, for finished tasks that no longer
+// report one, by source and start time. Zero fields leave the stored values
+// unchanged.
+func (s *Store) RecordMoveTask(update MoveTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task := s.moveTask(update)
+	if update.SourceArn != "" {
+		task.SourceArn = update.SourceArn
+		task.SourceQueue = arnQueueName(update.SourceArn)
+	}
+	if update.DestinationArn != "" {
+		task.DestinationArn = update.DestinationArn
+		task.DestinationQueue = arnQueueName(update.DestinationArn)
+	}
+	if update.Status != "" {
+		task.Status = update.Status
+	}
+	if update.MaxPerSecond != 0 {
+		task.MaxPerSecond = update.MaxPerSecond
+	}
+	if update.MessagesMoved != 0 {
+		task.MessagesMoved = update.MessagesMoved
+	}
+	if update.MessagesToMove != 0 {
+		task.MessagesToMove = update.MessagesToMove
+	}
+	if update.FailureReason != "" {
+		task.FailureReason = update.FailureReason
+	}
+	if !update.StartedAt.IsZero() {
+		task.StartedAt = update.StartedAt
+	}
+	task.UpdatedAt = s.now()
+}
+
+// GetMoveTasks returns the observed move tasks, most recently started first.
+func (s *Store) GetMoveTasks() []MoveTask {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make([]MoveTask, 0, len(s.moveTasks))
+	for _, task := range s.moveTasks {
+		tasks = append(tasks, *task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].StartedAt.After(tasks[j].StartedAt)
+	})
+	return tasks
+}
+
+// moveTask returns the stored task update refers to, creating it if needed.
+// Callers must hold the write lock.
+func (s *Store) moveTask(update MoveTask) *MoveTask {
+	if update.TaskHandle != "" {
+		if task, ok := s.moveTasks[update.TaskHandle]; ok {
+			return task
+		}
+	}
+	for _, task := range s.moveTasks {
+		if task.SourceArn == update.SourceArn && !update.StartedAt.IsZero() && task.StartedAt.Equal(update.StartedAt) {
+			return task
+		}
+	}
+
+	key := update.TaskHandle
+	if key == "" {
+		key = update.SourceArn + "@" + update.StartedAt.Format(time.RFC3339Nano)
+	}
+	task := &MoveTask{TaskHandle: update.TaskHandle, StartedAt: s.now()}
+	s.moveTasks[key] = task
+	return task
+}
+
+// arnQueueName returns the queue name at the end of an SQS queue ARN such as
+// arn:aws:sqs:us-east-1:000000000000:orders-dlq.
+func arnQueueName(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
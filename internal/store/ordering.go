@@ -0,0 +1,103 @@
+package store
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// OrderingViolation is a message received before one that was sent after it.
+type OrderingViolation struct {
+	QueueName      string    `json:"queueName"`
+	MessageGroupID string    `json:"messageGroupId,omitempty"`
+	MessageID      string    `json:"messageId"`
+	ReceivedAfter  string    `json:"receivedAfter"` // later-sent message received first
+	SentAt         time.Time `json:"sentAt"`
+	ReceivedAt     time.Time `json:"receivedAt"`
+}
+
+// SetOrderedQueues enables ordering checks on standard queues whose names
+// match one of patterns, exactly or as path.Match globs. FIFO queues are
+// always checked.
+func (s *Store) SetOrderedQueues(patterns []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.orderedQueues = patterns
+}
+
+// GetOrderingViolations compares send order with first-receive order on
+// every checked queue, per message group where sends named one, and returns
+// each message received after a message that was sent later. Redeliveries
+// are ignored, as are messages whose send wasn't captured.
+func (s *Store) GetOrderingViolations() []OrderingViolation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type sent struct {
+		seq   int
+		group string
+		at    time.Time
+	}
+	sends := make(map[string]sent)
+	for i := 0; i < s.history.len(); i++ {
+		event := s.history.at(i)
+		if event.Action == ActionSend && s.checksOrdering(event.QueueName) {
+			if _, dup := sends[event.MessageID]; !dup {
+				sends[event.MessageID] = sent{i, event.MessageGroupID, event.Timestamp}
+			}
+		}
+	}
+
+	type latest struct {
+		seq       int
+		messageID string
+	}
+	received := make(map[string]bool)
+	highest := make(map[string]latest) // queue + group -> latest-sent message received so far
+
+	violations := []OrderingViolation{}
+	for i := 0; i < s.history.len(); i++ {
+		event := s.history.at(i)
+		if event.Action != ActionReceive || received[event.MessageID] {
+			continue
+		}
+		send, ok := sends[event.MessageID]
+		if !ok {
+			continue
+		}
+		received[event.MessageID] = true
+
+		key := event.QueueName + "\x00" + send.group
+		if h, seen := highest[key]; seen && h.seq > send.seq {
+			violations = append(violations, OrderingViolation{
+				QueueName:      event.QueueName,
+				MessageGroupID: send.group,
+				MessageID:      event.MessageID,
+				ReceivedAfter:  h.messageID,
+				SentAt:         send.at,
+				ReceivedAt:     event.Timestamp,
+			})
+			continue
+		}
+		highest[key] = latest{send.seq, event.MessageID}
+	}
+	return violations
+}
+
+// checksOrdering reports whether queueName is a FIFO queue or matches an
+// ordered-queue pattern. Callers must hold the lock.
+func (s *Store) checksOrdering(queueName string) bool {
+	if strings.HasSuffix(queueName, ".fifo") {
+		return true
+	}
+	for _, pattern := range s.orderedQueues {
+		if pattern == queueName {
+			return true
+		}
+		if ok, _ := path.Match(pattern, queueName); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistInterval is how often a persistent store writes its snapshot when
+// something changed.
+const persistInterval = 5 * time.Second
+
+// snapshot is the on-disk form of a persistent store's captured state.
+type snapshot struct {
+	Messages map[string]*Message        `json:"messages"`
+	Queues   map[string]map[string]bool `json:"queues"`
+	History  []*Message                 `json:"history"`
+	Receipts map[string]string          `json:"receipts"`
+
+	// Indexes into History of send events that are also the message's
+	// record, so they stay one object after loading
+	SharedEvents []int `json:"sharedEvents"`
+}
+
+// NewPersistent returns a store that is loaded from the JSON snapshot at
+// path, if there is a usable one, and writes its captured messages and
+// history back there every few seconds while they change. maxHistory caps
+// history as SetMaxHistory does; it applies before loading, so a snapshot
+// isn't cut down to the default cap first.
+func NewPersistent(path string, maxHistory int) *Store {
+	s := New()
+	s.persistPath = path
+	s.history.capacity = maxHistory
+
+	if err := s.load(); err != nil {
+		log.Printf("Warning: starting with an empty store; could not load %s: %v", path, err)
+	}
+
+	go func() {
+		for range time.Tick(persistInterval) {
+			if err := s.Save(); err != nil {
+				log.Printf("Warning: could not save store to %s: %v", path, err)
+			}
+		}
+	}()
+	return s
+}
+
+// Save writes the snapshot of a persistent store if anything changed since
+// the last save. It does nothing for other stores. The state is copied under
+// the read lock and marshalled after releasing it, so capturing isn't held
+// up by a large snapshot.
+func (s *Store) Save() error {
+	s.mu.RLock()
+	// Writers hold the write lock, so nothing can mark the store dirty
+	// between the swap and the copy
+	if s.persistPath == "" || !s.dirty.Swap(false) {
+		s.mu.RUnlock()
+		return nil
+	}
+	snap := s.copyState()
+	s.mu.RUnlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		s.dirty.Store(true)
+		return err
+	}
+	return writeFileAtomic(s.persistPath, data)
+}
+
+// copyState copies the captured state for Save. Messages are copied by value:
+// the store only ever replaces or appends to their maps and slices, never
+// changes them in place, so the copies can be read without the lock.
+func (s *Store) copyState() snapshot {
+	copies := make(map[*Message]*Message, len(s.messages))
+	copyOf := func(msg *Message) *Message {
+		c, ok := copies[msg]
+		if !ok {
+			m := *msg
+			c = &m
+			copies[msg] = c
+		}
+		return c
+	}
+
+	snap := snapshot{
+		Messages: make(map[string]*Message, len(s.messages)),
+		Queues:   make(map[string]map[string]bool, len(s.queues)),
+		History:  make([]*Message, 0, s.history.len()),
+		Receipts: make(map[string]string, len(s.receipts)),
+	}
+	for id, msg := range s.messages {
+		snap.Messages[id] = copyOf(msg)
+	}
+	for name, ids := range s.queues {
+		queue := make(map[string]bool, len(ids))
+		for id, v := range ids {
+			queue[id] = v
+		}
+		snap.Queues[name] = queue
+	}
+	for i, event := range s.history.events() {
+		if s.messages[event.MessageID] == event {
+			snap.SharedEvents = append(snap.SharedEvents, i)
+		}
+		snap.History = append(snap.History, copyOf(event))
+	}
+	for handle, id := range s.receipts {
+		snap.Receipts[handle] = id
+	}
+	return snap
+}
+
+// load replaces the captured state with the snapshot at the persist path. A
+// missing file is not an error.
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.persistPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if snap.Messages == nil {
+		snap.Messages = make(map[string]*Message)
+	}
+	if snap.Queues == nil {
+		snap.Queues = make(map[string]map[string]bool)
+	}
+	if snap.Receipts == nil {
+		snap.Receipts = make(map[string]string)
+	}
+	for _, i := range snap.SharedEvents {
+		if i >= 0 && i < len(snap.History) {
+			if msg, ok := snap.Messages[snap.History[i].MessageID]; ok {
+				snap.History[i] = msg
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.restore(snap)
+	log.Printf("Loaded %d message(s) and %d event(s) from %s", len(s.messages), s.history.len(), s.persistPath)
+	return nil
+}
+
+// restore replaces the captured state with that of snap, whose shared
+// events must already be the message records. Callers must hold the write
+// lock.
+func (s *Store) restore(snap snapshot) {
+	s.messages = snap.Messages
+	s.queues = snap.Queues
+	s.receipts = snap.Receipts
+	s.eventCounts = make(map[string]int)
+	for _, event := range snap.History {
+		if event.MessageID != "" {
+			s.eventCounts[event.MessageID]++
+		}
+	}
+	s.queueCounts = make(map[string]*queueCounts)
+	s.topicCounts = make(map[string]int)
+	for _, event := range s.history.reset(snap.History) {
+		s.releaseEvent(event)
+	}
+	s.rebuildQueueCounts()
+}
+
+// writeFileAtomic writes data to path via a temporary file, so a crash
+// mid-write leaves the previous snapshot intact.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
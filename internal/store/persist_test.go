@@ -0,0 +1,153 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// capturedState is what a persistent store must carry across a restart, in
+// a comparable form.
+type capturedState struct {
+	Messages string
+	History  string
+	Totals   map[string]QueueStats
+}
+
+func captureState(t *testing.T, s *Store) capturedState {
+	t.Helper()
+	messages := s.GetMessages("", true)
+	sort.Slice(messages, func(i, j int) bool { return messages[i].MessageID < messages[j].MessageID })
+	encodedMessages, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedHistory, err := json.Marshal(s.GetHistory(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return capturedState{
+		Messages: string(encodedMessages),
+		History:  string(encodedHistory),
+		Totals:   runningTotals(s),
+	}
+}
+
+func TestPersistentStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay.json")
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+
+	s := NewPersistent(path, DefaultMaxHistory)
+	s.RecordSend(Meta{}, ordersURL, "orders", "m-1", "first", map[string]string{"kind": "a"}, nil)
+	s.RecordSend(Meta{}, ordersURL, "orders", "m-2", "second", nil, nil)
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-1", "r-1", "first", nil, nil)
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-2", "r-2", "second", nil, nil)
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-2", "r-2b", "second", nil, nil)
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-9", "r-9", "sent before the capture", nil, nil)
+	s.RecordDelete(Meta{}, ordersURL, "orders", "r-1")
+	s.AddMarker("checkpoint")
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := captureState(t, s)
+
+	reloaded := NewPersistent(path, DefaultMaxHistory)
+	got := captureState(t, reloaded)
+	if got.Messages != want.Messages {
+		t.Errorf("messages after reload:\n%s\nwant:\n%s", got.Messages, want.Messages)
+	}
+	if got.History != want.History {
+		t.Errorf("history after reload:\n%s\nwant:\n%s", got.History, want.History)
+	}
+	if !reflect.DeepEqual(got.Totals, want.Totals) {
+		t.Errorf("running totals after reload = %+v, want %+v", got.Totals, want.Totals)
+	}
+
+	// Receipts survive, and a send event is still its message's record, so
+	// deleting updates both
+	reloaded.RecordDelete(Meta{}, ordersURL, "orders", "r-2b")
+	for _, event := range reloaded.GetHistory(0) {
+		if event.Action == ActionSend && event.MessageID == "m-2" && !event.Deleted {
+			t.Error("send event of m-2 not updated by a delete after reload")
+		}
+	}
+	checkStatsMatchRescan(t, "after reload", reloaded)
+}
+
+func TestPersistentStoreSavesOnlyWhenDirty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay.json")
+	s := NewPersistent(path, DefaultMaxHistory)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewPersistent(path, DefaultMaxHistory).HistoryLen(); got != 0 {
+		t.Errorf("reloaded %d events from an untouched store", got)
+	}
+}
+
+func TestPersistentStoreKeepsHistoryBeyondTheDefaultCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxHistory int
+		events     int
+		want       int
+	}{
+		{"above the default", DefaultMaxHistory + 500, DefaultMaxHistory + 200, DefaultMaxHistory + 200},
+		{"unbounded", 0, DefaultMaxHistory + 200, DefaultMaxHistory + 200},
+		{"below the default", 100, 300, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "relay.json")
+			s := NewPersistent(path, tt.maxHistory)
+			for i := 0; i < tt.events; i++ {
+				s.AddMarker("event")
+			}
+			if err := s.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := NewPersistent(path, tt.maxHistory).HistoryLen(); got != tt.want {
+				t.Errorf("reloaded %d events, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersistentStoreSavesWhileCapturing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay.json")
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	s := NewPersistent(path, DefaultMaxHistory)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			id := fmt.Sprintf("m-%d", i)
+			s.RecordSend(Meta{}, ordersURL, "orders", id, "body", map[string]string{"kind": "a"}, nil)
+			s.RecordReceive(Meta{}, ordersURL, "orders", id, "r-"+id, "body", nil, nil)
+			s.AnnotateMessage(id, "note", false)
+		}
+	}()
+	for saving := true; saving; {
+		select {
+		case <-done:
+			saving = false
+		default:
+		}
+		if err := s.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := captureState(t, s)
+	if got := captureState(t, NewPersistent(path, DefaultMaxHistory)); got.Messages != want.Messages || got.History != want.History {
+		t.Error("state saved while capturing differs from the store after reload")
+	}
+}
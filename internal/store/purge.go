@@ -0,0 +1,55 @@
+package store
+
+import "time"
+
+// PurgeCooldown is how long SQS rejects further PurgeQueue calls on a queue
+// after a successful purge.
+const PurgeCooldown = 60 * time.Second
+
+// RecordPurge records a successful PurgeQueue on queueName, starting its
+// cooldown. Every undeleted message of the queue is marked deleted and
+// purged, and a purge event is added to history; the messages' own events
+// are kept so what was purged can still be inspected.
+func (s *Store) RecordPurge(meta Meta, queueURL, queueName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.purges[queueName] = now
+
+	purged := 0
+	for messageID := range s.queues[queueName] {
+		msg, ok := s.messages[messageID]
+		if !ok || msg.Deleted {
+			continue
+		}
+		s.trackPurge(msg)
+		msg.Deleted = true
+		msg.Purged = true
+		msg.DeletedAt = &now
+		msg.InFlightUntil = nil
+		purged++
+	}
+
+	event := &Message{
+		ID:          generateID(),
+		QueueURL:    queueURL,
+		QueueName:   queueName,
+		Action:      ActionPurge,
+		Timestamp:   now,
+		PurgedCount: purged,
+	}
+	meta.apply(event)
+	s.appendHistory(event)
+}
+
+// applyPurge sets the purge fields of stats. Callers must hold the lock.
+func (s *Store) applyPurge(stats *QueueStats) {
+	purgedAt, ok := s.purges[stats.QueueName]
+	if !ok {
+		return
+	}
+	next := purgedAt.Add(PurgeCooldown)
+	stats.LastPurgedAt = &purgedAt
+	stats.NextPurgeAllowedAt = &next
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeCooldownInQueueStats(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+
+	s.RecordSend(Meta{}, "http://localhost:4566/000000000000/orders", "orders", "m-1", "hi", nil, nil)
+	clock.Advance(time.Second)
+	purgedAt := clock.Now()
+	s.RecordPurge(Meta{}, "http://localhost:4566/000000000000/orders", "orders")
+	s.RecordPurge(Meta{}, "http://localhost:4566/000000000000/audit", "audit")
+
+	stats := map[string]QueueStats{}
+	for _, qs := range s.GetQueueStats() {
+		stats[qs.QueueName] = qs
+	}
+	for _, name := range []string{"orders", "audit"} {
+		qs, ok := stats[name]
+		if !ok {
+			t.Fatalf("purged queue %s missing from stats", name)
+		}
+		if qs.LastPurgedAt == nil || !qs.LastPurgedAt.Equal(purgedAt) {
+			t.Errorf("%s last purged at %v, want %v", name, qs.LastPurgedAt, purgedAt)
+		}
+		if want := purgedAt.Add(PurgeCooldown); qs.NextPurgeAllowedAt == nil || !qs.NextPurgeAllowedAt.Equal(want) {
+			t.Errorf("%s next purge allowed at %v, want %v", name, qs.NextPurgeAllowedAt, want)
+		}
+	}
+
+	messages := s.GetMessages("orders", true)
+	if len(messages) != 1 || !messages[0].Deleted || !messages[0].Purged {
+		t.Errorf("purged messages = %+v", messages)
+	}
+	if stats["orders"].Pending != 0 {
+		t.Errorf("pending after purge = %d, want 0", stats["orders"].Pending)
+	}
+}
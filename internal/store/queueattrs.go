@@ -0,0 +1,146 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaxMessageSize is the largest message body SQS accepts on any queue.
+const MaxMessageSize = 256 * 1024
+
+// queueAttributes is the latest value observed for each attribute of a
+// queue, from GetQueueAttributes responses or queue configuration requests.
+type queueAttributes struct {
+	values     map[string]string
+	observedAt time.Time
+}
+
+// RecordQueueAttributes merges attrs into the latest observed attributes of
+// queueName. Attributes are kept across Clear since they describe the queue
+// rather than captured traffic.
+func (s *Store) RecordQueueAttributes(queueName string, attrs map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	qa, ok := s.queueAttrs[queueName]
+	if !ok {
+		qa = &queueAttributes{values: make(map[string]string)}
+		s.queueAttrs[queueName] = qa
+	}
+	for name, value := range attrs {
+		qa.values[name] = value
+	}
+	qa.observedAt = s.now()
+}
+
+// RecordQueueCreate records a queue created with the given attributes, so it
+// is listed in the queue stats before any traffic reaches it. Like queue
+// attributes, created queues are kept across Clear.
+func (s *Store) RecordQueueCreate(queueName, queueURL string, attrs map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.knownQueues[queueName]; !ok {
+		s.knownQueues[queueName] = s.now()
+	}
+	s.createdQueues[queueName] = queueURL
+
+	if len(attrs) == 0 {
+		return
+	}
+	qa, ok := s.queueAttrs[queueName]
+	if !ok {
+		qa = &queueAttributes{values: make(map[string]string)}
+		s.queueAttrs[queueName] = qa
+	}
+	for name, value := range attrs {
+		qa.values[name] = value
+	}
+	qa.observedAt = s.now()
+}
+
+// GetQueueAttributes returns a copy of the latest observed attributes of
+// queueName.
+func (s *Store) GetQueueAttributes(queueName string) (map[string]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	qa, ok := s.queueAttrs[queueName]
+	if !ok {
+		return nil, false
+	}
+	attrs := make(map[string]string, len(qa.values))
+	for name, value := range qa.values {
+		attrs[name] = value
+	}
+	return attrs, true
+}
+
+// queueAttrInt returns a numeric queue attribute. Callers must hold the lock.
+func (s *Store) queueAttrInt(queueName, name string) (int, bool) {
+	qa, ok := s.queueAttrs[queueName]
+	if !ok {
+		return 0, false
+	}
+	v, ok := qa.values[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+// applyUpstreamCounts fills in the upstream-reported message counts of stats
+// and flags a discrepancy with the relay's own pending count. Counts observed
+// before the last Clear are ignored since they cover traffic the relay has
+// since forgotten. Callers must hold the lock.
+func (s *Store) applyUpstreamCounts(stats *QueueStats) {
+	qa, ok := s.queueAttrs[stats.QueueName]
+	if !ok || qa.observedAt.Before(s.clearedAt) {
+		return
+	}
+
+	visible, ok := s.queueAttrInt(stats.QueueName, "ApproximateNumberOfMessages")
+	if !ok {
+		return
+	}
+	notVisible, _ := s.queueAttrInt(stats.QueueName, "ApproximateNumberOfMessagesNotVisible")
+	delayed, _ := s.queueAttrInt(stats.QueueName, "ApproximateNumberOfMessagesDelayed")
+
+	stats.UpstreamApproximate = &visible
+	stats.UpstreamNotVisible = &notVisible
+	stats.UpstreamDelayed = &delayed
+
+	// The relay's pending includes in-flight and delayed messages
+	stats.Discrepancy = visible+notVisible+delayed != stats.Pending
+}
+
+// applyQueueConfig fills in the configured visibility timeout and redrive
+// target of stats. Unlike the upstream counts, configuration observed before
+// the last Clear still applies. Callers must hold the lock.
+func (s *Store) applyQueueConfig(stats *QueueStats) {
+	if qa, ok := s.queueAttrs[stats.QueueName]; ok {
+		observedAt := qa.observedAt
+		stats.AttributesObservedAt = &observedAt
+		if timeout, ok := s.queueAttrInt(stats.QueueName, "VisibilityTimeout"); ok {
+			stats.VisibilityTimeout = &timeout
+		}
+	}
+	if edge, ok := s.dlqEdges[stats.QueueName]; ok {
+		stats.DeadLetterQueue = edge.DeadLetterQueue
+		stats.MaxReceiveCount = edge.MaxReceiveCount
+	}
+}
+
+// checkMessageSize flags a send whose body exceeds the queue's configured
+// MaximumMessageSize, or the global SQS limit when the queue's is unknown.
+// Callers must hold the write lock.
+func (s *Store) checkMessageSize(queueName, messageID, body string) {
+	size := len(body)
+	if limit, ok := s.queueAttrInt(queueName, "MaximumMessageSize"); ok && size > limit {
+		s.addAnomaly(AnomalyOversized, queueName, fmt.Sprintf("message %s is %d bytes; queue MaximumMessageSize is %d", messageID, size, limit))
+	} else if size > MaxMessageSize {
+		s.addAnomaly(AnomalyOversized, queueName, fmt.Sprintf("message %s is %d bytes; SQS allows at most %d", messageID, size, MaxMessageSize))
+	}
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReceivedWithoutPriorSend(t *testing.T) {
+	s := New()
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+
+	// A message already in the queue before the relay started
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-1", "r-1", "from before", nil, nil)
+	qs := queueStats(t, s, "orders")
+	if qs.TotalSent != 0 || qs.TotalReceived != 1 || qs.Pending != 1 || qs.ReceivedOnly != 1 || qs.InFlight != 1 {
+		t.Errorf("after the first receive: %+v, want 0 sent, 1 received, pending, received-only and in flight", qs)
+	}
+	messages := s.GetMessages("orders", true)
+	if len(messages) != 1 || !messages[0].ReceivedOnly || messages[0].ReceiveCount != 1 || messages[0].Body != "from before" {
+		t.Fatalf("messages = %+v, want one received-only record", messages)
+	}
+
+	// Received again, it is one message, now redelivered
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-1", "r-2", "from before", nil, nil)
+	qs = queueStats(t, s, "orders")
+	if qs.TotalReceived != 2 || qs.Pending != 1 || qs.Redelivered != 1 {
+		t.Errorf("after a second receive: %+v, want 2 received, 1 pending and redelivered", qs)
+	}
+	if n := len(s.GetMessages("orders", true)); n != 1 {
+		t.Errorf("messages = %d after a second receive, want 1", n)
+	}
+
+	s.RecordDelete(Meta{}, ordersURL, "orders", "r-2")
+	qs = queueStats(t, s, "orders")
+	if qs.TotalDeleted != 1 || qs.Pending != 0 || qs.InFlight != 0 || qs.ReceivedOnly != 1 {
+		t.Errorf("after delete: %+v, want 1 deleted, nothing pending or in flight", qs)
+	}
+	if qs.AckRatio == nil || *qs.AckRatio != 1 {
+		t.Errorf("ack ratio = %v, want 1", qs.AckRatio)
+	}
+	checkStatsMatchRescan(t, "received without prior send", s)
+}
+
+func TestDeleteWithStaleHandleFlagged(t *testing.T) {
+	tests := []struct {
+		name      string
+		handle    string
+		wantStale bool
+	}{
+		{"first handle", "r-1", true},
+		{"latest handle", "r-2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			s.RecordSend(Meta{}, "", "orders", "m-1", "body", nil, nil)
+			s.RecordReceive(Meta{}, "", "orders", "m-1", "r-1", "body", nil, nil)
+			s.RecordReceive(Meta{}, "", "orders", "m-1", "r-2", "body", nil, nil)
+
+			msg, _ := s.GetMessage("m-1")
+			if got := strings.Join(msg.ReceiptHandles, ","); got != "r-1,r-2" {
+				t.Errorf("receipt handles = %s, want r-1,r-2", got)
+			}
+
+			s.RecordDelete(Meta{}, "", "orders", tt.handle)
+			history := s.GetHistory(0)
+			del := history[0]
+			if del.Action != ActionDelete || del.MessageID != "m-1" {
+				t.Fatalf("latest event = %+v, want the delete of m-1", del)
+			}
+			if del.StaleHandle != tt.wantStale {
+				t.Errorf("delete with %s: stale = %v, want %v", tt.handle, del.StaleHandle, tt.wantStale)
+			}
+			if msg, _ := s.GetMessage("m-1"); !msg.Deleted {
+				t.Errorf("m-1 not deleted by %s", tt.handle)
+			}
+		})
+	}
+}
+
+func TestOrderingViolationsOnCheckedQueues(t *testing.T) {
+	s := New()
+	s.SetOrderedQueues([]string{"orders-*"})
+
+	// Each queue gets a, b sent and b, a received; redelivering b is not
+	// a further violation
+	for _, queue := range []string{"orders-eu", "payments", "jobs.fifo"} {
+		for _, id := range []string{"a", "b"} {
+			s.RecordSend(Meta{}, "", queue, queue+"/"+id, "body", nil, nil)
+		}
+		for _, id := range []string{"b", "a", "b"} {
+			s.RecordReceive(Meta{}, "", queue, queue+"/"+id, "r-"+queue+"/"+id, "body", nil, nil)
+		}
+	}
+
+	var got []string
+	for _, v := range s.GetOrderingViolations() {
+		got = append(got, v.MessageID+" after "+v.ReceivedAfter)
+	}
+	want := []string{"orders-eu/a after orders-eu/b", "jobs.fifo/a after jobs.fifo/b"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("violations = %q, want %q", got, want)
+	}
+}
+
+func TestReceivedMessageNotVisibleUntilWindowElapses(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+	depth := func() (int, int) {
+		t.Helper()
+		for _, d := range s.GetQueueDepths() {
+			if d.QueueName == "orders" {
+				return d.Visible, d.NotVisible
+			}
+		}
+		t.Fatal("no depth for orders")
+		return 0, 0
+	}
+	check := func(stage string, wantVisible, wantNotVisible int) {
+		t.Helper()
+		if visible, notVisible := depth(); visible != wantVisible || notVisible != wantNotVisible {
+			t.Errorf("%s: visible %d, not visible %d; want %d, %d", stage, visible, notVisible, wantVisible, wantNotVisible)
+		}
+	}
+
+	s.RecordSend(Meta{}, "", "orders", "m-1", "one", nil, nil)
+	s.RecordSend(Meta{}, "", "orders", "m-2", "two", nil, nil)
+	check("after sends", 2, 0)
+
+	s.RecordReceive(Meta{}, "", "orders", "m-1", "r-1", "one", nil, nil)
+	check("after a receive", 1, 1)
+	clock.Advance(DefaultVisibilityTimeout - time.Second)
+	check("within the visibility timeout", 1, 1)
+	clock.Advance(2 * time.Second)
+	check("after the visibility timeout", 2, 0)
+
+	// A visibility change hides it again for its own timeout
+	s.RecordReceive(Meta{}, "", "orders", "m-1", "r-2", "one", nil, nil)
+	s.RecordChangeVisibility(Meta{}, "", "orders", "r-2", 120)
+	clock.Advance(time.Minute)
+	check("within the changed timeout", 1, 1)
+
+	// The queue's own timeout applies to later receives
+	s.RecordQueueAttributes("orders", map[string]string{"VisibilityTimeout": "5"})
+	s.RecordReceive(Meta{}, "", "orders", "m-2", "r-3", "two", nil, nil)
+	check("after a receive from the configured queue", 0, 2)
+	clock.Advance(6 * time.Second)
+	check("after the queue's timeout", 1, 1)
+
+	s.RecordDelete(Meta{}, "", "orders", "r-2")
+	check("after deleting the hidden message", 1, 0)
+}
@@ -0,0 +1,70 @@
+package store
+
+// RemoveQueue forgets a queue deleted upstream: its messages, their receipt
+// handles and events, and what is known of the queue itself. Its
+// control-plane events, including the DeleteQueue, stay in history for
+// audit, but the queue is left out of GetQueueStats until it sees traffic or
+// is created again.
+func (s *Store) RemoveQueue(queueName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.history.events()
+	kept := make([]*Message, 0, len(events))
+	var dropped []*Message
+	for _, event := range events {
+		if event.QueueName == queueName && event.Action != ActionControl {
+			dropped = append(dropped, event)
+		} else {
+			kept = append(kept, event)
+		}
+	}
+	s.history.reset(kept)
+	for _, event := range dropped {
+		s.releaseEvent(event)
+	}
+
+	// Messages whose events were already evicted
+	for messageID := range s.queues[queueName] {
+		if msg, ok := s.messages[messageID]; ok {
+			s.forgetMessage(msg)
+		}
+	}
+	delete(s.queues, queueName)
+
+	delete(s.createdQueues, queueName)
+	delete(s.knownQueues, queueName)
+	delete(s.queueAttrs, queueName)
+	delete(s.dlqEdges, queueName)
+	delete(s.purges, queueName)
+	delete(s.bodySizes, queueName)
+	s.removedQueues[queueName] = true
+	s.dirty.Store(true)
+}
+
+// DeleteMessage forgets the captured message with messageID: its record,
+// its place in its queue and its receipt handles. Its events stay in
+// history, followed by a removed event noting the deletion. Only the relay
+// forgets it; nothing is sent upstream. It reports whether the message was
+// stored.
+func (s *Store) DeleteMessage(messageID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.messages[messageID]
+	if !ok {
+		return false
+	}
+	s.forgetMessage(msg)
+
+	s.appendHistory(&Message{
+		ID:        generateID(),
+		MessageID: messageID,
+		QueueURL:  msg.QueueURL,
+		QueueName: msg.QueueName,
+		Action:    ActionRemoved,
+		Timestamp: s.now(),
+		Label:     "removed from relay",
+	})
+	return true
+}
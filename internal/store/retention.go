@@ -0,0 +1,173 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionRule limits how much history is kept for queues whose name
+// matches Pattern, either exactly or as a path.Match glob. Zero limits mean
+// unlimited, so a rule with neither limit keeps everything.
+type RetentionRule struct {
+	Pattern   string
+	MaxEvents int
+	MaxAge    time.Duration
+}
+
+// ParseRetention parses a comma-separated list of pattern=limit rules, where
+// limit is an event count, a Go duration, or "all". For example
+// "critical=all,debug-*=100,*=1h" keeps everything for critical, the last 100
+// events of each debug queue, and one hour of everything else.
+func ParseRetention(spec string) ([]RetentionRule, error) {
+	var rules []RetentionRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pattern, limit, ok := strings.Cut(part, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid retention rule %q", part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid retention pattern %q: %w", pattern, err)
+		}
+
+		rule := RetentionRule{Pattern: pattern}
+		if limit != "all" {
+			if n, err := strconv.Atoi(limit); err == nil && n >= 0 {
+				rule.MaxEvents = n
+			} else if d, err := time.ParseDuration(limit); err == nil && d >= 0 {
+				rule.MaxAge = d
+			} else {
+				return nil, fmt.Errorf("invalid retention limit %q for %s", limit, pattern)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// SetRetention replaces the retention rules. The first rule matching a queue
+// applies; queues matching no rule are kept in full.
+func (s *Store) SetRetention(rules []RetentionRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retention = rules
+}
+
+// StartSweeper prunes history according to the retention rules every
+// interval. It returns a function that stops the sweeper.
+func (s *Store) StartSweeper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if n := s.Prune(); n > 0 {
+					log.Printf("Retention sweep pruned %d event(s)", n)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Prune drops history events that fall outside their queue's retention rule,
+// along with messages that no longer have any events. It returns the number
+// of events removed.
+func (s *Store) Prune() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.retention) == 0 {
+		return 0
+	}
+
+	now := s.now()
+	events := s.history.events()
+	seen := make(map[string]int) // queue -> events kept so far, newest first
+	keep := make([]bool, len(events))
+	removed := 0
+
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		rule, ok := s.retentionFor(event.QueueName)
+		if !ok {
+			keep[i] = true
+			continue
+		}
+
+		expired := rule.MaxAge > 0 && now.Sub(event.Timestamp) > rule.MaxAge
+		overflow := rule.MaxEvents > 0 && seen[event.QueueName] >= rule.MaxEvents
+		if expired || overflow {
+			removed++
+			continue
+		}
+		keep[i] = true
+		seen[event.QueueName]++
+	}
+
+	if removed == 0 {
+		return 0
+	}
+
+	kept := make([]*Message, 0, len(events)-removed)
+	for i, event := range events {
+		if keep[i] {
+			kept = append(kept, event)
+		} else {
+			s.releaseEvent(event)
+		}
+	}
+	s.history.reset(kept)
+	s.dirty.Store(true)
+	return removed
+}
+
+// retentionFor returns the first retention rule matching queueName. Callers
+// must hold the lock.
+func (s *Store) retentionFor(queueName string) (RetentionRule, bool) {
+	if queueName == "" {
+		return RetentionRule{}, false
+	}
+	for _, rule := range s.retention {
+		if rule.Pattern == queueName {
+			return rule, true
+		}
+		if ok, _ := path.Match(rule.Pattern, queueName); ok {
+			return rule, true
+		}
+	}
+	return RetentionRule{}, false
+}
+
+// forgetMessage removes a message and its receipt handles from the indexes.
+// Callers must hold the write lock.
+func (s *Store) forgetMessage(msg *Message) {
+	s.untrackMessage(msg)
+	delete(s.messages, msg.MessageID)
+	if ids := s.queues[msg.QueueName]; ids != nil {
+		delete(ids, msg.MessageID)
+		if len(ids) == 0 {
+			delete(s.queues, msg.QueueName)
+		}
+	}
+	for handle, messageID := range s.receipts {
+		if messageID == msg.MessageID {
+			delete(s.receipts, handle)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+)
+
+// DefaultBodyPreviewBytes is how much of a sampled body is kept as a preview.
+const DefaultBodyPreviewBytes = 256
+
+// SetBodySampling stores only the size, MD5 and first previewBytes of bodies
+// larger than threshold bytes; smaller bodies are stored in full. A zero
+// threshold stores every body in full.
+func (s *Store) SetBodySampling(threshold, previewBytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sampleThreshold = threshold
+	s.previewBytes = previewBytes
+}
+
+// sampleBody replaces an oversized body of msg with a preview, recording the
+// full body's size and MD5. Callers must hold the lock.
+func (s *Store) sampleBody(msg *Message) {
+	if s.sampleThreshold <= 0 || len(msg.Body) <= s.sampleThreshold {
+		return
+	}
+
+	sum := md5.Sum([]byte(msg.Body))
+	msg.BodySize = len(msg.Body)
+	msg.BodyMD5 = hex.EncodeToString(sum[:])
+	msg.BodySampled = true
+	msg.Body = msg.Body[:min(len(msg.Body), max(0, s.previewBytes))]
+	msg.CanonicalBody = ""
+}
+
+// copyBody copies the body of src, sampled or not, onto dst.
+func copyBody(dst, src *Message) {
+	dst.Body = src.Body
+	dst.CanonicalBody = src.CanonicalBody
+	dst.BodySampled = src.BodySampled
+	dst.BodySize = src.BodySize
+	dst.BodyMD5 = src.BodyMD5
+}
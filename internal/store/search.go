@@ -0,0 +1,121 @@
+package store
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SearchOptions narrow a Search. The zero value matches case-insensitive
+// substrings across all queues without a limit.
+type SearchOptions struct {
+	Regex     bool   // treat the query as a regular expression
+	QueueName string // only search messages of this queue
+	Limit     int    // at most this many results, if positive
+}
+
+// SearchResult is a stored message whose body or an attribute value
+// matched a Search; Field is "body" or "attribute:<name>".
+type SearchResult struct {
+	ID        string        `json:"id"`
+	MessageID string        `json:"messageId"`
+	QueueName string        `json:"queueName"`
+	Action    MessageAction `json:"action"`
+	Timestamp time.Time     `json:"timestamp"`
+	Field     string        `json:"field"`
+}
+
+// Search returns the stored messages whose body or an attribute value
+// contains query, newest first. Matching is case-insensitive, for regular
+// expressions too; an invalid expression is an error.
+func (s *Store) Search(query string, opts SearchOptions) ([]SearchResult, error) {
+	match, err := searchMatcher(query, opts.Regex)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []SearchResult
+	for _, msg := range s.messages {
+		if opts.QueueName != "" && msg.QueueName != opts.QueueName {
+			continue
+		}
+		field, ok := searchMessage(msg, match)
+		if !ok {
+			continue
+		}
+		result = append(result, SearchResult{
+			ID:        msg.ID,
+			MessageID: msg.MessageID,
+			QueueName: msg.QueueName,
+			Action:    msg.Action,
+			Timestamp: msg.Timestamp,
+			Field:     field,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Timestamp.After(result[j].Timestamp)
+	})
+	if opts.Limit > 0 && len(result) > opts.Limit {
+		result = result[:opts.Limit]
+	}
+	return result, nil
+}
+
+// SearchFilter returns a predicate selecting the messages or events Search
+// would match with query and opts, ignoring opts.Limit. An empty query
+// matches every message of the queue, or all if opts.QueueName is empty.
+func SearchFilter(query string, opts SearchOptions) (func(*Message) bool, error) {
+	match, err := searchMatcher(query, opts.Regex)
+	if err != nil {
+		return nil, err
+	}
+	return func(msg *Message) bool {
+		if opts.QueueName != "" && msg.QueueName != opts.QueueName {
+			return false
+		}
+		if query == "" {
+			return true
+		}
+		_, ok := searchMessage(msg, match)
+		return ok
+	}, nil
+}
+
+// searchMatcher returns a case-insensitive matcher for query.
+func searchMatcher(query string, regex bool) (func(string) bool, error) {
+	if regex {
+		re, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	query = strings.ToLower(query)
+	return func(s string) bool {
+		return strings.Contains(strings.ToLower(s), query)
+	}, nil
+}
+
+// searchMessage returns the first field of msg that satisfies match, the
+// body before attributes in name order so results are stable.
+func searchMessage(msg *Message, match func(string) bool) (string, bool) {
+	if match(msg.Body) {
+		return "body", true
+	}
+	names := make([]string, 0, len(msg.Attributes))
+	for name := range msg.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if match(msg.Attributes[name]) {
+			return "attribute:" + name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	s := New()
+	clock := newFakeClock()
+	s.SetClock(clock)
+	s.RecordSend(Meta{}, "", "orders", "m-1", `{"order":"A-100","status":"NEW"}`, map[string]string{"customer": "Acme"}, nil)
+	clock.Advance(time.Second)
+	s.RecordSend(Meta{}, "", "orders", "m-2", `{"order":"A-200","status":"paid"}`, map[string]string{"customer": "Globex"}, nil)
+	clock.Advance(time.Second)
+	s.RecordSend(Meta{}, "", "billing", "m-3", `invoice for order A-100`, nil, nil)
+
+	tests := []struct {
+		name      string
+		query     string
+		opts      SearchOptions
+		want      []string // messageId:field, newest first
+		wantError bool
+	}{
+		{"substring ignores case", "a-100", SearchOptions{}, []string{"m-3:body", "m-1:body"}, false},
+		{"attribute value", "globex", SearchOptions{}, []string{"m-2:attribute:customer"}, false},
+		{"queue filter", "a-100", SearchOptions{QueueName: "orders"}, []string{"m-1:body"}, false},
+		{"limit", "order", SearchOptions{Limit: 2}, []string{"m-3:body", "m-2:body"}, false},
+		{"regex", `A-[12]00","status":"(new|PAID)`, SearchOptions{Regex: true}, []string{"m-2:body", "m-1:body"}, false},
+		{"regex on attributes", `^acme$`, SearchOptions{Regex: true}, []string{"m-1:attribute:customer"}, false},
+		{"no match", "nothing like this", SearchOptions{}, nil, false},
+		{"regex special characters are literal in substring mode", "A-[12]00", SearchOptions{}, nil, false},
+		{"invalid regex", "(unclosed", SearchOptions{Regex: true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := s.Search(tt.query, tt.opts)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("error = %v, want error %v", err, tt.wantError)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.MessageID+":"+r.Field)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
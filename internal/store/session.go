@@ -0,0 +1,119 @@
+package store
+
+import "time"
+
+// Session is a named bucket of captured events, used to keep several test
+// scenarios apart within one relay instance.
+type Session struct {
+	Name      string     `json:"name"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	Active    bool       `json:"active"`
+	Events    int        `json:"events"`
+}
+
+// StartSession makes name the active session, ending any other active one.
+// Every event recorded from now on is tagged with it. Restarting an existing
+// session resumes it.
+func (s *Store) StartSession(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endSession()
+
+	s.session = name
+	for _, sess := range s.sessions {
+		if sess.Name == name {
+			sess.EndedAt = nil
+			return
+		}
+	}
+	s.sessions = append(s.sessions, &Session{Name: name, StartedAt: s.now()})
+}
+
+// EndSession ends the active session, if any. Subsequent events are untagged.
+func (s *Store) EndSession() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endSession()
+}
+
+func (s *Store) endSession() {
+	if s.session == "" {
+		return
+	}
+
+	now := s.now()
+	for _, sess := range s.sessions {
+		if sess.Name == s.session {
+			sess.EndedAt = &now
+		}
+	}
+	s.session = ""
+}
+
+// ActiveSession returns the name of the active session, or "" if none.
+func (s *Store) ActiveSession() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.session
+}
+
+// GetSessions returns all sessions in start order with their event counts.
+func (s *Store) GetSessions() []Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for i := 0; i < s.history.len(); i++ {
+		event := s.history.at(i)
+		if event.Session != "" {
+			counts[event.Session]++
+		}
+	}
+
+	result := make([]Session, len(s.sessions))
+	for i, sess := range s.sessions {
+		result[i] = *sess
+		result[i].Active = sess.Name == s.session
+		result[i].Events = counts[sess.Name]
+	}
+	return result
+}
+
+// HistoryQuery selects a page of history: the events matching the filter,
+// newest first, skipping Offset of them and returning at most Limit.
+type HistoryQuery struct {
+	MessageFilter
+	Offset int
+	Limit  int // no limit if not positive
+}
+
+// QueryHistory returns the events of history selected by q, newest first.
+func (s *Store) QueryHistory(q HistoryQuery) []*Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*Message
+	skipped := 0
+	for i := s.history.len() - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(result) >= q.Limit {
+			break
+		}
+		event := s.history.at(i)
+		if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+			break // history is chronological, so nothing older matches
+		}
+		if !q.Matches(event) {
+			continue
+		}
+		if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		result = append(result, event)
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultSkewThreshold is the estimated clock skew beyond which an
+	// upstream is flagged.
+	DefaultSkewThreshold = time.Second
+
+	// skewWindowSize is how many recent samples the estimate is taken from.
+	skewWindowSize = 100
+
+	// minSkewSamples is how many samples are needed before an upstream can
+	// be flagged, so a single slow round trip doesn't raise an anomaly.
+	minSkewSamples = 5
+)
+
+// ClockSkew is the estimated offset of an upstream's clock from the relay's,
+// taken as the median over recent messages of the upstream's SentTimestamp
+// minus the time the relay saw the message sent. Positive means the upstream
+// is ahead. The estimate includes part of the SendMessage round trip, so
+// only large values are meaningful.
+type ClockSkew struct {
+	Upstream  string  `json:"upstream"`
+	SkewMs    int64   `json:"skewMs"`
+	Samples   int     `json:"samples"`
+	Exceeded  bool    `json:"exceeded"`
+	Threshold float64 `json:"thresholdSeconds"`
+}
+
+// skewWindow holds an upstream's most recent skew samples.
+type skewWindow struct {
+	samples []skewSample // ring of at most skewWindowSize samples
+	next    int
+	flagged bool
+}
+
+type skewSample struct {
+	messageID string
+	offset    time.Duration
+}
+
+// SetSkewThreshold sets the estimated clock skew beyond which an upstream is
+// flagged. Zero disables flagging.
+func (s *Store) SetSkewThreshold(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.skewThreshold = d
+}
+
+// RecordSentTimestamp compares the SentTimestamp upstream reported for a
+// received message with when the relay saw it sent. Messages the relay
+// didn't see sent are ignored, as are repeat receives of a message already
+// sampled.
+func (s *Store) RecordSentTimestamp(upstream, messageID string, sentAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.messages[messageID]
+	if !ok || msg.Action != ActionSend || msg.Upstream != upstream {
+		return
+	}
+
+	w := s.clockSkew[upstream]
+	if w == nil {
+		w = &skewWindow{}
+		s.clockSkew[upstream] = w
+	}
+	for _, sample := range w.samples {
+		if sample.messageID == messageID {
+			return
+		}
+	}
+
+	sample := skewSample{messageID: messageID, offset: sentAt.Sub(msg.Timestamp)}
+	if len(w.samples) < skewWindowSize {
+		w.samples = append(w.samples, sample)
+	} else {
+		w.samples[w.next] = sample
+		w.next = (w.next + 1) % skewWindowSize
+	}
+
+	skew := w.estimate()
+	exceeded := s.skewExceeded(skew, len(w.samples))
+	if exceeded && !w.flagged {
+		s.addAnomaly(AnomalyClockSkew, msg.QueueName, fmt.Sprintf("Upstream %s clock differs from the relay's by about %s", upstream, skew.Round(time.Millisecond)))
+	}
+	w.flagged = exceeded
+}
+
+// GetClockSkew returns the skew estimate of each upstream with samples.
+func (s *Store) GetClockSkew() []ClockSkew {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]ClockSkew, 0, len(s.clockSkew))
+	for upstream, w := range s.clockSkew {
+		skew := w.estimate()
+		result = append(result, ClockSkew{
+			Upstream:  upstream,
+			SkewMs:    skew.Milliseconds(),
+			Samples:   len(w.samples),
+			Exceeded:  s.skewExceeded(skew, len(w.samples)),
+			Threshold: s.skewThreshold.Seconds(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Upstream < result[j].Upstream
+	})
+	return result
+}
+
+// skewExceeded reports whether skew, estimated from n samples, is beyond the
+// threshold. Callers must hold the lock.
+func (s *Store) skewExceeded(skew time.Duration, n int) bool {
+	if s.skewThreshold <= 0 || n < minSkewSamples {
+		return false
+	}
+	return skew > s.skewThreshold || skew < -s.skewThreshold
+}
+
+// estimate returns the median offset of the window's samples.
+func (w *skewWindow) estimate() time.Duration {
+	if len(w.samples) == 0 {
+		return 0
+	}
+	offsets := make([]time.Duration, len(w.samples))
+	for i, sample := range w.samples {
+		offsets[i] = sample.offset
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	mid := len(offsets) / 2
+	if len(offsets)%2 == 0 {
+		return (offsets[mid-1] + offsets[mid]) / 2
+	}
+	return offsets[mid]
+}
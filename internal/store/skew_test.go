@@ -0,0 +1,74 @@
+package store
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClockSkewConverges(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+	const upstream = "http://localhost:4566"
+	const skew = 3 * time.Second
+
+	// Each SentTimestamp is 3s ahead of the relay, give or take a round
+	// trip, with the occasional wild outlier
+	jitter := []int{-200, 150, 0, 300, -100, 40 * 1000, 120, -250}
+	for i := 0; i < 40; i++ {
+		id := "m-" + strconv.Itoa(i)
+		s.RecordSend(Meta{Upstream: upstream}, "", "orders", id, "hi", nil, nil)
+		sentAt := clock.Now().Add(skew + time.Duration(jitter[i%len(jitter)])*time.Millisecond)
+		clock.Advance(time.Second)
+		s.RecordSentTimestamp(upstream, id, sentAt)
+
+		estimates := s.GetClockSkew()
+		if len(estimates) != 1 {
+			t.Fatalf("estimates = %+v, want one upstream", estimates)
+		}
+		if got := estimates[0]; got.Samples >= minSkewSamples && !got.Exceeded {
+			t.Errorf("after %d samples skew %dms not flagged", got.Samples, got.SkewMs)
+		}
+	}
+
+	got := s.GetClockSkew()[0]
+	if got.Samples != 40 {
+		t.Errorf("samples = %d, want 40", got.Samples)
+	}
+	if diff := time.Duration(got.SkewMs)*time.Millisecond - skew; diff < -100*time.Millisecond || diff > 100*time.Millisecond {
+		t.Errorf("estimate = %dms, want about %dms", got.SkewMs, skew.Milliseconds())
+	}
+
+	// A skew that persists is flagged once
+	flagged := 0
+	for _, a := range s.GetAnomalies() {
+		if a.Kind == AnomalyClockSkew {
+			flagged++
+		}
+	}
+	if flagged != 1 {
+		t.Errorf("clock skew flagged %d times, want once", flagged)
+	}
+}
+
+func TestClockSkewIgnoresUnusableSamples(t *testing.T) {
+	s := New()
+	const upstream = "http://localhost:4566"
+	s.RecordSend(Meta{Upstream: upstream}, "", "orders", "m-1", "hi", nil, nil)
+	s.RecordReceive(Meta{Upstream: upstream}, "", "orders", "m-2", "r-2", "sent elsewhere", nil, nil)
+
+	s.RecordSentTimestamp(upstream, "m-1", time.Now())
+	s.RecordSentTimestamp(upstream, "m-1", time.Now().Add(time.Hour)) // repeat receive
+	s.RecordSentTimestamp(upstream, "m-2", time.Now())                // never seen sent
+	s.RecordSentTimestamp("http://other:4566", "m-1", time.Now())     // another upstream
+	s.RecordSentTimestamp(upstream, "m-unknown", time.Now())
+
+	estimates := s.GetClockSkew()
+	if len(estimates) != 1 || estimates[0].Samples != 1 {
+		t.Errorf("estimates = %+v, want one sample of %s", estimates, upstream)
+	}
+	if estimates[0].Exceeded {
+		t.Error("flagged on fewer than the minimum samples")
+	}
+}
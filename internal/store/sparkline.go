@@ -0,0 +1,46 @@
+package store
+
+import "time"
+
+// Sparkline returns the number of events per bucket over the trailing window,
+// oldest bucket first. The result always has exactly buckets entries, or
+// none if buckets isn't positive. An empty queueName counts events for all
+// queues.
+func (s *Store) Sparkline(queueName string, window time.Duration, buckets int) []int {
+	if buckets <= 0 {
+		return []int{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make([]int, buckets)
+	if window <= 0 {
+		return counts
+	}
+
+	end := s.now()
+	start := end.Add(-window)
+	width := window / time.Duration(buckets)
+	if width <= 0 {
+		width = 1
+	}
+
+	// History is chronological, so walk back from the newest event until we
+	// leave the window.
+	for i := s.history.len() - 1; i >= 0; i-- {
+		event := s.history.at(i)
+		if event.Timestamp.Before(start) {
+			break
+		}
+		if event.Action == ActionMarker || queueName != "" && event.QueueName != queueName {
+			continue
+		}
+		idx := int(event.Timestamp.Sub(start) / width)
+		if idx >= buckets {
+			idx = buckets - 1
+		}
+		counts[idx]++
+	}
+	return counts
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	s := New()
+	clock := newFakeClock()
+	s.SetClock(clock)
+
+	// One send 50s ago and two 5s ago, on two queues
+	s.RecordSend(Meta{}, "", "orders", "m-1", "a", nil, nil)
+	clock.Advance(45 * time.Second)
+	s.RecordSend(Meta{}, "", "orders", "m-2", "b", nil, nil)
+	s.RecordSend(Meta{}, "", "billing", "m-3", "c", nil, nil)
+	clock.Advance(5 * time.Second)
+
+	tests := []struct {
+		name    string
+		queue   string
+		window  time.Duration
+		buckets int
+		want    []int
+	}{
+		{"all queues", "", time.Minute, 6, []int{0, 1, 0, 0, 0, 2}},
+		{"one queue", "orders", time.Minute, 6, []int{0, 1, 0, 0, 0, 1}},
+		{"short window", "", 30 * time.Second, 3, []int{0, 0, 2}},
+		{"no window", "", 0, 3, []int{0, 0, 0}},
+		{"zero buckets", "", time.Minute, 0, []int{}},
+		{"negative buckets", "", time.Minute, -1, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.Sparkline(tt.queue, tt.window, tt.buckets)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sparkline(%q, %s, %d) = %v, want %v", tt.queue, tt.window, tt.buckets, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package store
+
+import "time"
+
+// queueCounts are the running totals behind a queue's QueueStats, kept up to
+// date as events enter and leave history so GetQueueStats needn't rescan it.
+type queueCounts struct {
+	url    string
+	events int // events of any action in history
+
+	sent, received, deleted int // events of each action in history
+
+	pending int                  // captured messages not yet deleted
+	acked   int                  // received messages since deleted
+	unacked map[string]time.Time // received, undeleted messageId -> last receive
+
+	redelivered  int // captured messages received more than once
+	receivedOnly int // captured messages first seen in a receive
+}
+
+// countsFor returns the running totals of queueName, creating them if
+// needed. Callers must hold the write lock.
+func (s *Store) countsFor(queueName string) *queueCounts {
+	c, ok := s.queueCounts[queueName]
+	if !ok {
+		c = &queueCounts{unacked: make(map[string]time.Time)}
+		s.queueCounts[queueName] = c
+	}
+	return c
+}
+
+// countHistoryEvent adds (delta 1) or removes (delta -1) event from its
+// queue's event totals. Callers must hold the write lock.
+func (s *Store) countHistoryEvent(event *Message, delta int) {
+	if event.Action == ActionPublish {
+		s.countPublish(event, delta)
+		return
+	}
+	if event.QueueName == "" {
+		return // markers belong to no queue
+	}
+	if delta > 0 && event.Action != ActionRemoved && !(event.Action == ActionControl && event.Operation != "CreateQueue") {
+		delete(s.removedQueues, event.QueueName) // back in use
+	}
+	c := s.countsFor(event.QueueName)
+	if c.url == "" {
+		c.url = event.QueueURL
+	}
+	c.events += delta
+	switch event.Action {
+	case ActionSend:
+		c.sent += delta
+	case ActionReceive:
+		c.received += delta
+	case ActionDelete:
+		c.deleted += delta
+	}
+	s.dropIfEmpty(event.QueueName, c)
+}
+
+// dropIfEmpty forgets the totals of a queue with nothing left to count.
+// Callers must hold the write lock.
+func (s *Store) dropIfEmpty(queueName string, c *queueCounts) {
+	if c.events <= 0 && c.pending <= 0 && c.acked <= 0 && c.redelivered <= 0 && c.receivedOnly <= 0 && len(c.unacked) == 0 {
+		delete(s.queueCounts, queueName)
+	}
+}
+
+// trackMessage counts a newly captured message. Callers must hold the write
+// lock.
+func (s *Store) trackMessage(msg *Message) {
+	c := s.countsFor(msg.QueueName)
+	if !msg.Deleted {
+		c.pending++
+	}
+	if msg.ReceiveCount > 1 {
+		c.redelivered++
+	}
+	if msg.ReceivedOnly {
+		c.receivedOnly++
+	}
+}
+
+// untrackMessage stops counting a message that is being forgotten. Callers
+// must hold the write lock.
+func (s *Store) untrackMessage(msg *Message) {
+	c, ok := s.queueCounts[msg.QueueName]
+	if !ok {
+		return
+	}
+	if msg.ReceiveCount > 1 {
+		c.redelivered--
+	}
+	if msg.ReceivedOnly {
+		c.receivedOnly--
+	}
+	if msg.Deleted {
+		if msg.LastReceivedAt != nil && !msg.Purged {
+			c.acked--
+		}
+	} else {
+		c.pending--
+		delete(c.unacked, msg.MessageID)
+	}
+	s.dropIfEmpty(msg.QueueName, c)
+}
+
+// trackReceive notes that msg was received at receivedAt. Callers must hold
+// the write lock.
+func (s *Store) trackReceive(msg *Message, receivedAt time.Time) {
+	if !msg.Deleted {
+		s.countsFor(msg.QueueName).unacked[msg.MessageID] = receivedAt
+	}
+}
+
+// trackDelete notes that msg, previously undeleted, was deleted. Callers
+// must hold the write lock.
+func (s *Store) trackDelete(msg *Message) {
+	c := s.countsFor(msg.QueueName)
+	c.pending--
+	if _, ok := c.unacked[msg.MessageID]; ok {
+		delete(c.unacked, msg.MessageID)
+		c.acked++
+	}
+}
+
+// trackPurge notes that msg, previously undeleted, was purged. Unlike a
+// delete, a purge doesn't acknowledge a received message. Callers must hold
+// the write lock.
+func (s *Store) trackPurge(msg *Message) {
+	c := s.countsFor(msg.QueueName)
+	c.pending--
+	delete(c.unacked, msg.MessageID)
+}
+
+// rebuildQueueCounts recomputes every queue's running totals from history
+// and the captured messages, after they were replaced wholesale. Callers
+// must hold the write lock.
+func (s *Store) rebuildQueueCounts() {
+	s.queueCounts = make(map[string]*queueCounts)
+	s.topicCounts = make(map[string]int)
+	s.bodySizes = make(map[string]*bodySizes)
+	for i := 0; i < s.history.len(); i++ {
+		event := s.history.at(i)
+		s.countHistoryEvent(event, 1)
+		if event.Action == ActionSend {
+			s.countBodySize(event.QueueName, sentBodySize(event))
+		}
+	}
+	for _, msg := range s.messages {
+		s.trackMessage(msg)
+		if msg.LastReceivedAt == nil {
+			continue
+		}
+		if msg.Deleted {
+			if !msg.Purged {
+				s.countsFor(msg.QueueName).acked++
+			}
+		} else {
+			s.trackReceive(msg, *msg.LastReceivedAt)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rescanStats recomputes the running totals of GetQueueStats the slow way,
+// from history and the captured messages.
+func rescanStats(s *Store) map[string]QueueStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := make(map[string]QueueStats)
+	get := func(queueName string) QueueStats {
+		qs, ok := stats[queueName]
+		if !ok {
+			qs = QueueStats{QueueName: queueName}
+		}
+		return qs
+	}
+	for _, event := range s.history.events() {
+		if event.QueueName == "" || event.Action == ActionPublish {
+			continue
+		}
+		qs := get(event.QueueName)
+		switch event.Action {
+		case ActionSend:
+			qs.TotalSent++
+		case ActionReceive:
+			qs.TotalReceived++
+		case ActionDelete:
+			qs.TotalDeleted++
+		}
+		stats[event.QueueName] = qs
+	}
+
+	now := s.now()
+	cutoff := now.Add(-s.ackGrace)
+	acked := make(map[string]int)
+	settled := make(map[string]int)
+	for _, msg := range s.messages {
+		qs, ok := stats[msg.QueueName]
+		if !ok {
+			continue // no events left, so not listed
+		}
+		if !msg.Deleted {
+			qs.Pending++
+			if msg.InFlight(now) {
+				qs.InFlight++
+			}
+		}
+		if msg.ReceiveCount > 1 {
+			qs.Redelivered++
+		}
+		if msg.ReceivedOnly {
+			qs.ReceivedOnly++
+		}
+		if msg.LastReceivedAt != nil {
+			if msg.Deleted && !msg.Purged {
+				acked[msg.QueueName]++
+				settled[msg.QueueName]++
+			} else if !msg.Deleted && msg.LastReceivedAt.Before(cutoff) {
+				settled[msg.QueueName]++
+			}
+		}
+		stats[msg.QueueName] = qs
+	}
+	for queueName, n := range settled {
+		if qs, ok := stats[queueName]; ok && n > 0 {
+			ratio := float64(acked[queueName]) / float64(n)
+			qs.AckRatio = &ratio
+			stats[queueName] = qs
+		}
+	}
+	return stats
+}
+
+// runningTotals returns the fields of GetQueueStats kept as running totals,
+// by queue.
+func runningTotals(s *Store) map[string]QueueStats {
+	stats := make(map[string]QueueStats)
+	for _, qs := range s.GetQueueStats() {
+		if qs.TotalSent+qs.TotalReceived+qs.TotalDeleted+qs.Pending == 0 && qs.QueueURL == "" {
+			continue // listed for a create or purge alone
+		}
+		stats[qs.QueueName] = QueueStats{
+			QueueName:     qs.QueueName,
+			TotalSent:     qs.TotalSent,
+			TotalReceived: qs.TotalReceived,
+			TotalDeleted:  qs.TotalDeleted,
+			Pending:       qs.Pending,
+			InFlight:      qs.InFlight,
+			Redelivered:   qs.Redelivered,
+			ReceivedOnly:  qs.ReceivedOnly,
+			AckRatio:      qs.AckRatio,
+		}
+	}
+	return stats
+}
+
+func checkStatsMatchRescan(t *testing.T, stage string, s *Store) {
+	t.Helper()
+	got, want := runningTotals(s), rescanStats(s)
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !reflect.DeepEqual(got[name], want[name]) {
+			t.Errorf("%s: %s stats = %+v, rescan = %+v", stage, name, got[name], want[name])
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s: stats list %s, which has no events in history", stage, name)
+		}
+	}
+}
+
+func TestQueueStatsMatchHistoryRescan(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+	s.SetAckGrace(time.Minute)
+	step := func() { clock.Advance(time.Second) }
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	const auditURL = "http://localhost:4566/000000000000/audit"
+
+	for _, id := range []string{"m-1", "m-2", "m-3", "m-4"} {
+		s.RecordSend(Meta{}, ordersURL, "orders", id, "body of "+id, nil, nil)
+		step()
+	}
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-1", "r-1", "body of m-1", nil, nil)
+	step()
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-2", "r-2a", "body of m-2", nil, nil)
+	step()
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-2", "r-2b", "body of m-2", nil, nil)
+	step()
+	s.RecordReceive(Meta{}, ordersURL, "orders", "m-9", "r-9", "sent before the capture", nil, nil)
+	step()
+	s.RecordDelete(Meta{}, ordersURL, "orders", "r-1")
+	step()
+	s.RecordDelete(Meta{}, ordersURL, "orders", "r-unknown")
+	step()
+	s.RecordSend(Meta{}, auditURL, "audit", "a-1", "audit", nil, nil)
+	step()
+	s.RecordReceive(Meta{}, auditURL, "audit", "a-1", "r-a1", "audit", nil, nil)
+	step()
+	checkStatsMatchRescan(t, "after traffic", s)
+
+	s.RecordPurge(Meta{}, auditURL, "audit")
+	step()
+	checkStatsMatchRescan(t, "after purge", s)
+
+	// Receives age past the ack grace, settling unacknowledged
+	clock.Advance(2 * time.Minute)
+	checkStatsMatchRescan(t, "after the ack grace", s)
+
+	// Shrinking history evicts the oldest sends and the messages left
+	// without events
+	s.SetMaxHistory(8)
+	checkStatsMatchRescan(t, "after SetMaxHistory", s)
+	for i := 0; i < 6; i++ {
+		s.RecordSend(Meta{}, ordersURL, "orders", "n-"+string(rune('a'+i)), "more", nil, nil)
+		step()
+	}
+	checkStatsMatchRescan(t, "after eviction", s)
+
+	// Importing an export rebuilds the totals from scratch
+	history := s.GetHistory(0)
+	exported := make([]*Message, len(history))
+	for i, event := range history {
+		copied := *event
+		exported[i] = &copied
+	}
+	imported := New()
+	imported.SetClock(clock)
+	imported.SetAckGrace(time.Minute)
+	if _, err := imported.Import(exported); err != nil {
+		t.Fatal(err)
+	}
+	checkStatsMatchRescan(t, "after import", imported)
+}
+
+func TestPendingFollowsDeletesAndRemoves(t *testing.T) {
+	s := New()
+	const ordersURL = "http://localhost:4566/000000000000/orders"
+	for _, id := range []string{"m-1", "m-2", "m-3", "m-4"} {
+		s.RecordSend(Meta{}, ordersURL, "orders", id, "body of "+id, nil, nil)
+	}
+	pending := func() int { return queueStats(t, s, "orders").Pending }
+	if got := pending(); got != 4 {
+		t.Fatalf("pending after sends = %d, want 4", got)
+	}
+
+	steps := []struct {
+		name string
+		do   func()
+		want int
+	}{
+		{"delete", func() {
+			s.RecordReceive(Meta{}, ordersURL, "orders", "m-1", "r-1", "body of m-1", nil, nil)
+			s.RecordDelete(Meta{}, ordersURL, "orders", "r-1")
+		}, 3},
+		{"repeated delete", func() { s.RecordDelete(Meta{}, ordersURL, "orders", "r-1") }, 3},
+		{"delete of an unknown handle", func() { s.RecordDelete(Meta{}, ordersURL, "orders", "r-unknown") }, 3},
+		{"remove", func() { s.DeleteMessage("m-2") }, 2},
+		{"remove of a deleted message", func() { s.DeleteMessage("m-1") }, 2},
+		{"receive", func() { s.RecordReceive(Meta{}, ordersURL, "orders", "m-3", "r-3", "body of m-3", nil, nil) }, 2},
+	}
+	for _, step := range steps {
+		step.do()
+		if got := pending(); got != step.want {
+			t.Errorf("pending after %s = %d, want %d", step.name, got, step.want)
+		}
+		checkStatsMatchRescan(t, step.name, s)
+	}
+}
+
+// BenchmarkQueueStats compares rescanning history for queue stats, as
+// GetQueueStats once did, with reading the running totals.
+func TestAckRatio(t *testing.T) {
+	clock := newFakeClock()
+	s := New()
+	s.SetClock(clock)
+	receive := func(id string) {
+		s.RecordSend(Meta{}, "", "orders", id, "body", nil, nil)
+		s.RecordReceive(Meta{}, "", "orders", id, "r-"+id, "body", nil, nil)
+	}
+	ackRatio := func() *float64 { return queueStats(t, s, "orders").AckRatio }
+
+	// Three acked, one abandoned, and one received just now
+	for _, id := range []string{"a-1", "a-2", "a-3", "abandoned"} {
+		receive(id)
+	}
+	for _, id := range []string{"a-1", "a-2", "a-3"} {
+		s.RecordDelete(Meta{}, "", "orders", "r-"+id)
+	}
+	clock.Advance(DefaultAckGrace + time.Second)
+	receive("in-flight")
+
+	if got := ackRatio(); got == nil || *got != 0.75 {
+		t.Fatalf("ack ratio = %v, want 0.75 with the in-flight receive left out", got)
+	}
+
+	// Once its grace period is over, the in-flight receive counts against it
+	clock.Advance(DefaultAckGrace + time.Second)
+	if got := ackRatio(); got == nil || *got != 0.6 {
+		t.Errorf("ack ratio = %v, want 0.6 once the grace period is over", got)
+	}
+	s.RecordDelete(Meta{}, "", "orders", "r-in-flight")
+	if got := ackRatio(); got == nil || *got != 0.8 {
+		t.Errorf("ack ratio = %v, want 0.8 after a late delete", got)
+	}
+
+	s.RecordSend(Meta{}, "", "quiet", "q-1", "body", nil, nil)
+	if got := queueStats(t, s, "quiet").AckRatio; got != nil {
+		t.Errorf("ack ratio of a queue with no receives = %v, want none", *got)
+	}
+}
+
+func BenchmarkQueueStats(b *testing.B) {
+	s := New()
+	for q := 0; q < 10; q++ {
+		queueName := "queue-" + strconv.Itoa(q)
+		for i := 0; i < 1000; i++ {
+			id := queueName + "-m-" + strconv.Itoa(i)
+			s.RecordSend(Meta{}, "", queueName, id, "body", nil, nil)
+			s.RecordReceive(Meta{}, "", queueName, id, "r-"+id, "body", nil, nil)
+			if i%2 == 0 {
+				s.RecordDelete(Meta{}, "", queueName, "r-"+id)
+			}
+		}
+	}
+
+	b.Run("rescan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rescanStats(s)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.GetQueueStats()
+		}
+	})
+}
+
+func TestQueueColorStable(t *testing.T) {
+	if a, b := QueueColor("orders"), QueueColor("orders"); a != b {
+		t.Fatalf("QueueColor(orders) = %q then %q", a, b)
+	}
+	if QueueColor("orders") == QueueColor("payments") {
+		t.Errorf("orders and payments share colour %q", QueueColor("orders"))
+	}
+
+	// A queue's colour doesn't depend on which other queues exist
+	s := New()
+	s.RecordSend(Meta{}, "", "orders", "m-1", "body", nil, nil)
+	alone := queueStats(t, s, "orders").Color
+	s.RecordSend(Meta{}, "", "alpha", "m-2", "body", nil, nil)
+	s.RecordSend(Meta{}, "", "zulu", "m-3", "body", nil, nil)
+	if got := queueStats(t, s, "orders").Color; got != alone || got != QueueColor("orders") {
+		t.Errorf("orders colour = %q after other queues appeared, want %q", got, alone)
+	}
+	if got := queueStats(t, s, "alpha").Color; !strings.HasPrefix(got, "hsl(") {
+		t.Errorf("alpha colour = %q, want an hsl() colour", got)
+	}
+}
@@ -1,7 +1,10 @@
 package store
 
 import (
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,6 +14,41 @@ const (
 	ActionSend    MessageAction = "send"
 	ActionReceive MessageAction = "receive"
 	ActionDelete  MessageAction = "delete"
+
+	// ActionControl events record control-plane calls such as CreateQueue;
+	// Operation holds the SQS action.
+	ActionControl MessageAction = "control"
+
+	// ActionChangeVisibility events record a ChangeMessageVisibility;
+	// VisibilityTimeout holds the requested timeout.
+	ActionChangeVisibility MessageAction = "change_visibility"
+
+	// ActionFault events record an injected fault: a call the relay
+	// answered with an error instead of forwarding. Operation holds the SQS
+	// action.
+	ActionFault MessageAction = "fault"
+
+	// ActionMarker events are free-form timeline annotations with no queue;
+	// Label holds the text.
+	ActionMarker MessageAction = "marker"
+
+	// ActionPublish events record an SNS Publish; TopicArn holds the topic
+	// and there is no queue.
+	ActionPublish MessageAction = "publish"
+
+	// ActionPurge events record a PurgeQueue; PurgedCount holds how many
+	// captured messages it removed.
+	ActionPurge MessageAction = "purge"
+
+	// ActionRemoved events note a message removed from the relay with
+	// DeleteMessage. They are not SQS traffic: the upstream still has it.
+	ActionRemoved MessageAction = "removed"
+
+	// ActionGeneric events record a call the relay doesn't parse, such as
+	// one to DynamoDB or S3; Service, HTTPMethod, HTTPPath and HTTPStatus
+	// describe it and Body holds the start of its request body. There is
+	// no queue.
+	ActionGeneric MessageAction = "generic"
 )
 
 type Message struct {
@@ -25,38 +63,351 @@ type Message struct {
 	Timestamp     time.Time         `json:"timestamp"`
 	Deleted       bool              `json:"deleted"`
 	DeletedAt     *time.Time        `json:"deletedAt,omitempty"`
+	Session       string            `json:"session,omitempty"`
+
+	// AttributeTypes is the DataType of each of Attributes. The values of
+	// Binary attributes are base64 encoded.
+	AttributeTypes map[string]string `json:"attributeTypes,omitempty"`
+	// MessageSystemAttributes holds SendMessage system attributes such as
+	// AWSTraceHeader, kept apart from the user-defined Attributes.
+	MessageSystemAttributes map[string]string `json:"messageSystemAttributes,omitempty"`
+	// CanonicalBody is the body with sorted keys and normalised whitespace,
+	// set when canonical JSON is enabled and the body is a JSON document.
+	CanonicalBody string `json:"canonicalBody,omitempty"`
+	// SystemAttributes are the SQS attributes a ReceiveMessage returned,
+	// such as SentTimestamp and ApproximateReceiveCount. A stored message
+	// keeps those of its latest receive that returned any.
+	SystemAttributes map[string]string `json:"systemAttributes,omitempty"`
+	// TraceID is the relay-generated ID of the proxied call that produced
+	// this event.
+	TraceID string `json:"traceId,omitempty"`
+	// LastReceivedAt is when the message was most recently received.
+	LastReceivedAt *time.Time `json:"lastReceivedAt,omitempty"`
+	// ReceiveCount is how many times the message was received; more than
+	// one means it was redelivered.
+	ReceiveCount int `json:"receiveCount,omitempty"`
+	// Tags are user-assigned labels, set from the dashboard.
+	Tags []string `json:"tags,omitempty"`
+	// Notes are free-form annotations, set from the dashboard. Like tags,
+	// they don't affect SQS semantics and last as long as the message.
+	Notes []string `json:"notes,omitempty"`
+	// ReceiptHandles lists every receipt handle the message was received
+	// with, oldest first.
+	ReceiptHandles []string `json:"receiptHandles,omitempty"`
+	// StaleHandle marks a delete that used a receipt handle other than the
+	// message's latest.
+	StaleHandle bool `json:"staleHandle,omitempty"`
+	// MirroredAs is the message ID of the copy sent to the shadow queue, and
+	// MirrorError why sending the copy failed.
+	MirroredAs  string `json:"mirroredAs,omitempty"`
+	MirrorError string `json:"mirrorError,omitempty"`
+	// Operation is the SQS action of a control event.
+	Operation string `json:"operation,omitempty"`
+	// PartialCapture marks events parsed from a response that exceeded the
+	// capture limit, which may therefore be missing data.
+	PartialCapture bool `json:"partialCapture,omitempty"`
+	// Uninspected marks a generic event for a call whose request body was
+	// beyond the JSON limits, so it was kept raw rather than parsed.
+	Uninspected bool `json:"uninspected,omitempty"`
+	// MessageGroupID is the FIFO message group a send named.
+	MessageGroupID string `json:"messageGroupId,omitempty"`
+	// MessageDeduplicationID is the FIFO deduplication ID a send named, and
+	// SequenceNumber the position in its group SQS assigned the message.
+	MessageDeduplicationID string `json:"messageDeduplicationId,omitempty"`
+	SequenceNumber         string `json:"sequenceNumber,omitempty"`
+	// RequestedAttributeNames and RequestedMessageAttributeNames are the
+	// attributes the ReceiveMessage behind a receive event asked for; SQS
+	// returns no others.
+	RequestedAttributeNames        []string `json:"requestedAttributeNames,omitempty"`
+	RequestedMessageAttributeNames []string `json:"requestedMessageAttributeNames,omitempty"`
+	// BodySampled marks a body above the sampling threshold: Body holds
+	// only a preview, and BodySize and BodyMD5 describe the full body.
+	BodySampled bool   `json:"bodySampled,omitempty"`
+	BodySize    int    `json:"bodySize,omitempty"`
+	BodyMD5     string `json:"bodyMd5,omitempty"`
+	// ReceiveRequestAttemptID is the FIFO deduplication ID of the
+	// ReceiveMessage behind a receive event, and AttemptReused marks a
+	// receive whose attempt ID an earlier call already used.
+	ReceiveRequestAttemptID string `json:"receiveRequestAttemptId,omitempty"`
+	AttemptReused           bool   `json:"attemptReused,omitempty"`
+	// ListenAddr is the relay address the call arrived on and Upstream the
+	// endpoint it was forwarded to; for a message, those of the call it
+	// was first seen in.
+	ListenAddr string `json:"listenAddr,omitempty"`
+	Upstream   string `json:"upstream,omitempty"`
+	// VisibilityTimeout is the timeout, in seconds, a receive or
+	// visibility change requested, and InFlightUntil when the message
+	// becomes visible again after its latest receive or change.
+	VisibilityTimeout *int       `json:"visibilityTimeout,omitempty"`
+	InFlightUntil     *time.Time `json:"inFlightUntil,omitempty"`
+	// FaultStatus and FaultCode are the error a fault event returned in
+	// place of the upstream's response.
+	FaultStatus int    `json:"faultStatus,omitempty"`
+	FaultCode   string `json:"faultCode,omitempty"`
+	// Label is the text of a marker or removed event.
+	Label string `json:"label,omitempty"`
+	// TopicArn is the SNS topic of a publish event or, with SNSMessageID,
+	// the topic and publish a received SNS notification came from.
+	TopicArn     string `json:"topicArn,omitempty"`
+	SNSMessageID string `json:"snsMessageId,omitempty"`
+	// Purged marks a message removed by PurgeQueue rather than deleted by
+	// a consumer, and PurgedCount is the number removed by a purge event.
+	Purged      bool `json:"purged,omitempty"`
+	PurgedCount int  `json:"purgedCount,omitempty"`
+	// ReplayOf is the message ID a send replayed from the dashboard copied.
+	ReplayOf string `json:"replayOf,omitempty"`
+	// ReceivedOnly marks a message first seen in a receive: sent before
+	// the relay was watching, or by a client not going through it.
+	ReceivedOnly bool `json:"receivedOnly,omitempty"`
+	// DeadLetter marks a message first seen in a dead-letter queue, and the
+	// event it was seen in, and links it to its original.
+	DeadLetter *DLQArrival `json:"deadLetter,omitempty"`
+	// Service is the AWS service of a generic event, and HTTPMethod,
+	// HTTPPath and HTTPStatus the request line and status of its call.
+	Service    string `json:"service,omitempty"`
+	HTTPMethod string `json:"httpMethod,omitempty"`
+	HTTPPath   string `json:"httpPath,omitempty"`
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+}
+
+// IsBinaryType reports whether an attribute DataType, such as "Binary" or
+// the custom "Binary.gzip", holds a binary value.
+func IsBinaryType(dataType string) bool {
+	return dataType == "Binary" || strings.HasPrefix(dataType, "Binary.")
+}
+
+// Meta describes the proxied call an event was captured from.
+type Meta struct {
+	TraceID        string
+	Partial        bool   // only part of the response was inspected
+	Uninspected    bool   // request body beyond the JSON limits, kept raw
+	MessageGroupID string // FIFO message group of a SendMessage
+
+	// ReceiveRequestAttemptId of a FIFO ReceiveMessage
+	ReceiveRequestAttemptID string
+
+	ListenAddr string // relay address the call arrived on
+	Upstream   string // endpoint the call was forwarded to
+
+	// VisibilityTimeout a ReceiveMessage asked for, in seconds
+	VisibilityTimeout *int
+
+	// DataType of each message attribute of a SendMessage (entry),
+	// received message or Publish
+	AttributeTypes map[string]string
+
+	ReplayOf string // message a relay-issued replay send copied
+
+	// FIFO deduplication ID and sequence number of a SendMessage (entry)
+	MessageDeduplicationID string
+	SequenceNumber         string
+
+	// Attribute names a ReceiveMessage asked for
+	RequestedAttributeNames        []string
+	RequestedMessageAttributeNames []string
+}
+
+func (m Meta) apply(msg *Message) {
+	msg.TraceID = m.TraceID
+	msg.PartialCapture = m.Partial
+	msg.Uninspected = m.Uninspected
+	msg.MessageGroupID = m.MessageGroupID
+	msg.RequestedAttributeNames = m.RequestedAttributeNames
+	msg.RequestedMessageAttributeNames = m.RequestedMessageAttributeNames
+	msg.ReceiveRequestAttemptID = m.ReceiveRequestAttemptID
+	msg.ListenAddr = m.ListenAddr
+	msg.Upstream = m.Upstream
+	msg.VisibilityTimeout = m.VisibilityTimeout
+	msg.AttributeTypes = m.AttributeTypes
+	msg.ReplayOf = m.ReplayOf
+	msg.MessageDeduplicationID = m.MessageDeduplicationID
+	msg.SequenceNumber = m.SequenceNumber
 }
 
 type QueueStats struct {
 	QueueName     string `json:"queueName"`
 	QueueURL      string `json:"queueUrl"`
+	Color         string `json:"color"`
 	TotalSent     int    `json:"totalSent"`
 	TotalReceived int    `json:"totalReceived"`
 	TotalDeleted  int    `json:"totalDeleted"`
 	Pending       int    `json:"pending"`
+	InFlight      int    `json:"inFlight"`
+	Redelivered   int    `json:"redelivered"` // messages received more than once
+
+	// ReceivedOnly is the number of captured messages first seen in a
+	// receive, whose send the relay never saw. They count towards Pending
+	// until deleted, but not towards TotalSent.
+	ReceivedOnly int `json:"receivedOnly"`
+
+	// AvgBodyBytes and MaxBodyBytes are the average and largest body sent
+	// to the queue since the last clear.
+	AvgBodyBytes int `json:"avgBodyBytes"`
+	MaxBodyBytes int `json:"maxBodyBytes"`
+
+	// Message counts last reported upstream by GetQueueAttributes, and
+	// whether they disagree with Pending (the relay missed some traffic).
+	UpstreamApproximate *int `json:"upstreamApproximate,omitempty"`
+	UpstreamNotVisible  *int `json:"upstreamNotVisible,omitempty"`
+	UpstreamDelayed     *int `json:"upstreamDelayed,omitempty"`
+	Discrepancy         bool `json:"discrepancy"`
+
+	// The queue's configuration as last observed in GetQueueAttributes
+	// responses and queue configuration requests: its visibility timeout
+	// in seconds, and the DLQ its redrive policy targets after
+	// MaxReceiveCount receives.
+	VisibilityTimeout    *int       `json:"visibilityTimeout,omitempty"`
+	DeadLetterQueue      string     `json:"deadLetterQueue,omitempty"`
+	MaxReceiveCount      int        `json:"maxReceiveCount,omitempty"`
+	AttributesObservedAt *time.Time `json:"attributesObservedAt,omitempty"`
+
+	// AckRatio is the fraction of received messages that were deleted, or
+	// nil if no received message has settled yet.
+	AckRatio *float64 `json:"ackRatio,omitempty"`
+
+	// LastPurgedAt is when the queue was last purged through the relay, and
+	// NextPurgeAllowedAt when SQS will accept the next PurgeQueue.
+	LastPurgedAt       *time.Time `json:"lastPurgedAt,omitempty"`
+	NextPurgeAllowedAt *time.Time `json:"nextPurgeAllowedAt,omitempty"`
 }
 
 type Store struct {
 	mu       sync.RWMutex
-	messages map[string]*Message          // messageId -> Message
-	queues   map[string]map[string]bool   // queueName -> messageIds
-	history  []*Message                   // chronological history
-	receipts map[string]string            // receiptHandle -> messageId
+	clock    Clock
+	messages map[string]*Message        // messageId -> Message
+	queues   map[string]map[string]bool // queueName -> messageIds
+	history  *historyRing               // chronological history
+	receipts map[string]string          // receiptHandle -> messageId
+	dlqEdges map[string]*DLQEdge        // source queueName -> redrive edge
+
+	moveTasks   map[string]*MoveTask // task handle -> move task
+	eventCounts map[string]int       // messageId -> events in history
+
+	receiveAttempts map[attemptKey]*receiveAttempt // first use of each FIFO receive attempt ID
+	queueCounts     map[string]*queueCounts        // running totals behind GetQueueStats
+	topicCounts     map[string]int                 // topicArn -> publish events in history
+	bodySizes       map[string]*bodySizes          // sent body sizes since the last clear
+	sizeThreshold   int                            // sends above this count as large
+
+	clockSkew     map[string]*skewWindow // upstream -> recent SentTimestamp offsets
+	skewThreshold time.Duration
+
+	// Last successful PurgeQueue of each queue; like createdQueues, it is
+	// upstream state and survives Clear
+	purges map[string]time.Time
+
+	// Cumulative per-queue, per-action event counts for /metrics. Never
+	// reset, so unlike the stats they don't drop on Clear.
+	counters map[counterKey]uint64
+
+	// Timestamp of the newest captured event, for /readyz; like the
+	// counters it survives Clear.
+	lastActivity time.Time
+
+	persistPath string      // snapshot file of a persistent store
+	dirty       atomic.Bool // changed since the last snapshot; cleared by Save under the read lock
+
+	recordExchanges bool
+	exchanges       []*Exchange
+
+	anomalies   []*Anomaly
+	emptyBodies map[string]map[AnomalyKind]int // queueName -> kind -> sends
+
+	// Queues observed via CreateQueue/GetQueueUrl, kept across Clear since
+	// queue existence outlives captured traffic.
+	knownQueues   map[string]time.Time
+	flagNewQueues bool
+	createdQueues map[string]string // queueName -> URL, from CreateQueue
+	removedQueues map[string]bool   // deleted upstream and not used since
+	queueAttrs    map[string]*queueAttributes
+	clearedAt     time.Time
+
+	canonicalJSON   bool
+	correlationAttr string
+	retention       []RetentionRule
+	orderedQueues   []string
+	dlqPatterns     []string
+	ackGrace        time.Duration
+
+	sampleThreshold int // bodies larger than this are stored as a preview
+	previewBytes    int
+
+	session  string // active session name
+	sessions []*Session
+
+	listeners          []func(Message)
+	subscribers        map[*Subscription]struct{}
+	evictedSubscribers int
 }
 
 func New() *Store {
 	return &Store{
+		clock:    systemClock{},
 		messages: make(map[string]*Message),
 		queues:   make(map[string]map[string]bool),
-		history:  make([]*Message, 0),
+		history:  newHistoryRing(DefaultMaxHistory),
 		receipts: make(map[string]string),
+		dlqEdges: make(map[string]*DLQEdge),
+
+		moveTasks:   make(map[string]*MoveTask),
+		eventCounts: make(map[string]int),
+		counters:    make(map[counterKey]uint64),
+		emptyBodies: make(map[string]map[AnomalyKind]int),
+		knownQueues: make(map[string]time.Time),
+		queueAttrs:  make(map[string]*queueAttributes),
+		subscribers: make(map[*Subscription]struct{}),
+
+		createdQueues:   make(map[string]string),
+		purges:          make(map[string]time.Time),
+		removedQueues:   make(map[string]bool),
+		receiveAttempts: make(map[attemptKey]*receiveAttempt),
+		queueCounts:     make(map[string]*queueCounts),
+		topicCounts:     make(map[string]int),
+		bodySizes:       make(map[string]*bodySizes),
+		sizeThreshold:   DefaultSizeThreshold,
+
+		clockSkew:     make(map[string]*skewWindow),
+		skewThreshold: DefaultSkewThreshold,
+
+		correlationAttr: DefaultCorrelationAttribute,
+		dlqPatterns:     DefaultDLQPatterns,
+		ackGrace:        DefaultAckGrace,
+		previewBytes:    DefaultBodyPreviewBytes,
+		clearedAt:       time.Now(),
 	}
 }
 
-func (s *Store) RecordSend(queueURL, queueName, messageID, body string, attributes map[string]string) {
+// SetFlagNewQueues enables the queue_first_seen anomaly for sends to queues
+// that were never seen created or looked up.
+func (s *Store) SetFlagNewQueues(enabled bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.flagNewQueues = enabled
+}
+
+// MarkQueueKnown records that queueName exists, e.g. because a CreateQueue or
+// GetQueueUrl call for it succeeded.
+func (s *Store) MarkQueueKnown(queueName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.knownQueues[queueName]; !ok {
+		s.knownQueues[queueName] = s.now()
+	}
+}
+
+func (s *Store) RecordSend(meta Meta, queueURL, queueName, messageID, body string, attributes, systemAttributes map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, known := s.knownQueues[queueName]; !known && s.flagNewQueues {
+		s.knownQueues[queueName] = s.now()
+		s.addAnomaly(AnomalyQueueFirstSeen, queueName, "send to a queue never seen in CreateQueue or GetQueueUrl")
+	}
+	s.checkMessageSize(queueName, messageID, body)
+	s.countBodySize(queueName, len(body))
+
 	msg := &Message{
 		ID:         generateID(),
 		MessageID:  messageID,
@@ -65,18 +416,28 @@ func (s *Store) RecordSend(queueURL, queueName, messageID, body string, attribut
 		Body:       body,
 		Attributes: attributes,
 		Action:     ActionSend,
-		Timestamp:  time.Now(),
+		Timestamp:  s.now(),
+
+		MessageSystemAttributes: systemAttributes,
+		CanonicalBody:           s.canonicalBody(body),
 	}
+	meta.apply(msg)
+	s.sampleBody(msg)
+	msg.DeadLetter = s.dlqArrival(msg)
 
+	if old, ok := s.messages[messageID]; ok {
+		s.untrackMessage(old)
+	}
 	s.messages[messageID] = msg
+	s.trackMessage(msg)
 	if s.queues[queueName] == nil {
 		s.queues[queueName] = make(map[string]bool)
 	}
 	s.queues[queueName][messageID] = true
-	s.history = append(s.history, msg)
+	s.appendHistory(msg)
 }
 
-func (s *Store) RecordReceive(queueURL, queueName, messageID, receiptHandle, body string, attributes map[string]string) {
+func (s *Store) RecordReceive(meta Meta, queueURL, queueName, messageID, receiptHandle, body string, attributes, systemAttributes map[string]string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -90,14 +451,30 @@ func (s *Store) RecordReceive(queueURL, queueName, messageID, receiptHandle, bod
 		Body:          body,
 		Attributes:    attributes,
 		Action:        ActionReceive,
-		Timestamp:     time.Now(),
+		Timestamp:     s.now(),
+		CanonicalBody: s.canonicalBody(body),
+
+		SystemAttributes: systemAttributes,
 	}
-	s.history = append(s.history, event)
+	meta.apply(event)
+	tagSNSDelivery(event)
+	s.sampleBody(event)
+	s.checkReceiveAttempt(event)
+	event.DeadLetter = s.dlqArrival(event)
+	s.appendHistory(event)
 
 	// Track receipt handle for deletion lookup
 	s.receipts[receiptHandle] = messageID
 
-	// If we haven't seen this message before (e.g., pre-existing in queue), add it
+	// A message redriven with its ID intact now lives in the DLQ
+	if msg, exists := s.messages[messageID]; exists && event.DeadLetter != nil {
+		s.moveToDLQ(msg, queueURL, queueName)
+		msg.DeadLetter = event.DeadLetter
+	}
+
+	// A message never seen sent (e.g., pre-existing in the queue) is
+	// captured as first seen in this receive. It is counted once, as
+	// pending, and not as sent.
 	if _, exists := s.messages[messageID]; !exists {
 		msg := &Message{
 			ID:            event.ID,
@@ -105,24 +482,49 @@ func (s *Store) RecordReceive(queueURL, queueName, messageID, receiptHandle, bod
 			ReceiptHandle: receiptHandle,
 			QueueURL:      queueURL,
 			QueueName:     queueName,
-			Body:          body,
 			Attributes:    attributes,
 			Action:        ActionReceive,
-			Timestamp:     time.Now(),
+			Timestamp:     event.Timestamp,
+			ReceivedOnly:  true,
+			TraceID:       event.TraceID,
+			ListenAddr:    event.ListenAddr,
+			Upstream:      event.Upstream,
+			TopicArn:      event.TopicArn,
+			SNSMessageID:  event.SNSMessageID,
+			DeadLetter:    event.DeadLetter,
+
+			AttributeTypes: event.AttributeTypes,
 		}
+		copyBody(msg, event)
 		s.messages[messageID] = msg
 		if s.queues[queueName] == nil {
 			s.queues[queueName] = make(map[string]bool)
 		}
 		s.queues[queueName][messageID] = true
+		s.trackMessage(msg)
 	}
+
+	msg := s.messages[messageID]
+	receivedAt := event.Timestamp
+	hiddenUntil := receivedAt.Add(s.visibilityTimeout(queueName, meta.VisibilityTimeout))
+	msg.LastReceivedAt = &receivedAt
+	msg.ReceiveCount++
+	if msg.ReceiveCount == 2 {
+		s.countsFor(queueName).redelivered++
+	}
+	msg.InFlightUntil = &hiddenUntil
+	if len(systemAttributes) > 0 {
+		msg.SystemAttributes = systemAttributes
+	}
+	s.trackReceive(msg, receivedAt)
+	msg.ReceiptHandles = append(msg.ReceiptHandles, receiptHandle)
 }
 
-func (s *Store) RecordDelete(queueURL, queueName, receiptHandle string) {
+func (s *Store) RecordDelete(meta Meta, queueURL, queueName, receiptHandle string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	now := time.Now()
+	now := s.now()
 
 	// Create delete event
 	event := &Message{
@@ -133,18 +535,161 @@ func (s *Store) RecordDelete(queueURL, queueName, receiptHandle string) {
 		Action:        ActionDelete,
 		Timestamp:     now,
 	}
+	meta.apply(event)
 
 	// Try to find the message by receipt handle
 	if messageID, ok := s.receipts[receiptHandle]; ok {
 		event.MessageID = messageID
 		if msg, exists := s.messages[messageID]; exists {
+			if !msg.Deleted {
+				s.trackDelete(msg)
+			}
 			msg.Deleted = true
 			msg.DeletedAt = &now
-			event.Body = msg.Body
+			copyBody(event, msg)
+			if n := len(msg.ReceiptHandles); n > 0 && msg.ReceiptHandles[n-1] != receiptHandle {
+				event.StaleHandle = true
+			}
 		}
 	}
 
-	s.history = append(s.history, event)
+	s.appendHistory(event)
+}
+
+// RecordControl records a control-plane call on a queue, such as CreateQueue
+// or SetQueueAttributes.
+func (s *Store) RecordControl(meta Meta, queueURL, queueName, operation string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := &Message{
+		ID:        generateID(),
+		QueueURL:  queueURL,
+		QueueName: queueName,
+		Action:    ActionControl,
+		Timestamp: s.now(),
+		Operation: operation,
+	}
+	meta.apply(event)
+	s.appendHistory(event)
+}
+
+// GenericCall describes a call recorded as a generic event. Body is the
+// start of the request body, and BodySize its full length.
+type GenericCall struct {
+	Service   string
+	Operation string
+	Method    string
+	Path      string
+	Status    int
+	Body      string
+	BodySize  int
+}
+
+// RecordGeneric records a call the relay doesn't parse, such as one to
+// another AWS service.
+func (s *Store) RecordGeneric(meta Meta, call GenericCall) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := &Message{
+		ID:         generateID(),
+		Body:       call.Body,
+		Action:     ActionGeneric,
+		Timestamp:  s.now(),
+		Operation:  call.Operation,
+		Service:    call.Service,
+		HTTPMethod: call.Method,
+		HTTPPath:   call.Path,
+		HTTPStatus: call.Status,
+		BodySize:   call.BodySize,
+	}
+	meta.apply(event)
+	s.appendHistory(event)
+}
+
+// RecordFault records that operation on queueName was answered with an
+// injected error rather than forwarded upstream.
+func (s *Store) RecordFault(meta Meta, queueURL, queueName, operation string, status int, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := &Message{
+		ID:          generateID(),
+		QueueURL:    queueURL,
+		QueueName:   queueName,
+		Action:      ActionFault,
+		Timestamp:   s.now(),
+		Operation:   operation,
+		FaultStatus: status,
+		FaultCode:   code,
+	}
+	meta.apply(event)
+	s.appendHistory(event)
+}
+
+// AddMarker inserts a marker labelled label into history, to correlate
+// captured traffic with what was happening at the time, and returns it.
+func (s *Store) AddMarker(label string) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := &Message{
+		ID:        generateID(),
+		Action:    ActionMarker,
+		Timestamp: s.now(),
+		Label:     label,
+	}
+	s.appendHistory(event)
+	return event
+}
+
+// RecordMirror records the outcome of copying messageID to the shadow queue.
+func (s *Store) RecordMirror(messageID, shadowMessageID string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.messages[messageID]
+	if !ok {
+		return
+	}
+	if err != nil {
+		msg.MirrorError = err.Error()
+		return
+	}
+	msg.MirroredAs = shadowMessageID
+}
+
+// AddListener registers fn to be called with a copy of every event appended
+// to history. Listeners run with the store lock held, so they must not block
+// or call back into the store.
+func (s *Store) AddListener(fn func(Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, fn)
+}
+
+// appendHistory records an event and notifies listeners. Callers must hold
+// the write lock.
+func (s *Store) appendHistory(event *Message) {
+	event.Session = s.session
+	s.dirty.Store(true)
+	s.countEvent(event)
+	s.countHistoryEvent(event, 1)
+	if event.Action != ActionMarker && event.Action != ActionRemoved {
+		s.lastActivity = event.Timestamp
+	}
+	if event.MessageID != "" {
+		s.eventCounts[event.MessageID]++
+	}
+	if evicted := s.history.push(event); evicted != nil {
+		s.releaseEvent(evicted)
+	}
+	for _, fn := range s.listeners {
+		fn(*event)
+	}
+	s.publish(*event)
 }
 
 func (s *Store) GetMessages(queueName string, includeDeleted bool) []*Message {
@@ -168,58 +713,107 @@ func (s *Store) GetHistory(limit int) []*Message {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if limit <= 0 || limit > len(s.history) {
-		limit = len(s.history)
+	n := s.history.len()
+	if limit <= 0 || limit > n {
+		limit = n
 	}
 
 	// Return most recent first
 	result := make([]*Message, limit)
 	for i := 0; i < limit; i++ {
-		result[i] = s.history[len(s.history)-1-i]
+		result[i] = s.history.at(n - 1 - i)
 	}
 	return result
 }
 
-func (s *Store) GetQueueStats() []QueueStats {
+// HistoryLen returns the number of events in history.
+func (s *Store) HistoryLen() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	stats := make(map[string]*QueueStats)
+	return s.history.len()
+}
 
-	for _, event := range s.history {
-		if stats[event.QueueName] == nil {
-			stats[event.QueueName] = &QueueStats{
-				QueueName: event.QueueName,
-				QueueURL:  event.QueueURL,
-			}
+// HistoryRange returns copies of up to n events of history, oldest first,
+// starting at index start. It lets large exports walk history without
+// holding the lock throughout.
+func (s *Store) HistoryRange(start, n int) []Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if start < 0 || start >= s.history.len() {
+		return nil
+	}
+	end := min(start+n, s.history.len())
+
+	result := make([]Message, 0, end-start)
+	for i := start; i < end; i++ {
+		result = append(result, *s.history.at(i))
+	}
+	return result
+}
+
+func (s *Store) GetQueueStats() []QueueStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	stats := make(map[string]*QueueStats, len(s.queueCounts))
+	for queueName, c := range s.queueCounts {
+		if c.events <= 0 || s.removedQueues[queueName] {
+			continue
+		}
+		qs := &QueueStats{
+			QueueName:     queueName,
+			QueueURL:      c.url,
+			Color:         QueueColor(queueName),
+			TotalSent:     c.sent,
+			TotalReceived: c.received,
+			TotalDeleted:  c.deleted,
+			Pending:       c.pending,
+			Redelivered:   c.redelivered,
+
+			ReceivedOnly: c.receivedOnly,
 		}
-		switch event.Action {
-		case ActionSend:
-			stats[event.QueueName].TotalSent++
-		case ActionReceive:
-			stats[event.QueueName].TotalReceived++
-		case ActionDelete:
-			stats[event.QueueName].TotalDeleted++
+		for messageID := range c.unacked {
+			if msg, ok := s.messages[messageID]; ok && msg.InFlight(now) {
+				qs.InFlight++
+			}
 		}
+		s.applyAckRatio(qs, c)
+		stats[queueName] = qs
 	}
 
-	// Calculate pending (sent but not deleted)
-	for queueName, queueMsgs := range s.queues {
+	// Created queues are listed before any traffic reaches them
+	for queueName, queueURL := range s.createdQueues {
 		if stats[queueName] == nil {
-			continue
+			stats[queueName] = &QueueStats{
+				QueueName: queueName,
+				QueueURL:  queueURL,
+				Color:     QueueColor(queueName),
+			}
+		} else if stats[queueName].QueueURL == "" {
+			stats[queueName].QueueURL = queueURL
 		}
-		pending := 0
-		for msgID := range queueMsgs {
-			if msg, ok := s.messages[msgID]; ok && !msg.Deleted {
-				pending++
+	}
+
+	// So are recently purged queues, whose cooldown callers may wait on
+	for queueName := range s.purges {
+		if stats[queueName] == nil {
+			stats[queueName] = &QueueStats{
+				QueueName: queueName,
+				Color:     QueueColor(queueName),
 			}
 		}
-		stats[queueName].Pending = pending
 	}
 
 	result := make([]QueueStats, 0, len(stats))
-	for _, s := range stats {
-		result = append(result, *s)
+	for _, qs := range stats {
+		s.applyUpstreamCounts(qs)
+		s.applyPurge(qs)
+		s.applyBodySizes(qs)
+		s.applyQueueConfig(qs)
+		result = append(result, *qs)
 	}
 	return result
 }
@@ -228,18 +822,42 @@ func (s *Store) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	s.clear()
+}
+
+// clear resets captured state. Callers must hold the write lock.
+func (s *Store) clear() {
 	s.messages = make(map[string]*Message)
 	s.queues = make(map[string]map[string]bool)
-	s.history = make([]*Message, 0)
+	s.history.reset(nil)
+	s.eventCounts = make(map[string]int)
+	s.dirty.Store(true)
 	s.receipts = make(map[string]string)
+	s.clearedAt = s.now()
+	s.dlqEdges = make(map[string]*DLQEdge)
+	s.moveTasks = make(map[string]*MoveTask)
+	s.exchanges = nil
+	s.anomalies = nil
+	s.emptyBodies = make(map[string]map[AnomalyKind]int)
+	s.receiveAttempts = make(map[attemptKey]*receiveAttempt)
+	s.queueCounts = make(map[string]*queueCounts)
+	s.topicCounts = make(map[string]int)
+	s.bodySizes = make(map[string]*bodySizes)
+
+	// Keep the active session running but forget ended ones
+	var active []*Session
+	for _, sess := range s.sessions {
+		if sess.Name == s.session {
+			active = append(active, sess)
+		}
+	}
+	s.sessions = active
 }
 
-var idCounter int64
-var idMu sync.Mutex
+var idCounter atomic.Int64
 
+// generateID returns a unique ID made of the creation time and a process-wide
+// sequence number, zero-padded so IDs sort lexically in creation order.
 func generateID() string {
-	idMu.Lock()
-	defer idMu.Unlock()
-	idCounter++
-	return time.Now().Format("20060102150405") + "-" + string(rune(idCounter))
+	return fmt.Sprintf("%s-%012d", time.Now().Format("20060102150405"), idCounter.Add(1))
 }
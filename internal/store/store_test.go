@@ -0,0 +1,42 @@
+package store
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestGenerateIDUniqueAndOrdered(t *testing.T) {
+	const workers, perWorker = 100, 1000
+
+	ids := make([][]string, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			ids[w] = make([]string, perWorker)
+			for i := range ids[w] {
+				ids[w][i] = generateID()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, workers*perWorker)
+	for w, batch := range ids {
+		for i, id := range batch {
+			if seen[id] {
+				t.Fatalf("duplicate ID %s", id)
+			}
+			seen[id] = true
+			// Each worker made its IDs one after another, so they must
+			// sort in that order
+			if i > 0 && id <= batch[i-1] {
+				t.Fatalf("worker %d: ID %s sorts before or with the earlier %s", w, id, batch[i-1])
+			}
+		}
+	}
+	if len(seen) != workers*perWorker {
+		t.Errorf("%d unique IDs, want %d", len(seen), workers*perWorker)
+	}
+}
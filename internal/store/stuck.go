@@ -0,0 +1,32 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// GetStuck returns messages that were received but never deleted, and whose
+// most recent receive is at least olderThan ago: consumers that took a
+// message and never acknowledged it. Oldest receives come first.
+func (s *Store) GetStuck(queueName string, olderThan time.Duration) []*Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := s.now().Add(-olderThan)
+
+	var result []*Message
+	for _, msg := range s.messages {
+		if queueName != "" && msg.QueueName != queueName {
+			continue
+		}
+		if msg.Deleted || msg.LastReceivedAt == nil || msg.LastReceivedAt.After(cutoff) {
+			continue
+		}
+		result = append(result, msg)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastReceivedAt.Before(*result[j].LastReceivedAt)
+	})
+	return result
+}
@@ -0,0 +1,89 @@
+package store
+
+import "log"
+
+// DefaultSubscriberBuffer is the number of undelivered events a subscriber
+// may fall behind by before it is evicted.
+const DefaultSubscriberBuffer = 256
+
+// Subscription streams a copy of every event appended to history. Each
+// subscription has its own bounded buffer; a subscriber that lets it fill up
+// is evicted rather than allowed to stall recording or buffer without limit.
+type Subscription struct {
+	// C receives events. It is closed when the subscription is closed or
+	// evicted.
+	C <-chan Message
+
+	ch      chan Message
+	store   *Store
+	evicted bool
+}
+
+// SubscriberStats summarises streaming subscribers.
+type SubscriberStats struct {
+	Active  int `json:"active"`
+	Evicted int `json:"evicted"`
+}
+
+// Subscribe registers a new subscription buffering up to buffer events.
+func (s *Store) Subscribe(buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultSubscriberBuffer
+	}
+
+	ch := make(chan Message, buffer)
+	sub := &Subscription{C: ch, ch: ch, store: s}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once and
+// after eviction.
+func (sub *Subscription) Close() {
+	s := sub.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[sub]; ok {
+		delete(s.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Evicted reports whether the subscription was dropped for falling behind.
+func (sub *Subscription) Evicted() bool {
+	sub.store.mu.RLock()
+	defer sub.store.mu.RUnlock()
+
+	return sub.evicted
+}
+
+func (s *Store) GetSubscriberStats() SubscriberStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return SubscriberStats{
+		Active:  len(s.subscribers),
+		Evicted: s.evictedSubscribers,
+	}
+}
+
+// publish fans event out to subscribers without blocking, evicting any
+// whose buffer is full. Callers must hold the write lock.
+func (s *Store) publish(event Message) {
+	for sub := range s.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			delete(s.subscribers, sub)
+			close(sub.ch)
+			sub.evicted = true
+			s.evictedSubscribers++
+			log.Printf("Evicted slow subscriber after %d undelivered events", cap(sub.ch))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSlowSubscriberEvicted(t *testing.T) {
+	s := New()
+	slow := s.Subscribe(2) // never read
+	fast := s.Subscribe(2)
+	defer fast.Close()
+
+	// Publishing must never wait on the slow subscriber
+	done := make(chan struct{})
+	var received []string
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			s.RecordSend(Meta{}, "", "orders", "m-"+strconv.Itoa(i), "body", nil, nil)
+			select {
+			case event := <-fast.C:
+				received = append(received, event.MessageID)
+			case <-time.After(time.Second):
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording blocked on a full subscriber")
+	}
+
+	if len(received) != 5 {
+		t.Errorf("fast subscriber received %v, want all 5 events", received)
+	}
+	if !slow.Evicted() || fast.Evicted() {
+		t.Errorf("evicted slow = %v, fast = %v; want only the slow one", slow.Evicted(), fast.Evicted())
+	}
+
+	// The slow subscriber keeps what it buffered, then sees C closed
+	var buffered int
+	for range slow.C {
+		buffered++
+	}
+	if buffered != 2 {
+		t.Errorf("slow subscriber buffered %d events, want 2", buffered)
+	}
+
+	if stats := s.GetSubscriberStats(); stats.Active != 1 || stats.Evicted != 1 {
+		t.Errorf("subscriber stats = %+v, want 1 active and 1 evicted", stats)
+	}
+	slow.Close() // safe after eviction
+}
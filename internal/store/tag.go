@@ -0,0 +1,113 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// MessageFilter selects history events. Zero-valued fields match anything.
+type MessageFilter struct {
+	QueueName    string
+	Action       MessageAction
+	BodyContains string
+	Since        time.Time
+	Until        time.Time
+	Session      string
+	Upstream     string
+	Topic        string // SNS topic name or ARN
+	Service      string // AWS service of generic events; "sqs" for all others
+}
+
+// Matches reports whether event satisfies every set field of f.
+func (f MessageFilter) Matches(event *Message) bool {
+	if f.QueueName != "" && event.QueueName != f.QueueName {
+		return false
+	}
+	if f.Action != "" && event.Action != f.Action {
+		return false
+	}
+	if f.BodyContains != "" && !strings.Contains(event.Body, f.BodyContains) {
+		return false
+	}
+	if !f.Since.IsZero() && event.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && event.Timestamp.After(f.Until) {
+		return false
+	}
+	if f.Session != "" && event.Session != f.Session {
+		return false
+	}
+	if f.Upstream != "" && event.Upstream != f.Upstream {
+		return false
+	}
+	if f.Topic != "" && (event.TopicArn == "" || event.TopicArn != f.Topic && TopicName(event.TopicArn) != f.Topic) {
+		return false
+	}
+	if f.Service != "" && eventService(event) != f.Service {
+		return false
+	}
+	return true
+}
+
+// eventService returns the AWS service of a generic event, or "sqs" for the
+// SQS and SNS traffic the relay parses.
+func eventService(event *Message) string {
+	if event.Action == ActionGeneric {
+		return event.Service
+	}
+	return "sqs"
+}
+
+// TagMessages adds tag to every stored message with at least one history
+// event matching f, and returns the number of messages newly tagged.
+func (s *Store) TagMessages(f MessageFilter, tag string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tagged := 0
+	for i := 0; i < s.history.len(); i++ {
+		event := s.history.at(i)
+		if !f.Matches(event) {
+			continue
+		}
+		if msg, ok := s.messages[event.MessageID]; ok && msg.addTag(tag) {
+			tagged++
+			s.dirty.Store(true)
+		}
+	}
+	return tagged
+}
+
+// addTag adds tag to m, reporting whether it was not already present.
+func (m *Message) addTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return false
+		}
+	}
+	m.Tags = append(m.Tags, tag)
+	return true
+}
+
+// AnnotateMessage appends note to the notes of the stored message with
+// messageID or, if replace is set, makes it the only note; an empty note
+// with replace clears them. It returns the message, or false if it isn't
+// stored.
+func (s *Store) AnnotateMessage(messageID, note string, replace bool) (*Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msg, ok := s.messages[messageID]
+	if !ok {
+		return nil, false
+	}
+	if replace {
+		msg.Notes = nil
+	}
+	if note != "" {
+		msg.Notes = append(msg.Notes, note)
+	}
+	s.dirty.Store(true)
+	return msg, true
+}
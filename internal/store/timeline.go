@@ -0,0 +1,125 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// EventsAt returns the events recorded within window either side of t, in
+// chronological order. History is appended in time order, so the window is
+// located by binary search rather than a scan.
+func (s *Store) EventsAt(t time.Time, window time.Duration) []*Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	start, end := t.Add(-window), t.Add(window)
+	n := s.history.len()
+	first := sort.Search(n, func(i int) bool {
+		return !s.history.at(i).Timestamp.Before(start)
+	})
+
+	result := []*Message{}
+	for i := first; i < n && !s.history.at(i).Timestamp.After(end); i++ {
+		result = append(result, s.history.at(i))
+	}
+	return result
+}
+
+// Timeline is the lifecycle of one message: its send, every receive and its
+// delete, with the durations between them. Durations are in milliseconds
+// and nil when the events they span weren't captured; those still running,
+// for a message not yet deleted, are measured up to now.
+type Timeline struct {
+	MessageID string     `json:"messageId"`
+	QueueName string     `json:"queueName"`
+	Send      *Message   `json:"send,omitempty"`
+	Receives  []*Message `json:"receives"`
+	Delete    *Message   `json:"delete,omitempty"`
+	Deleted   bool       `json:"deleted"`
+	Purged    bool       `json:"purged,omitempty"`
+
+	// Events is every event of the message in chronological order,
+	// including visibility changes and any beyond the first delete.
+	Events []*Message `json:"events"`
+
+	TimeToFirstReceiveMs *int64 `json:"timeToFirstReceiveMs,omitempty"` // send to first receive
+	TimeInFlightMs       *int64 `json:"timeInFlightMs,omitempty"`       // first receive to delete
+	LifetimeMs           *int64 `json:"lifetimeMs,omitempty"`           // send to delete
+}
+
+// Timeline returns the lifecycle of messageID, and false if the relay knows
+// nothing of it.
+func (s *Store) Timeline(messageID string) (Timeline, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t := Timeline{MessageID: messageID, Receives: []*Message{}, Events: []*Message{}}
+	for i := 0; i < s.history.len(); i++ {
+		event := s.history.at(i)
+		if event.MessageID != messageID {
+			continue
+		}
+		t.Events = append(t.Events, event)
+		t.QueueName = event.QueueName
+		switch event.Action {
+		case ActionSend:
+			if t.Send == nil {
+				t.Send = event
+			}
+		case ActionReceive:
+			t.Receives = append(t.Receives, event)
+		case ActionDelete:
+			if t.Delete == nil {
+				t.Delete = event
+			}
+		}
+	}
+
+	msg, stored := s.messages[messageID]
+	if !stored && len(t.Events) == 0 {
+		return Timeline{}, false
+	}
+
+	// The stored message outlives evicted events: it has the send time of
+	// a captured send and the time of a delete or purge
+	var sentAt, endedAt *time.Time
+	if t.Send != nil {
+		sentAt = &t.Send.Timestamp
+	}
+	if t.Delete != nil {
+		endedAt = &t.Delete.Timestamp
+	}
+	if stored {
+		t.QueueName = msg.QueueName
+		t.Deleted = msg.Deleted
+		t.Purged = msg.Purged
+		if sentAt == nil && msg.Action == ActionSend {
+			sentAt = &msg.Timestamp
+		}
+		if endedAt == nil && msg.DeletedAt != nil {
+			endedAt = msg.DeletedAt
+		}
+	} else {
+		t.Deleted = t.Delete != nil
+	}
+
+	end := s.now()
+	if endedAt != nil {
+		end = *endedAt
+	}
+	if sentAt != nil && len(t.Receives) > 0 {
+		t.TimeToFirstReceiveMs = millisBetween(*sentAt, t.Receives[0].Timestamp)
+	}
+	if len(t.Receives) > 0 {
+		t.TimeInFlightMs = millisBetween(t.Receives[0].Timestamp, end)
+	}
+	if sentAt != nil {
+		t.LifetimeMs = millisBetween(*sentAt, end)
+	}
+	return t, true
+}
+
+func millisBetween(from, to time.Time) *int64 {
+	ms := to.Sub(from).Milliseconds()
+	return &ms
+}
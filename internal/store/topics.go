@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// TopicStats summarises the SNS publishes to a topic still in history.
+type TopicStats struct {
+	TopicName string `json:"topicName"`
+	TopicArn  string `json:"topicArn"`
+	Color     string `json:"color"`
+	Published int    `json:"published"`
+}
+
+// TopicName returns the name part of an SNS topic ARN.
+func TopicName(topicArn string) string {
+	return topicArn[strings.LastIndex(topicArn, ":")+1:]
+}
+
+// RecordPublish records an SNS Publish to topicArn that the upstream
+// accepted under messageID.
+func (s *Store) RecordPublish(meta Meta, topicArn, messageID, body string, attributes map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := &Message{
+		ID:            generateID(),
+		MessageID:     messageID,
+		TopicArn:      topicArn,
+		Body:          body,
+		Attributes:    attributes,
+		Action:        ActionPublish,
+		Timestamp:     s.now(),
+		CanonicalBody: s.canonicalBody(body),
+	}
+	meta.apply(event)
+	s.sampleBody(event)
+	s.appendHistory(event)
+}
+
+// GetTopicStats returns the publish totals of each topic, ordered by name.
+func (s *Store) GetTopicStats() []TopicStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]TopicStats, 0, len(s.topicCounts))
+	for topicArn, published := range s.topicCounts {
+		name := TopicName(topicArn)
+		result = append(result, TopicStats{
+			TopicName: name,
+			TopicArn:  topicArn,
+			Color:     QueueColor(name),
+			Published: published,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TopicName < result[j].TopicName
+	})
+	return result
+}
+
+// countPublish adds (delta 1) or removes (delta -1) a publish event from its
+// topic's total. Callers must hold the write lock.
+func (s *Store) countPublish(event *Message, delta int) {
+	s.topicCounts[event.TopicArn] += delta
+	if s.topicCounts[event.TopicArn] <= 0 {
+		delete(s.topicCounts, event.TopicArn)
+	}
+}
+
+// tagSNSDelivery marks a received message whose body is an SNS notification
+// envelope with the topic and SNS message ID it was published under, so it
+// can be followed back to the Publish. Raw deliveries carry no envelope and
+// are left alone.
+func tagSNSDelivery(event *Message) {
+	if !strings.HasPrefix(strings.TrimSpace(event.Body), "{") {
+		return
+	}
+	var envelope struct {
+		Type      string
+		MessageId string
+		TopicArn  string
+	}
+	if json.Unmarshal([]byte(event.Body), &envelope) != nil || envelope.Type != "Notification" || envelope.TopicArn == "" {
+		return
+	}
+	event.TopicArn = envelope.TopicArn
+	event.SNSMessageID = envelope.MessageId
+}
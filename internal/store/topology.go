@@ -0,0 +1,109 @@
+package store
+
+import "sort"
+
+// Topology node and edge kinds.
+const (
+	NodeQueue        = "queue"
+	NodeTopic        = "topic"
+	EdgeRedrive      = "redrive"
+	EdgeSubscription = "subscription"
+)
+
+// TopologyNode is a queue or SNS topic the relay has seen, by traffic or by
+// a redrive relationship.
+type TopologyNode struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	DeadLetter bool   `json:"deadLetter,omitempty"` // the target of a redrive edge
+}
+
+// TopologyEdge is a path messages flow along, from node ID From to node ID
+// To.
+type TopologyEdge struct {
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Kind            string `json:"kind"`
+	MaxReceiveCount int    `json:"maxReceiveCount,omitempty"`
+}
+
+// Topology is the message-flow graph between the queues the relay has seen,
+// shaped for rendering as a diagram. Node IDs are "<kind>:<name>", so other
+// kinds of node can join the graph without clashing with queue names.
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// GetTopology returns the message-flow graph: every queue with stored
+// messages or a redrive relationship and every topic published to, with an
+// edge from each topic to the queues its notifications were received from
+// and from each source queue to its dead-letter queue.
+func (s *Store) GetTopology() Topology {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	topology := Topology{
+		Nodes: []TopologyNode{},
+		Edges: []TopologyEdge{},
+	}
+	nodes := make(map[string]*TopologyNode)
+	addNode := func(kind, name string) *TopologyNode {
+		id := kind + ":" + name
+		node, ok := nodes[id]
+		if !ok {
+			node = &TopologyNode{ID: id, Kind: kind, Name: name}
+			nodes[id] = node
+		}
+		return node
+	}
+	addQueue := func(name string) *TopologyNode { return addNode(NodeQueue, name) }
+
+	for name := range s.queues {
+		addQueue(name)
+	}
+	for topicArn := range s.topicCounts {
+		addNode(NodeTopic, TopicName(topicArn))
+	}
+
+	// SNS deliveries are first seen in a receive, tagged with their topic.
+	// Those since redriven sit in the DLQ, which the topic doesn't feed.
+	subscribed := make(map[[2]string]bool)
+	for _, msg := range s.messages {
+		if msg.TopicArn == "" || msg.QueueName == "" || msg.DeadLetter != nil {
+			continue
+		}
+		edge := [2]string{addNode(NodeTopic, TopicName(msg.TopicArn)).ID, addQueue(msg.QueueName).ID}
+		if !subscribed[edge] {
+			subscribed[edge] = true
+			topology.Edges = append(topology.Edges, TopologyEdge{From: edge[0], To: edge[1], Kind: EdgeSubscription})
+		}
+	}
+	for _, edge := range s.dlqEdges {
+		source := addQueue(edge.Source)
+		dlq := addQueue(edge.DeadLetterQueue)
+		dlq.DeadLetter = true
+		topology.Edges = append(topology.Edges, TopologyEdge{
+			From:            source.ID,
+			To:              dlq.ID,
+			Kind:            EdgeRedrive,
+			MaxReceiveCount: edge.MaxReceiveCount,
+		})
+	}
+
+	for _, node := range nodes {
+		topology.Nodes = append(topology.Nodes, *node)
+	}
+	sort.Slice(topology.Nodes, func(i, j int) bool {
+		return topology.Nodes[i].ID < topology.Nodes[j].ID
+	})
+	sort.Slice(topology.Edges, func(i, j int) bool {
+		a, b := topology.Edges[i], topology.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return topology
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultVisibilityTimeout is the SQS visibility timeout of a queue created
+// without one.
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// RecordChangeVisibility records a ChangeMessageVisibility of the message
+// received with receiptHandle, which hides it for timeout seconds from now.
+func (s *Store) RecordChangeVisibility(meta Meta, queueURL, queueName, receiptHandle string, timeout int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event := &Message{
+		ID:            generateID(),
+		ReceiptHandle: receiptHandle,
+		QueueURL:      queueURL,
+		QueueName:     queueName,
+		Action:        ActionChangeVisibility,
+		Timestamp:     s.now(),
+	}
+	meta.apply(event)
+	event.VisibilityTimeout = &timeout
+
+	if messageID, ok := s.receipts[receiptHandle]; ok {
+		event.MessageID = messageID
+		if msg, exists := s.messages[messageID]; exists {
+			hiddenUntil := event.Timestamp.Add(time.Duration(timeout) * time.Second)
+			msg.InFlightUntil = &hiddenUntil
+		}
+	}
+
+	s.appendHistory(event)
+}
+
+// visibilityTimeout returns how long a message received from queueName stays
+// hidden: the timeout the receive requested if any, else the queue's
+// VisibilityTimeout if known, else the SQS default. Callers must hold the
+// lock.
+func (s *Store) visibilityTimeout(queueName string, requested *int) time.Duration {
+	if requested != nil {
+		return time.Duration(*requested) * time.Second
+	}
+	if n, ok := s.queueAttrInt(queueName, "VisibilityTimeout"); ok {
+		return time.Duration(n) * time.Second
+	}
+	return DefaultVisibilityTimeout
+}
+
+// InFlight reports whether m was received and has been neither deleted nor
+// made visible again as of now.
+func (m *Message) InFlight(now time.Time) bool {
+	return !m.Deleted && m.InFlightUntil != nil && now.Before(*m.InFlightUntil)
+}
+
+// QueueDepth estimates the depth of a queue the way SQS reports it: Visible
+// messages could be received now (ApproximateNumberOfMessages) and
+// NotVisible ones are hidden by a receive or visibility change
+// (ApproximateNumberOfMessagesNotVisible).
+type QueueDepth struct {
+	QueueName  string `json:"queueName"`
+	Visible    int    `json:"visible"`
+	NotVisible int    `json:"notVisible"`
+}
+
+// GetQueueDepths returns the estimated depth of each queue with captured
+// messages, ordered by queue name, as of now.
+func (s *Store) GetQueueDepths() []QueueDepth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	depths := make([]QueueDepth, 0, len(s.queues))
+	for queueName, queueMsgs := range s.queues {
+		depth := QueueDepth{QueueName: queueName}
+		for msgID := range queueMsgs {
+			msg, ok := s.messages[msgID]
+			if !ok || msg.Deleted {
+				continue
+			}
+			if msg.InFlight(now) {
+				depth.NotVisible++
+			} else {
+				depth.Visible++
+			}
+		}
+		depths = append(depths, depth)
+	}
+	sort.Slice(depths, func(i, j int) bool { return depths[i].QueueName < depths[j].QueueName })
+	return depths
+}
@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+const (
+	queueSize  = 1000
+	maxRetries = 3
+	retryDelay = 500 * time.Millisecond
+
+	// SignatureHeader carries the hex HMAC-SHA256 of the request body,
+	// prefixed with "sha256=", when a secret is configured.
+	SignatureHeader = "X-Relay-Signature"
+)
+
+// Sink POSTs captured events to an external URL. Events are queued in a
+// bounded buffer and delivered by a background worker, so a slow webhook
+// never stalls capture; when the buffer is full new events are dropped.
+type Sink struct {
+	url    string
+	secret []byte
+	client *http.Client
+	queue  chan store.Message
+}
+
+func New(url, secret string) *Sink {
+	s := &Sink{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 5 * time.Second},
+		queue:  make(chan store.Message, queueSize),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Enqueue schedules an event for delivery without blocking. It is suitable
+// for use as a store listener.
+func (s *Sink) Enqueue(event store.Message) {
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("Webhook queue full, dropping event %s", event.ID)
+	}
+}
+
+func (s *Sink) run() {
+	for event := range s.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("Webhook encode error: %v", err)
+			continue
+		}
+
+		delay := retryDelay
+		for attempt := 1; ; attempt++ {
+			err = s.deliver(body)
+			if err == nil {
+				break
+			}
+			if attempt > maxRetries {
+				log.Printf("Webhook delivery of event %s failed: %v", event.ID, err)
+				break
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+func (s *Sink) deliver(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of body using secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"aws-relay/internal/store"
+)
+
+// delivery is one request seen by the test receiver.
+type delivery struct {
+	signature string
+	body      []byte
+}
+
+func TestDeliverySignedAndRetried(t *testing.T) {
+	const secret = "s3cret"
+	deliveries := make(chan delivery, 10)
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{signature: r.Header.Get(SignatureHeader), body: body}
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	sink := New(receiver.URL, secret)
+	sink.Enqueue(store.Message{ID: "evt-1", Action: store.ActionSend, QueueName: "orders"})
+
+	for i, status := range []string{"rejected", "retried"} {
+		var d delivery
+		select {
+		case d = <-deliveries:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s delivery", status)
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(d.body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); d.signature != want {
+			t.Errorf("delivery %d signature = %q, want %q", i+1, d.signature, want)
+		}
+		var event store.Message
+		if err := json.Unmarshal(d.body, &event); err != nil || event.ID != "evt-1" {
+			t.Errorf("delivery %d body = %s (%v), want event evt-1", i+1, d.body, err)
+		}
+	}
+
+	// The 2xx ends the retries
+	select {
+	case d := <-deliveries:
+		t.Errorf("unexpected delivery after success: %s", d.body)
+	case <-time.After(2 * retryDelay):
+	}
+}
+
+func TestDeliveryUnsignedWithoutSecret(t *testing.T) {
+	signatures := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures <- r.Header.Get(SignatureHeader)
+	}))
+	defer receiver.Close()
+
+	New(receiver.URL, "").Enqueue(store.Message{ID: "evt-1"})
+	select {
+	case sig := <-signatures:
+		if sig != "" {
+			t.Errorf("signature = %q, want none without a secret", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+}
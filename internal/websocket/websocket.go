@@ -0,0 +1,315 @@
+// Package websocket implements the server side of the WebSocket protocol
+// (RFC 6455), as much of it as the dashboard needs: text messages in both
+// directions, pings and the closing handshake. Extensions and subprotocols
+// are not negotiated.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID is appended to the client's key to prove the server speaks
+// WebSocket (RFC 6455 section 1.3).
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// DefaultMaxMessageBytes bounds a message read from a client.
+const DefaultMaxMessageBytes = 1 << 20
+
+// Opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close status codes.
+const (
+	CloseNormal       = 1000
+	CloseGoingAway    = 1001
+	CloseProtocol     = 1002
+	CloseTooLarge     = 1009
+	closeNoStatusSent = 1005
+)
+
+var (
+	// ErrClosed is returned by Read once the peer has closed the
+	// connection, and by WriteText once either side has.
+	ErrClosed   = errors.New("websocket closed")
+	ErrTooLarge = errors.New("websocket message too large")
+	ErrProtocol = errors.New("websocket protocol error")
+)
+
+// Conn is an upgraded WebSocket connection. Read must only be called from
+// one goroutine; WriteText, Ping and Close may be called from any.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	maxMessageBytes int
+
+	writeMu sync.Mutex
+	closed  bool // a close frame was sent
+}
+
+// IsUpgrade reports whether r asks to switch to WebSocket.
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") &&
+		headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade completes the opening handshake for r and takes over its
+// connection. On failure it has already answered r with an error status.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("%w: method %s", ErrProtocol, r.Method)
+	}
+	if !IsUpgrade(r) {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, fmt.Errorf("%w: not an upgrade request", ErrProtocol)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("%w: version %q", ErrProtocol, r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("%w: invalid key %q", ErrProtocol, key)
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket unsupported", http.StatusInternalServerError)
+		return nil, err
+	}
+
+	// The connection outlives the request, so it is exempt from the
+	// server's timeouts
+	conn.SetDeadline(time.Time{})
+
+	// Headers set on w before hijacking, such as CORS headers, are not sent
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: rw.Reader, maxMessageBytes: DefaultMaxMessageBytes}, nil
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value answering key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether a comma-separated header of h lists token,
+// ignoring case.
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Read returns the next text or binary message from the peer, answering
+// pings along the way. It returns ErrClosed once the peer closes the
+// connection, after completing the closing handshake.
+func (c *Conn) Read() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			if errors.Is(err, ErrTooLarge) {
+				c.Close(CloseTooLarge, "message too large")
+			} else if errors.Is(err, ErrProtocol) {
+				c.Close(CloseProtocol, "protocol error")
+			}
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := closeNoStatusSent
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.Close(code, "")
+			return nil, ErrClosed
+		case opText, opBinary:
+			if started {
+				c.Close(CloseProtocol, "expected continuation")
+				return nil, fmt.Errorf("%w: new message before the last finished", ErrProtocol)
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				c.Close(CloseProtocol, "unexpected continuation")
+				return nil, fmt.Errorf("%w: continuation without a message", ErrProtocol)
+			}
+		default:
+			c.Close(CloseProtocol, "unknown opcode")
+			return nil, fmt.Errorf("%w: opcode %#x", ErrProtocol, opcode)
+		}
+
+		if len(message)+len(payload) > c.maxMessageBytes {
+			c.Close(CloseTooLarge, "message too large")
+			return nil, ErrTooLarge
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads one frame, unmasking its payload.
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", ErrProtocol)
+	}
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	if !masked {
+		return false, 0, nil, fmt.Errorf("%w: unmasked client frame", ErrProtocol)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, fmt.Errorf("%w: invalid control frame", ErrProtocol)
+	}
+	if length > uint64(c.maxMessageBytes) {
+		return false, 0, nil, ErrTooLarge
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteText sends data as a single text message.
+func (c *Conn) WriteText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Ping sends a ping, which a live peer answers with a pong.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// writeFrame sends one unmasked, final frame, as servers must.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	return c.writeFrameLocked(opcode, payload)
+}
+
+func (c *Conn) writeFrameLocked(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	// A peer that stops reading must not block the writer forever
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := (&net.Buffers{header, payload}).WriteTo(c.conn)
+	return err
+}
+
+// Close sends a close frame with code and reason, if none was sent yet, and
+// closes the connection. It is safe to call more than once.
+func (c *Conn) Close(code int, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	if code != closeNoStatusSent {
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		c.writeFrameLocked(opClose, append(payload, reason...))
+	} else {
+		c.writeFrameLocked(opClose, nil)
+	}
+	return c.conn.Close()
+}
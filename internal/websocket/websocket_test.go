@@ -0,0 +1,319 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKey and testAccept are the handshake example of RFC 6455 section 1.3.
+const (
+	testKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	testAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// echoServer upgrades every request and echoes each message back until the
+// connection ends, then sends Read's error on errs.
+func echoServer(t *testing.T, maxMessageBytes int) (*httptest.Server, <-chan error) {
+	t.Helper()
+	errs := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		if maxMessageBytes > 0 {
+			conn.maxMessageBytes = maxMessageBytes
+		}
+		for {
+			data, err := conn.Read()
+			if err != nil {
+				errs <- err
+				return
+			}
+			conn.WriteText(data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, errs
+}
+
+// client is the raw client end of a test connection.
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// handshake sends an opening handshake with header to srv and returns the
+// response, and the connection for reading frames after it.
+func handshake(t *testing.T, srv *httptest.Server, method string, header http.Header) (*http.Response, *client) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(method, srv.URL, nil)
+	req.Header = header
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, &client{t: t, conn: conn, reader: reader}
+}
+
+func upgradeHeader() http.Header {
+	return http.Header{
+		"Connection":            {"keep-alive, Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {testKey},
+	}
+}
+
+// dial completes a handshake with srv.
+func dial(t *testing.T, srv *httptest.Server) *client {
+	t.Helper()
+	resp, c := handshake(t, srv, http.MethodGet, upgradeHeader())
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", resp.StatusCode)
+	}
+	return c
+}
+
+// writeFrame sends a frame, masked unless masked is false.
+func (c *client) writeFrame(fin bool, opcode byte, payload []byte, masked bool) {
+	c.t.Helper()
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if masked {
+		mask := [4]byte{0xA1, 0xB2, 0xC3, 0xD4}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// readFrame reads one frame from the server, which must be final and
+// unmasked.
+func (c *client) readFrame() (byte, []byte) {
+	c.t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		c.t.Fatalf("frame header %x: want final and unmasked", header)
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+// expectClose reads a close frame and checks its status code.
+func (c *client) expectClose(code int) {
+	c.t.Helper()
+	opcode, payload := c.readFrame()
+	if opcode != opClose || len(payload) < 2 {
+		c.t.Fatalf("got opcode %#x %q, want a close frame", opcode, payload)
+	}
+	if got := int(binary.BigEndian.Uint16(payload)); got != code {
+		c.t.Errorf("close code = %d (%q), want %d", got, payload[2:], code)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	srv, _ := echoServer(t, 0)
+	tests := []struct {
+		name   string
+		method string
+		edit   func(http.Header)
+		want   int
+	}{
+		{"valid", http.MethodGet, func(http.Header) {}, http.StatusSwitchingProtocols},
+		{"header tokens ignore case", http.MethodGet, func(h http.Header) { h.Set("Upgrade", "WebSocket") }, http.StatusSwitchingProtocols},
+		{"not GET", http.MethodPost, func(http.Header) {}, http.StatusMethodNotAllowed},
+		{"not an upgrade", http.MethodGet, func(h http.Header) { h.Del("Upgrade") }, http.StatusBadRequest},
+		{"old version", http.MethodGet, func(h http.Header) { h.Set("Sec-WebSocket-Version", "8") }, http.StatusUpgradeRequired},
+		{"missing key", http.MethodGet, func(h http.Header) { h.Del("Sec-WebSocket-Key") }, http.StatusBadRequest},
+		{"short key", http.MethodGet, func(h http.Header) { h.Set("Sec-WebSocket-Key", "c2hvcnQ=") }, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := upgradeHeader()
+			tt.edit(header)
+			resp, _ := handshake(t, srv, tt.method, header)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusSwitchingProtocols {
+				if got := resp.Header.Get("Sec-WebSocket-Accept"); got != testAccept {
+					t.Errorf("Sec-WebSocket-Accept = %q, want %q", got, testAccept)
+				}
+			}
+		})
+	}
+}
+
+func TestEchoMessages(t *testing.T) {
+	srv, _ := echoServer(t, 0)
+	c := dial(t, srv)
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"short", 5},
+		{"16-bit length", 300},
+		{"64-bit length", 70000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(strings.Repeat("x", tt.size))
+			c.writeFrame(true, opText, payload, true)
+			opcode, got := c.readFrame()
+			if opcode != opText || string(got) != string(payload) {
+				t.Errorf("echo = opcode %#x, %d bytes; want text of %d", opcode, len(got), tt.size)
+			}
+		})
+	}
+}
+
+func TestFragmentedMessageWithPing(t *testing.T) {
+	srv, _ := echoServer(t, 0)
+	c := dial(t, srv)
+
+	// A ping between fragments is answered at once
+	c.writeFrame(false, opText, []byte("hel"), true)
+	c.writeFrame(true, opPing, []byte("are you there"), true)
+	c.writeFrame(false, opContinuation, []byte("lo, "), true)
+	c.writeFrame(true, opContinuation, []byte("world"), true)
+
+	if opcode, payload := c.readFrame(); opcode != opPong || string(payload) != "are you there" {
+		t.Errorf("got opcode %#x %q, want the pong", opcode, payload)
+	}
+	if opcode, payload := c.readFrame(); opcode != opText || string(payload) != "hello, world" {
+		t.Errorf("got opcode %#x %q, want the reassembled message", opcode, payload)
+	}
+}
+
+func TestClosingHandshake(t *testing.T) {
+	srv, errs := echoServer(t, 0)
+	c := dial(t, srv)
+
+	c.writeFrame(true, opClose, binary.BigEndian.AppendUint16(nil, CloseGoingAway), true)
+	c.expectClose(CloseGoingAway)
+	if err := <-errs; !errors.Is(err, ErrClosed) {
+		t.Errorf("Read error = %v, want ErrClosed", err)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxBytes  int
+		send      func(c *client)
+		wantCode  int
+		wantError error
+	}{
+		{"unmasked frame", 0, func(c *client) { c.writeFrame(true, opText, []byte("hi"), false) }, CloseProtocol, ErrProtocol},
+		{"unknown opcode", 0, func(c *client) { c.writeFrame(true, 0x3, []byte("hi"), true) }, CloseProtocol, ErrProtocol},
+		{"continuation without a message", 0, func(c *client) { c.writeFrame(true, opContinuation, []byte("hi"), true) }, CloseProtocol, ErrProtocol},
+		{"new message before the last finished", 0, func(c *client) {
+			c.writeFrame(false, opText, []byte("a"), true)
+			c.writeFrame(true, opText, []byte("b"), true)
+		}, CloseProtocol, ErrProtocol},
+		{"fragmented control frame", 0, func(c *client) { c.writeFrame(false, opPing, nil, true) }, CloseProtocol, ErrProtocol},
+		{"oversized control frame", 0, func(c *client) { c.writeFrame(true, opPing, make([]byte, 126), true) }, CloseProtocol, ErrProtocol},
+		{"frame too large", 10, func(c *client) { c.writeFrame(true, opText, make([]byte, 11), true) }, CloseTooLarge, ErrTooLarge},
+		{"fragments too large", 10, func(c *client) {
+			c.writeFrame(false, opText, make([]byte, 6), true)
+			c.writeFrame(true, opContinuation, make([]byte, 6), true)
+		}, CloseTooLarge, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, errs := echoServer(t, tt.maxBytes)
+			c := dial(t, srv)
+			tt.send(c)
+			c.expectClose(tt.wantCode)
+			if err := <-errs; !errors.Is(err, tt.wantError) {
+				t.Errorf("Read error = %v, want %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		conn.Close(CloseNormal, "bye")
+		conn.Close(CloseNormal, "again") // no second close frame
+		done <- conn.WriteText([]byte("late"))
+	}))
+	defer srv.Close()
+
+	c := dial(t, srv)
+	c.expectClose(CloseNormal)
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("WriteText after Close = %v, want ErrClosed", err)
+	}
+	if _, err := c.reader.ReadByte(); err != io.EOF {
+		t.Errorf("read after close = %v, want EOF", err)
+	}
+}
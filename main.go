@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"aws-relay/internal/dashboard"
+	"aws-relay/internal/jsonguard"
 	"aws-relay/internal/proxy"
 	"aws-relay/internal/store"
+	"aws-relay/internal/webhook"
 )
 
 func main() {
@@ -26,21 +36,259 @@ func main() {
 		dashboardAddr = ":4568"
 	}
 
-	messageStore := store.New()
+	var messageStore *store.Store
+	maxHistory := envInt("AWS_RELAY_MAX_HISTORY", store.DefaultMaxHistory)
+	if path := os.Getenv("AWS_RELAY_PERSIST_PATH"); path != "" {
+		messageStore = store.NewPersistent(path, maxHistory)
+		log.Printf("Persisting captures to %s", path)
+	} else {
+		messageStore = store.New()
+		messageStore.SetMaxHistory(maxHistory)
+	}
+	messageStore.SetFlagNewQueues(os.Getenv("AWS_RELAY_FLAG_NEW_QUEUES") == "true")
+	messageStore.SetCanonicalJSON(os.Getenv("AWS_RELAY_CANONICAL_JSON") == "true")
+	if attr := os.Getenv("AWS_RELAY_CORRELATION_ATTRIBUTE"); attr != "" {
+		messageStore.SetCorrelationAttribute(attr)
+	}
+
+	if queues := os.Getenv("AWS_RELAY_ORDERED_QUEUES"); queues != "" {
+		messageStore.SetOrderedQueues(strings.Split(queues, ","))
+	}
+	if patterns := os.Getenv("AWS_RELAY_DLQ_PATTERNS"); patterns != "" {
+		messageStore.SetDLQPatterns(strings.Split(patterns, ","))
+	}
+	messageStore.SetBodySampling(
+		envInt("AWS_RELAY_BODY_SAMPLE_THRESHOLD", 0),
+		envInt("AWS_RELAY_BODY_PREVIEW_BYTES", store.DefaultBodyPreviewBytes),
+	)
+	messageStore.SetAckGrace(envDuration("AWS_RELAY_ACK_GRACE", store.DefaultAckGrace))
+	messageStore.SetSizeThreshold(envInt("AWS_RELAY_SIZE_THRESHOLD", store.DefaultSizeThreshold))
+	messageStore.SetSkewThreshold(envDuration("AWS_RELAY_CLOCK_SKEW_THRESHOLD", store.DefaultSkewThreshold))
+
+	if os.Getenv("AWS_RELAY_HAR") == "true" {
+		messageStore.SetExchangeRecording(true)
+		log.Printf("Recording raw exchanges for HAR export")
+	}
+
+	if interval := envDuration("AWS_RELAY_AUTO_CLEAR_INTERVAL", 0); interval > 0 {
+		messageStore.StartAutoClear(interval)
+		log.Printf("Auto-clearing captures every %s", interval)
+	}
+
+	if spec := os.Getenv("AWS_RELAY_QUEUE_RETENTION"); spec != "" {
+		rules, err := store.ParseRetention(spec)
+		if err != nil {
+			log.Fatalf("Invalid AWS_RELAY_QUEUE_RETENTION: %v", err)
+		}
+		messageStore.SetRetention(rules)
+		messageStore.StartSweeper(envDuration("AWS_RELAY_RETENTION_SWEEP_INTERVAL", 10*time.Second))
+		log.Printf("Applying per-queue retention: %s", spec)
+	}
+
+	if webhookURL := os.Getenv("AWS_RELAY_EVENT_WEBHOOK"); webhookURL != "" {
+		sink := webhook.New(webhookURL, os.Getenv("AWS_RELAY_EVENT_WEBHOOK_SECRET"))
+		messageStore.AddListener(sink.Enqueue)
+		log.Printf("Forwarding events to webhook %s", webhookURL)
+	}
+
 	sqsProxy := proxy.New(upstreamURL, messageStore)
-	dashboardServer := dashboard.New(messageStore)
+	sqsProxy.SetUpstreamHost(os.Getenv("AWS_RELAY_UPSTREAM_HOST"))
+	if name := os.Getenv("AWS_RELAY_UNKNOWN_QUEUE_NAME"); name != "" {
+		sqsProxy.SetUnknownQueueName(name)
+	}
+	sqsProxy.SetUpstreamTimeout(envDuration("AWS_RELAY_UPSTREAM_TIMEOUT", proxy.DefaultUpstreamTimeout))
+	if shadowURL := os.Getenv("AWS_RELAY_SHADOW_QUEUE_URL"); shadowURL != "" {
+		sqsProxy.SetShadowQueue(shadowURL)
+		log.Printf("Mirroring sends to shadow queue %s", shadowURL)
+	}
+	if spec := os.Getenv("AWS_RELAY_RESPONSE_HEADERS"); spec != "" {
+		headers, err := proxy.ParseResponseHeaders(spec)
+		if err != nil {
+			log.Fatalf("Invalid AWS_RELAY_RESPONSE_HEADERS: %v", err)
+		}
+		sqsProxy.SetResponseHeaders(headers)
+		log.Printf("Adding response headers for %d action(s)", len(headers))
+	}
+	if spec := os.Getenv("AWS_RELAY_FAULTS"); spec != "" {
+		rules, err := proxy.ParseFaults(spec)
+		if err != nil {
+			log.Fatalf("Invalid AWS_RELAY_FAULTS: %v", err)
+		}
+		sqsProxy.SetFaults(rules)
+		log.Printf("Injecting faults from %d rule(s)", len(rules))
+	}
+	if spec := os.Getenv("AWS_RELAY_LATENCY"); spec != "" {
+		rules, err := proxy.ParseLatency(spec)
+		if err != nil {
+			log.Fatalf("Invalid AWS_RELAY_LATENCY: %v", err)
+		}
+		sqsProxy.SetLatency(rules)
+		log.Printf("Injecting latency from %d rule(s)", len(rules))
+	}
+	if v := os.Getenv("AWS_RELAY_CAPTURE_SCOPE"); v != "" {
+		scope, err := proxy.ParseCaptureScope(v)
+		if err != nil {
+			log.Fatalf("Invalid AWS_RELAY_CAPTURE_SCOPE: %v", err)
+		}
+		sqsProxy.SetCaptureScope(scope)
+		if scope != proxy.ScopeAll {
+			log.Printf("Capturing %s-plane actions only", scope)
+		}
+	}
+	sqsProxy.SetCaptureLimits(
+		envInt("AWS_RELAY_MAX_CAPTURE_BYTES", proxy.DefaultMaxCaptureBytes),
+		envDuration("AWS_RELAY_PARSE_TIMEOUT", proxy.DefaultParseTimeout),
+	)
+	sqsProxy.SetStrictMethod(os.Getenv("AWS_RELAY_STRICT_METHOD") == "true")
+	if os.Getenv("AWS_RELAY_UPSTREAM_INSECURE_TLS") == "true" {
+		sqsProxy.SetInsecureTLS(true)
+		log.Printf("Not verifying the upstream's TLS certificate")
+	}
+	sqsProxy.SetJSONLimits(
+		envInt("AWS_RELAY_JSON_MAX_DEPTH", jsonguard.DefaultMaxDepth),
+		envInt("AWS_RELAY_JSON_MAX_BYTES", jsonguard.DefaultMaxBytes),
+	)
+	dashboardServer := dashboard.New(messageStore, sqsProxy)
+	dashboardServer.SetCacheTTL(envDuration("AWS_RELAY_DASHBOARD_CACHE_TTL", 500*time.Millisecond))
+	if origin := os.Getenv("AWS_RELAY_CORS_ORIGIN"); origin != "" {
+		dashboardServer.SetCORSOrigin(origin)
+	}
+	user, pass := os.Getenv("AWS_RELAY_DASHBOARD_USER"), os.Getenv("AWS_RELAY_DASHBOARD_PASS")
+	if (user == "") != (pass == "") {
+		log.Fatalf("AWS_RELAY_DASHBOARD_USER and AWS_RELAY_DASHBOARD_PASS must be set together")
+	}
+	if user != "" {
+		dashboardServer.SetBasicAuth(user, pass)
+		log.Printf("Dashboard requires basic auth as %s", user)
+	}
+
+	proxyServer := newServer(listenAddr, sqsProxy)
+	dashboardHTTP := newServer(dashboardAddr, dashboardServer)
+
+	// Event streams stay open until the client leaves, so end them when
+	// shutdown starts rather than letting them hold up the drain
+	streams, endStreams := context.WithCancel(context.Background())
+	dashboardHTTP.BaseContext = func(net.Listener) context.Context { return streams }
+	dashboardHTTP.RegisterOnShutdown(endStreams)
+
+	dashboardListener, err := listen(dashboardAddr)
+	if err != nil {
+		log.Fatalf("Dashboard server error: %v", err)
+	}
+	proxyListener, err := listen(listenAddr)
+	if err != nil {
+		log.Fatalf("Proxy server error: %v", err)
+	}
 
 	// Start dashboard server in background
 	go func() {
 		log.Printf("Dashboard listening on %s", dashboardAddr)
-		if err := http.ListenAndServe(dashboardAddr, dashboardServer); err != nil {
+		if err := dashboardHTTP.Serve(dashboardListener); err != http.ErrServerClosed {
 			log.Fatalf("Dashboard server error: %v", err)
 		}
 	}()
 
 	// Start proxy
-	log.Printf("AWS Relay listening on %s -> %s", listenAddr, upstreamURL)
-	if err := http.ListenAndServe(listenAddr, sqsProxy); err != nil {
-		log.Fatalf("Proxy server error: %v", err)
+	go func() {
+		log.Printf("AWS Relay listening on %s -> %s", listenAddr, upstreamURL)
+		if err := proxyServer.Serve(proxyListener); err != http.ErrServerClosed {
+			log.Fatalf("Proxy server error: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	shutdown(messageStore, envDuration("AWS_RELAY_SHUTDOWN_TIMEOUT", 30*time.Second), proxyServer, dashboardHTTP)
+}
+
+// shutdown stops the servers accepting connections, waits up to timeout for
+// in-flight requests to finish so their captures are recorded, then writes
+// the final snapshot of a persistent store. The default timeout outlasts a
+// ReceiveMessage long poll.
+func shutdown(messageStore *store.Store, timeout time.Duration, servers ...*http.Server) {
+	log.Printf("Shutting down; draining in-flight requests for up to %s", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Warning: %s did not drain: %v", srv.Addr, err)
+			srv.Close()
+		}
+	}
+	log.Printf("Servers stopped")
+
+	if err := messageStore.Save(); err != nil {
+		log.Printf("Warning: could not save store: %v", err)
+	}
+	log.Printf("Shutdown complete")
+}
+
+// listen listens on addr: a TCP address such as ":4567", or a Unix domain
+// socket given as "unix:/path/to.sock" for environments that forbid binding
+// ports. A stale socket file left by an unclean exit is replaced, but not
+// one still being served. The listener removes its socket file when the
+// server shuts down.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// newServer returns a server for handler on addr with the configured
+// timeouts, so stalled clients can't hold connections open indefinitely. The
+// write timeout must outlast a ReceiveMessage long poll plus the upstream
+// call; the dashboard's event stream lifts it for itself.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: envDuration("AWS_RELAY_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       envDuration("AWS_RELAY_READ_TIMEOUT", time.Minute),
+		WriteTimeout:      envDuration("AWS_RELAY_WRITE_TIMEOUT", 2*time.Minute),
+		IdleTimeout:       envDuration("AWS_RELAY_IDLE_TIMEOUT", 2*time.Minute),
+	}
+}
+
+// envInt returns the integer value of the environment variable key, or def
+// if it is unset or not a valid integer.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", key, v, err)
+		return def
+	}
+	return n
+}
+
+// envDuration returns the duration value of the environment variable key,
+// or def if it is unset or not a valid duration.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q: %v", key, v, err)
+		return def
 	}
+	return d
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSlowHeaderClientDisconnected(t *testing.T) {
+	t.Setenv("AWS_RELAY_READ_HEADER_TIMEOUT", "100ms")
+	srv := newServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler reached by an incomplete request")
+	}))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Start a request and never finish its headers
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: relay\r\nX-Slow: "); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(5 * time.Second))
+	io.Copy(io.Discard, conn)
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Fatal("connection still open after 5s")
+	} else if elapsed < 100*time.Millisecond {
+		t.Errorf("disconnected after %s, before the header timeout", elapsed)
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	t.Setenv("AWS_RELAY_READ_TIMEOUT", "30s")
+	t.Setenv("AWS_RELAY_WRITE_TIMEOUT", "not a duration")
+	srv := newServer(":0", http.NotFoundHandler())
+
+	if srv.ReadHeaderTimeout != 10*time.Second {
+		t.Errorf("ReadHeaderTimeout = %s, want the 10s default", srv.ReadHeaderTimeout)
+	}
+	if srv.ReadTimeout != 30*time.Second {
+		t.Errorf("ReadTimeout = %s, want 30s from the environment", srv.ReadTimeout)
+	}
+	if srv.WriteTimeout != 2*time.Minute {
+		t.Errorf("WriteTimeout = %s, want the 2m default for an invalid value", srv.WriteTimeout)
+	}
+	if srv.IdleTimeout != 2*time.Minute {
+		t.Errorf("IdleTimeout = %s, want the 2m default", srv.IdleTimeout)
+	}
+}